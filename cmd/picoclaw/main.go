@@ -31,10 +31,13 @@ import (
 	"github.com/sipeed/picoclaw/pkg/council"
 	"github.com/sipeed/picoclaw/pkg/cron"
 	"github.com/sipeed/picoclaw/pkg/devices"
+	"github.com/sipeed/picoclaw/pkg/gateway"
 	"github.com/sipeed/picoclaw/pkg/heartbeat"
+	"github.com/sipeed/picoclaw/pkg/knowledge"
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/migrate"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/ratelimit"
 	"github.com/sipeed/picoclaw/pkg/sentinel"
 	"github.com/sipeed/picoclaw/pkg/skills"
 	"github.com/sipeed/picoclaw/pkg/state"
@@ -145,6 +148,8 @@ func main() {
 		authCmd()
 	case "cron":
 		cronCmd()
+	case "knowledge":
+		knowledgeCmd()
 	case "skills":
 		if len(os.Args) < 3 {
 			skillsHelp()
@@ -214,6 +219,7 @@ func printHelp() {
 	fmt.Println("  gateway     Start picoclaw gateway")
 	fmt.Println("  status      Show picoclaw status")
 	fmt.Println("  cron        Manage scheduled tasks")
+	fmt.Println("  knowledge   Manage ingested knowledge (add, list, remove, refresh)")
 	fmt.Println("  migrate     Migrate from OpenClaw to PicoClaw")
 	fmt.Println("  skills      Manage skills (install, list, remove)")
 	fmt.Println("  version     Show version information")
@@ -579,6 +585,19 @@ func gatewayCmd() {
 	// Setup cron tool and service
 	cronService := setupCronTool(agentLoop, msgBus, cfg.WorkspacePath())
 
+	// Knowledge ingestion: inbox watcher and scheduled source refresh
+	ingester := knowledge.NewIngester(agentLoop.KnowledgeLoader(), cfg.Knowledge.RefreshHours)
+	ingester.Start(ctx, time.Duration(cfg.Knowledge.IngestIntervalMinutes)*time.Minute)
+	fmt.Printf("✓ Knowledge ingestion started (inbox: %s)\n", ingester.InboxDir())
+	agentLoop.StartKnowledgeRefresh(ctx, time.Hour)
+
+	// Experiment metrics and periodic hypothesis evaluation
+	agentLoop.StartExperiments(ctx, cfg.Experiments)
+	msgBus.SetFeedbackHandler(agentLoop.HandleFeedback)
+	if cfg.Experiments.Enabled {
+		fmt.Printf("✓ Experiment evaluation every %dh\n", cfg.Experiments.EvaluationIntervalHours)
+	}
+
 	// Council setup
 	if cfg.Council.Enabled && len(cfg.Council.Members) > 0 {
 		councilInstance, err := council.NewCouncil(cfg.Council, provider, cfg.Agents.Defaults.Model, cfg.WorkspacePath())
@@ -660,6 +679,24 @@ func gatewayCmd() {
 		os.Exit(1)
 	}
 
+	// Roles from the permissions config apply across all channels
+	policy := agentLoop.Permissions()
+	if policy.Enabled() {
+		channelManager.SetAccessPolicy(policy)
+	}
+
+	// Inbound rate limits are checked before messages reach the agent
+	limiter := ratelimit.NewLimiter(cfg.RateLimits, func(channel, senderID string) string {
+		if !policy.Enabled() {
+			return ""
+		}
+		return policy.RoleFor(channel, senderID).Name
+	})
+	if limiter.Enabled() {
+		channelManager.SetRateLimiter(limiter)
+		agentLoop.SetRateLimiter(limiter)
+	}
+
 	// Configure Telegram channel for group support
 	if telegramCh, ok := channelManager.GetChannel("telegram"); ok {
 		if tc, ok := telegramCh.(*channels.TelegramChannel); ok {
@@ -701,6 +738,32 @@ func gatewayCmd() {
 				logger.InfoC("voice", "Groq transcription attached to Slack channel")
 			}
 		}
+		if signalChannel, ok := channelManager.GetChannel("signal"); ok {
+			if sc, ok := signalChannel.(*channels.SignalChannel); ok {
+				sc.SetTranscriber(transcriber)
+				logger.InfoC("voice", "Groq transcription attached to Signal channel")
+			}
+		}
+		if mattermostChannel, ok := channelManager.GetChannel("mattermost"); ok {
+			if mc, ok := mattermostChannel.(*channels.MattermostChannel); ok {
+				mc.SetTranscriber(transcriber)
+				logger.InfoC("voice", "Groq transcription attached to Mattermost channel")
+			}
+		}
+		if rocketChatChannel, ok := channelManager.GetChannel("rocketchat"); ok {
+			if rc, ok := rocketChatChannel.(*channels.RocketChatChannel); ok {
+				rc.SetTranscriber(transcriber)
+				logger.InfoC("voice", "Groq transcription attached to Rocket.Chat channel")
+			}
+		}
+	}
+
+	synthesizer, err := voice.NewSynthesizer(cfg.TTS)
+	if err != nil {
+		logger.WarnCF("voice", "Voice replies disabled", map[string]interface{}{"error": err.Error()})
+	} else if synthesizer != nil {
+		channelManager.SetSynthesizer(synthesizer)
+		logger.InfoCF("voice", "Voice replies enabled", map[string]interface{}{"engine": cfg.TTS.Engine})
 	}
 
 	enabledChannels := channelManager.GetEnabledChannels()
@@ -747,6 +810,17 @@ func gatewayCmd() {
 		fmt.Println("✓ Sentinel service started")
 	}
 
+	// Persistent channel failures are reported wherever the owner last wrote
+	// from, unless that is the failing channel itself
+	channelManager.SetAlertHandler(func(channel, message string) {
+		platform, chatID, ok := policy.OwnerChat()
+		if !ok || platform == channel {
+			logger.WarnCF("channels", "No way to alert the owner", map[string]interface{}{"channel": channel, "alert": message})
+			return
+		}
+		msgBus.PublishOutbound(bus.OutboundMessage{Channel: platform, ChatID: chatID, Content: "⚠️ " + message})
+	})
+
 	if err := channelManager.StartAll(ctx); err != nil {
 		fmt.Printf("Error starting channels: %v\n", err)
 	}
@@ -756,12 +830,44 @@ func gatewayCmd() {
 	healthMux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		status := map[string]interface{}{
-			"status":  "ok",
-			"version": formatVersion(),
-			"uptime":  time.Since(startTime).String(),
+			"status":   "ok",
+			"version":  formatVersion(),
+			"uptime":   time.Since(startTime).String(),
+			"channels": channelManager.Health(),
 		}
 		json.NewEncoder(w).Encode(status)
 	})
+	if cfg.Gateway.API.Enabled {
+		if len(cfg.Gateway.API.APIKeys) == 0 {
+			fmt.Println("⚠ Gateway API enabled but no api_keys configured; /v1 endpoints disabled")
+		} else {
+			gateway.NewOpenAIServer(ctx, agentLoop, cfg.Gateway.API).Register(healthMux)
+			fmt.Printf("✓ OpenAI-compatible API: http://%s:%d/v1 (model %q)\n", cfg.Gateway.Host, cfg.Gateway.Port, cfg.Gateway.API.ModelName)
+		}
+	}
+	if cfg.Gateway.WebUI.Enabled {
+		if cfg.Gateway.WebUI.Token == "" {
+			fmt.Println("⚠ Web UI enabled but no token configured; /ui disabled")
+		} else {
+			gateway.NewWebUI(ctx, gateway.WebUIOptions{
+				Token:     cfg.Gateway.WebUI.Token,
+				Workspace: cfg.WorkspacePath(),
+				Agent:     agentLoop,
+				Sessions:  agentLoop.Sessions(),
+				Cron:      cronService,
+				Channels:  channelManager,
+				Telemetry: tracker,
+				Info: func() map[string]interface{} {
+					return map[string]interface{}{
+						"version": formatVersion(),
+						"uptime":  time.Since(startTime).Round(time.Second).String(),
+						"model":   cfg.Agents.Defaults.Model,
+					}
+				},
+			}).Register(healthMux)
+			fmt.Printf("✓ Web UI: http://%s:%d/ui/\n", cfg.Gateway.Host, cfg.Gateway.Port)
+		}
+	}
 	healthAddr := fmt.Sprintf("%s:%d", cfg.Gateway.Host, cfg.Gateway.Port)
 	healthServer := &http.Server{Addr: healthAddr, Handler: healthMux}
 	go func() {
@@ -781,6 +887,7 @@ func gatewayCmd() {
 	cancel()
 	healthServer.Close()
 	tracker.Stop()
+	agentLoop.ExperimentMetrics().Stop()
 	sentinelService.Stop()
 	deviceService.Stop()
 	heartbeatService.Stop()
@@ -1327,6 +1434,155 @@ func cronEnableCmd(storePath string, disable bool) {
 	}
 }
 
+func knowledgeCmd() {
+	if len(os.Args) < 3 {
+		knowledgeHelp()
+		return
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+
+	loader := knowledge.NewLoader(cfg.WorkspacePath())
+	ingester := knowledge.NewIngester(loader, cfg.Knowledge.RefreshHours)
+
+	switch os.Args[2] {
+	case "add":
+		knowledgeAddCmd(ingester)
+	case "list":
+		knowledgeListCmd(ingester, loader)
+	case "remove":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: picoclaw knowledge remove <source-id|topic-slug>")
+			return
+		}
+		if err := ingester.Remove(os.Args[3]); err != nil {
+			fmt.Printf("✗ %v\n", err)
+			return
+		}
+		fmt.Printf("✓ Removed %s\n", os.Args[3])
+	case "refresh":
+		id := ""
+		if len(os.Args) > 3 {
+			id = os.Args[3]
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		if n := ingester.ProcessInbox(ctx); n > 0 {
+			fmt.Printf("✓ Ingested %d inbox file(s)\n", n)
+		}
+		if err := ingester.Refresh(ctx, id); err != nil {
+			fmt.Printf("✗ %v\n", err)
+			return
+		}
+		fmt.Println("✓ Knowledge refreshed")
+	default:
+		fmt.Printf("Unknown knowledge command: %s\n", os.Args[2])
+		knowledgeHelp()
+	}
+}
+
+func knowledgeHelp() {
+	fmt.Println("\nKnowledge commands:")
+	fmt.Println("  add <path|url>          Ingest a file (md, txt, html, pdf) or web page")
+	fmt.Println("  list                    List sources and topics")
+	fmt.Println("  remove <id>             Remove a source (and its topics) or a single topic")
+	fmt.Println("  refresh [id]            Re-ingest one source, or all, and process the inbox")
+	fmt.Println()
+	fmt.Println("Add options:")
+	fmt.Println("  --feed                  Treat the URL as an RSS/Atom feed")
+	fmt.Println("  -t, --title             Title for the source")
+	fmt.Println("  -r, --refresh <hours>   Refresh interval (0 = never)")
+	fmt.Println()
+	fmt.Println("Files dropped into <workspace>/knowledge/inbox are ingested by the gateway.")
+}
+
+func knowledgeAddCmd(ingester *knowledge.Ingester) {
+	var location string
+	opts := knowledge.AddOptions{}
+
+	args := os.Args[3:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--feed":
+			opts.Feed = true
+		case "-t", "--title":
+			if i+1 < len(args) {
+				opts.Title = args[i+1]
+				i++
+			}
+		case "-r", "--refresh":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &opts.RefreshHours)
+				if opts.RefreshHours == 0 {
+					opts.RefreshHours = -1 // explicit "never"
+				}
+				i++
+			}
+		default:
+			location = args[i]
+		}
+	}
+
+	if location == "" {
+		fmt.Println("Usage: picoclaw knowledge add <path|url> [--feed] [--title T] [--refresh H]")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	src, err := ingester.Add(ctx, location, opts)
+	if err != nil {
+		fmt.Printf("✗ Failed to add %s: %v\n", location, err)
+		return
+	}
+	fmt.Printf("✓ Added %s '%s' (%s) → %d topic(s)\n", src.Kind, src.Title, src.ID, len(src.Topics))
+}
+
+func knowledgeListCmd(ingester *knowledge.Ingester, loader *knowledge.Loader) {
+	sources, err := ingester.ListSources()
+	if err != nil {
+		fmt.Printf("Error reading sources: %v\n", err)
+		return
+	}
+
+	fmt.Println("\nSources:")
+	fmt.Println("--------")
+	if len(sources) == 0 {
+		fmt.Println("  (none)")
+	}
+	for _, src := range sources {
+		refresh := "manual"
+		if src.RefreshHours > 0 {
+			refresh = fmt.Sprintf("every %dh", src.RefreshHours)
+		}
+		fmt.Printf("  %s [%s] %s\n", src.ID, src.Kind, src.Title)
+		fmt.Printf("    Location: %s\n", src.Location)
+		fmt.Printf("    Topics: %d, refresh: %s, last fetched: %s\n", len(src.Topics), refresh, src.LastFetched)
+		if src.Error != "" {
+			fmt.Printf("    Error: %s\n", src.Error)
+		}
+	}
+
+	fmt.Println("\nTopics:")
+	fmt.Println("-------")
+	topics := loader.ListAll()
+	if len(topics) == 0 {
+		fmt.Println("  (none)")
+	}
+	for _, meta := range topics {
+		origin := "learned"
+		if meta.Source != "" {
+			origin = meta.Source
+		}
+		fmt.Printf("  %s [%s] %s (%d chars, v%d, %s)\n", meta.Slug, meta.Status, meta.Title, meta.CharCount, meta.Version, origin)
+	}
+}
+
 func skillsHelp() {
 	fmt.Println("\nSkills commands:")
 	fmt.Println("  list                    List installed skills")
@@ -0,0 +1,311 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Causes for cancelling a turn in progress.
+var (
+	errTurnInterrupted = errors.New("turn interrupted by a newer message")
+	errTurnStopped     = errors.New("turn stopped by the user")
+)
+
+// stoppedNote stands in for the answer to a turn stopped with /stop, so the
+// agent knows later that it never finished.
+const stoppedNote = "[Stopped by the user with /stop before finishing.]"
+
+// inboundTurn is one unit of work for the agent: an inbound message,
+// possibly merged from several the sender wrote in quick succession.
+type inboundTurn struct {
+	ctx   context.Context
+	msg   bus.InboundMessage
+	count int // inbound messages merged into msg
+}
+
+// pendingTurn collects a sender's messages until their window closes.
+type pendingTurn struct {
+	msg   bus.InboundMessage
+	count int
+	first time.Time
+	timer *time.Timer
+	due   bool // the window closed while the turn it interrupted was being put back
+}
+
+// activeTurn is the turn the agent is working on.
+type activeTurn struct {
+	key         string
+	session     string
+	cancel      context.CancelCauseFunc
+	interrupted bool
+	stopped     bool
+}
+
+// coalescer sits between the bus and the agent. It waits for a short quiet
+// window before handing a sender's messages over as one turn and, where
+// configured, cancels a turn in progress when the same sender writes again
+// so the new message can join it. With coalescing off it simply queues
+// messages, which lets /stop reach the turn in progress.
+type coalescer struct {
+	cfg config.CoalesceConfig
+
+	mu      sync.Mutex
+	pending map[string]*pendingTurn // session and sender -> messages waiting
+	ready   []inboundTurn
+	signal  chan struct{}
+	active  *activeTurn
+}
+
+func newCoalescer(cfg config.CoalesceConfig) *coalescer {
+	return &coalescer{
+		cfg:     cfg,
+		pending: make(map[string]*pendingTurn),
+		signal:  make(chan struct{}, 1),
+	}
+}
+
+// policy returns the effective options for a channel.
+func (c *coalescer) policy(channel string) config.CoalescePolicyConfig {
+	policy := c.cfg.CoalescePolicyConfig
+	if override, ok := c.cfg.Channels[channel]; ok {
+		if override.WindowMS != 0 {
+			policy.WindowMS = override.WindowMS
+		}
+		if override.MaxWaitMS != 0 {
+			policy.MaxWaitMS = override.MaxWaitMS
+		}
+		if override.Interrupt != nil {
+			policy.Interrupt = override.Interrupt
+		}
+	}
+	return policy
+}
+
+// add takes in an inbound message.
+func (c *coalescer) add(msg bus.InboundMessage) {
+	key := turnKey(msg)
+	policy := c.policy(msg.Channel)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !coalescable(msg) {
+		if _, ok := c.pending[key]; ok {
+			c.fireLocked(key, true)
+		}
+		c.pushLocked(msg, 1)
+		return
+	}
+
+	if policy.Interrupt != nil && *policy.Interrupt && c.active != nil && c.active.key == key && !c.active.interrupted {
+		logger.InfoCF("agent", "Interrupting turn for new message", map[string]interface{}{
+			"channel": msg.Channel,
+			"chat_id": msg.ChatID,
+		})
+		c.active.interrupted = true
+		c.active.cancel(errTurnInterrupted)
+	}
+
+	p, ok := c.pending[key]
+	if ok {
+		p.msg = mergeInbound(p.msg, msg)
+		p.count++
+	} else {
+		p = &pendingTurn{msg: msg, count: 1, first: time.Now()}
+		c.pending[key] = p
+	}
+	c.scheduleLocked(key, p, policy)
+}
+
+// scheduleLocked (re)starts a pending turn's window, capped so a steady
+// stream of messages can't hold the first one back forever.
+func (c *coalescer) scheduleLocked(key string, p *pendingTurn, policy config.CoalescePolicyConfig) {
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+
+	wait := time.Duration(policy.WindowMS) * time.Millisecond
+	if wait <= 0 {
+		c.fireLocked(key, false)
+		return
+	}
+	maxWait := time.Duration(policy.MaxWaitMS) * time.Millisecond
+	if maxWait <= 0 {
+		maxWait = 4 * wait
+	}
+	if left := time.Until(p.first.Add(maxWait)); left < wait {
+		wait = left
+	}
+	if wait <= 0 {
+		c.fireLocked(key, false)
+		return
+	}
+	p.timer = time.AfterFunc(wait, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.pending[key] == p {
+			c.fireLocked(key, false)
+		}
+	})
+}
+
+// fireLocked hands a pending turn to the agent, unless it is waiting for
+// the turn it interrupted to be put back in front of it and force is false.
+func (c *coalescer) fireLocked(key string, force bool) {
+	p := c.pending[key]
+	if !force && c.active != nil && c.active.key == key && c.active.interrupted {
+		p.due = true
+		return
+	}
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	delete(c.pending, key)
+	c.pushLocked(p.msg, p.count)
+}
+
+func (c *coalescer) pushLocked(msg bus.InboundMessage, count int) {
+	c.ready = append(c.ready, inboundTurn{msg: msg, count: count})
+	select {
+	case c.signal <- struct{}{}:
+	default:
+	}
+}
+
+// next waits for the next turn and marks it active. The turn's context is
+// cancelled if it gets interrupted or stopped.
+func (c *coalescer) next(ctx context.Context) (inboundTurn, bool) {
+	for {
+		c.mu.Lock()
+		if len(c.ready) > 0 {
+			turn := c.ready[0]
+			c.ready = c.ready[1:]
+			turnCtx, cancel := context.WithCancelCause(ctx)
+			c.active = &activeTurn{key: turnKey(turn.msg), session: turnSession(turn.msg), cancel: cancel}
+			c.mu.Unlock()
+			turn.ctx = turnCtx
+			return turn, true
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return inboundTurn{}, false
+		case <-c.signal:
+		}
+	}
+}
+
+// stop cancels the turn in progress in a session. It reports whether there
+// was one.
+func (c *coalescer) stop(session string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.active == nil || c.active.session != session || c.active.stopped {
+		return false
+	}
+	c.active.stopped = true
+	c.active.cancel(errTurnStopped)
+	return true
+}
+
+// finish ends the active turn. It reports dropped when the turn was cut
+// short, in which case its response should be dropped. An interrupted turn's
+// messages are put back ahead of the ones that interrupted it, and requeued
+// reports that they are still waiting to be answered.
+func (c *coalescer) finish(turn inboundTurn, err error) (dropped, requeued bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	active := c.active
+	c.active = nil
+	if active == nil {
+		return false, false
+	}
+	active.cancel(nil)
+
+	p, pending := c.pending[active.key]
+	cutShort := err != nil && turn.ctx.Err() != nil
+	if active.stopped && cutShort {
+		if pending && p.due {
+			c.fireLocked(active.key, true)
+		}
+		return true, false
+	}
+	if active.interrupted && cutShort {
+		if !pending {
+			c.pushLocked(turn.msg, turn.count)
+			return true, true
+		}
+		p.msg = mergeInbound(turn.msg, p.msg)
+		p.count += turn.count
+		p.first = time.Now()
+		if p.due {
+			c.fireLocked(active.key, true)
+		}
+		return true, true
+	}
+	if pending && p.due {
+		c.fireLocked(active.key, true)
+	}
+	return false, false
+}
+
+// coalescable reports whether a message may wait for, or be merged with,
+// others. Commands, passive group context and internal channels go through
+// as they are.
+func coalescable(msg bus.InboundMessage) bool {
+	return msg.Metadata[bus.MetadataPassive] != "true" &&
+		!constants.IsInternalChannel(msg.Channel) &&
+		!strings.HasPrefix(strings.TrimSpace(msg.Content), "/")
+}
+
+// turnKey groups messages by session and sender, so two people writing in
+// the same group chat are never merged.
+func turnKey(msg bus.InboundMessage) string {
+	return turnSession(msg) + "|" + msg.SenderID
+}
+
+func turnSession(msg bus.InboundMessage) string {
+	if msg.SessionKey != "" {
+		return msg.SessionKey
+	}
+	return msg.Channel + ":" + msg.ChatID
+}
+
+// isStopCommand reports whether msg is /stop, including Telegram's
+// "/stop@BotName" form.
+func isStopCommand(msg bus.InboundMessage) bool {
+	if msg.Metadata[bus.MetadataPassive] == "true" {
+		return false
+	}
+	fields := strings.Fields(msg.Content)
+	return len(fields) == 1 && (fields[0] == "/stop" || strings.HasPrefix(fields[0], "/stop@"))
+}
+
+// mergeInbound joins b onto a. Later metadata wins, so replies thread onto
+// the newest message.
+func mergeInbound(a, b bus.InboundMessage) bus.InboundMessage {
+	merged := b
+	merged.Content = strings.TrimSpace(strings.Join([]string{a.Content, b.Content}, "\n"))
+	merged.Media = append(append([]string(nil), a.Media...), b.Media...)
+	if len(a.Metadata) > 0 {
+		merged.Metadata = make(map[string]string, len(a.Metadata)+len(b.Metadata))
+		for k, v := range a.Metadata {
+			merged.Metadata[k] = v
+		}
+		for k, v := range b.Metadata {
+			merged.Metadata[k] = v
+		}
+	}
+	return merged
+}
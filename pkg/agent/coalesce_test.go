@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func coalesceMsg(sender, content string) bus.InboundMessage {
+	return bus.InboundMessage{
+		Channel:    "telegram",
+		SenderID:   sender,
+		ChatID:     "c1",
+		Content:    content,
+		SessionKey: "telegram:c1",
+	}
+}
+
+func nextWithin(t *testing.T, c *coalescer, d time.Duration) (inboundTurn, bool) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	t.Cleanup(cancel) // the turn's context derives from ctx
+	return c.next(ctx)
+}
+
+func TestCoalescerMergesBurst(t *testing.T) {
+	c := newCoalescer(config.CoalesceConfig{
+		CoalescePolicyConfig: config.CoalescePolicyConfig{WindowMS: 50},
+	})
+	c.add(coalesceMsg("u1", "hey"))
+	c.add(coalesceMsg("u1", "can you"))
+	photo := coalesceMsg("u1", "check the weather")
+	photo.Media = []string{"data:image/png;base64,AAAA"}
+	c.add(photo)
+
+	if _, ok := nextWithin(t, c, 20*time.Millisecond); ok {
+		t.Fatal("turn handed over before the window closed")
+	}
+	turn, ok := nextWithin(t, c, time.Second)
+	if !ok || turn.count != 3 || turn.msg.Content != "hey\ncan you\ncheck the weather" || len(turn.msg.Media) != 1 {
+		t.Fatalf("turn = %+v, %v", turn, ok)
+	}
+	c.finish(turn, nil)
+}
+
+func TestCoalescerKeepsSendersApart(t *testing.T) {
+	c := newCoalescer(config.CoalesceConfig{
+		CoalescePolicyConfig: config.CoalescePolicyConfig{WindowMS: 20},
+	})
+	c.add(coalesceMsg("u1", "hello"))
+	c.add(coalesceMsg("u2", "hi"))
+
+	for i := 0; i < 2; i++ {
+		turn, ok := nextWithin(t, c, time.Second)
+		if !ok || turn.count != 1 {
+			t.Fatalf("turn %d = %+v, %v", i+1, turn, ok)
+		}
+		c.finish(turn, nil)
+	}
+}
+
+func TestCoalescerCommandsPassThrough(t *testing.T) {
+	c := newCoalescer(config.CoalesceConfig{
+		CoalescePolicyConfig: config.CoalescePolicyConfig{WindowMS: 10000},
+	})
+	c.add(coalesceMsg("u1", "hello"))
+	c.add(coalesceMsg("u1", "/model"))
+
+	turn, ok := nextWithin(t, c, 100*time.Millisecond)
+	if !ok || turn.msg.Content != "hello" {
+		t.Fatalf("pending message not flushed ahead of the command: %+v, %v", turn, ok)
+	}
+	c.finish(turn, nil)
+	turn, ok = nextWithin(t, c, 100*time.Millisecond)
+	if !ok || turn.msg.Content != "/model" {
+		t.Errorf("command turn = %+v, %v", turn, ok)
+	}
+}
+
+func TestCoalescerChannelOverride(t *testing.T) {
+	c := newCoalescer(config.CoalesceConfig{
+		CoalescePolicyConfig: config.CoalescePolicyConfig{WindowMS: 10000},
+		Channels: map[string]config.CoalescePolicyConfig{
+			"telegram": {WindowMS: -1},
+		},
+	})
+	c.add(coalesceMsg("u1", "hello"))
+	if turn, ok := nextWithin(t, c, 100*time.Millisecond); !ok || turn.msg.Content != "hello" {
+		t.Errorf("channel with waiting turned off held the message: %+v, %v", turn, ok)
+	}
+}
+
+func TestCoalescerInterrupt(t *testing.T) {
+	interrupt := true
+	c := newCoalescer(config.CoalesceConfig{
+		CoalescePolicyConfig: config.CoalescePolicyConfig{Interrupt: &interrupt},
+	})
+	c.add(coalesceMsg("u1", "what's the weather"))
+	turn, ok := nextWithin(t, c, 100*time.Millisecond)
+	if !ok {
+		t.Fatal("no turn")
+	}
+
+	c.add(coalesceMsg("u2", "unrelated"))
+	if turn.ctx.Err() != nil {
+		t.Fatal("another sender interrupted the turn")
+	}
+	c.add(coalesceMsg("u1", "in Oslo"))
+	if turn.ctx.Err() == nil {
+		t.Fatal("turn not interrupted by the same sender")
+	}
+	if dropped, requeued := c.finish(turn, turn.ctx.Err()); !dropped || !requeued {
+		t.Fatal("interrupted turn not put back")
+	}
+
+	turn, ok = nextWithin(t, c, 100*time.Millisecond)
+	if !ok || turn.msg.SenderID != "u2" {
+		t.Fatalf("first turn after the interruption = %+v, %v", turn, ok)
+	}
+	c.finish(turn, nil)
+	turn, ok = nextWithin(t, c, 100*time.Millisecond)
+	if !ok || turn.count != 2 || turn.msg.Content != "what's the weather\nin Oslo" {
+		t.Errorf("merged turn = %+v, %v", turn, ok)
+	}
+}
+
+func TestCoalescerFinishedTurnNotRepeated(t *testing.T) {
+	interrupt := true
+	c := newCoalescer(config.CoalesceConfig{
+		CoalescePolicyConfig: config.CoalescePolicyConfig{Interrupt: &interrupt},
+	})
+	c.add(coalesceMsg("u1", "hello"))
+	turn, _ := nextWithin(t, c, 100*time.Millisecond)
+	c.add(coalesceMsg("u1", "there"))
+
+	// The turn completed before it noticed the cancellation
+	if dropped, _ := c.finish(turn, nil); dropped {
+		t.Fatal("completed turn reported as interrupted")
+	}
+	turn, ok := nextWithin(t, c, 100*time.Millisecond)
+	if !ok || turn.count != 1 || turn.msg.Content != "there" {
+		t.Errorf("next turn = %+v, %v", turn, ok)
+	}
+}
+
+func TestCoalescerStop(t *testing.T) {
+	c := newCoalescer(config.CoalesceConfig{})
+	c.add(coalesceMsg("u1", "research everything"))
+	turn, _ := nextWithin(t, c, 100*time.Millisecond)
+
+	if c.stop("telegram:other") {
+		t.Error("stop reached a turn in another session")
+	}
+	if !c.stop("telegram:c1") || turn.ctx.Err() == nil {
+		t.Fatal("turn not stopped")
+	}
+	if dropped, requeued := c.finish(turn, turn.ctx.Err()); !dropped || requeued {
+		t.Error("stopped turn's response not dropped")
+	}
+	if _, ok := nextWithin(t, c, 50*time.Millisecond); ok {
+		t.Error("stopped turn was put back")
+	}
+	if c.stop("telegram:c1") {
+		t.Error("stop reported a turn with nothing running")
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/skills"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/users"
 )
 
 type ContextBuilder struct {
@@ -188,7 +189,7 @@ func (cb *ContextBuilder) LoadBootstrapFiles() string {
 	return result
 }
 
-func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary string, currentMessage string, media []string, channel, chatID string) []providers.Message {
+func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary string, currentMessage string, media []string, channel, chatID string, user *users.User) []providers.Message {
 	messages := []providers.Message{}
 
 	systemPrompt := cb.BuildSystemPrompt()
@@ -208,6 +209,11 @@ func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary str
 		systemPrompt += fmt.Sprintf("\n\n## Current Session\nChannel: %s\nChat ID: %s", channel, chatID)
 	}
 
+	// Who is talking, across all their linked channels
+	if user != nil {
+		systemPrompt += "\n\n" + cb.buildUserSection(user)
+	}
+
 	// Log system prompt summary for debugging (debug mode only)
 	logger.DebugCF("agent", "System prompt built",
 		map[string]interface{}{
@@ -271,6 +277,24 @@ func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary str
 	return messages
 }
 
+// buildUserSection describes the current person and includes their own
+// memory file.
+func (cb *ContextBuilder) buildUserSection(user *users.User) string {
+	name := user.Name
+	if name == "" {
+		name = "unknown name"
+	}
+	section := fmt.Sprintf("## Current User\n%s (user ID %s, reachable on: %s)\nPersonal memory: %s - write what you learn about this person there",
+		name, user.ID, strings.Join(user.Channels(), ", "), cb.memory.UserFile(user.ID))
+	if mem := cb.memory.ReadUser(user.ID); mem != "" {
+		if len(mem) > maxMemoryChars {
+			mem = mem[:maxMemoryChars] + "\n\n[...memory truncated for context efficiency]"
+		}
+		section += "\n\n" + mem
+	}
+	return section
+}
+
 // GetSkillsInfo returns information about loaded skills.
 func (cb *ContextBuilder) GetSkillsInfo() map[string]interface{} {
 	allSkills := cb.skillsLoader.ListSkills()
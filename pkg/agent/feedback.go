@@ -0,0 +1,57 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// HandleFeedback records a user's reaction to an assistant message. The event
+// is persisted, counted in telemetry and experiment metrics, and noted in the
+// daily memory file so reflection can pick up what the user liked or disliked.
+func (al *AgentLoop) HandleFeedback(ev bus.FeedbackEvent) {
+	positive := ev.Score > 0
+	if ev.Timestamp == 0 {
+		ev.Timestamp = time.Now().Unix()
+	}
+	// Reactions in a person's direct chat belong to their own session when
+	// sessions are per user, as messages there do
+	if al.cfg.Agents.Defaults.SessionScope == "user" {
+		if u, ok := al.users.Lookup(ev.Channel, ev.SenderID); ok && u.LastChannel == ev.Channel && u.LastChatID == ev.ChatID {
+			ev.SessionKey = "user:" + u.ID
+		}
+	}
+
+	if err := al.feedback.Record(ev); err != nil {
+		logger.WarnCF("agent", "Failed to persist feedback",
+			map[string]interface{}{"error": err.Error()})
+	}
+	if al.metrics != nil {
+		al.metrics.RecordFeedback(positive)
+	}
+	if al.tracker != nil {
+		al.tracker.RecordFeedback(positive)
+	}
+
+	verdict := "liked"
+	if !positive {
+		verdict = "disliked"
+	}
+	note := fmt.Sprintf("- [%s] User %s an answer (%s %s via %s)",
+		time.Unix(ev.Timestamp, 0).Format("15:04"), verdict, ev.Reaction, ev.SenderID, ev.Channel)
+	if ev.Content != "" {
+		note += fmt.Sprintf(": %q", ev.Content)
+	}
+	if err := al.contextBuilder.memory.AppendToday(note); err != nil {
+		logger.WarnCF("agent", "Failed to note feedback in memory",
+			map[string]interface{}{"error": err.Error()})
+	}
+}
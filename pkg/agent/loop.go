@@ -9,6 +9,7 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -22,13 +23,18 @@ import (
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
 	"github.com/sipeed/picoclaw/pkg/experiments"
+	"github.com/sipeed/picoclaw/pkg/feedback"
 	"github.com/sipeed/picoclaw/pkg/knowledge"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/mqtt"
+	"github.com/sipeed/picoclaw/pkg/permissions"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/ratelimit"
 	"github.com/sipeed/picoclaw/pkg/session"
 	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/telemetry"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/users"
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
@@ -45,29 +51,43 @@ type AgentLoop struct {
 	tools          *tools.ToolRegistry
 	running        atomic.Bool
 	summarizing    sync.Map // Tracks which sessions are currently being summarized
+	summaryCfg     config.SummarizationConfig
 	cfg            *config.Config // Reference to config for runtime updates
 	configPath     string         // Path to config.json for persistence
 	tracker        *telemetry.Tracker
 	subagentMgr    *tools.SubagentManager
+	knowledge      *knowledge.Loader
+	experiments    *experiments.Store
+	metrics        *experiments.Metrics
+	feedback       *feedback.Store
+	users          *users.Directory
+	policy         *permissions.Policy
+	limiter        *ratelimit.Limiter
+	coalescer      *coalescer
+	turnMu         sync.Mutex // Serializes bus and API turns, which share the tools' per-turn state
 }
 
 // processOptions configures how a message is processed
 type processOptions struct {
-	SessionKey      string   // Session identifier for history/context
-	Channel         string   // Target channel for tool execution
-	ChatID          string   // Target chat ID for tool execution
-	UserMessage     string   // User message content (may include prefix)
-	Media           []string // Media data URIs (images as base64 data URIs)
-	DefaultResponse string   // Response when LLM returns empty
-	EnableSummary   bool     // Whether to trigger summarization
-	SendResponse    bool     // Whether to send response via bus
-	NoHistory       bool     // If true, don't load session history (for heartbeat)
-	Feature         string   // Telemetry feature label (chat, heartbeat, cron, summarize)
+	SessionKey      string            // Session identifier for history/context
+	Channel         string            // Target channel for tool execution
+	ChatID          string            // Target chat ID for tool execution
+	SenderID        string            // Sender the reply's tokens count against
+	UserMessage     string            // User message content (may include prefix)
+	Media           []string          // Media data URIs (images as base64 data URIs)
+	DefaultResponse string            // Response when LLM returns empty
+	EnableSummary   bool              // Whether to trigger summarization
+	SendResponse    bool              // Whether to send response via bus
+	NoHistory       bool              // If true, don't load session history (for heartbeat)
+	Feature         string            // Telemetry feature label (chat, heartbeat, cron, summarize)
+	User            *users.User       // Person behind the message, if known
+	Role            *permissions.Role // Sender's role; nil for internal messages, which may do everything
+	Speech          *bus.Speech       // How to speak the reply, or nil for text
 }
 
 // createToolRegistry creates a tool registry with common tools.
 // This is shared between main agent and subagents.
-func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msgBus *bus.MessageBus) *tools.ToolRegistry {
+func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msgBus *bus.MessageBus, directory *users.Directory) *tools.ToolRegistry {
 	registry := tools.NewToolRegistry()
 
 	// File system tools
@@ -127,6 +147,16 @@ func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msg
 	// Smart lights (Magic Home WiFi)
 	registry.Register(tools.NewLightsTool(workspace))
 
+	// MQTT home automation (uses the broker configured for the mqtt channel)
+	if cfg.Tools.MQTT.Enabled && cfg.Channels.MQTT.Broker != "" {
+		registry.Register(tools.NewMQTTTool(mqtt.Options{
+			Broker:   cfg.Channels.MQTT.Broker,
+			ClientID: cfg.Channels.MQTT.ClientID,
+			Username: cfg.Channels.MQTT.Username,
+			Password: cfg.Channels.MQTT.Password,
+		}, cfg.Tools.MQTT.PublishTopics))
+	}
+
 	// Translator
 	registry.Register(tools.NewTranslateTool())
 
@@ -151,14 +181,28 @@ func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msg
 	// Message tool - available to both agent and subagent
 	// Subagent uses it to communicate directly with user
 	messageTool := tools.NewMessageTool()
-	messageTool.SetSendCallback(func(channel, chatID, content string) error {
-		msgBus.PublishOutbound(bus.OutboundMessage{
-			Channel: channel,
-			ChatID:  chatID,
-			Content: content,
-		})
+	// Attachments come from the workspace or files the channels downloaded
+	messageTool.SetAttachmentDirs(workspace, filepath.Join(os.TempDir(), "picoclaw_media"))
+	messageTool.SetOutboundCallback(func(msg bus.OutboundMessage) error {
+		// Speak in the voice the person in that chat picked with /voice
+		if msg.Speech != nil && *msg.Speech == (bus.Speech{}) {
+			if user, ok := directory.ForChat(msg.Channel, msg.ChatID); ok {
+				msg.Speech = &bus.Speech{Voice: user.Voice.Voice, Language: user.Voice.Language}
+			}
+		}
+		msgBus.PublishOutbound(msg)
 		return nil
 	})
+	messageTool.SetRecipientResolver(func(name string) (string, string, error) {
+		user, ok := directory.Find(name)
+		if !ok {
+			return "", "", fmt.Errorf("no known person called %q", name)
+		}
+		if user.LastChannel == "" || user.LastChatID == "" {
+			return "", "", fmt.Errorf("%s has not messaged me directly on any channel yet", name)
+		}
+		return user.LastChannel, user.LastChatID, nil
+	})
 	registry.Register(messageTool)
 
 	return registry
@@ -170,12 +214,15 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 
 	restrict := cfg.Agents.Defaults.RestrictToWorkspace
 
+	// People known across channels
+	userDirectory := users.NewDirectory(workspace)
+
 	// Create tool registry for main agent
-	toolsRegistry := createToolRegistry(workspace, restrict, cfg, msgBus)
+	toolsRegistry := createToolRegistry(workspace, restrict, cfg, msgBus, userDirectory)
 
 	// Create subagent manager with its own tool registry
 	subagentManager := tools.NewSubagentManager(provider, cfg.Agents.Defaults.Model, workspace, msgBus)
-	subagentTools := createToolRegistry(workspace, restrict, cfg, msgBus)
+	subagentTools := createToolRegistry(workspace, restrict, cfg, msgBus, userDirectory)
 	// Subagent doesn't need spawn/subagent tools to avoid recursion
 	subagentManager.SetTools(subagentTools)
 
@@ -198,6 +245,15 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 
 	// Register learn tool (needs knowledge loader and subagent manager)
 	learnTool := tools.NewLearnTool(workspace, knowledgeLoader, subagentManager)
+	learnTool.SetDefaultTTL(cfg.Knowledge.TopicTTLHours)
+	learnTool.SetSendCallback(func(channel, chatID, content string) error {
+		msgBus.PublishOutbound(bus.OutboundMessage{
+			Channel: channel,
+			ChatID:  chatID,
+			Content: content,
+		})
+		return nil
+	})
 	toolsRegistry.Register(learnTool)
 
 	// Create context builder and set tools registry
@@ -222,48 +278,75 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 		contextBuilder: contextBuilder,
 		tools:          toolsRegistry,
 		summarizing:    sync.Map{},
+		summaryCfg:     cfg.Agents.Defaults.Summarization.WithDefaults(),
 		cfg:            cfg,
 		configPath:     configPath,
 		subagentMgr:    subagentManager,
+		knowledge:      knowledgeLoader,
+		experiments:    experimentsStore,
+		metrics:        experiments.NewMetrics(workspace),
+		feedback:       feedback.NewStore(workspace),
+		users:          userDirectory,
+		policy:         permissions.NewPolicy(cfg.Permissions, userDirectory),
+		coalescer:      newCoalescer(cfg.Agents.Defaults.Coalesce),
 	}
 }
 
 func (al *AgentLoop) Run(ctx context.Context) error {
 	al.running.Store(true)
+	go al.feedInbound(ctx)
 
 	for al.running.Load() {
 		select {
 		case <-ctx.Done():
 			return nil
 		default:
-			msg, ok := al.bus.ConsumeInbound(ctx)
+			turn, ok := al.coalescer.next(ctx)
 			if !ok {
 				continue
 			}
+			msg := turn.msg
+
+			al.turnMu.Lock()
+			response, media, err := al.processMessage(turn.ctx, msg)
+			// Check if the message tool already sent a response during this round.
+			// If so, skip publishing to avoid duplicate messages to the user.
+			alreadySent := false
+			if tool, ok := al.tools.Get("message"); ok {
+				if mt, ok := tool.(*tools.MessageTool); ok {
+					alreadySent = mt.HasSentInRound()
+				}
+			}
+			al.turnMu.Unlock()
 
-			response, media, err := al.processMessage(ctx, msg)
+			dropped, requeued := al.coalescer.finish(turn, err)
+			// Requeued messages keep their queue slots until answered
+			if !requeued && al.limiter != nil && msg.Metadata[bus.MetadataPassive] != "true" {
+				for i := 0; i < turn.count; i++ {
+					al.limiter.Done(msg.Channel, msg.ChatID)
+				}
+			}
+			if dropped {
+				// Stopped, or interrupted by a newer message it will be answered with
+				continue
+			}
 			if err != nil {
 				response = fmt.Sprintf("Error processing message: %v", err)
 				media = nil
 			}
 
 			if response != "" {
-				// Check if the message tool already sent a response during this round.
-				// If so, skip publishing to avoid duplicate messages to the user.
-				alreadySent := false
-				if tool, ok := al.tools.Get("message"); ok {
-					if mt, ok := tool.(*tools.MessageTool); ok {
-						alreadySent = mt.HasSentInRound()
-					}
-				}
-
 				if !alreadySent {
-					al.bus.PublishOutbound(bus.OutboundMessage{
+					outbound := bus.OutboundMessage{
 						Channel: msg.Channel,
 						ChatID:  msg.ChatID,
 						Content: response,
 						Media:   media,
-					})
+					}
+					if err == nil {
+						outbound.Speech = al.speechFor(msg)
+					}
+					al.bus.PublishOutbound(outbound)
 				}
 			}
 		}
@@ -272,8 +355,60 @@ func (al *AgentLoop) Run(ctx context.Context) error {
 	return nil
 }
 
+// feedInbound moves messages from the bus to the coalescer until ctx is
+// done. /stop is acted on right away, as the turn it stops would otherwise
+// hold it up.
+func (al *AgentLoop) feedInbound(ctx context.Context) {
+	for {
+		msg, ok := al.bus.ConsumeInbound(ctx)
+		if !ok {
+			return
+		}
+		if isStopCommand(msg) {
+			al.stopTurn(msg)
+			continue
+		}
+		al.coalescer.add(msg)
+	}
+}
+
+// stopTurn cancels the turn in progress in the sender's chat, along with
+// any subagents spawned from it, and tells them so.
+func (al *AgentLoop) stopTurn(msg bus.InboundMessage) {
+	stopped := al.coalescer.stop(turnSession(msg))
+	subagents := al.subagentMgr.CancelOrigin(msg.Channel, msg.ChatID)
+	if al.limiter != nil {
+		al.limiter.Done(msg.Channel, msg.ChatID)
+	}
+	logger.InfoCF("agent", "Stop requested", map[string]interface{}{
+		"channel":   msg.Channel,
+		"chat_id":   msg.ChatID,
+		"sender_id": msg.SenderID,
+		"stopped":   stopped,
+		"subagents": subagents,
+	})
+
+	reply := "Nothing to stop."
+	switch {
+	case stopped && subagents > 0:
+		reply = fmt.Sprintf("Stopped, along with %d background task(s).", subagents)
+	case stopped:
+		reply = "Stopped."
+	case subagents > 0:
+		reply = fmt.Sprintf("Stopped %d background task(s).", subagents)
+	}
+	al.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Content: reply,
+	})
+}
+
 func (al *AgentLoop) Stop() {
 	al.running.Store(false)
+	if err := al.users.Flush(); err != nil {
+		logger.WarnCF("agent", "Failed to save user directory", map[string]interface{}{"error": err.Error()})
+	}
 }
 
 func (al *AgentLoop) RegisterTool(tool tools.Tool) {
@@ -285,6 +420,63 @@ func (al *AgentLoop) SetTracker(t *telemetry.Tracker) {
 	al.tracker = t
 }
 
+// KnowledgeLoader returns the knowledge loader used for context injection.
+func (al *AgentLoop) KnowledgeLoader() *knowledge.Loader {
+	return al.knowledge
+}
+
+// StartKnowledgeRefresh starts re-researching knowledge topics whose TTL has
+// expired, checking every interval until ctx is done.
+func (al *AgentLoop) StartKnowledgeRefresh(ctx context.Context, interval time.Duration) {
+	tool, ok := al.tools.Get("learn")
+	if !ok {
+		return
+	}
+	if lt, ok := tool.(*tools.LearnTool); ok {
+		lt.StartRefreshLoop(ctx, interval)
+	}
+}
+
+// Sessions returns the conversation session store.
+func (al *AgentLoop) Sessions() *session.SessionManager {
+	return al.sessions
+}
+
+// ExperimentMetrics returns the recorder of signals used to evaluate experiments.
+func (al *AgentLoop) ExperimentMetrics() *experiments.Metrics {
+	return al.metrics
+}
+
+// StartExperiments starts metric flushing and the periodic hypothesis
+// evaluator. Reports go to the owner's direct chat.
+func (al *AgentLoop) StartExperiments(ctx context.Context, cfg config.ExperimentsConfig) {
+	al.metrics.Start(ctx)
+	if !cfg.Enabled {
+		return
+	}
+
+	evaluator := experiments.NewEvaluator(al.experiments, al.metrics, experiments.EvalConfig{
+		BaselineDays: cfg.BaselineDays,
+		MinTurns:     cfg.MinTurns,
+		Threshold:    cfg.Threshold,
+		MinCycles:    cfg.MinCycles,
+		MinFeedback:  cfg.MinFeedback,
+	})
+	evaluator.SetReportCallback(func(report string) {
+		channel, chatID, ok := al.policy.OwnerChat()
+		if !ok {
+			logger.WarnCF("agent", "No channel for experiment report", nil)
+			return
+		}
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel: channel,
+			ChatID:  chatID,
+			Content: report,
+		})
+	})
+	evaluator.Start(ctx, time.Duration(cfg.EvaluationIntervalHours)*time.Hour)
+}
+
 // RecordLastChannel records the last active channel for this workspace.
 // This uses the atomic state save mechanism to prevent data loss on crash.
 func (al *AgentLoop) RecordLastChannel(channel string) error {
@@ -314,6 +506,17 @@ func (al *AgentLoop) ProcessDirectWithChannel(ctx context.Context, content, sess
 	return response, err
 }
 
+// ProcessInbound runs a user message through the agent outside the bus and
+// returns the reply, e.g. for the gateway's OpenAI-compatible API. It waits
+// for the bus turn in progress, if any, as both share the tools' per-turn
+// state.
+func (al *AgentLoop) ProcessInbound(ctx context.Context, msg bus.InboundMessage) (string, error) {
+	al.turnMu.Lock()
+	defer al.turnMu.Unlock()
+	response, _, err := al.processMessage(ctx, msg)
+	return response, err
+}
+
 // ProcessHeartbeat processes a heartbeat request without session history.
 // Each heartbeat is independent and doesn't accumulate context.
 // If the heartbeat sends a proactive message to the user, that message is
@@ -356,6 +559,13 @@ func (al *AgentLoop) ProcessHeartbeat(ctx context.Context, content, channel, cha
 }
 
 func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage) (string, []string, error) {
+	// Passively observed group messages only become context for later turns
+	if msg.Metadata[bus.MetadataPassive] == "true" {
+		al.sessions.AddMessage(msg.SessionKey, "user", msg.Content)
+		al.sessions.Save(msg.SessionKey)
+		return "", nil, nil
+	}
+
 	// Add message preview to log (show full content for error messages)
 	var logContent string
 	if strings.Contains(msg.Content, "Error:") || strings.Contains(msg.Content, "error") {
@@ -377,6 +587,44 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 		return resp, nil, err
 	}
 
+	// Resolve the person behind the message
+	sessionKey := msg.SessionKey
+	var user *users.User
+	var role *permissions.Role
+	if msg.SenderID != "" && msg.SenderID != "cron" && !constants.IsInternalChannel(msg.Channel) {
+		reachAt := msg.ChatID
+		if msg.Metadata["peer_kind"] == "group" {
+			reachAt = ""
+		}
+		u, err := al.users.Touch(msg.Channel, msg.SenderID, reachAt, senderName(msg.Metadata))
+		if err != nil {
+			logger.WarnCF("agent", "Failed to save user directory", map[string]interface{}{"error": err.Error()})
+		}
+		user = &u
+
+		r := al.policy.RoleFor(msg.Channel, msg.SenderID)
+		role = &r
+		if !role.AllowsAgent(permissions.AgentMain) {
+			return fmt.Sprintf("Sorry, the %s role can't talk to me.", role.Name), nil, nil
+		}
+		if cmd := agentCommand(msg.Content); cmd != "" && !role.AllowsCommand(cmd) {
+			return fmt.Sprintf("Sorry, the %s role can't use %s.", role.Name, cmd), nil, nil
+		}
+
+		if response, handled := al.handleUserCommand(msg, u); handled {
+			return response, nil, nil
+		}
+
+		if role.DailyTokens > 0 && al.users.TokensToday(u.ID) >= role.DailyTokens {
+			return "You've used up today's allowance. Let's talk again tomorrow.", nil, nil
+		}
+
+		// One session per person across channels for direct chats
+		if al.cfg.Agents.Defaults.SessionScope == "user" && msg.Metadata["peer_kind"] == "direct" {
+			sessionKey = "user:" + u.ID
+		}
+	}
+
 	// Handle /provider command
 	if response, handled := al.handleProviderCommand(msg.Content); handled {
 		return response, nil, nil
@@ -395,15 +643,19 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 
 	// Process as user message
 	return al.runAgentLoop(ctx, processOptions{
-		SessionKey:      msg.SessionKey,
+		SessionKey:      sessionKey,
 		Channel:         msg.Channel,
 		ChatID:          msg.ChatID,
+		SenderID:        msg.SenderID,
 		UserMessage:     msg.Content,
 		Media:           msg.Media,
 		DefaultResponse: "I've completed processing but have no response to give.",
 		EnableSummary:   true,
 		SendResponse:    false,
 		Feature:         feature,
+		User:            user,
+		Role:            role,
+		Speech:          al.speechFor(msg),
 	})
 }
 
@@ -459,6 +711,91 @@ func (al *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMe
 	return "", nil
 }
 
+// handleUserCommand handles /link, which ties the sender's accounts on
+// different channels to one person, /name, which sets what the agent calls
+// them, and /voice, which sets how replies to them are spoken. Returns the
+// response string and true if the command was handled.
+func (al *AgentLoop) handleUserCommand(msg bus.InboundMessage, user users.User) (string, bool) {
+	fields := strings.Fields(msg.Content)
+	if len(fields) == 0 {
+		return "", false
+	}
+
+	switch fields[0] {
+	case "/link":
+		// Codes posted in a group could be used by anyone in it
+		if msg.Metadata["peer_kind"] == "group" {
+			return "Linking only works in a direct chat with me. Send /link there.", true
+		}
+		if len(fields) == 1 {
+			code := al.users.NewLinkCode(user.ID)
+			return fmt.Sprintf("Your link code is %s. Send \"/link %s\" from your account on another channel within %d minutes to link it to this one.\nLinked so far: %s",
+				code, code, int(users.LinkCodeTTL.Minutes()), strings.Join(user.Channels(), ", ")), true
+		}
+		linked, err := al.users.Link(fields[1], msg.Channel, msg.SenderID)
+		if err != nil {
+			return fmt.Sprintf("Could not link: %v", err), true
+		}
+		logger.InfoCF("agent", "Linked account", map[string]interface{}{
+			"user_id":   linked.ID,
+			"channel":   msg.Channel,
+			"sender_id": msg.SenderID,
+		})
+		name := linked.Name
+		if name == "" {
+			name = linked.ID
+		}
+		return fmt.Sprintf("Linked. This %s account now belongs to %s (%s).", msg.Channel, name, strings.Join(linked.Channels(), ", ")), true
+
+	case "/name":
+		name := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(msg.Content), "/name"))
+		if name == "" {
+			return fmt.Sprintf("I know you as %q. Send \"/name <name>\" to change it.", user.Name), true
+		}
+		if err := al.users.SetName(user.ID, name); err != nil {
+			return fmt.Sprintf("Could not change your name: %v", err), true
+		}
+		return fmt.Sprintf("Got it, I'll call you %s.", name), true
+
+	case "/voice":
+		return al.handleVoiceCommand(fields, user), true
+	}
+	return "", false
+}
+
+// agentCommands are the slash commands the agent handles itself.
+var agentCommands = map[string]bool{"/model": true, "/provider": true, "/link": true, "/name": true, "/voice": true}
+
+// agentCommand returns the agent slash command content starts with, if any.
+func agentCommand(content string) string {
+	fields := strings.Fields(content)
+	if len(fields) > 0 && agentCommands[fields[0]] {
+		return fields[0]
+	}
+	return ""
+}
+
+// Permissions returns the role policy, e.g. to share it with channels.
+func (al *AgentLoop) Permissions() *permissions.Policy {
+	return al.policy
+}
+
+// SetRateLimiter shares the inbound rate limiter so the agent can release
+// queue slots and count tokens against senders' daily budgets.
+func (al *AgentLoop) SetRateLimiter(limiter *ratelimit.Limiter) {
+	al.limiter = limiter
+}
+
+// senderName picks the sender's display name from channel metadata.
+func senderName(metadata map[string]string) string {
+	for _, key := range []string{"display_name", "first_name", "user_name", "sender_name"} {
+		if name := metadata[key]; name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
 // handleModelCommand handles the /model command to view or change the current model at runtime.
 // Returns the response string and true if the command was handled.
 func (al *AgentLoop) handleModelCommand(content string) (string, bool) {
@@ -602,13 +939,19 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 
 	// 1. Update tool contexts
 	al.updateToolContexts(opts.Channel, opts.ChatID)
+	if tool, ok := al.tools.Get("message"); ok {
+		if mt, ok := tool.(*tools.MessageTool); ok {
+			mt.SetSpeech(opts.Speech)
+			mt.SetCurrentChatOnly(opts.Role != nil && !opts.Role.AllowsTool(permissions.MessageOthers))
+		}
+	}
 
 	// 2. Build messages (skip history for heartbeat)
 	var history []providers.Message
 	var summary string
 	if !opts.NoHistory {
 		history = al.sessions.GetHistory(opts.SessionKey)
-		summary = al.sessions.GetSummary(opts.SessionKey)
+		summary = al.buildSessionSummary(opts.SessionKey)
 	}
 	messages := al.contextBuilder.BuildMessages(
 		history,
@@ -617,14 +960,25 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 		opts.Media,
 		opts.Channel,
 		opts.ChatID,
+		opts.User,
 	)
 
 	// 3. Save user message to session
 	al.sessions.AddMessage(opts.SessionKey, "user", opts.UserMessage)
+	turnStart := len(al.sessions.GetHistory(opts.SessionKey))
 
 	// 4. Run LLM iteration loop
 	finalContent, iteration, media, err := al.runLLMIteration(ctx, messages, opts)
 	if err != nil {
+		if ctx.Err() != nil {
+			// Cancelled turns leave no half-finished exchange behind
+			al.sessions.DropLastTurn(opts.SessionKey)
+			if errors.Is(context.Cause(ctx), errTurnStopped) {
+				al.sessions.AddMessage(opts.SessionKey, "user", opts.UserMessage)
+				al.sessions.AddMessage(opts.SessionKey, "assistant", stoppedNote)
+				al.sessions.Save(opts.SessionKey)
+			}
+		}
 		return "", nil, err
 	}
 
@@ -640,6 +994,12 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 	al.sessions.AddMessage(opts.SessionKey, "assistant", finalContent)
 	al.sessions.Save(opts.SessionKey)
 
+	// Record experiment metrics for conversations with the user
+	if opts.Feature == telemetry.FeatureChat && al.metrics != nil {
+		al.metrics.RecordTurn(opts.UserMessage, utf8.RuneCountInString(finalContent),
+			countToolMessages(al.sessions.GetHistory(opts.SessionKey), turnStart))
+	}
+
 	// 7. Optional: summarization
 	if opts.EnableSummary {
 		al.maybeSummarize(opts.SessionKey)
@@ -652,6 +1012,7 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 			ChatID:  opts.ChatID,
 			Content: finalContent,
 			Media:   media,
+			Speech:  opts.Speech,
 		})
 	}
 
@@ -683,8 +1044,17 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 				"max":       al.maxIterations,
 			})
 
-		// Build tool definitions
+		// Build tool definitions, limited to what the sender's role may use
 		providerToolDefs := al.tools.ToProviderDefs()
+		if opts.Role != nil {
+			allowed := providerToolDefs[:0]
+			for _, def := range providerToolDefs {
+				if opts.Role.AllowsTool(def.Function.Name) {
+					allowed = append(allowed, def)
+				}
+			}
+			providerToolDefs = allowed
+		}
 
 		// Log LLM request details
 		logger.DebugCF("agent", "LLM request",
@@ -718,6 +1088,14 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 		if response != nil && response.Usage != nil && al.tracker != nil {
 			al.tracker.Record(opts.Feature, response.Usage.PromptTokens, response.Usage.CompletionTokens, response.Usage.TotalTokens)
 		}
+		if response != nil && response.Usage != nil && opts.User != nil {
+			if err := al.users.AddTokens(opts.User.ID, response.Usage.TotalTokens); err != nil {
+				logger.WarnCF("agent", "Failed to record user token usage", map[string]interface{}{"error": err.Error()})
+			}
+		}
+		if response != nil && response.Usage != nil && al.limiter != nil && opts.SenderID != "" {
+			al.limiter.RecordTokens(opts.Channel, opts.SenderID, opts.ChatID, response.Usage.TotalTokens)
+		}
 
 		if err != nil {
 			logger.ErrorCF("agent", "LLM call failed",
@@ -815,7 +1193,12 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 				}
 			}
 
-			toolResult := al.tools.ExecuteWithContext(ctx, tc.Name, tc.Arguments, opts.Channel, opts.ChatID, asyncCallback)
+			var toolResult *tools.ToolResult
+			if opts.Role != nil && !opts.Role.AllowsTool(tc.Name) {
+				toolResult = tools.ErrorResult(fmt.Sprintf("tool %s is not available to the %s role", tc.Name, opts.Role.Name))
+			} else {
+				toolResult = al.tools.ExecuteWithContext(ctx, tc.Name, tc.Arguments, opts.Channel, opts.ChatID, asyncCallback)
+			}
 
 			// Collect media URLs from tool results
 			if len(toolResult.Media) > 0 {
@@ -857,6 +1240,17 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 	return finalContent, iteration, collectedMedia, nil
 }
 
+// countToolMessages counts tool results in history from index start on.
+func countToolMessages(history []providers.Message, start int) int {
+	count := 0
+	for i := start; i < len(history); i++ {
+		if history[i].Role == "tool" {
+			count++
+		}
+	}
+	return count
+}
+
 // updateToolContexts updates the context for tools that need channel/chatID info.
 func (al *AgentLoop) updateToolContexts(channel, chatID string) {
 	// Use ContextualTool interface instead of type assertions
@@ -882,22 +1276,6 @@ func (al *AgentLoop) updateToolContexts(channel, chatID string) {
 	}
 }
 
-// maybeSummarize triggers summarization if the session history exceeds thresholds.
-func (al *AgentLoop) maybeSummarize(sessionKey string) {
-	newHistory := al.sessions.GetHistory(sessionKey)
-	tokenEstimate := al.estimateTokens(newHistory)
-	threshold := al.contextWindow * 75 / 100
-
-	if len(newHistory) > 20 || tokenEstimate > threshold {
-		if _, loading := al.summarizing.LoadOrStore(sessionKey, true); !loading {
-			go func() {
-				defer al.summarizing.Delete(sessionKey)
-				al.summarizeSession(sessionKey)
-			}()
-		}
-	}
-}
-
 // GetStartupInfo returns information about loaded tools and skills for logging.
 func (al *AgentLoop) GetStartupInfo() map[string]interface{} {
 	info := make(map[string]interface{})
@@ -965,115 +1343,6 @@ func formatToolsForLog(tools []providers.ToolDefinition) string {
 	return result
 }
 
-// summarizeSession summarizes the conversation history for a session.
-func (al *AgentLoop) summarizeSession(sessionKey string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
-	defer cancel()
-
-	history := al.sessions.GetHistory(sessionKey)
-	summary := al.sessions.GetSummary(sessionKey)
-
-	// Keep last 4 messages for continuity
-	if len(history) <= 4 {
-		return
-	}
-
-	toSummarize := history[:len(history)-4]
-
-	// Oversized Message Guard
-	// Skip messages larger than 50% of context window to prevent summarizer overflow
-	maxMessageTokens := al.contextWindow / 2
-	validMessages := make([]providers.Message, 0)
-	omitted := false
-
-	for _, m := range toSummarize {
-		if m.Role != "user" && m.Role != "assistant" {
-			continue
-		}
-		// Estimate tokens for this message
-		msgTokens := len(m.Content) / 4
-		if msgTokens > maxMessageTokens {
-			omitted = true
-			continue
-		}
-		validMessages = append(validMessages, m)
-	}
-
-	if len(validMessages) == 0 {
-		return
-	}
-
-	// Multi-Part Summarization
-	// Split into two parts if history is significant
-	var finalSummary string
-	if len(validMessages) > 10 {
-		mid := len(validMessages) / 2
-		part1 := validMessages[:mid]
-		part2 := validMessages[mid:]
-
-		s1, err1 := al.summarizeBatch(ctx, part1, "")
-		s2, err2 := al.summarizeBatch(ctx, part2, "")
-
-		if err1 != nil && err2 != nil {
-			logger.WarnCF("agent", "Both summarize batches failed", map[string]interface{}{
-				"err1": err1.Error(), "err2": err2.Error(),
-			})
-			return
-		}
-
-		// Merge them
-		mergePrompt := fmt.Sprintf("Merge these two conversation summaries into one cohesive summary:\n\n1: %s\n\n2: %s", s1, s2)
-		resp, err := al.provider.Chat(ctx, []providers.Message{{Role: "user", Content: mergePrompt}}, nil, al.model, map[string]interface{}{
-			"max_tokens":  1024,
-			"temperature": 0.3,
-		})
-		if resp != nil && resp.Usage != nil && al.tracker != nil {
-			al.tracker.Record(telemetry.FeatureSummarize, resp.Usage.PromptTokens, resp.Usage.CompletionTokens, resp.Usage.TotalTokens)
-		}
-		if err == nil {
-			finalSummary = resp.Content
-		} else {
-			finalSummary = s1 + " " + s2
-		}
-	} else {
-		finalSummary, _ = al.summarizeBatch(ctx, validMessages, summary)
-	}
-
-	if omitted && finalSummary != "" {
-		finalSummary += "\n[Note: Some oversized messages were omitted from this summary for efficiency.]"
-	}
-
-	if finalSummary != "" {
-		al.sessions.SetSummary(sessionKey, finalSummary)
-		al.sessions.TruncateHistory(sessionKey, 4)
-		al.sessions.Save(sessionKey)
-	}
-}
-
-// summarizeBatch summarizes a batch of messages.
-func (al *AgentLoop) summarizeBatch(ctx context.Context, batch []providers.Message, existingSummary string) (string, error) {
-	prompt := "Provide a concise summary of this conversation segment, preserving core context and key points.\n"
-	if existingSummary != "" {
-		prompt += "Existing context: " + existingSummary + "\n"
-	}
-	prompt += "\nCONVERSATION:\n"
-	for _, m := range batch {
-		prompt += fmt.Sprintf("%s: %s\n", m.Role, m.Content)
-	}
-
-	response, err := al.provider.Chat(ctx, []providers.Message{{Role: "user", Content: prompt}}, nil, al.model, map[string]interface{}{
-		"max_tokens":  1024,
-		"temperature": 0.3,
-	})
-	if response != nil && response.Usage != nil && al.tracker != nil {
-		al.tracker.Record(telemetry.FeatureSummarize, response.Usage.PromptTokens, response.Usage.CompletionTokens, response.Usage.TotalTokens)
-	}
-	if err != nil {
-		return "", err
-	}
-	return response.Content, nil
-}
-
 // estimateTokens estimates the number of tokens in a message list.
 // Uses rune count instead of byte length so that CJK and other multi-byte
 // characters are not over-counted (a Chinese character is 3 bytes but roughly
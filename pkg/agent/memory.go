@@ -16,6 +16,7 @@ import (
 // MemoryStore manages persistent memory for the agent.
 // - Long-term memory: memory/MEMORY.md
 // - Daily notes: memory/YYYYMM/YYYYMMDD.md
+// - Per-person memory: memory/people/<userID>.md
 type MemoryStore struct {
 	workspace  string
 	memoryDir  string
@@ -60,6 +61,21 @@ func (ms *MemoryStore) WriteLongTerm(content string) error {
 	return os.WriteFile(ms.memoryFile, []byte(content), 0644)
 }
 
+// UserFile returns the path of a person's own memory file
+// (memory/people/<userID>.md).
+func (ms *MemoryStore) UserFile(userID string) string {
+	return filepath.Join(ms.memoryDir, "people", userID+".md")
+}
+
+// ReadUser reads a person's memory file.
+// Returns empty string if the file doesn't exist.
+func (ms *MemoryStore) ReadUser(userID string) string {
+	if data, err := os.ReadFile(ms.UserFile(userID)); err == nil {
+		return string(data)
+	}
+	return ""
+}
+
 // ReadToday reads today's daily note.
 // Returns empty string if the file doesn't exist.
 func (ms *MemoryStore) ReadToday() string {
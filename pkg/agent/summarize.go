@@ -0,0 +1,358 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/session"
+	"github.com/sipeed/picoclaw/pkg/telemetry"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// Summarization is hierarchical:
+//
+//  1. Older messages are split into chunks of summaryCfg.ChunkSize and each
+//     chunk is summarized under a short topic label (level 1).
+//  2. Once more than summaryCfg.MaxChunks chunk summaries accumulate, the
+//     oldest are rolled up into the session digest (level 2).
+//  3. Outcomes of side-effecting tools (files written, emails sent, reminders
+//     set) are extracted verbatim so they survive both levels.
+
+// outcomeTools lists tools whose results are worth remembering after the
+// tool messages themselves have been summarized away.
+var outcomeTools = map[string]bool{
+	"write_file":  true,
+	"edit_file":   true,
+	"append_file": true,
+	"exec":        true,
+	"host_exec":   true,
+	"gmail":       true,
+	"calendar":    true,
+	"gdrive":      true,
+	"reminder":    true,
+	"tasks":       true,
+	"cron":        true,
+	"snippet":     true,
+	"memory":      true,
+	"lights":      true,
+	"image_gen":   true,
+}
+
+// readOnlyActions are "action" argument values that never change anything,
+// so calls using them are not recorded as outcomes.
+var readOnlyActions = map[string]bool{
+	"list":   true,
+	"get":    true,
+	"read":   true,
+	"search": true,
+	"show":   true,
+	"status": true,
+	"view":   true,
+}
+
+// maybeSummarize triggers summarization if the session history exceeds thresholds.
+func (al *AgentLoop) maybeSummarize(sessionKey string) {
+	newHistory := al.sessions.GetHistory(sessionKey)
+	tokenEstimate := al.estimateTokens(newHistory)
+	threshold := al.contextWindow * al.summaryCfg.TokenPercent / 100
+
+	if len(newHistory) > al.summaryCfg.MessageThreshold || tokenEstimate > threshold {
+		if _, loading := al.summarizing.LoadOrStore(sessionKey, true); !loading {
+			go func() {
+				defer al.summarizing.Delete(sessionKey)
+				al.summarizeSession(sessionKey)
+			}()
+		}
+	}
+}
+
+// buildSessionSummary renders the digest, pending chunk summaries and key
+// outcomes of a session into the text injected into the system prompt.
+func (al *AgentLoop) buildSessionSummary(sessionKey string) string {
+	digest := al.sessions.GetSummary(sessionKey)
+	chunks := al.sessions.GetSummaryChunks(sessionKey)
+	outcomes := al.sessions.GetOutcomes(sessionKey)
+
+	var b strings.Builder
+	if digest != "" {
+		b.WriteString(digest)
+	}
+	if len(chunks) > 0 {
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		b.WriteString("### Recent Topics\n")
+		for _, c := range chunks {
+			if c.Topic != "" {
+				fmt.Fprintf(&b, "- **%s**: %s\n", c.Topic, c.Summary)
+			} else {
+				fmt.Fprintf(&b, "- %s\n", c.Summary)
+			}
+		}
+	}
+	if len(outcomes) > 0 {
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		b.WriteString("### Key Outcomes\n")
+		for _, o := range outcomes {
+			fmt.Fprintf(&b, "- %s\n", o)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// summarizeSession summarizes the conversation history for a session.
+func (al *AgentLoop) summarizeSession(sessionKey string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	cfg := al.summaryCfg
+	history := al.sessions.GetHistory(sessionKey)
+	if len(history) <= cfg.KeepLast {
+		return
+	}
+
+	// Same cut rule as TruncateHistory: never start the kept tail on an
+	// orphaned tool message.
+	cut := len(history) - cfg.KeepLast
+	for cut < len(history) && history[cut].Role == "tool" {
+		cut++
+	}
+	toSummarize := history[:cut]
+
+	outcomes := extractOutcomes(toSummarize)
+	transcript := al.renderTranscript(toSummarize)
+	if len(transcript) == 0 {
+		return
+	}
+
+	// Level 1: one topic-labelled summary per chunk
+	var chunks []session.SummaryChunk
+	for start := 0; start < len(transcript); start += cfg.ChunkSize {
+		end := start + cfg.ChunkSize
+		if end > len(transcript) {
+			end = len(transcript)
+		}
+		chunk, err := al.summarizeChunk(ctx, transcript[start:end])
+		if err != nil {
+			// Keep the raw history rather than losing an unsummarized chunk
+			logger.WarnCF("agent", "Chunk summarization failed, keeping history",
+				map[string]interface{}{"session": sessionKey, "error": err.Error()})
+			return
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	// Messages may have been added while we were summarizing, which are
+	// kept, or the session cleared, in which case the summary is stale.
+	if !al.sessions.CompactPrefix(sessionKey, toSummarize, chunks) {
+		logger.InfoCF("agent", "Session changed while summarizing, keeping history",
+			map[string]interface{}{"session": sessionKey})
+		return
+	}
+	al.sessions.AddOutcomes(sessionKey, outcomes, cfg.MaxOutcomes)
+
+	// Level 2: roll the oldest chunks into the digest
+	pending := al.sessions.GetSummaryChunks(sessionKey)
+	if overflow := len(pending) - cfg.MaxChunks; overflow > 0 {
+		digest, err := al.rollUpDigest(ctx, al.sessions.GetSummary(sessionKey), pending[:overflow])
+		if err != nil {
+			logger.WarnCF("agent", "Digest roll-up failed, keeping chunk summaries",
+				map[string]interface{}{"session": sessionKey, "error": err.Error()})
+		} else {
+			al.sessions.RollUpChunks(sessionKey, digest, overflow)
+		}
+	}
+
+	al.sessions.Save(sessionKey)
+
+	logger.InfoCF("agent", "Session summarized",
+		map[string]interface{}{
+			"session":    sessionKey,
+			"summarized": cut,
+			"chunks":     len(chunks),
+			"outcomes":   len(outcomes),
+		})
+}
+
+// renderTranscript turns messages into one line each for the summarizer.
+// Tool results are condensed instead of dropped, and oversized messages are
+// truncated to half the context window instead of being omitted.
+func (al *AgentLoop) renderTranscript(messages []providers.Message) []string {
+	maxChars := al.contextWindow / 2 * 4
+	if maxChars <= 0 {
+		maxChars = 8000
+	}
+
+	lines := make([]string, 0, len(messages))
+	for _, m := range messages {
+		switch m.Role {
+		case "user", "assistant":
+			content := m.Content
+			if len(m.ToolCalls) > 0 {
+				names := make([]string, 0, len(m.ToolCalls))
+				for _, tc := range m.ToolCalls {
+					names = append(names, toolCallName(tc))
+				}
+				content = strings.TrimSpace(content + " [called tools: " + strings.Join(names, ", ") + "]")
+			}
+			if content == "" {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("%s: %s", m.Role, utils.Truncate(content, maxChars)))
+		case "tool":
+			if m.Content == "" {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("tool result: %s", utils.Truncate(m.Content, 300)))
+		}
+	}
+	return lines
+}
+
+// summarizeChunk summarizes one chunk of transcript lines under a topic label.
+func (al *AgentLoop) summarizeChunk(ctx context.Context, lines []string) (session.SummaryChunk, error) {
+	prompt := "Summarize this conversation segment. Preserve decisions, facts about the user, " +
+		"commitments and results of actions. Reply in exactly this format:\n" +
+		"TOPIC: <2-5 word topic>\nSUMMARY: <concise summary>\n\nCONVERSATION:\n" +
+		strings.Join(lines, "\n")
+
+	content, err := al.summaryChat(ctx, prompt)
+	if err != nil {
+		return session.SummaryChunk{}, err
+	}
+
+	topic, summary := parseTopicSummary(content)
+	return session.SummaryChunk{
+		Topic:    topic,
+		Summary:  summary,
+		Messages: len(lines),
+		Created:  time.Now(),
+	}, nil
+}
+
+// rollUpDigest folds chunk summaries into the existing digest, grouped by topic.
+func (al *AgentLoop) rollUpDigest(ctx context.Context, digest string, chunks []session.SummaryChunk) (string, error) {
+	var b strings.Builder
+	b.WriteString("Merge the existing conversation digest with the newer topic summaries into one " +
+		"cohesive digest grouped by topic. Keep decisions, facts about the user and open commitments; " +
+		"drop small talk.\n\n")
+	if digest != "" {
+		b.WriteString("EXISTING DIGEST:\n" + digest + "\n\n")
+	}
+	b.WriteString("NEWER TOPIC SUMMARIES:\n")
+	for _, c := range chunks {
+		fmt.Fprintf(&b, "- %s: %s\n", c.Topic, c.Summary)
+	}
+	return al.summaryChat(ctx, b.String())
+}
+
+// summaryChat sends a single summarization prompt and records its token usage.
+func (al *AgentLoop) summaryChat(ctx context.Context, prompt string) (string, error) {
+	response, err := al.provider.Chat(ctx, []providers.Message{{Role: "user", Content: prompt}}, nil, al.model, map[string]interface{}{
+		"max_tokens":  1024,
+		"temperature": 0.3,
+	})
+	if response != nil && response.Usage != nil && al.tracker != nil {
+		al.tracker.Record(telemetry.FeatureSummarize, response.Usage.PromptTokens, response.Usage.CompletionTokens, response.Usage.TotalTokens)
+	}
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(response.Content) == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return strings.TrimSpace(response.Content), nil
+}
+
+// parseTopicSummary splits a "TOPIC: ...\nSUMMARY: ..." reply. Replies that
+// ignore the format are used whole as the summary.
+func parseTopicSummary(content string) (string, string) {
+	var topic string
+	summary := content
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if rest, ok := strings.CutPrefix(trimmed, "TOPIC:"); ok && topic == "" {
+			topic = strings.TrimSpace(rest)
+		}
+	}
+	if idx := strings.Index(content, "SUMMARY:"); idx >= 0 {
+		summary = content[idx+len("SUMMARY:"):]
+	}
+	return topic, strings.TrimSpace(summary)
+}
+
+// extractOutcomes pairs side-effecting tool calls with their results.
+func extractOutcomes(messages []providers.Message) []string {
+	calls := make(map[string]providers.ToolCall)
+	var outcomes []string
+
+	for _, m := range messages {
+		if m.Role == "assistant" {
+			for _, tc := range m.ToolCalls {
+				calls[tc.ID] = tc
+			}
+			continue
+		}
+		if m.Role != "tool" || m.ToolCallID == "" {
+			continue
+		}
+		tc, ok := calls[m.ToolCallID]
+		if !ok {
+			continue
+		}
+		name := toolCallName(tc)
+		if !outcomeTools[name] {
+			continue
+		}
+
+		args := toolCallArgs(tc)
+		var parsed map[string]interface{}
+		if json.Unmarshal([]byte(args), &parsed) == nil {
+			if action, ok := parsed["action"].(string); ok && readOnlyActions[action] {
+				continue
+			}
+		}
+
+		result := strings.TrimSpace(m.Content)
+		if idx := strings.IndexByte(result, '\n'); idx >= 0 {
+			result = result[:idx]
+		}
+		outcomes = append(outcomes, fmt.Sprintf("%s %s → %s",
+			name, utils.Truncate(args, 120), utils.Truncate(result, 160)))
+	}
+	return outcomes
+}
+
+func toolCallName(tc providers.ToolCall) string {
+	if tc.Name != "" {
+		return tc.Name
+	}
+	if tc.Function != nil {
+		return tc.Function.Name
+	}
+	return ""
+}
+
+func toolCallArgs(tc providers.ToolCall) string {
+	if tc.Function != nil && tc.Function.Arguments != "" {
+		return tc.Function.Arguments
+	}
+	if len(tc.Arguments) > 0 {
+		data, _ := json.Marshal(tc.Arguments)
+		return string(data)
+	}
+	return "{}"
+}
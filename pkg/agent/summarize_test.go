@@ -0,0 +1,176 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// summaryMockProvider answers every prompt with a fixed topic/summary pair.
+type summaryMockProvider struct {
+	calls  int
+	onChat func() // runs on every call, e.g. to change the session meanwhile
+}
+
+func (m *summaryMockProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	m.calls++
+	if m.onChat != nil {
+		m.onChat()
+	}
+	if strings.Contains(messages[0].Content, "EXISTING DIGEST") || strings.Contains(messages[0].Content, "NEWER TOPIC SUMMARIES") {
+		return &providers.LLMResponse{Content: "rolled digest"}, nil
+	}
+	return &providers.LLMResponse{Content: "TOPIC: Weather\nSUMMARY: talked about rain"}, nil
+}
+
+func (m *summaryMockProvider) GetDefaultModel() string {
+	return "mock-model"
+}
+
+func newSummaryTestLoop(t *testing.T, sc config.SummarizationConfig) (*AgentLoop, *summaryMockProvider) {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+				Summarization:     sc,
+			},
+		},
+	}
+	provider := &summaryMockProvider{}
+	return NewAgentLoop(cfg, bus.NewMessageBus(), provider, ""), provider
+}
+
+func TestSummarizeSession_ChunksAndOutcomes(t *testing.T) {
+	al, provider := newSummaryTestLoop(t, config.SummarizationConfig{KeepLast: 2, ChunkSize: 4, MaxChunks: 10})
+	key := "test:chat"
+
+	al.sessions.AddMessage(key, "user", "write a note")
+	al.sessions.AddFullMessage(key, providers.Message{
+		Role: "assistant",
+		ToolCalls: []providers.ToolCall{{
+			ID:       "call_1",
+			Type:     "function",
+			Function: &providers.FunctionCall{Name: "write_file", Arguments: `{"path":"notes.md"}`},
+		}},
+	})
+	al.sessions.AddFullMessage(key, providers.Message{Role: "tool", Content: "File written: notes.md", ToolCallID: "call_1"})
+	for i := 0; i < 5; i++ {
+		al.sessions.AddMessage(key, "user", "hello")
+		al.sessions.AddMessage(key, "assistant", "hi")
+	}
+
+	al.summarizeSession(key)
+
+	if got := len(al.sessions.GetHistory(key)); got != 2 {
+		t.Errorf("history length = %d, want 2", got)
+	}
+	chunks := al.sessions.GetSummaryChunks(key)
+	if len(chunks) != 3 {
+		t.Fatalf("chunks = %d, want 3 (11 transcript lines / chunk size 4)", len(chunks))
+	}
+	if chunks[0].Topic != "Weather" || chunks[0].Summary != "talked about rain" {
+		t.Errorf("unexpected chunk: %+v", chunks[0])
+	}
+	if provider.calls != 3 {
+		t.Errorf("provider calls = %d, want 3", provider.calls)
+	}
+
+	outcomes := al.sessions.GetOutcomes(key)
+	if len(outcomes) != 1 || !strings.Contains(outcomes[0], "write_file") || !strings.Contains(outcomes[0], "File written") {
+		t.Errorf("unexpected outcomes: %v", outcomes)
+	}
+
+	summary := al.buildSessionSummary(key)
+	if !strings.Contains(summary, "**Weather**") || !strings.Contains(summary, "### Key Outcomes") {
+		t.Errorf("summary missing sections:\n%s", summary)
+	}
+}
+
+func TestSummarizeSession_RollsUpDigest(t *testing.T) {
+	al, _ := newSummaryTestLoop(t, config.SummarizationConfig{KeepLast: 2, ChunkSize: 2, MaxChunks: 1})
+	key := "test:chat"
+
+	for i := 0; i < 4; i++ {
+		al.sessions.AddMessage(key, "user", "hello")
+		al.sessions.AddMessage(key, "assistant", "hi")
+	}
+
+	al.summarizeSession(key)
+
+	if got := al.sessions.GetSummary(key); got != "rolled digest" {
+		t.Errorf("digest = %q, want %q", got, "rolled digest")
+	}
+	if got := len(al.sessions.GetSummaryChunks(key)); got != 1 {
+		t.Errorf("pending chunks = %d, want 1", got)
+	}
+}
+
+func TestSummarizeSession_KeepsMessagesAddedMeanwhile(t *testing.T) {
+	al, provider := newSummaryTestLoop(t, config.SummarizationConfig{KeepLast: 2, ChunkSize: 10, MaxChunks: 10})
+	key := "test:chat"
+	for i := 0; i < 4; i++ {
+		al.sessions.AddMessage(key, "user", "hello")
+		al.sessions.AddMessage(key, "assistant", "hi")
+	}
+
+	provider.onChat = func() { al.sessions.AddMessage(key, "user", "still there?") }
+	al.summarizeSession(key)
+
+	history := al.sessions.GetHistory(key)
+	if len(history) != 3 || history[2].Content != "still there?" {
+		t.Errorf("history = %+v, want the kept tail plus the new message", history)
+	}
+	if got := len(al.sessions.GetSummaryChunks(key)); got != 1 {
+		t.Errorf("chunks = %d, want 1", got)
+	}
+}
+
+func TestSummarizeSession_SessionClearedMeanwhile(t *testing.T) {
+	al, provider := newSummaryTestLoop(t, config.SummarizationConfig{KeepLast: 2, ChunkSize: 10, MaxChunks: 10})
+	key := "test:chat"
+	for i := 0; i < 4; i++ {
+		al.sessions.AddMessage(key, "user", "hello")
+		al.sessions.AddMessage(key, "assistant", "hi")
+	}
+
+	// Cleared, then a new message arrives before the summary comes back
+	provider.onChat = func() {
+		al.sessions.TruncateHistory(key, 0)
+		al.sessions.AddMessage(key, "user", "fresh start")
+	}
+	al.summarizeSession(key)
+
+	history := al.sessions.GetHistory(key)
+	if len(history) != 1 || history[0].Content != "fresh start" {
+		t.Errorf("history = %+v, want the new message kept", history)
+	}
+	if chunks := al.sessions.GetSummaryChunks(key); len(chunks) != 0 {
+		t.Errorf("stale summary saved: %+v", chunks)
+	}
+}
+
+func TestExtractOutcomes_SkipsReadOnlyActions(t *testing.T) {
+	messages := []providers.Message{
+		{Role: "assistant", ToolCalls: []providers.ToolCall{
+			{ID: "a", Function: &providers.FunctionCall{Name: "reminder", Arguments: `{"action":"list"}`}},
+			{ID: "b", Function: &providers.FunctionCall{Name: "reminder", Arguments: `{"action":"set","text":"call mom"}`}},
+			{ID: "c", Function: &providers.FunctionCall{Name: "web_search", Arguments: `{"query":"go"}`}},
+		}},
+		{Role: "tool", ToolCallID: "a", Content: "no reminders"},
+		{Role: "tool", ToolCallID: "b", Content: "Reminder set for 18:00"},
+		{Role: "tool", ToolCallID: "c", Content: "results"},
+	}
+
+	outcomes := extractOutcomes(messages)
+	if len(outcomes) != 1 || !strings.Contains(outcomes[0], "Reminder set") {
+		t.Errorf("unexpected outcomes: %v", outcomes)
+	}
+}
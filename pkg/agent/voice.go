@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/users"
+)
+
+// speechFor decides whether the reply to msg is spoken: when it came as a
+// voice note, or always if the sender asked for that with /voice, in their
+// chosen voice and language. Commands are always answered in text.
+func (al *AgentLoop) speechFor(msg bus.InboundMessage) *bus.Speech {
+	if msg.SenderID == "" || msg.SenderID == "cron" || constants.IsInternalChannel(msg.Channel) ||
+		msg.Metadata[bus.MetadataPassive] == "true" || strings.HasPrefix(strings.TrimSpace(msg.Content), "/") {
+		return nil
+	}
+
+	var settings users.VoiceSettings
+	if u, ok := al.users.Lookup(msg.Channel, msg.SenderID); ok {
+		settings = u.Voice
+	}
+	switch {
+	case settings.Replies == users.VoiceRepliesOff:
+		return nil
+	case settings.Replies == users.VoiceRepliesAlways, msg.Metadata[bus.MetadataVoice] == "true":
+		return &bus.Speech{Voice: settings.Voice, Language: settings.Language}
+	}
+	return nil
+}
+
+// handleVoiceCommand handles /voice, which sets when and how the user's
+// replies are spoken.
+func (al *AgentLoop) handleVoiceCommand(fields []string, user users.User) string {
+	settings := user.Voice
+	if len(fields) == 1 {
+		mode := settings.Replies
+		if mode == users.VoiceRepliesAuto {
+			mode = "auto (when you send a voice note)"
+		}
+		return fmt.Sprintf("Voice replies: %s. Voice: %s. Language: %s.\n"+
+			"Send \"/voice always\", \"/voice off\" or \"/voice auto\" to change when I speak, \"/voice <name>\" to pick a voice, "+
+			"\"/voice language <code>\" to set your language, or \"/voice default\" to reset both.",
+			mode, orDefault(settings.Voice), orDefault(settings.Language))
+	}
+
+	var reply string
+	switch arg := fields[1]; strings.ToLower(arg) {
+	case "always":
+		settings.Replies = users.VoiceRepliesAlways
+		reply = "I'll answer you with voice notes from now on."
+	case "off":
+		settings.Replies = users.VoiceRepliesOff
+		reply = "I'll only answer you in text."
+	case "auto":
+		settings.Replies = users.VoiceRepliesAuto
+		reply = "I'll answer voice notes with voice notes, and text with text."
+	case "default":
+		settings.Voice, settings.Language = "", ""
+		reply = "Back to the default voice."
+	case "language":
+		if len(fields) < 3 {
+			return "Send \"/voice language <code>\", e.g. \"/voice language en-US\"."
+		}
+		settings.Language = fields[2]
+		reply = fmt.Sprintf("Got it, I'll speak %s.", settings.Language)
+	default:
+		settings.Voice = arg
+		reply = fmt.Sprintf("Got it, I'll speak as %s.", settings.Voice)
+	}
+	if err := al.users.SetVoice(user.ID, settings); err != nil {
+		return fmt.Sprintf("Could not change your voice settings: %v", err)
+	}
+	return reply
+}
+
+func orDefault(s string) string {
+	if s == "" {
+		return "default"
+	}
+	return s
+}
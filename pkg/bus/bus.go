@@ -12,6 +12,7 @@ type MessageBus struct {
 	inbound  chan InboundMessage
 	outbound chan OutboundMessage
 	handlers map[string]MessageHandler
+	feedback FeedbackHandler
 	mu       sync.RWMutex
 }
 
@@ -76,6 +77,28 @@ func (mb *MessageBus) GetHandler(channel string) (MessageHandler, bool) {
 	return handler, ok
 }
 
+// SetFeedbackHandler sets the handler that receives reaction feedback from channels.
+func (mb *MessageBus) SetFeedbackHandler(handler FeedbackHandler) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.feedback = handler
+}
+
+// PublishFeedback delivers a feedback event to the registered handler, if any.
+func (mb *MessageBus) PublishFeedback(ev FeedbackEvent) {
+	mb.mu.RLock()
+	handler := mb.feedback
+	mb.mu.RUnlock()
+	if handler == nil {
+		logger.DebugCF("bus", "No feedback handler, event dropped", map[string]interface{}{
+			"channel":  ev.Channel,
+			"reaction": ev.Reaction,
+		})
+		return
+	}
+	handler(ev)
+}
+
 // Drain discards remaining messages from both channels before closing.
 // Call this during graceful shutdown to unblock any goroutines waiting to send.
 func (mb *MessageBus) Drain() {
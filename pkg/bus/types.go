@@ -15,6 +15,67 @@ type OutboundMessage struct {
 	ChatID  string   `json:"chat_id"`
 	Content string   `json:"content"`
 	Media   []string `json:"media,omitempty"`
+
+	// Rich fields. Channels declare which of these they render natively and
+	// the channel manager degrades the rest to plain content before Send.
+	Attachments []Attachment `json:"attachments,omitempty"`
+	ReplyTo     string       `json:"reply_to,omitempty"`  // platform message ID to reply to
+	Actions     []Action     `json:"actions,omitempty"`   // inline buttons under the message
+	EditID      string       `json:"edit_id,omitempty"`   // replace this sent message's content instead of sending
+	DeleteID    string       `json:"delete_id,omitempty"` // delete this sent message; Content is ignored
+	Speech      *Speech      `json:"speech,omitempty"`    // speak Content as a voice note where the channel can
+}
+
+// Speech asks for a message to be spoken. Empty fields use the configured
+// voice.
+type Speech struct {
+	Voice    string `json:"voice,omitempty"`
+	Language string `json:"language,omitempty"`
+}
+
+// Attachment is a file sent with a message. Path is a local file or URL;
+// Filename and MIMEType are derived from it when empty.
+type Attachment struct {
+	Path     string `json:"path"`
+	Filename string `json:"filename,omitempty"`
+	MIMEType string `json:"mime_type,omitempty"`
+	Caption  string `json:"caption,omitempty"`
+	Voice    bool   `json:"voice,omitempty"` // audio to play as a voice note rather than a file
+}
+
+// Action is an inline button. Buttons with a URL open a link; the others
+// report Data back to the bot when pressed.
+type Action struct {
+	Label string `json:"label"`
+	Data  string `json:"data,omitempty"`
+	URL   string `json:"url,omitempty"`
+}
+
+// MetadataPassive marks an inbound message that should only be recorded in
+// its session as context, without the agent replying.
+const MetadataPassive = "passive"
+
+// MetadataVoice marks an inbound message that came as a voice note or
+// audio, which is answered in kind.
+const MetadataVoice = "voice"
+
+// LastSentID can be used as EditID or DeleteID to target the most recent
+// message the bot sent to the chat.
+const LastSentID = "last"
+
+// FeedbackEvent is a user's reaction to one of the assistant's messages.
+type FeedbackEvent struct {
+	Channel    string `json:"channel"`
+	ChatID     string `json:"chat_id"`
+	SenderID   string `json:"sender_id"`
+	MessageID  string `json:"message_id"`
+	SessionKey string `json:"session_key"`
+	Reaction   string `json:"reaction"`
+	Score      int    `json:"score"`             // +1 positive, -1 negative
+	Content    string `json:"content,omitempty"` // preview of the message reacted to
+	Timestamp  int64  `json:"timestamp"`
 }
 
 type MessageHandler func(InboundMessage) error
+
+type FeedbackHandler func(FeedbackEvent)
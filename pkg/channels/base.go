@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
 )
 
 type Channel interface {
@@ -24,6 +26,28 @@ type BaseChannel struct {
 	running   atomic.Bool
 	name      string
 	allowList []string
+	sent      *sentLog
+	groups    groupState
+	access    AccessPolicy
+	limiter   RateLimiter
+	inbound   atomic.Int64 // unix nanoseconds of the last message received
+}
+
+// AccessPolicy is the central, role-based view of who may use the bot,
+// shared by all channels.
+type AccessPolicy interface {
+	// Allows reports whether a sender has been granted access even if the
+	// channel's own allow list doesn't name them.
+	Allows(channel, senderID string) bool
+	// AllowsCommand reports whether a sender may use a slash command.
+	AllowsCommand(channel, senderID, command string) bool
+}
+
+// RateLimiter throttles inbound messages before they reach the agent.
+type RateLimiter interface {
+	// Admit reports whether a message may go to the agent. When it may not,
+	// reply is a notice for the sender, or "" if they were told recently.
+	Admit(channel, senderID, chatID string) (ok bool, reply string)
 }
 
 func NewBaseChannel(name string, config interface{}, bus *bus.MessageBus, allowList []string) *BaseChannel {
@@ -32,6 +56,7 @@ func NewBaseChannel(name string, config interface{}, bus *bus.MessageBus, allowL
 		bus:       bus,
 		name:      name,
 		allowList: allowList,
+		sent:      newSentLog(),
 	}
 }
 
@@ -44,10 +69,43 @@ func (c *BaseChannel) IsRunning() bool {
 }
 
 func (c *BaseChannel) IsAllowed(senderID string) bool {
-	if len(c.allowList) == 0 {
+	if len(c.allowList) == 0 || allowListMatch(c.allowList, senderID) {
 		return true
 	}
+	return c.access != nil && c.access.Allows(c.name, senderID)
+}
+
+// SetAccessPolicy installs the central access policy.
+func (c *BaseChannel) SetAccessPolicy(access AccessPolicy) {
+	c.access = access
+}
+
+// LastInbound returns when the channel last received a message, or the
+// zero time if it hasn't yet.
+func (c *BaseChannel) LastInbound() time.Time {
+	if ns := c.inbound.Load(); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
 
+func (c *BaseChannel) markInbound() {
+	c.inbound.Store(time.Now().UnixNano())
+}
+
+// SetRateLimiter installs the inbound rate limiter.
+func (c *BaseChannel) SetRateLimiter(limiter RateLimiter) {
+	c.limiter = limiter
+}
+
+// AllowsCommand reports whether a sender may use a slash command. Without
+// a central access policy every allowed sender may.
+func (c *BaseChannel) AllowsCommand(senderID, command string) bool {
+	return c.access == nil || c.access.AllowsCommand(c.name, senderID, command)
+}
+
+// allowListMatch reports whether senderID matches an entry of allowList.
+func allowListMatch(allowList []string, senderID string) bool {
 	// Extract parts from compound senderID like "123456|username"
 	idPart := senderID
 	userPart := ""
@@ -56,7 +114,7 @@ func (c *BaseChannel) IsAllowed(senderID string) bool {
 		userPart = senderID[idx+1:]
 	}
 
-	for _, allowed := range c.allowList {
+	for _, allowed := range allowList {
 		// Strip leading "@" from allowed value for username matching
 		trimmed := strings.TrimPrefix(allowed, "@")
 		allowedID := trimmed
@@ -114,10 +172,24 @@ func (c *BaseChannel) RemoveFromAllowList(id string) bool {
 }
 
 func (c *BaseChannel) HandleMessage(senderID, chatID, content string, media []string, metadata map[string]string) {
-	if !c.IsAllowed(senderID) {
+	c.markInbound()
+	if !c.IsAllowed(senderID) && !c.IsAllowedChat(chatID) {
 		return
 	}
 
+	if c.limiter != nil {
+		if ok, reply := c.limiter.Admit(c.name, senderID, chatID); !ok {
+			logger.InfoCF(c.name, "Message throttled", map[string]interface{}{
+				"sender_id": senderID,
+				"chat_id":   chatID,
+			})
+			if reply != "" {
+				c.bus.PublishOutbound(bus.OutboundMessage{Channel: c.name, ChatID: chatID, Content: reply})
+			}
+			return
+		}
+	}
+
 	// Build session key: channel:chatID
 	sessionKey := fmt.Sprintf("%s:%s", c.name, chatID)
 
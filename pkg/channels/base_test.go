@@ -1,6 +1,12 @@
 package channels
 
-import "testing"
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
 
 func TestBaseChannelIsAllowed(t *testing.T) {
 	tests := []struct {
@@ -50,3 +56,65 @@ func TestBaseChannelIsAllowed(t *testing.T) {
 		})
 	}
 }
+
+type testAccessPolicy map[string]bool
+
+func (p testAccessPolicy) Allows(channel, senderID string) bool {
+	return p[channel+":"+senderID]
+}
+
+func (p testAccessPolicy) AllowsCommand(channel, senderID, command string) bool {
+	return p[channel+":"+senderID+" "+command]
+}
+
+func TestBaseChannelAccessPolicy(t *testing.T) {
+	ch := NewBaseChannel("test", nil, nil, []string{"123456"})
+	if !ch.AllowsCommand("654321", "/model") {
+		t.Fatal("without a policy every allowed sender may use commands")
+	}
+
+	ch.SetAccessPolicy(testAccessPolicy{"test:654321": true, "test:123456 /model": true})
+	if !ch.IsAllowed("654321") {
+		t.Error("sender granted by the policy was denied")
+	}
+	if !ch.IsAllowed("123456") || ch.IsAllowed("111111") {
+		t.Error("allow list no longer applies")
+	}
+	if !ch.AllowsCommand("123456", "/model") || ch.AllowsCommand("654321", "/model") {
+		t.Error("command permissions not taken from the policy")
+	}
+}
+
+type testRateLimiter struct{ admitted int }
+
+func (l *testRateLimiter) Admit(channel, senderID, chatID string) (bool, string) {
+	if l.admitted > 0 {
+		return false, "slow down"
+	}
+	l.admitted++
+	return true, ""
+}
+
+func TestBaseChannelRateLimiter(t *testing.T) {
+	mb := bus.NewMessageBus()
+	ch := NewBaseChannel("test", nil, mb, nil)
+	ch.SetRateLimiter(&testRateLimiter{})
+
+	ch.HandleMessage("u1", "c1", "one", nil, nil)
+	ch.HandleMessage("u1", "c1", "two", nil, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if msg, ok := mb.ConsumeInbound(ctx); !ok || msg.Content != "one" {
+		t.Fatalf("first message = %+v, %v", msg, ok)
+	}
+	if out, ok := mb.SubscribeOutbound(ctx); !ok || out.Content != "slow down" || out.ChatID != "c1" {
+		t.Errorf("throttling reply = %+v, %v", out, ok)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if msg, ok := mb.ConsumeInbound(ctx); ok {
+		t.Errorf("throttled message reached the agent: %+v", msg)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
@@ -17,6 +18,7 @@ import (
 const (
 	transcriptionTimeout = 30 * time.Second
 	sendTimeout          = 10 * time.Second
+	staleHeartbeat       = 3 * time.Minute // Discord asks for a heartbeat every ~40s
 )
 
 type DiscordChannel struct {
@@ -25,6 +27,7 @@ type DiscordChannel struct {
 	config      config.DiscordConfig
 	transcriber *voice.GroqTranscriber
 	ctx         context.Context
+	handlers    []func() // removes the session handlers added by Start
 }
 
 func NewDiscordChannel(cfg config.DiscordConfig, bus *bus.MessageBus) (*DiscordChannel, error) {
@@ -34,6 +37,8 @@ func NewDiscordChannel(cfg config.DiscordConfig, bus *bus.MessageBus) (*DiscordC
 	}
 
 	base := NewBaseChannel("discord", cfg, bus, cfg.AllowFrom)
+	// Discord answered every server message before group policies existed
+	base.SetGroupPolicy(cfg.Groups, config.GroupPolicyConfig{Trigger: []string{GroupTriggerAlways}})
 
 	return &DiscordChannel{
 		BaseChannel: base,
@@ -59,7 +64,11 @@ func (c *DiscordChannel) Start(ctx context.Context) error {
 	logger.InfoC("discord", "Starting Discord bot")
 
 	c.ctx = ctx
-	c.session.AddHandler(c.handleMessage)
+	c.handlers = append(c.handlers,
+		c.session.AddHandler(c.handleMessage),
+		c.session.AddHandler(c.handleReactionAdd),
+		c.session.AddHandler(c.handleInteraction),
+	)
 
 	if err := c.session.Open(); err != nil {
 		return fmt.Errorf("failed to open discord session: %w", err)
@@ -82,6 +91,10 @@ func (c *DiscordChannel) Start(ctx context.Context) error {
 func (c *DiscordChannel) Stop(ctx context.Context) error {
 	logger.InfoC("discord", "Stopping Discord bot")
 	c.setRunning(false)
+	for _, remove := range c.handlers {
+		remove()
+	}
+	c.handlers = nil
 
 	if err := c.session.Close(); err != nil {
 		return fmt.Errorf("failed to close discord session: %w", err)
@@ -90,6 +103,22 @@ func (c *DiscordChannel) Stop(ctx context.Context) error {
 	return nil
 }
 
+// HealthCheck reports whether the gateway connection is up. discordgo
+// reconnects by itself; this catches the times it gives up.
+func (c *DiscordChannel) HealthCheck(ctx context.Context) error {
+	c.session.RLock()
+	ready, lastAck := c.session.DataReady, c.session.LastHeartbeatAck
+	c.session.RUnlock()
+
+	if !ready {
+		return fmt.Errorf("discord gateway not connected")
+	}
+	if !lastAck.IsZero() && time.Since(lastAck) > staleHeartbeat {
+		return fmt.Errorf("no discord heartbeat since %s", lastAck.Format(time.RFC3339))
+	}
+	return nil
+}
+
 func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	if !c.IsRunning() {
 		return fmt.Errorf("discord bot not running")
@@ -100,16 +129,13 @@ func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 		return fmt.Errorf("channel ID is empty")
 	}
 
-	message := msg.Content
-
 	// 使用传入的 ctx 进行超时控制
 	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
 	defer cancel()
 
 	done := make(chan error, 1)
 	go func() {
-		_, err := c.session.ChannelMessageSend(channelID, message)
-		done <- err
+		done <- c.deliver(channelID, msg)
 	}()
 
 	select {
@@ -124,6 +150,90 @@ func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 }
 
 // appendContent 安全地追加内容到现有文本
+// Capabilities reports that Discord renders every rich outbound field.
+func (c *DiscordChannel) Capabilities() Capabilities {
+	return Capabilities{Attachments: true, Replies: true, Actions: true, Edit: true, Delete: true, Voice: true}
+}
+
+// deliver performs the send, edit or delete msg asks for.
+func (c *DiscordChannel) deliver(channelID string, msg bus.OutboundMessage) error {
+	if msg.DeleteID != "" {
+		return c.session.ChannelMessageDelete(channelID, c.resolveSentID(channelID, msg.DeleteID))
+	}
+
+	components := discordActionComponents(msg.Actions)
+	if msg.EditID != "" {
+		id := c.resolveSentID(channelID, msg.EditID)
+		content := msg.Content
+		edit := &discordgo.MessageEdit{ID: id, Channel: channelID, Content: &content}
+		if components != nil {
+			edit.Components = &components
+		}
+		if _, err := c.session.ChannelMessageEditComplex(edit); err != nil {
+			return err
+		}
+		c.RecordSent(channelID, id, content)
+		return nil
+	}
+
+	send := &discordgo.MessageSend{Content: msg.Content, Components: components}
+	if msg.ReplyTo != "" {
+		send.Reference = &discordgo.MessageReference{MessageID: msg.ReplyTo, ChannelID: channelID}
+	}
+	for _, a := range msg.Attachments {
+		if a.Caption != "" {
+			send.Content = appendContent(send.Content, a.Caption)
+		}
+		// Discord unfurls links itself, so remote files aren't re-uploaded
+		if isRemoteMedia(a.Path) {
+			send.Content = appendContent(send.Content, a.Path)
+			continue
+		}
+		f, err := os.Open(a.Path)
+		if err != nil {
+			return fmt.Errorf("failed to open attachment: %w", err)
+		}
+		defer f.Close()
+		filename, mimeType := attachmentInfo(a)
+		send.Files = append(send.Files, &discordgo.File{Name: filename, ContentType: mimeType, Reader: f})
+	}
+
+	sent, err := c.session.ChannelMessageSendComplex(channelID, send)
+	if err != nil {
+		return err
+	}
+	c.RecordSent(channelID, sent.ID, send.Content)
+	return nil
+}
+
+// discordActionComponents lays buttons out in rows of five, the most Discord
+// allows per row. Clicks carry the prefixed action Data as custom ID.
+func discordActionComponents(actions []bus.Action) []discordgo.MessageComponent {
+	var rows []discordgo.MessageComponent
+	var row discordgo.ActionsRow
+	for _, a := range actions {
+		button := discordgo.Button{Label: a.Label, Style: discordgo.PrimaryButton}
+		if a.URL != "" {
+			button.Style = discordgo.LinkButton
+			button.URL = a.URL
+		} else {
+			button.CustomID = actionDataPrefix + a.Data
+			if len(button.CustomID) > 100 {
+				button.CustomID = button.CustomID[:100]
+			}
+		}
+		row.Components = append(row.Components, button)
+		if len(row.Components) == 5 {
+			rows = append(rows, row)
+			row = discordgo.ActionsRow{}
+		}
+	}
+	if len(row.Components) > 0 {
+		rows = append(rows, row)
+	}
+	return rows
+}
+
 func appendContent(content, suffix string) string {
 	if content == "" {
 		return suffix
@@ -140,27 +250,48 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 		return
 	}
 
-	if err := c.session.ChannelTyping(m.ChannelID); err != nil {
-		logger.ErrorCF("discord", "Failed to send typing indicator", map[string]any{
-			"error": err.Error(),
-		})
+	senderID := m.Author.ID
+	senderName := m.Author.Username
+	if m.Author.Discriminator != "" && m.Author.Discriminator != "0" {
+		senderName += "#" + m.Author.Discriminator
 	}
 
-	// 检查白名单，避免为被拒绝的用户下载附件和转录
-	if !c.IsAllowed(m.Author.ID) {
+	content := m.Content
+	if m.GuildID != "" {
+		botID := s.State.User.ID
+		mentioned := false
+		for _, u := range m.Mentions {
+			if u.ID == botID {
+				mentioned = true
+			}
+		}
+		content = strings.TrimSpace(strings.NewReplacer("<@"+botID+">", "", "<@!"+botID+">", "").Replace(content))
+		repliedToBot := m.ReferencedMessage != nil && m.ReferencedMessage.Author != nil && m.ReferencedMessage.Author.ID == botID
+		text, reply := c.GroupReply(GroupMessage{
+			SenderID:   senderID,
+			SenderName: senderName,
+			ChatID:     m.ChannelID,
+			Content:    content,
+			Mentioned:  mentioned,
+			ReplyToBot: repliedToBot,
+		})
+		if !reply {
+			return
+		}
+		content = text
+	} else if !c.IsAllowed(m.Author.ID) {
+		// 检查白名单，避免为被拒绝的用户下载附件和转录
 		logger.DebugCF("discord", "Message rejected by allowlist", map[string]any{
 			"user_id": m.Author.ID,
 		})
 		return
 	}
 
-	senderID := m.Author.ID
-	senderName := m.Author.Username
-	if m.Author.Discriminator != "" && m.Author.Discriminator != "0" {
-		senderName += "#" + m.Author.Discriminator
+	if err := c.session.ChannelTyping(m.ChannelID); err != nil {
+		logger.ErrorCF("discord", "Failed to send typing indicator", map[string]any{
+			"error": err.Error(),
+		})
 	}
-
-	content := m.Content
 	mediaPaths := make([]string, 0, len(m.Attachments))
 	localFiles := make([]string, 0, len(m.Attachments))
 
@@ -176,8 +307,10 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 		}
 	}()
 
+	hasAudio := false
 	for _, attachment := range m.Attachments {
 		isAudio := utils.IsAudioFile(attachment.Filename, attachment.ContentType)
+		hasAudio = hasAudio || isAudio
 
 		if isAudio {
 			localPath := c.downloadAttachment(attachment.URL, attachment.Filename)
@@ -242,11 +375,71 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 		"guild_id":     m.GuildID,
 		"channel_id":   m.ChannelID,
 		"is_dm":        fmt.Sprintf("%t", m.GuildID == ""),
+		"peer_kind":    peerKind(m.GuildID != ""),
+	}
+	if hasAudio {
+		metadata[bus.MetadataVoice] = "true"
 	}
 
 	c.HandleMessage(senderID, m.ChannelID, content, mediaPaths, metadata)
 }
 
+// handleReactionAdd records reactions to the bot's messages as feedback.
+func (c *DiscordChannel) handleReactionAdd(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	if r == nil || r.MessageReaction == nil {
+		return
+	}
+	if s.State != nil && s.State.User != nil && r.UserID == s.State.User.ID {
+		return
+	}
+	c.HandleReaction(r.UserID, r.ChannelID, r.MessageID, r.Emoji.Name, false)
+}
+
+// handleInteraction routes presses on our buttons to the agent and strips
+// the buttons from the message so the same choice can't be made twice.
+func (c *DiscordChannel) handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionMessageComponent || i.Message == nil {
+		return
+	}
+	user := i.User
+	if i.Member != nil && i.Member.User != nil {
+		user = i.Member.User
+	}
+	if user == nil || !c.IsAllowed(user.ID) {
+		return
+	}
+
+	customID := i.MessageComponentData().CustomID
+	var label string
+	for _, component := range i.Message.Components {
+		if row, ok := component.(*discordgo.ActionsRow); ok {
+			for _, rc := range row.Components {
+				if button, ok := rc.(*discordgo.Button); ok && button.CustomID == customID {
+					label = button.Label
+				}
+			}
+		}
+	}
+
+	handled := c.HandleAction(user.ID, i.ChannelID, i.Message.ID, customID, label, map[string]string{
+		"user_id":  user.ID,
+		"username": user.Username,
+	})
+	if !handled {
+		return
+	}
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate}); err != nil {
+		logger.ErrorCF("discord", "Failed to acknowledge button press", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:         i.Message.ID,
+		Channel:    i.ChannelID,
+		Components: &[]discordgo.MessageComponent{},
+	})
+}
+
 func (c *DiscordChannel) downloadAttachment(url, filename string) string {
 	return utils.DownloadFile(url, filename, utils.DownloadOptions{
 		LoggerPrefix: "discord",
@@ -0,0 +1,789 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	// emailIdleTimeout re-issues IDLE well before the 29 minute server limit.
+	emailIdleTimeout = 10 * time.Minute
+	// maxEmailThreads bounds the in-memory thread table.
+	maxEmailThreads = 1000
+)
+
+// EmailChannel receives mail over IMAP (IDLE, or polling when unsupported)
+// and replies in-thread over SMTP.
+//
+// Chat IDs have the form "address:thread", where thread is a short hash of
+// the thread's root Message-ID, so every email thread gets its own session.
+// A bare address as chat ID starts a new thread.
+type EmailChannel struct {
+	*BaseChannel
+	config  config.EmailConfig
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	imap    *imapClient
+	threads map[string]*emailThread // chatID -> thread
+	order   []string
+	roots   map[string]string // known Message-ID -> thread root
+}
+
+// emailThread holds what a reply needs to land in the right thread.
+type emailThread struct {
+	to         string
+	subject    string
+	lastID     string
+	references []string
+}
+
+// emailMessage is a parsed inbound email.
+type emailMessage struct {
+	from        string
+	subject     string
+	messageID   string
+	inReplyTo   string
+	references  []string
+	autoReply   bool
+	text        string
+	attachments []emailAttachment
+}
+
+type emailAttachment struct {
+	filename string
+	data     []byte
+}
+
+// NewEmailChannel creates a new email channel instance.
+func NewEmailChannel(cfg config.EmailConfig, messageBus *bus.MessageBus) (*EmailChannel, error) {
+	if cfg.IMAPHost == "" || cfg.SMTPHost == "" || cfg.Username == "" {
+		return nil, fmt.Errorf("email imap_host, smtp_host and username are required")
+	}
+	if cfg.Mailbox == "" {
+		cfg.Mailbox = "INBOX"
+	}
+	if cfg.From == "" {
+		cfg.From = cfg.Username
+	}
+	if cfg.SMTPUsername == "" {
+		cfg.SMTPUsername = cfg.Username
+		cfg.SMTPPassword = cfg.Password
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 60
+	}
+
+	base := NewBaseChannel("email", cfg, messageBus, cfg.AllowFrom)
+
+	return &EmailChannel{
+		BaseChannel: base,
+		config:      cfg,
+		threads:     make(map[string]*emailThread),
+		roots:       make(map[string]string),
+	}, nil
+}
+
+// Start launches the mailbox watcher.
+func (c *EmailChannel) Start(ctx context.Context) error {
+	logger.InfoC("email", "Starting email channel")
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	c.setRunning(true)
+	go c.watch()
+
+	logger.InfoCF("email", "Email channel started", map[string]interface{}{
+		"imap":    fmt.Sprintf("%s:%d", c.config.IMAPHost, c.config.IMAPPort),
+		"mailbox": c.config.Mailbox,
+	})
+	return nil
+}
+
+// Stop ends the watcher and closes the IMAP connection.
+func (c *EmailChannel) Stop(ctx context.Context) error {
+	logger.InfoC("email", "Stopping email channel")
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.mu.Lock()
+	if c.imap != nil {
+		c.imap.conn.Close()
+	}
+	c.mu.Unlock()
+	c.setRunning(false)
+	return nil
+}
+
+// Send replies to the thread identified by msg.ChatID.
+func (c *EmailChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("email channel not running")
+	}
+
+	to, _, _ := strings.Cut(msg.ChatID, ":")
+	if _, err := mail.ParseAddress(to); err != nil {
+		return fmt.Errorf("invalid email recipient %q: %w", to, err)
+	}
+
+	c.mu.Lock()
+	thread := c.threads[msg.ChatID]
+	var t emailThread
+	if thread != nil {
+		t = *thread
+		t.references = append([]string(nil), thread.references...)
+	}
+	c.mu.Unlock()
+
+	subject := "PicoClaw"
+	if t.subject != "" {
+		subject = t.subject
+		if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+			subject = "Re: " + subject
+		}
+	}
+
+	messageID := c.newMessageID()
+	raw, err := buildEmail(c.config.From, to, subject, messageID, t.lastID, t.references, msg.Content, msg.Media)
+	if err != nil {
+		return fmt.Errorf("failed to build email: %w", err)
+	}
+	if err := c.sendMail(to, raw); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	if thread != nil {
+		c.mu.Lock()
+		thread.lastID = messageID
+		thread.references = append(thread.references, messageID)
+		if len(t.references) > 0 {
+			c.roots[messageID] = t.references[0]
+		}
+		c.mu.Unlock()
+	}
+
+	logger.DebugCF("email", "Email sent", map[string]interface{}{
+		"to":      to,
+		"subject": subject,
+	})
+	return nil
+}
+
+func (c *EmailChannel) watch() {
+	backoff := 5 * time.Second
+	maxBackoff := 5 * time.Minute
+
+	for c.ctx.Err() == nil {
+		err := c.session()
+		if c.ctx.Err() != nil {
+			return
+		}
+		logger.WarnCF("email", "IMAP session ended, reconnecting", map[string]interface{}{
+			"error":   fmt.Sprintf("%v", err),
+			"backoff": backoff.String(),
+		})
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// session runs one IMAP connection: fetch unread mail, then wait with IDLE
+// (or sleep when the server lacks it) and repeat.
+func (c *EmailChannel) session() error {
+	client, err := dialIMAP(c.config.IMAPHost, c.config.IMAPPort, c.config.IMAPTLS)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.imap = client
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.imap = nil
+		c.mu.Unlock()
+		client.logout()
+	}()
+
+	if err := client.login(c.config.Username, c.config.Password); err != nil {
+		return err
+	}
+	if err := client.selectMailbox(c.config.Mailbox); err != nil {
+		return err
+	}
+
+	useIdle := client.caps["IDLE"]
+	if !useIdle {
+		logger.InfoC("email", "IMAP server lacks IDLE, polling instead")
+	}
+	poll := time.Duration(c.config.PollInterval) * time.Second
+
+	for c.ctx.Err() == nil {
+		if err := c.fetchUnseen(client); err != nil {
+			return err
+		}
+
+		if useIdle {
+			if _, err := client.idle(emailIdleTimeout); err != nil {
+				if c.ctx.Err() != nil {
+					return nil
+				}
+				logger.WarnCF("email", "IDLE failed, falling back to polling", map[string]interface{}{
+					"error": err.Error(),
+				})
+				return err
+			}
+			continue
+		}
+
+		select {
+		case <-c.ctx.Done():
+			return nil
+		case <-time.After(poll):
+		}
+	}
+	return nil
+}
+
+func (c *EmailChannel) fetchUnseen(client *imapClient) error {
+	uids, err := client.searchUnseen()
+	if err != nil {
+		return err
+	}
+	for _, uid := range uids {
+		raw, err := client.fetch(uid)
+		if err != nil {
+			return err
+		}
+		// Mark first so a message that breaks processing isn't retried forever
+		if err := client.markSeen(uid); err != nil {
+			return err
+		}
+		c.processEmail(raw)
+	}
+	return nil
+}
+
+func (c *EmailChannel) processEmail(raw []byte) {
+	msg, err := parseEmail(raw)
+	if err != nil {
+		logger.WarnCF("email", "Failed to parse email", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if msg.autoReply || strings.EqualFold(msg.from, c.config.From) {
+		return
+	}
+	if !c.IsAllowed(msg.from) {
+		logger.DebugCF("email", "Email rejected by allowlist", map[string]interface{}{
+			"from": msg.from,
+		})
+		return
+	}
+
+	chatID := c.trackThread(msg)
+
+	var mediaPaths []string
+	localFiles := []string{}
+	defer func() {
+		for _, file := range localFiles {
+			if err := os.Remove(file); err != nil {
+				logger.DebugCF("email", "Failed to cleanup temp file", map[string]interface{}{
+					"file":  file,
+					"error": err.Error(),
+				})
+			}
+		}
+	}()
+
+	content := msg.text
+	for _, att := range msg.attachments {
+		localPath, err := saveAttachment(att)
+		if err != nil {
+			logger.WarnCF("email", "Failed to save attachment", map[string]interface{}{
+				"filename": att.filename,
+				"error":    err.Error(),
+			})
+			continue
+		}
+		localFiles = append(localFiles, localPath)
+		mediaPaths = append(mediaPaths, localPath)
+		content = appendContent(content, fmt.Sprintf("[attachment: %s]", att.filename))
+	}
+
+	if strings.TrimSpace(content) == "" {
+		return
+	}
+	if msg.subject != "" {
+		content = fmt.Sprintf("Subject: %s\n\n%s", msg.subject, content)
+	}
+
+	metadata := map[string]string{
+		"platform":   "email",
+		"message_id": msg.messageID,
+		"subject":    msg.subject,
+		"from":       msg.from,
+	}
+
+	logger.DebugCF("email", "Received email", map[string]interface{}{
+		"from":    msg.from,
+		"chat_id": chatID,
+		"preview": utils.Truncate(content, 50),
+	})
+
+	c.HandleMessage(msg.from, chatID, content, mediaPaths, metadata)
+}
+
+// trackThread records the message in its thread and returns the chat ID.
+func (c *EmailChannel) trackThread(msg *emailMessage) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	root := ""
+	if len(msg.references) > 0 {
+		root = msg.references[0]
+	} else if msg.inReplyTo != "" {
+		root = msg.inReplyTo
+	}
+	if known, ok := c.roots[root]; ok {
+		root = known
+	}
+	if root == "" {
+		root = msg.messageID
+	}
+	if msg.messageID != "" {
+		c.roots[msg.messageID] = root
+	}
+
+	chatID := msg.from + ":" + threadKey(root)
+
+	refs := msg.references
+	if len(refs) == 0 && msg.inReplyTo != "" {
+		refs = []string{msg.inReplyTo}
+	}
+	if msg.messageID != "" {
+		refs = append(append([]string(nil), refs...), msg.messageID)
+	}
+
+	thread, exists := c.threads[chatID]
+	if !exists {
+		thread = &emailThread{to: msg.from}
+		c.threads[chatID] = thread
+		c.order = append(c.order, chatID)
+		for len(c.order) > maxEmailThreads {
+			delete(c.threads, c.order[0])
+			c.order = c.order[1:]
+		}
+	}
+	thread.subject = msg.subject
+	thread.lastID = msg.messageID
+	thread.references = refs
+
+	return chatID
+}
+
+// threadKey shortens a Message-ID into a filesystem-safe session suffix.
+func threadKey(messageID string) string {
+	if messageID == "" {
+		return "new"
+	}
+	sum := sha1.Sum([]byte(messageID))
+	return hex.EncodeToString(sum[:6])
+}
+
+func (c *EmailChannel) newMessageID() string {
+	domain := "picoclaw.local"
+	if _, d, ok := strings.Cut(c.config.From, "@"); ok && d != "" {
+		domain = strings.Trim(d, "> ")
+	}
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(buf), domain)
+}
+
+// sendMail delivers raw over SMTP: implicit TLS on port 465, STARTTLS when
+// the server offers it otherwise.
+func (c *EmailChannel) sendMail(to string, raw []byte) error {
+	host := c.config.SMTPHost
+	addr := net.JoinHostPort(host, strconv.Itoa(c.config.SMTPPort))
+	tlsConfig := &tls.Config{ServerName: host}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	if c.config.SMTPPort == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && c.config.SMTPPort != 465 {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if ok, _ := client.Extension("AUTH"); ok && c.config.SMTPPassword != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.config.SMTPUsername, c.config.SMTPPassword, host)); err != nil {
+			return err
+		}
+	}
+
+	from := c.config.From
+	if addr, err := mail.ParseAddress(from); err == nil {
+		from = addr.Address
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildEmail renders a UTF-8 text email, with attachments as multipart/mixed.
+func buildEmail(from, to, subject, messageID, inReplyTo string, references []string, body string, attachments []string) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(k, v string) { fmt.Fprintf(&buf, "%s: %s\r\n", k, v) }
+
+	header("From", from)
+	header("To", to)
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID)
+	if inReplyTo != "" {
+		header("In-Reply-To", inReplyTo)
+	}
+	if len(references) > 0 {
+		header("References", strings.Join(references, " "))
+	}
+	header("Auto-Submitted", "auto-replied")
+	header("MIME-Version", "1.0")
+
+	if len(attachments) == 0 {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, body); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	buf.WriteString("\r\n")
+
+	textPart, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeQuotedPrintable(textPart, body); err != nil {
+		return nil, err
+	}
+
+	for _, path := range attachments {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Base(path)
+		contentType := mime.TypeByExtension(filepath.Ext(name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": name})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(data)
+		for len(encoded) > 76 {
+			io.WriteString(part, encoded[:76]+"\r\n")
+			encoded = encoded[76:]
+		}
+		io.WriteString(part, encoded+"\r\n")
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qp, strings.ReplaceAll(body, "\n", "\r\n")); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+var wordDecoder = &mime.WordDecoder{}
+
+// parseEmail extracts sender, threading headers, text and attachments.
+func parseEmail(raw []byte) (*emailMessage, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := mail.ParseAddress(m.Header.Get("From"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid From header: %w", err)
+	}
+
+	subject, err := wordDecoder.DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		subject = m.Header.Get("Subject")
+	}
+
+	msg := &emailMessage{
+		from:       strings.ToLower(from.Address),
+		subject:    strings.TrimSpace(subject),
+		messageID:  strings.TrimSpace(m.Header.Get("Message-ID")),
+		inReplyTo:  firstMessageID(m.Header.Get("In-Reply-To")),
+		references: messageIDs(m.Header.Get("References")),
+	}
+	if auto := strings.ToLower(m.Header.Get("Auto-Submitted")); auto != "" && auto != "no" {
+		msg.autoReply = true
+	}
+
+	var plain, html string
+	if err := walkPart(textproto.MIMEHeader(m.Header), m.Body, msg, &plain, &html); err != nil {
+		return nil, err
+	}
+	if plain == "" && html != "" {
+		plain = htmlToText(html)
+	}
+	msg.text = stripQuotedReply(plain)
+	return msg, nil
+}
+
+// walkPart descends into multipart bodies, keeping the first text/plain and
+// text/html parts and collecting attachments.
+func walkPart(header textproto.MIMEHeader, body io.Reader, msg *emailMessage, plain, html *string) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+		params = map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := walkPart(part.Header, part, msg, plain, html); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(decodeTransfer(header.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return err
+	}
+
+	disposition, dispParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := dispParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	if filename != "" {
+		if decoded, err := wordDecoder.DecodeHeader(filename); err == nil {
+			filename = decoded
+		}
+	}
+
+	switch {
+	case disposition == "attachment" || (filename != "" && !strings.HasPrefix(mediaType, "text/")):
+		if filename == "" {
+			filename = "attachment"
+		}
+		msg.attachments = append(msg.attachments, emailAttachment{filename: filename, data: data})
+	case mediaType == "text/plain" && *plain == "":
+		*plain = decodeCharset(data, params["charset"])
+	case mediaType == "text/html" && *html == "":
+		*html = decodeCharset(data, params["charset"])
+	}
+	return nil
+}
+
+func decodeTransfer(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// newlineStripper drops CR/LF so base64 bodies wrapped at 76 columns decode.
+type newlineStripper struct{ r io.Reader }
+
+func (n *newlineStripper) Read(p []byte) (int, error) {
+	for {
+		cnt, err := n.r.Read(p)
+		out := 0
+		for _, b := range p[:cnt] {
+			if b != '\r' && b != '\n' {
+				p[out] = b
+				out++
+			}
+		}
+		if out > 0 || err != nil {
+			return out, err
+		}
+	}
+}
+
+// decodeCharset converts Latin-1 style bodies to UTF-8; others pass through.
+func decodeCharset(data []byte, charset string) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "iso-8859-15", "windows-1252":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+	return string(data)
+}
+
+var (
+	htmlBreakRe = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>`)
+	htmlTagRe   = regexp.MustCompile(`(?s)<[^>]*>`)
+	htmlStyleRe = regexp.MustCompile(`(?is)<(style|script)[^>]*>.*?</(style|script)>`)
+	blankRunRe  = regexp.MustCompile(`\n{3,}`)
+	// Reply headers such as "On Mon, Jan 1, Alice wrote:" or "El lun, Alice escribió:"
+	replyHeaderRe = regexp.MustCompile(`(?i)^(on|el)\s.+(wrote|escribió):\s*$`)
+)
+
+func htmlToText(html string) string {
+	text := htmlStyleRe.ReplaceAllString(html, "")
+	text = htmlBreakRe.ReplaceAllString(text, "\n")
+	text = htmlTagRe.ReplaceAllString(text, "")
+	text = strings.NewReplacer("&nbsp;", " ", "&amp;", "&", "&lt;", "<", "&gt;", ">", "&quot;", `"`, "&#39;", "'").Replace(text)
+	return strings.TrimSpace(blankRunRe.ReplaceAllString(text, "\n\n"))
+}
+
+// stripQuotedReply drops the quoted previous message that clients append
+// below a reply, since the thread history already lives in the session.
+func stripQuotedReply(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if replyHeaderRe.MatchString(trimmed) || trimmed == "-----Original Message-----" {
+			lines = lines[:i]
+			break
+		}
+	}
+	// Trailing "> ..." block
+	end := len(lines)
+	for end > 0 {
+		trimmed := strings.TrimSpace(lines[end-1])
+		if trimmed != "" && !strings.HasPrefix(trimmed, ">") {
+			break
+		}
+		end--
+	}
+	return strings.TrimSpace(strings.Join(lines[:end], "\n"))
+}
+
+func firstMessageID(header string) string {
+	ids := messageIDs(header)
+	if len(ids) == 0 {
+		return ""
+	}
+	return ids[0]
+}
+
+func messageIDs(header string) []string {
+	var ids []string
+	for _, field := range strings.Fields(header) {
+		if strings.HasPrefix(field, "<") && strings.HasSuffix(field, ">") {
+			ids = append(ids, field)
+		}
+	}
+	return ids
+}
+
+func saveAttachment(att emailAttachment) (string, error) {
+	mediaDir := filepath.Join(os.TempDir(), "picoclaw_media")
+	if err := os.MkdirAll(mediaDir, 0700); err != nil {
+		return "", err
+	}
+	localPath := filepath.Join(mediaDir, uuid.New().String()[:8]+"_"+utils.SanitizeFilename(att.filename))
+	if err := os.WriteFile(localPath, att.data, 0600); err != nil {
+		return "", err
+	}
+	return localPath, nil
+}
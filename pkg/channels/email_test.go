@@ -0,0 +1,282 @@
+package channels
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+const testMultipartEmail = "From: Alice <Alice@example.org>\r\n" +
+	"To: picoclaw@example.org\r\n" +
+	"Subject: =?utf-8?q?Informe_de_ma=C3=B1ana?=\r\n" +
+	"Message-ID: <m2@example.org>\r\n" +
+	"In-Reply-To: <m1@example.org>\r\n" +
+	"References: <root@example.org> <m1@example.org>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=XYZ\r\n" +
+	"\r\n" +
+	"--XYZ\r\n" +
+	"Content-Type: multipart/alternative; boundary=ALT\r\n" +
+	"\r\n" +
+	"--ALT\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Please summarize the attached caf=C3=A9 menu.\r\n" +
+	"\r\n" +
+	"On Mon, Jan 5, 2026 at 10:00 PicoClaw wrote:\r\n" +
+	"> Earlier reply\r\n" +
+	"--ALT\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<p>Please summarize</p>\r\n" +
+	"--ALT--\r\n" +
+	"--XYZ\r\n" +
+	"Content-Type: text/csv; name=\"menu.csv\"\r\n" +
+	"Content-Disposition: attachment; filename=\"menu.csv\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"aXRlbSxwcmljZQpjYWZlLDIK\r\n" +
+	"--XYZ--\r\n"
+
+func TestParseEmail(t *testing.T) {
+	msg, err := parseEmail([]byte(testMultipartEmail))
+	if err != nil {
+		t.Fatalf("parseEmail failed: %v", err)
+	}
+	if msg.from != "alice@example.org" {
+		t.Errorf("from = %q", msg.from)
+	}
+	if msg.subject != "Informe de mañana" {
+		t.Errorf("subject = %q", msg.subject)
+	}
+	if msg.text != "Please summarize the attached café menu." {
+		t.Errorf("text = %q", msg.text)
+	}
+	if len(msg.references) != 2 || msg.references[0] != "<root@example.org>" || msg.inReplyTo != "<m1@example.org>" {
+		t.Errorf("unexpected threading headers: %v %q", msg.references, msg.inReplyTo)
+	}
+	if len(msg.attachments) != 1 || msg.attachments[0].filename != "menu.csv" ||
+		string(msg.attachments[0].data) != "item,price\ncafe,2\n" {
+		t.Errorf("unexpected attachments: %+v", msg.attachments)
+	}
+}
+
+func TestParseEmailHTMLOnly(t *testing.T) {
+	raw := "From: bob@example.org\r\nSubject: hi\r\nContent-Type: text/html\r\n\r\n<style>p{}</style><p>Hello &amp; welcome</p><br>Bye"
+	msg, err := parseEmail([]byte(raw))
+	if err != nil {
+		t.Fatalf("parseEmail failed: %v", err)
+	}
+	if msg.text != "Hello & welcome\n\nBye" {
+		t.Errorf("text = %q", msg.text)
+	}
+}
+
+func TestEmailThreadTracking(t *testing.T) {
+	ch, err := NewEmailChannel(config.EmailConfig{IMAPHost: "imap", SMTPHost: "smtp", Username: "bot@example.org"}, bus.NewMessageBus())
+	if err != nil {
+		t.Fatalf("NewEmailChannel failed: %v", err)
+	}
+
+	first := ch.trackThread(&emailMessage{from: "alice@example.org", subject: "Plan", messageID: "<a@x>"})
+	// Our reply's Message-ID is all some clients put in In-Reply-To
+	ch.roots["<reply@bot>"] = "<a@x>"
+	second := ch.trackThread(&emailMessage{from: "alice@example.org", subject: "Re: Plan", messageID: "<b@x>", inReplyTo: "<reply@bot>"})
+	third := ch.trackThread(&emailMessage{from: "alice@example.org", subject: "Re: Plan", messageID: "<c@x>", references: []string{"<a@x>", "<b@x>"}})
+	other := ch.trackThread(&emailMessage{from: "alice@example.org", subject: "Other", messageID: "<d@x>"})
+
+	if first != second || second != third {
+		t.Errorf("replies should share a chat ID: %s %s %s", first, second, third)
+	}
+	if first == other {
+		t.Error("a new thread should get its own chat ID")
+	}
+	if !strings.HasPrefix(first, "alice@example.org:") {
+		t.Errorf("chat ID should start with the sender address: %s", first)
+	}
+	if th := ch.threads[third]; th.lastID != "<c@x>" || len(th.references) != 3 {
+		t.Errorf("unexpected thread state: %+v", th)
+	}
+}
+
+// fakeIMAPServer serves a single message over a plain connection without IDLE.
+func fakeIMAPServer(ln net.Listener, message string, seen chan string) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprint(conn, "* OK fake IMAP ready\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		tag, cmd, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch {
+		case cmd == "CAPABILITY":
+			fmt.Fprint(conn, "* CAPABILITY IMAP4rev1\r\n")
+		case strings.HasPrefix(cmd, "LOGIN "):
+			if cmd != `LOGIN "bot@example.org" "secret"` {
+				fmt.Fprintf(conn, "%s NO bad credentials\r\n", tag)
+				continue
+			}
+		case strings.HasPrefix(cmd, "SELECT "):
+			fmt.Fprint(conn, "* 1 EXISTS\r\n")
+		case cmd == "UID SEARCH UNSEEN":
+			select {
+			case <-seen:
+				fmt.Fprint(conn, "* SEARCH\r\n")
+			default:
+				fmt.Fprint(conn, "* SEARCH 7\r\n")
+			}
+		case cmd == "UID FETCH 7 BODY.PEEK[]":
+			fmt.Fprintf(conn, "* 1 FETCH (UID 7 BODY[] {%d}\r\n%s)\r\n", len(message), message)
+		case strings.HasPrefix(cmd, "UID STORE 7 +FLAGS.SILENT"):
+			seen <- "7"
+		case cmd == "LOGOUT":
+			fmt.Fprint(conn, "* BYE\r\n")
+			fmt.Fprintf(conn, "%s OK\r\n", tag)
+			return
+		}
+		fmt.Fprintf(conn, "%s OK done\r\n", tag)
+	}
+}
+
+// fakeSMTPServer accepts one message and hands its DATA to received.
+func fakeSMTPServer(ln net.Listener, received chan<- string) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprint(conn, "220 fake ESMTP\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			fmt.Fprint(conn, "250 fake\r\n")
+		case strings.HasPrefix(cmd, "DATA"):
+			fmt.Fprint(conn, "354 go ahead\r\n")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil || l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			received <- data.String()
+			fmt.Fprint(conn, "250 queued\r\n")
+		case strings.HasPrefix(cmd, "QUIT"):
+			fmt.Fprint(conn, "221 bye\r\n")
+			return
+		default:
+			fmt.Fprint(conn, "250 ok\r\n")
+		}
+	}
+}
+
+func listenLocal(t *testing.T) (net.Listener, int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return ln, p
+}
+
+func TestEmailChannelRoundTrip(t *testing.T) {
+	imapLn, imapPort := listenLocal(t)
+	defer imapLn.Close()
+	smtpLn, smtpPort := listenLocal(t)
+	defer smtpLn.Close()
+
+	seen := make(chan string, 1)
+	received := make(chan string, 1)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); fakeIMAPServer(imapLn, testMultipartEmail, seen) }()
+	go func() { defer wg.Done(); fakeSMTPServer(smtpLn, received) }()
+
+	msgBus := bus.NewMessageBus()
+	ch, err := NewEmailChannel(config.EmailConfig{
+		IMAPHost:  "127.0.0.1",
+		IMAPPort:  imapPort,
+		Username:  "bot@example.org",
+		Password:  "secret",
+		SMTPHost:  "127.0.0.1",
+		SMTPPort:  smtpPort,
+		AllowFrom: config.FlexibleStringSlice{"alice@example.org"},
+	}, msgBus)
+	if err != nil {
+		t.Fatalf("NewEmailChannel failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ch.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("expected an inbound email")
+	}
+	if msg.SenderID != "alice@example.org" || msg.SessionKey != "email:"+msg.ChatID {
+		t.Errorf("unexpected sender/session: %s %s", msg.SenderID, msg.SessionKey)
+	}
+	if !strings.HasPrefix(msg.Content, "Subject: Informe de mañana\n\nPlease summarize") ||
+		!strings.Contains(msg.Content, "[attachment: menu.csv]") {
+		t.Errorf("unexpected content: %q", msg.Content)
+	}
+	if len(msg.Media) != 1 {
+		t.Errorf("expected the attachment in Media, got %v", msg.Media)
+	}
+
+	if err := ch.Send(ctx, bus.OutboundMessage{Channel: "email", ChatID: msg.ChatID, Content: "Here is the summary."}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	select {
+	case data := <-received:
+		for _, want := range []string{
+			"To: alice@example.org",
+			"In-Reply-To: <m2@example.org>",
+			"References: <root@example.org> <m1@example.org> <m2@example.org>",
+			"Here is the summary.",
+		} {
+			if !strings.Contains(data, want) {
+				t.Errorf("sent email missing %q:\n%s", want, data)
+			}
+		}
+		if !strings.Contains(data, "Subject: =?utf-8?q?Re:_Informe_de_ma=C3=B1ana?=") {
+			t.Errorf("reply subject not encoded as expected:\n%s", data)
+		}
+	case <-ctx.Done():
+		t.Fatal("no email delivered over SMTP")
+	}
+
+	ch.Stop(context.Background())
+	imapLn.Close()
+	smtpLn.Close()
+	wg.Wait()
+}
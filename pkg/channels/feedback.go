@@ -0,0 +1,145 @@
+package channels
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// maxTrackedMessages bounds how many sent messages per channel can receive feedback.
+const maxTrackedMessages = 500
+
+// sentMessage remembers an outbound message so reactions to it can be tied back.
+type sentMessage struct {
+	chatID  string
+	content string
+}
+
+// sentLog is a bounded, insertion-ordered record of messages the bot sent.
+type sentLog struct {
+	mu    sync.Mutex
+	order []string
+	items map[string]sentMessage
+}
+
+func newSentLog() *sentLog {
+	return &sentLog{items: make(map[string]sentMessage)}
+}
+
+func (l *sentLog) add(messageID string, msg sentMessage) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, exists := l.items[messageID]; !exists {
+		l.order = append(l.order, messageID)
+	}
+	l.items[messageID] = msg
+	for len(l.order) > maxTrackedMessages {
+		delete(l.items, l.order[0])
+		l.order = l.order[1:]
+	}
+}
+
+func (l *sentLog) get(messageID string) (sentMessage, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	msg, ok := l.items[messageID]
+	return msg, ok
+}
+
+// last returns the newest message ID recorded for chatID, or "".
+func (l *sentLog) last(chatID string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := len(l.order) - 1; i >= 0; i-- {
+		if l.items[l.order[i]].chatID == chatID {
+			return l.order[i]
+		}
+	}
+	return ""
+}
+
+// RecordSent remembers a message the bot sent so reactions to it count as feedback.
+func (c *BaseChannel) RecordSent(chatID, messageID, content string) {
+	if messageID == "" {
+		return
+	}
+	c.sent.add(messageID, sentMessage{chatID: chatID, content: utils.Truncate(content, 200)})
+}
+
+// HandleReaction turns a reaction on one of the bot's messages into a feedback
+// event. Reactions to messages this channel didn't record as sent are ignored,
+// unless botMessage is set by a platform that reports message authorship.
+// Only allowed senders count, even in an allowed group chat. The session key
+// is the chat's; the agent moves it to the person's session where needed.
+func (c *BaseChannel) HandleReaction(senderID, chatID, messageID, reaction string, botMessage bool) {
+	if !c.IsAllowed(senderID) {
+		return
+	}
+	score := ReactionScore(reaction)
+	if score == 0 {
+		return
+	}
+
+	sent, tracked := c.sent.get(messageID)
+	if !tracked && !botMessage {
+		return
+	}
+	if tracked && sent.chatID != "" {
+		chatID = sent.chatID
+	}
+
+	logger.InfoCF(c.name, "Feedback reaction received", map[string]interface{}{
+		"sender_id":  senderID,
+		"chat_id":    chatID,
+		"message_id": messageID,
+		"reaction":   reaction,
+		"score":      score,
+	})
+
+	c.bus.PublishFeedback(bus.FeedbackEvent{
+		Channel:    c.name,
+		ChatID:     chatID,
+		SenderID:   senderID,
+		MessageID:  messageID,
+		SessionKey: fmt.Sprintf("%s:%s", c.name, chatID),
+		Reaction:   reaction,
+		Score:      score,
+		Content:    sent.content,
+		Timestamp:  time.Now().Unix(),
+	})
+}
+
+// reactionScores maps emoji and Slack reaction names to feedback scores.
+// Reactions not listed (e.g. 👀, 🤔) are neutral and ignored.
+var reactionScores = map[string]int{
+	// Positive
+	"👍": 1, "❤": 1, "🔥": 1, "🥰": 1, "👏": 1, "🎉": 1, "🤩": 1, "😍": 1, "💯": 1,
+	"🏆": 1, "👌": 1, "🙏": 1, "😁": 1, "🤣": 1, "⚡": 1, "✅": 1, "⭐": 1, "🙌": 1, "💪": 1,
+	"+1": 1, "thumbsup": 1, "heart": 1, "fire": 1, "clap": 1, "tada": 1, "star-struck": 1,
+	"heart_eyes": 1, "100": 1, "trophy": 1, "ok_hand": 1, "pray": 1, "white_check_mark": 1,
+	"heavy_check_mark": 1, "star": 1, "raised_hands": 1, "muscle": 1, "grinning": 1, "joy": 1,
+	// Negative
+	"👎": -1, "💩": -1, "🤮": -1, "🤬": -1, "😡": -1, "💔": -1, "🤨": -1, "😐": -1, "🥱": -1,
+	"🤡": -1, "😢": -1, "😭": -1, "❌": -1,
+	"-1": -1, "thumbsdown": -1, "poop": -1, "hankey": -1, "nauseated_face": -1, "rage": -1,
+	"broken_heart": -1, "face_with_raised_eyebrow": -1, "neutral_face": -1, "yawning_face": -1,
+	"clown_face": -1, "cry": -1, "sob": -1, "x": -1, "disappointed": -1, "confused": -1,
+}
+
+// ReactionScore returns +1 for positive reactions, -1 for negative ones and 0
+// for anything else. Skin tones and emoji variation selectors are ignored.
+func ReactionScore(reaction string) int {
+	r := strings.TrimSpace(reaction)
+	if idx := strings.Index(r, "::"); idx > 0 {
+		r = r[:idx] // Slack skin tone suffix: "+1::skin-tone-2"
+	}
+	r = strings.Trim(r, ":")
+	r = strings.NewReplacer("\uFE0F", "", "\U0001F3FB", "", "\U0001F3FC", "", "\U0001F3FD", "",
+		"\U0001F3FE", "", "\U0001F3FF", "").Replace(r)
+	return reactionScores[r]
+}
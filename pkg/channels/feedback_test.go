@@ -0,0 +1,56 @@
+package channels
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestReactionScore(t *testing.T) {
+	tests := []struct {
+		reaction string
+		want     int
+	}{
+		{"👍", 1},
+		{"👍🏽", 1},
+		{"❤️", 1},
+		{"+1::skin-tone-3", 1},
+		{":thumbsup:", 1},
+		{"👎", -1},
+		{"-1", -1},
+		{"👀", 0},
+		{"thinking_face", 0},
+	}
+	for _, tt := range tests {
+		if got := ReactionScore(tt.reaction); got != tt.want {
+			t.Errorf("ReactionScore(%q) = %d, want %d", tt.reaction, got, tt.want)
+		}
+	}
+}
+
+func TestHandleReaction(t *testing.T) {
+	mb := bus.NewMessageBus()
+	var events []bus.FeedbackEvent
+	mb.SetFeedbackHandler(func(ev bus.FeedbackEvent) { events = append(events, ev) })
+
+	ch := NewBaseChannel("test", nil, mb, []string{"42", "group-1"})
+	ch.RecordSent("chat-1", "m1", "Roma fue fundada en el 753 a.C.")
+	ch.RecordSent("group-1", "g1", "Hola a todos")
+
+	ch.HandleReaction("42", "chat-1", "m1", "👍", false)
+	ch.HandleReaction("42", "chat-1", "unknown", "👍", false) // not our message
+	ch.HandleReaction("99", "chat-1", "m1", "👎", false)      // not allowed
+	ch.HandleReaction("42", "chat-1", "m1", "👀", false)      // neutral
+	ch.HandleReaction("42", "chat-1", "m2", "👎", true)       // platform says it's ours
+	ch.HandleReaction("99", "group-1", "g1", "👍", false)     // allowed chat, but not sender
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 feedback events, got %d: %+v", len(events), events)
+	}
+	if ev := events[0]; ev.Score != 1 || ev.SessionKey != "test:chat-1" || ev.Content == "" {
+		t.Errorf("unexpected first event: %+v", ev)
+	}
+	if ev := events[1]; ev.Score != -1 || ev.MessageID != "m2" {
+		t.Errorf("unexpected second event: %+v", ev)
+	}
+}
@@ -0,0 +1,206 @@
+package channels
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Group triggers, see config.GroupPolicyConfig.Trigger.
+const (
+	GroupTriggerMention = "mention"
+	GroupTriggerReply   = "reply"
+	GroupTriggerPrefix  = "prefix"
+	GroupTriggerAlways  = "always"
+)
+
+// defaultGroupTriggers answers whenever the bot is explicitly addressed.
+var defaultGroupTriggers = []string{GroupTriggerMention, GroupTriggerReply, GroupTriggerPrefix}
+
+// GroupMessage is a group-chat message as seen by the group policy.
+type GroupMessage struct {
+	SenderID   string
+	SenderName string // shown to the agent for passively recorded messages
+	ChatID     string // session chat ID
+	GroupID    string // key for overrides, allow lists and cooldowns; ChatID when empty
+	Content    string // with any bot mention already stripped
+	Mentioned  bool   // the bot was @mentioned
+	ReplyToBot bool   // a reply to, or thread follow-up on, one of the bot's messages
+}
+
+// groupState holds a channel's group policy and reply cooldowns.
+type groupState struct {
+	mu        sync.Mutex
+	cfg       config.GroupsConfig
+	lastReply map[string]time.Time
+}
+
+// SetGroupPolicy installs the channel's group-chat policy. defaults carries
+// what the channel did before group policies existed (its require_mention
+// or group_trigger_prefix options); anything set in groups takes precedence.
+func (c *BaseChannel) SetGroupPolicy(groups config.GroupsConfig, defaults config.GroupPolicyConfig) {
+	groups.GroupPolicyConfig = mergeGroupPolicy(defaults, groups.GroupPolicyConfig)
+	c.groups.mu.Lock()
+	c.groups.cfg = groups
+	c.groups.lastReply = make(map[string]time.Time)
+	c.groups.mu.Unlock()
+}
+
+// GroupPolicy returns the effective policy for a group.
+func (c *BaseChannel) GroupPolicy(groupID string) config.GroupPolicyConfig {
+	c.groups.mu.Lock()
+	defer c.groups.mu.Unlock()
+	policy := c.groups.cfg.GroupPolicyConfig
+	if override, ok := c.groups.cfg.Overrides[groupID]; ok {
+		policy = mergeGroupPolicy(policy, override)
+	}
+	if len(policy.Trigger) == 0 {
+		policy.Trigger = defaultGroupTriggers
+	}
+	return policy
+}
+
+// GroupReply applies the group policy to m. It returns the content to hand
+// to the agent (with a matched trigger prefix stripped) and true when the
+// bot should answer. Otherwise the message is recorded as passive context
+// if the policy asks for it, and the channel should drop it.
+//
+// A group message is considered at all when its sender or the group itself
+// is in the channel's allow list.
+func (c *BaseChannel) GroupReply(m GroupMessage) (string, bool) {
+	c.markInbound()
+	groupID := m.GroupID
+	if groupID == "" {
+		groupID = m.ChatID
+	}
+	if !c.IsAllowed(m.SenderID) && !c.IsAllowedChat(groupID) {
+		return "", false
+	}
+
+	policy := c.GroupPolicy(groupID)
+	content, triggered := groupTriggered(policy, m)
+	if triggered && len(policy.AllowFrom) > 0 && !allowListMatch(policy.AllowFrom, m.SenderID) {
+		triggered = false
+	}
+	if triggered && policy.Cooldown > 0 && !c.takeGroupTurn(groupID, time.Duration(policy.Cooldown)*time.Second) {
+		logger.DebugCF(c.name, "Group reply skipped during cooldown", map[string]interface{}{
+			"group_id": groupID,
+		})
+		triggered = false
+	}
+	if triggered {
+		return content, true
+	}
+
+	if policy.Passive != nil && *policy.Passive && strings.TrimSpace(m.Content) != "" {
+		c.recordPassive(m)
+	}
+	return "", false
+}
+
+// groupTriggered checks m against the policy's triggers.
+func groupTriggered(policy config.GroupPolicyConfig, m GroupMessage) (string, bool) {
+	content := strings.TrimSpace(m.Content)
+	stripped, hasPrefix := content, false
+	for _, prefix := range policy.Prefixes {
+		if prefix != "" && strings.HasPrefix(content, prefix) {
+			stripped, hasPrefix = strings.TrimSpace(strings.TrimPrefix(content, prefix)), true
+			break
+		}
+	}
+
+	for _, trigger := range policy.Trigger {
+		switch trigger {
+		case GroupTriggerAlways:
+			return stripped, true
+		case GroupTriggerMention:
+			if m.Mentioned {
+				return stripped, true
+			}
+		case GroupTriggerReply:
+			if m.ReplyToBot {
+				return stripped, true
+			}
+		case GroupTriggerPrefix:
+			if hasPrefix {
+				return stripped, true
+			}
+		}
+	}
+	return content, false
+}
+
+// takeGroupTurn reports whether the group is out of its cooldown and, if
+// so, starts a new one.
+func (c *BaseChannel) takeGroupTurn(groupID string, cooldown time.Duration) bool {
+	c.groups.mu.Lock()
+	defer c.groups.mu.Unlock()
+	if c.groups.lastReply == nil {
+		c.groups.lastReply = make(map[string]time.Time)
+	}
+	if last, ok := c.groups.lastReply[groupID]; ok && time.Since(last) < cooldown {
+		return false
+	}
+	c.groups.lastReply[groupID] = time.Now()
+	return true
+}
+
+// recordPassive hands a group message to the agent as context only: it is
+// added to the session without producing a reply.
+func (c *BaseChannel) recordPassive(m GroupMessage) {
+	name := m.SenderName
+	if name == "" {
+		name = m.SenderID
+	}
+	c.bus.PublishInbound(bus.InboundMessage{
+		Channel:    c.name,
+		SenderID:   m.SenderID,
+		ChatID:     m.ChatID,
+		Content:    fmt.Sprintf("[%s]: %s", name, strings.TrimSpace(m.Content)),
+		SessionKey: fmt.Sprintf("%s:%s", c.name, m.ChatID),
+		Metadata:   map[string]string{bus.MetadataPassive: "true"},
+	})
+}
+
+// peerKind is the "peer_kind" metadata value for a direct or group chat.
+func peerKind(isGroup bool) string {
+	if isGroup {
+		return "group"
+	}
+	return "direct"
+}
+
+// requireMentionPolicy maps the older require_mention and
+// group_trigger_prefix options onto a group policy.
+func requireMentionPolicy(requireMention bool, prefixes []string) config.GroupPolicyConfig {
+	policy := config.GroupPolicyConfig{Prefixes: prefixes}
+	if !requireMention {
+		policy.Trigger = []string{GroupTriggerAlways}
+	}
+	return policy
+}
+
+// mergeGroupPolicy returns base with the fields set in override replacing it.
+func mergeGroupPolicy(base, override config.GroupPolicyConfig) config.GroupPolicyConfig {
+	if len(override.Trigger) > 0 {
+		base.Trigger = override.Trigger
+	}
+	if len(override.Prefixes) > 0 {
+		base.Prefixes = override.Prefixes
+	}
+	if len(override.AllowFrom) > 0 {
+		base.AllowFrom = override.AllowFrom
+	}
+	if override.Cooldown > 0 {
+		base.Cooldown = override.Cooldown
+	}
+	if override.Passive != nil {
+		base.Passive = override.Passive
+	}
+	return base
+}
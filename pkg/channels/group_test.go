@@ -0,0 +1,120 @@
+package channels
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestGroupReplyTriggers(t *testing.T) {
+	ch := NewBaseChannel("test", nil, bus.NewMessageBus(), nil)
+	ch.SetGroupPolicy(config.GroupsConfig{}, config.GroupPolicyConfig{Prefixes: []string{"/ask"}})
+
+	tests := []struct {
+		name  string
+		msg   GroupMessage
+		reply bool
+		want  string
+	}{
+		{"plain", GroupMessage{Content: "hello all"}, false, ""},
+		{"mention", GroupMessage{Content: "what time is it", Mentioned: true}, true, "what time is it"},
+		{"reply", GroupMessage{Content: "and tomorrow?", ReplyToBot: true}, true, "and tomorrow?"},
+		{"prefix", GroupMessage{Content: "/ask weather in Oslo"}, true, "weather in Oslo"},
+	}
+	for _, tt := range tests {
+		tt.msg.SenderID, tt.msg.ChatID = "u1", "g1"
+		got, reply := ch.GroupReply(tt.msg)
+		if reply != tt.reply || got != tt.want {
+			t.Errorf("%s: got (%q, %v), want (%q, %v)", tt.name, got, reply, tt.want, tt.reply)
+		}
+	}
+}
+
+func TestGroupReplyOverrides(t *testing.T) {
+	ch := NewBaseChannel("test", nil, bus.NewMessageBus(), nil)
+	ch.SetGroupPolicy(config.GroupsConfig{
+		GroupPolicyConfig: config.GroupPolicyConfig{Trigger: []string{GroupTriggerMention}},
+		Overrides: map[string]config.GroupPolicyConfig{
+			"family": {Trigger: []string{GroupTriggerAlways}},
+			"work":   {AllowFrom: config.FlexibleStringSlice{"alice"}},
+		},
+	}, config.GroupPolicyConfig{Trigger: []string{GroupTriggerAlways}})
+
+	if _, reply := ch.GroupReply(GroupMessage{SenderID: "u1", ChatID: "other", Content: "hi"}); reply {
+		t.Error("configured trigger should replace the channel default")
+	}
+	if _, reply := ch.GroupReply(GroupMessage{SenderID: "u1", ChatID: "family", Content: "hi"}); !reply {
+		t.Error("override should answer everything in its group")
+	}
+	if _, reply := ch.GroupReply(GroupMessage{SenderID: "1|bob", ChatID: "work", Content: "hi", Mentioned: true}); reply {
+		t.Error("sender outside the group allow list was answered")
+	}
+	if _, reply := ch.GroupReply(GroupMessage{SenderID: "2|alice", ChatID: "work", Content: "hi", Mentioned: true}); !reply {
+		t.Error("sender in the group allow list was ignored")
+	}
+}
+
+func TestGroupReplyAllowedChat(t *testing.T) {
+	ch := NewBaseChannel("test", nil, bus.NewMessageBus(), []string{"alice"})
+	ch.SetGroupPolicy(config.GroupsConfig{}, config.GroupPolicyConfig{Trigger: []string{GroupTriggerAlways}})
+
+	if _, reply := ch.GroupReply(GroupMessage{SenderID: "bob", ChatID: "g1", Content: "hi"}); reply {
+		t.Error("sender outside the channel allow list was answered")
+	}
+	ch.AddToAllowList("g1")
+	if _, reply := ch.GroupReply(GroupMessage{SenderID: "bob", ChatID: "g1", Content: "hi"}); !reply {
+		t.Error("allowed group should admit every member")
+	}
+}
+
+func TestGroupReplyCooldown(t *testing.T) {
+	ch := NewBaseChannel("test", nil, bus.NewMessageBus(), nil)
+	ch.SetGroupPolicy(config.GroupsConfig{
+		GroupPolicyConfig: config.GroupPolicyConfig{Trigger: []string{GroupTriggerAlways}, Cooldown: 60},
+	}, config.GroupPolicyConfig{})
+
+	if _, reply := ch.GroupReply(GroupMessage{SenderID: "u1", ChatID: "g1", Content: "one"}); !reply {
+		t.Fatal("first message should be answered")
+	}
+	if _, reply := ch.GroupReply(GroupMessage{SenderID: "u2", ChatID: "g1", Content: "two"}); reply {
+		t.Error("second message answered during cooldown")
+	}
+	if _, reply := ch.GroupReply(GroupMessage{SenderID: "u2", ChatID: "g2", Content: "two"}); !reply {
+		t.Error("cooldown leaked into another group")
+	}
+}
+
+func TestGroupReplyPassive(t *testing.T) {
+	mb := bus.NewMessageBus()
+	passive := true
+	ch := NewBaseChannel("test", nil, mb, nil)
+	ch.SetGroupPolicy(config.GroupsConfig{
+		GroupPolicyConfig: config.GroupPolicyConfig{Passive: &passive},
+	}, config.GroupPolicyConfig{})
+
+	if _, reply := ch.GroupReply(GroupMessage{SenderID: "u1", SenderName: "Alice", ChatID: "g1", Content: "lunch at noon"}); reply {
+		t.Fatal("untriggered message was answered")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := mb.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("passive message not recorded")
+	}
+	if msg.Content != "[Alice]: lunch at noon" || msg.SessionKey != "test:g1" || msg.Metadata[bus.MetadataPassive] != "true" {
+		t.Errorf("message = %+v", msg)
+	}
+
+	if _, reply := ch.GroupReply(GroupMessage{SenderID: "u1", ChatID: "g1", Content: "hi", Mentioned: true}); !reply {
+		t.Error("mention should still be answered")
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if msg, ok := mb.ConsumeInbound(ctx); ok {
+		t.Errorf("answered message also recorded passively: %+v", msg)
+	}
+}
@@ -0,0 +1,249 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Send failures in a row that mark a channel unhealthy even while it
+// reports itself running.
+const maxSendErrors = 3
+
+// HealthChecker is implemented by channels that can tell whether their
+// connection is actually alive, beyond IsRunning.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// AlertFunc tells the owner about a channel that keeps failing, or that has
+// recovered after they were told.
+type AlertFunc func(channel, message string)
+
+// ChannelHealth is a channel's health as tracked by the supervisor.
+type ChannelHealth struct {
+	Running       bool       `json:"running"`
+	Healthy       bool       `json:"healthy"`
+	LastInbound   *time.Time `json:"last_inbound,omitempty"`
+	LastOutbound  *time.Time `json:"last_outbound,omitempty"`
+	LastCheck     *time.Time `json:"last_check,omitempty"`
+	SendErrors    int        `json:"send_errors"`    // in total
+	CheckFailures int        `json:"check_failures"` // in a row
+	Restarts      int        `json:"restarts"`       // in total
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+// channelHealth is the supervisor's bookkeeping for one channel.
+type channelHealth struct {
+	ChannelHealth
+	sendErrorsInRow int
+	failedRestarts  int // since the channel was last healthy
+	backoff         time.Duration
+	nextRestart     time.Time
+	alerted         bool
+}
+
+// SetAlertHandler sets who hears about channels that keep failing.
+func (m *Manager) SetAlertHandler(alert AlertFunc) {
+	m.healthMu.Lock()
+	defer m.healthMu.Unlock()
+	m.alert = alert
+}
+
+// Health returns the health of every channel.
+func (m *Manager) Health() map[string]ChannelHealth {
+	m.mu.RLock()
+	channels := make(map[string]Channel, len(m.channels))
+	for name, channel := range m.channels {
+		channels[name] = channel
+	}
+	m.mu.RUnlock()
+
+	m.healthMu.Lock()
+	defer m.healthMu.Unlock()
+	health := make(map[string]ChannelHealth, len(channels))
+	for name, channel := range channels {
+		h := m.healthLocked(name).ChannelHealth
+		h.Running = channel.IsRunning()
+		if ch, ok := channel.(interface{ LastInbound() time.Time }); ok {
+			if t := ch.LastInbound(); !t.IsZero() {
+				h.LastInbound = &t
+			}
+		}
+		health[name] = h
+	}
+	return health
+}
+
+// healthLocked returns the bookkeeping for a channel. Must be called with
+// healthMu held.
+func (m *Manager) healthLocked(name string) *channelHealth {
+	if m.health == nil {
+		m.health = make(map[string]*channelHealth)
+	}
+	h, ok := m.health[name]
+	if !ok {
+		h = &channelHealth{ChannelHealth: ChannelHealth{Healthy: true}}
+		m.health[name] = h
+	}
+	return h
+}
+
+// recordSend notes the outcome of delivering a message on a channel.
+func (m *Manager) recordSend(name string, err error) {
+	m.healthMu.Lock()
+	defer m.healthMu.Unlock()
+	h := m.healthLocked(name)
+	if err != nil {
+		h.SendErrors++
+		h.sendErrorsInRow++
+		h.LastError = err.Error()
+		return
+	}
+	now := time.Now()
+	h.LastOutbound = &now
+	h.sendErrorsInRow = 0
+}
+
+// supervise checks every channel's health at each interval until ctx is
+// done, restarting the ones that fail.
+func (m *Manager) supervise(ctx context.Context) {
+	interval := time.Duration(m.config.Channels.Supervisor.IntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	logger.InfoCF("channels", "Channel supervisor started", map[string]interface{}{
+		"interval": interval.String(),
+	})
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.checkChannels(ctx, interval)
+		}
+	}
+}
+
+func (m *Manager) checkChannels(ctx context.Context, interval time.Duration) {
+	m.mu.RLock()
+	names := make([]string, 0, len(m.channels))
+	channels := make(map[string]Channel, len(m.channels))
+	for name, channel := range m.channels {
+		names = append(names, name)
+		channels[name] = channel
+	}
+	m.mu.RUnlock()
+
+	sort.Strings(names)
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return
+		}
+		m.checkChannel(ctx, name, channels[name], interval)
+	}
+}
+
+// checkChannel runs one health check. A channel is restarted once it has
+// failed two checks in a row, then again with a doubling backoff for as
+// long as it stays unhealthy.
+func (m *Manager) checkChannel(ctx context.Context, name string, channel Channel, interval time.Duration) {
+	err := checkHealth(ctx, channel)
+	now := time.Now()
+
+	m.healthMu.Lock()
+	h := m.healthLocked(name)
+	h.LastCheck = &now
+	if err == nil && h.sendErrorsInRow >= maxSendErrors {
+		err = fmt.Errorf("%d sends failed in a row: %s", h.sendErrorsInRow, h.LastError)
+	}
+	if err == nil {
+		recovered := h.alerted
+		h.Healthy, h.CheckFailures, h.failedRestarts, h.backoff, h.alerted = true, 0, 0, 0, false
+		alert := m.alert
+		m.healthMu.Unlock()
+		if recovered && alert != nil {
+			alert(name, fmt.Sprintf("The %s channel is working again.", name))
+		}
+		return
+	}
+
+	h.Healthy = false
+	h.CheckFailures++
+	h.LastError = err.Error()
+	if h.CheckFailures < 2 || now.Before(h.nextRestart) {
+		m.healthMu.Unlock()
+		return
+	}
+	m.healthMu.Unlock()
+
+	logger.WarnCF("channels", "Restarting unhealthy channel", map[string]interface{}{
+		"channel": name,
+		"error":   err.Error(),
+	})
+	if stopErr := channel.Stop(ctx); stopErr != nil {
+		logger.DebugCF("channels", "Error stopping channel for restart", map[string]interface{}{
+			"channel": name,
+			"error":   stopErr.Error(),
+		})
+	}
+	startErr := channel.Start(ctx)
+
+	m.healthMu.Lock()
+	h.Restarts++
+	h.sendErrorsInRow = 0
+	if startErr != nil {
+		h.LastError = startErr.Error()
+		logger.ErrorCF("channels", "Channel restart failed", map[string]interface{}{
+			"channel": name,
+			"error":   startErr.Error(),
+		})
+	}
+	h.failedRestarts++
+	h.backoff = nextBackoff(h.backoff, interval, time.Duration(m.config.Channels.Supervisor.MaxBackoffSeconds)*time.Second)
+	h.nextRestart = time.Now().Add(h.backoff)
+
+	var message string
+	alertAfter := m.config.Channels.Supervisor.AlertAfter
+	if alertAfter > 0 && h.failedRestarts >= alertAfter && !h.alerted {
+		h.alerted = true
+		message = fmt.Sprintf("The %s channel keeps failing and has been restarted %d times without recovering. Last error: %s", name, h.failedRestarts, h.LastError)
+	}
+	alert := m.alert
+	m.healthMu.Unlock()
+
+	if message != "" && alert != nil {
+		alert(name, message)
+	}
+}
+
+// checkHealth asks a channel whether it is working.
+func checkHealth(ctx context.Context, channel Channel) error {
+	if !channel.IsRunning() {
+		return errors.New("channel is not running")
+	}
+	if hc, ok := channel.(HealthChecker); ok {
+		return hc.HealthCheck(ctx)
+	}
+	return nil
+}
+
+// nextBackoff doubles the wait between restarts, starting at one check
+// interval and capped at max (if set).
+func nextBackoff(current, interval, max time.Duration) time.Duration {
+	next := 2 * current
+	if next < interval {
+		next = interval
+	}
+	if max > 0 && next > max {
+		next = max
+	}
+	return next
+}
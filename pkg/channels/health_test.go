@@ -0,0 +1,149 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+type flakyChannel struct {
+	*BaseChannel
+	healthErr error
+	startErr  error
+	starts    int
+	stops     int
+}
+
+func (c *flakyChannel) Start(ctx context.Context) error {
+	c.starts++
+	if c.startErr != nil {
+		return c.startErr
+	}
+	c.setRunning(true)
+	return nil
+}
+
+func (c *flakyChannel) Stop(ctx context.Context) error {
+	c.stops++
+	c.setRunning(false)
+	return nil
+}
+
+func (c *flakyChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	return nil
+}
+
+func (c *flakyChannel) HealthCheck(ctx context.Context) error {
+	return c.healthErr
+}
+
+func newSupervisedManager(alertAfter int) (*Manager, *flakyChannel) {
+	ch := &flakyChannel{BaseChannel: NewBaseChannel("flaky", nil, bus.NewMessageBus(), nil)}
+	ch.setRunning(true)
+	m := &Manager{
+		channels: map[string]Channel{"flaky": ch},
+		config: &config.Config{Channels: config.ChannelsConfig{
+			Supervisor: config.SupervisorConfig{Enabled: true, AlertAfter: alertAfter},
+		}},
+	}
+	return m, ch
+}
+
+func TestSupervisorRestartsUnhealthyChannel(t *testing.T) {
+	m, ch := newSupervisedManager(0)
+	ctx := context.Background()
+
+	m.checkChannels(ctx, time.Minute)
+	if h := m.Health()["flaky"]; !h.Healthy || h.LastCheck == nil || ch.starts != 0 {
+		t.Fatalf("healthy channel: health %+v, starts %d", h, ch.starts)
+	}
+
+	ch.healthErr = errors.New("socket closed")
+	m.checkChannels(ctx, time.Minute)
+	if h := m.Health()["flaky"]; h.Healthy || h.CheckFailures != 1 || h.LastError != "socket closed" || ch.starts != 0 {
+		t.Fatalf("restarted after a single failed check: health %+v, starts %d", h, ch.starts)
+	}
+	m.checkChannels(ctx, time.Minute)
+	if ch.stops != 1 || ch.starts != 1 || m.Health()["flaky"].Restarts != 1 {
+		t.Fatalf("channel not restarted: stops %d, starts %d", ch.stops, ch.starts)
+	}
+	m.checkChannels(ctx, time.Minute)
+	if ch.starts != 1 {
+		t.Error("restarted again within the backoff")
+	}
+
+	ch.healthErr = nil
+	m.checkChannels(ctx, time.Minute)
+	if h := m.Health()["flaky"]; !h.Healthy || h.CheckFailures != 0 {
+		t.Errorf("recovered channel still unhealthy: %+v", h)
+	}
+}
+
+func TestSupervisorAlertsOnPersistentFailure(t *testing.T) {
+	m, ch := newSupervisedManager(2)
+	var alerts []string
+	m.SetAlertHandler(func(channel, message string) { alerts = append(alerts, channel+": "+message) })
+	ctx := context.Background()
+
+	ch.setRunning(false)
+	ch.startErr = errors.New("bridge unreachable")
+	for i := 0; i < 6; i++ {
+		m.checkChannels(ctx, time.Minute)
+		m.healthMu.Lock()
+		m.health["flaky"].nextRestart = time.Time{} // skip the backoff
+		m.healthMu.Unlock()
+	}
+	if len(alerts) != 1 || !strings.Contains(alerts[0], "flaky: ") || !strings.Contains(alerts[0], "bridge unreachable") {
+		t.Fatalf("alerts = %v, want one about the failing channel", alerts)
+	}
+
+	ch.startErr = nil
+	m.checkChannels(ctx, time.Minute)
+	m.checkChannels(ctx, time.Minute)
+	if len(alerts) != 2 || !strings.Contains(alerts[1], "working again") {
+		t.Errorf("alerts = %v, want a recovery notice", alerts)
+	}
+}
+
+func TestSupervisorCountsSendErrors(t *testing.T) {
+	m, ch := newSupervisedManager(0)
+	ch.HandleMessage("u1", "c1", "hi", nil, nil)
+	for i := 0; i < maxSendErrors; i++ {
+		m.recordSend("flaky", errors.New("401 unauthorized"))
+	}
+
+	m.checkChannels(context.Background(), time.Minute)
+	h := m.Health()["flaky"]
+	if h.Healthy || h.SendErrors != maxSendErrors || !strings.Contains(h.LastError, "401 unauthorized") {
+		t.Errorf("health = %+v, want unhealthy after repeated send errors", h)
+	}
+	if h.LastInbound == nil || h.LastOutbound != nil {
+		t.Errorf("activity times = %v / %v", h.LastInbound, h.LastOutbound)
+	}
+
+	m.recordSend("flaky", nil)
+	m.checkChannels(context.Background(), time.Minute)
+	if h := m.Health()["flaky"]; !h.Healthy || h.LastOutbound == nil {
+		t.Errorf("health after a successful send = %+v", h)
+	}
+}
+
+func TestNextBackoff(t *testing.T) {
+	tests := []struct {
+		current, want time.Duration
+	}{
+		{0, time.Minute},
+		{time.Minute, 2 * time.Minute},
+		{4 * time.Minute, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := nextBackoff(tt.current, time.Minute, 5*time.Minute); got != tt.want {
+			t.Errorf("nextBackoff(%s) = %s, want %s", tt.current, got, tt.want)
+		}
+	}
+}
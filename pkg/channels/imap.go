@@ -0,0 +1,283 @@
+package channels
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// imapClient is a minimal IMAP4rev1 client covering what the email channel
+// needs: login, select, search, fetch, flag and IDLE.
+type imapClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+	caps map[string]bool
+}
+
+// imapResponse is one untagged response line with any literals it carried.
+type imapResponse struct {
+	line     string
+	literals [][]byte
+}
+
+// dialIMAP connects and reads the greeting. With useTLS the connection is
+// TLS from the start (port 993); otherwise STARTTLS is used when offered.
+func dialIMAP(host string, port int, useTLS bool) (*imapClient, error) {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if useTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+
+	c := &imapClient{conn: conn, r: bufio.NewReader(conn)}
+	greeting, err := c.readResponse()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read greeting: %w", err)
+	}
+	if !strings.HasPrefix(greeting.line, "* OK") && !strings.HasPrefix(greeting.line, "* PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected greeting: %s", greeting.line)
+	}
+
+	if err := c.capability(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if !useTLS && c.caps["STARTTLS"] {
+		if _, err := c.command("STARTTLS"); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("STARTTLS handshake failed: %w", err)
+		}
+		c.conn = tlsConn
+		c.r = bufio.NewReader(tlsConn)
+		if err := c.capability(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func (c *imapClient) capability() error {
+	resps, err := c.command("CAPABILITY")
+	if err != nil {
+		return err
+	}
+	c.caps = make(map[string]bool)
+	for _, r := range resps {
+		if rest, ok := strings.CutPrefix(r.line, "* CAPABILITY "); ok {
+			for _, capName := range strings.Fields(rest) {
+				c.caps[strings.ToUpper(capName)] = true
+			}
+		}
+	}
+	return nil
+}
+
+func (c *imapClient) login(username, password string) error {
+	_, err := c.command(fmt.Sprintf("LOGIN %s %s", imapQuote(username), imapQuote(password)))
+	if err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+	// Servers may advertise more capabilities (e.g. IDLE) once authenticated
+	return c.capability()
+}
+
+func (c *imapClient) selectMailbox(name string) error {
+	_, err := c.command("SELECT " + imapQuote(name))
+	return err
+}
+
+// searchUnseen returns the UIDs of unread messages.
+func (c *imapClient) searchUnseen() ([]uint32, error) {
+	resps, err := c.command("UID SEARCH UNSEEN")
+	if err != nil {
+		return nil, err
+	}
+	var uids []uint32
+	for _, r := range resps {
+		rest, ok := strings.CutPrefix(r.line, "* SEARCH")
+		if !ok {
+			continue
+		}
+		for _, field := range strings.Fields(rest) {
+			if uid, err := strconv.ParseUint(field, 10, 32); err == nil {
+				uids = append(uids, uint32(uid))
+			}
+		}
+	}
+	return uids, nil
+}
+
+// fetch returns the raw RFC 5322 message without setting \Seen.
+func (c *imapClient) fetch(uid uint32) ([]byte, error) {
+	resps, err := c.command(fmt.Sprintf("UID FETCH %d BODY.PEEK[]", uid))
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range resps {
+		if strings.Contains(r.line, "FETCH") && len(r.literals) > 0 {
+			return r.literals[0], nil
+		}
+	}
+	return nil, fmt.Errorf("message %d not found", uid)
+}
+
+func (c *imapClient) markSeen(uid uint32) error {
+	_, err := c.command(fmt.Sprintf("UID STORE %d +FLAGS.SILENT (\\Seen)", uid))
+	return err
+}
+
+// idle waits up to timeout for the server to report new mail. It returns
+// true when an EXISTS or RECENT update arrived.
+func (c *imapClient) idle(timeout time.Duration) (bool, error) {
+	tag := c.nextTag()
+	if _, err := fmt.Fprintf(c.conn, "%s IDLE\r\n", tag); err != nil {
+		return false, err
+	}
+	first, err := c.readResponse()
+	if err != nil {
+		return false, err
+	}
+	if !strings.HasPrefix(first.line, "+") {
+		return false, fmt.Errorf("IDLE rejected: %s", first.line)
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(timeout))
+	newMail := false
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			c.conn.SetReadDeadline(time.Time{})
+			return false, err
+		}
+		if strings.HasSuffix(resp.line, " EXISTS") || strings.HasSuffix(resp.line, " RECENT") {
+			newMail = true
+			break
+		}
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	defer c.conn.SetReadDeadline(time.Time{})
+	if _, err := io.WriteString(c.conn, "DONE\r\n"); err != nil {
+		return false, err
+	}
+	if _, err := c.readUntilTagged(tag); err != nil {
+		return false, err
+	}
+	return newMail, nil
+}
+
+func (c *imapClient) logout() {
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	c.command("LOGOUT")
+	c.conn.Close()
+}
+
+func (c *imapClient) nextTag() string {
+	c.tag++
+	return fmt.Sprintf("a%d", c.tag)
+}
+
+// command sends a tagged command and returns its untagged responses.
+func (c *imapClient) command(cmd string) ([]imapResponse, error) {
+	tag := c.nextTag()
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, cmd); err != nil {
+		return nil, err
+	}
+	return c.readUntilTagged(tag)
+}
+
+func (c *imapClient) readUntilTagged(tag string) ([]imapResponse, error) {
+	var untagged []imapResponse
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		status, ok := strings.CutPrefix(resp.line, tag+" ")
+		if !ok {
+			untagged = append(untagged, resp)
+			continue
+		}
+		if strings.HasPrefix(strings.ToUpper(status), "OK") {
+			return untagged, nil
+		}
+		return nil, fmt.Errorf("imap: %s", status)
+	}
+}
+
+// readResponse reads one logical response line, collecting {n} literals.
+func (c *imapClient) readResponse() (imapResponse, error) {
+	var resp imapResponse
+	var sb strings.Builder
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return resp, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		sb.WriteString(line)
+
+		size, ok := literalSize(line)
+		if !ok {
+			break
+		}
+		lit := make([]byte, size)
+		if _, err := io.ReadFull(c.r, lit); err != nil {
+			return resp, err
+		}
+		resp.literals = append(resp.literals, lit)
+	}
+	resp.line = sb.String()
+	return resp, nil
+}
+
+// literalSize parses a trailing "{123}" literal marker.
+func literalSize(line string) (int, bool) {
+	if !strings.HasSuffix(line, "}") {
+		return 0, false
+	}
+	open := strings.LastIndex(line, "{")
+	if open < 0 {
+		return 0, false
+	}
+	size, err := strconv.Atoi(strings.TrimSuffix(line[open+1:len(line)-1], "+"))
+	if err != nil {
+		return 0, false
+	}
+	return size, true
+}
+
+func imapQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,541 @@
+package channels
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	// Payload budget per PRIVMSG; the 512-byte line limit also has to fit
+	// the server-added prefix and the target.
+	ircMaxLineBytes = 400
+	ircFloodBurst   = 4
+	ircQueueSize    = 500
+)
+
+// IRCChannel connects to an IRC server with optional TLS and SASL PLAIN.
+// In channels it answers when its nick is mentioned or a trigger prefix is
+// used; private messages always reach the agent.
+type IRCChannel struct {
+	*BaseChannel
+	config config.IRCConfig
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu   sync.Mutex
+	conn net.Conn
+	nick string // current nick, may differ from config after a collision
+
+	writeMu sync.Mutex
+	queue   chan ircLine
+}
+
+type ircLine struct {
+	target string
+	text   string
+}
+
+// ircMessage is a parsed protocol line.
+type ircMessage struct {
+	Prefix  string
+	Command string
+	Params  []string
+}
+
+func (m ircMessage) nick() string {
+	nick, _, _ := strings.Cut(m.Prefix, "!")
+	return nick
+}
+
+func (m ircMessage) trailing() string {
+	if len(m.Params) == 0 {
+		return ""
+	}
+	return m.Params[len(m.Params)-1]
+}
+
+func parseIRCLine(line string) ircMessage {
+	var msg ircMessage
+	if strings.HasPrefix(line, "@") { // IRCv3 tags are not used
+		if _, rest, ok := strings.Cut(line, " "); ok {
+			line = rest
+		}
+	}
+	if strings.HasPrefix(line, ":") {
+		msg.Prefix, line, _ = strings.Cut(line[1:], " ")
+	}
+	for line != "" {
+		if strings.HasPrefix(line, ":") {
+			msg.Params = append(msg.Params, line[1:])
+			break
+		}
+		var param string
+		param, line, _ = strings.Cut(line, " ")
+		if param == "" {
+			continue
+		}
+		if msg.Command == "" {
+			msg.Command = strings.ToUpper(param)
+		} else {
+			msg.Params = append(msg.Params, param)
+		}
+	}
+	return msg
+}
+
+func NewIRCChannel(cfg config.IRCConfig, messageBus *bus.MessageBus) (*IRCChannel, error) {
+	if cfg.Server == "" {
+		return nil, fmt.Errorf("IRC server not configured")
+	}
+	if cfg.Nick == "" {
+		cfg.Nick = "picoclaw"
+	}
+	base := NewBaseChannel("irc", cfg, messageBus, cfg.AllowFrom)
+	base.SetGroupPolicy(cfg.Groups, config.GroupPolicyConfig{Prefixes: cfg.GroupTriggerPrefix})
+	return &IRCChannel{
+		BaseChannel: base,
+		config:      cfg,
+		nick:        cfg.Nick,
+		queue:       make(chan ircLine, ircQueueSize),
+	}, nil
+}
+
+func (c *IRCChannel) Start(ctx context.Context) error {
+	logger.InfoCF("irc", "Starting IRC channel", map[string]interface{}{
+		"server": c.config.Server,
+		"nick":   c.config.Nick,
+	})
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+
+	if err := c.connect(); err != nil {
+		logger.WarnCF("irc", "Initial connection failed, will retry in background", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	go c.reconnectLoop()
+	go c.writeLoop()
+
+	c.setRunning(true)
+	logger.InfoC("irc", "IRC channel started successfully")
+	return nil
+}
+
+func (c *IRCChannel) Stop(ctx context.Context) error {
+	logger.InfoC("irc", "Stopping IRC channel")
+	c.setRunning(false)
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	c.mu.Lock()
+	conn := c.conn
+	c.conn = nil
+	c.mu.Unlock()
+	if conn != nil {
+		c.writeRaw(conn, "QUIT :bye")
+		conn.Close()
+	}
+	return nil
+}
+
+// Send queues the reply, split into IRC-sized lines; a background writer
+// paces them so the server doesn't kick us for flooding.
+func (c *IRCChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("irc channel not running")
+	}
+	if msg.ChatID == "" {
+		return fmt.Errorf("chat ID is empty")
+	}
+	if len(msg.Media) > 0 {
+		logger.DebugCF("irc", "IRC cannot send media, skipping attachments", map[string]interface{}{
+			"count": len(msg.Media),
+		})
+	}
+
+	for _, line := range splitIRCMessage(msg.Content, ircMaxLineBytes) {
+		select {
+		case c.queue <- ircLine{target: msg.ChatID, text: line}:
+		default:
+			return fmt.Errorf("irc send queue full")
+		}
+	}
+	return nil
+}
+
+func (c *IRCChannel) connect() error {
+	dialer := &net.Dialer{Timeout: 15 * time.Second}
+	var conn net.Conn
+	var err error
+	if c.config.TLS {
+		host, _, _ := net.SplitHostPort(c.config.Server)
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.config.Server, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", c.config.Server)
+	}
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(conn)
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	if err := c.register(conn, reader); err != nil {
+		conn.Close()
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+
+	for _, channel := range c.config.Channels {
+		// Entries may carry a key: "#private secret"
+		c.writeRaw(conn, "JOIN "+channel)
+	}
+
+	logger.InfoCF("irc", "IRC connected", map[string]interface{}{
+		"server":   c.config.Server,
+		"nick":     c.currentNick(),
+		"channels": c.config.Channels,
+	})
+	go c.listen(conn, reader)
+	return nil
+}
+
+// register runs SASL (when configured) and NICK/USER until the welcome
+// numeric, handling nick collisions along the way.
+func (c *IRCChannel) register(conn net.Conn, reader *bufio.Reader) error {
+	sasl := c.config.SASLUser != ""
+	if sasl {
+		c.writeRaw(conn, "CAP REQ :sasl")
+	}
+	if c.config.Password != "" {
+		c.writeRaw(conn, "PASS "+c.config.Password)
+	}
+	nick := c.config.Nick
+	user := c.config.Username
+	if user == "" {
+		user = nick
+	}
+	realName := c.config.RealName
+	if realName == "" {
+		realName = "PicoClaw"
+	}
+	c.writeRaw(conn, "NICK "+nick)
+	c.writeRaw(conn, fmt.Sprintf("USER %s 0 * :%s", user, realName))
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("registration: %w", err)
+		}
+		msg := parseIRCLine(strings.TrimRight(line, "\r\n"))
+		switch msg.Command {
+		case "PING":
+			c.writeRaw(conn, "PONG :"+msg.trailing())
+		case "CAP":
+			if len(msg.Params) < 2 {
+				continue
+			}
+			switch strings.ToUpper(msg.Params[1]) {
+			case "ACK":
+				c.writeRaw(conn, "AUTHENTICATE PLAIN")
+			case "NAK":
+				return fmt.Errorf("server does not support SASL")
+			}
+		case "AUTHENTICATE":
+			if msg.trailing() == "+" {
+				creds := c.config.SASLUser + "\x00" + c.config.SASLUser + "\x00" + c.config.SASLPassword
+				c.writeRaw(conn, "AUTHENTICATE "+base64.StdEncoding.EncodeToString([]byte(creds)))
+			}
+		case "903": // RPL_SASLSUCCESS
+			c.writeRaw(conn, "CAP END")
+		case "902", "904", "905", "906", "908":
+			return fmt.Errorf("SASL authentication failed: %s", msg.trailing())
+		case "433": // ERR_NICKNAMEINUSE
+			nick += "_"
+			c.writeRaw(conn, "NICK "+nick)
+		case "001": // RPL_WELCOME
+			if len(msg.Params) > 0 {
+				nick = msg.Params[0]
+			}
+			c.mu.Lock()
+			c.nick = nick
+			c.mu.Unlock()
+			return nil
+		case "ERROR":
+			return fmt.Errorf("server error: %s", msg.trailing())
+		}
+	}
+}
+
+func (c *IRCChannel) reconnectLoop() {
+	interval := time.Duration(c.config.ReconnectInterval) * time.Second
+	if interval < 5*time.Second {
+		interval = 5 * time.Second
+	}
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(interval):
+			c.mu.Lock()
+			conn := c.conn
+			c.mu.Unlock()
+
+			if conn == nil {
+				logger.InfoC("irc", "Attempting to reconnect...")
+				if err := c.connect(); err != nil {
+					logger.ErrorCF("irc", "Reconnect failed", map[string]interface{}{
+						"error": err.Error(),
+					})
+				}
+			}
+		}
+	}
+}
+
+func (c *IRCChannel) listen(conn net.Conn, reader *bufio.Reader) {
+	defer func() {
+		c.mu.Lock()
+		if c.conn == conn {
+			c.conn = nil
+		}
+		c.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		// Servers PING every few minutes; silence this long means a dead link.
+		conn.SetReadDeadline(time.Now().Add(6 * time.Minute))
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if c.ctx.Err() == nil {
+				logger.WarnCF("irc", "IRC connection lost", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+			return
+		}
+		msg := parseIRCLine(strings.TrimRight(line, "\r\n"))
+		switch msg.Command {
+		case "PING":
+			c.writeRaw(conn, "PONG :"+msg.trailing())
+		case "NICK":
+			if msg.nick() == c.currentNick() {
+				c.mu.Lock()
+				c.nick = msg.trailing()
+				c.mu.Unlock()
+			}
+		case "KICK":
+			if len(msg.Params) >= 2 && strings.EqualFold(msg.Params[1], c.currentNick()) {
+				logger.WarnCF("irc", "Kicked from channel", map[string]interface{}{
+					"channel": msg.Params[0],
+					"by":      msg.nick(),
+					"reason":  msg.trailing(),
+				})
+			}
+		case "PRIVMSG":
+			c.handlePrivmsg(msg)
+		case "ERROR":
+			logger.WarnCF("irc", "Server closed the connection", map[string]interface{}{
+				"reason": msg.trailing(),
+			})
+			return
+		}
+	}
+}
+
+func (c *IRCChannel) handlePrivmsg(msg ircMessage) {
+	if len(msg.Params) < 2 {
+		return
+	}
+	sender := msg.nick()
+	target := msg.Params[0]
+	content := msg.trailing()
+	nick := c.currentNick()
+
+	if strings.HasPrefix(content, "\x01") {
+		// CTCP: keep /me actions, ignore VERSION and friends
+		inner := strings.Trim(content, "\x01")
+		action, ok := strings.CutPrefix(inner, "ACTION ")
+		if !ok {
+			return
+		}
+		content = "* " + sender + " " + action
+	}
+
+	metadata := map[string]string{
+		"platform": "irc",
+		"nick":     sender,
+		"hostmask": msg.Prefix,
+	}
+
+	var chatID string
+	if strings.EqualFold(target, nick) {
+		if !c.IsAllowed(sender) {
+			logger.DebugCF("irc", "Message from unlisted nick ignored", map[string]interface{}{
+				"sender": sender,
+			})
+			return
+		}
+		chatID = sender
+		metadata["peer_kind"] = "direct"
+	} else {
+		mentioned, stripped := ircMention(content, nick)
+		text, reply := c.GroupReply(GroupMessage{
+			SenderID:   sender,
+			SenderName: sender,
+			ChatID:     target,
+			Content:    stripped,
+			Mentioned:  mentioned,
+		})
+		if !reply {
+			return
+		}
+		content = text
+		chatID = target
+		metadata["peer_kind"] = "group"
+		metadata["channel"] = target
+	}
+
+	if strings.TrimSpace(content) == "" {
+		return
+	}
+
+	logger.InfoCF("irc", "Received message", map[string]interface{}{
+		"sender":  sender,
+		"chat_id": chatID,
+		"preview": utils.Truncate(content, 80),
+	})
+	c.HandleMessage(sender, chatID, content, nil, metadata)
+}
+
+// ircMention reports whether a channel message is addressed to the bot as
+// "nick: ...", "nick, ..." or "@nick ...", which is stripped, or mentions
+// its nick anywhere else in the line.
+func ircMention(content, nick string) (bool, string) {
+	lower := strings.ToLower(content)
+	lnick := strings.ToLower(nick)
+	for _, form := range []string{lnick + ":", lnick + ",", "@" + lnick} {
+		if strings.HasPrefix(lower, form) {
+			return true, strings.TrimSpace(content[len(form):])
+		}
+	}
+	// A mention anywhere else in the line also counts, without stripping
+	for _, word := range strings.FieldsFunc(lower, func(r rune) bool {
+		return !(r == '_' || r == '-' || r == '[' || r == ']' || r == '\\' || r == '`' || r == '^' || r == '{' || r == '}' || r == '|' ||
+			(r >= 'a' && r <= 'z') || (r >= '0' && r <= '9'))
+	}) {
+		if word == lnick {
+			return true, content
+		}
+	}
+	return false, content
+}
+
+// writeLoop sends queued lines: a short burst immediately, then one line
+// per message_delay.
+func (c *IRCChannel) writeLoop() {
+	delay := time.Duration(c.config.MessageDelay) * time.Millisecond
+	if delay <= 0 {
+		delay = time.Second
+	}
+	tokens := ircFloodBurst
+	refill := time.NewTicker(delay)
+	defer refill.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case line := <-c.queue:
+			for tokens == 0 {
+				select {
+				case <-c.ctx.Done():
+					return
+				case <-refill.C:
+					tokens++
+				}
+			}
+			tokens--
+
+			c.mu.Lock()
+			conn := c.conn
+			c.mu.Unlock()
+			if conn == nil {
+				logger.WarnCF("irc", "Not connected, dropping line", map[string]interface{}{
+					"target": line.target,
+				})
+				continue
+			}
+			if err := c.writeRaw(conn, fmt.Sprintf("PRIVMSG %s :%s", line.target, line.text)); err != nil {
+				logger.ErrorCF("irc", "Failed to send line", map[string]interface{}{
+					"target": line.target,
+					"error":  err.Error(),
+				})
+			}
+		case <-refill.C:
+			if tokens < ircFloodBurst {
+				tokens++
+			}
+		}
+	}
+}
+
+func (c *IRCChannel) writeRaw(conn net.Conn, line string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := conn.Write([]byte(line + "\r\n"))
+	return err
+}
+
+func (c *IRCChannel) currentNick() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nick
+}
+
+// splitIRCMessage turns a reply into lines of at most maxBytes, one per
+// input line, wrapping long lines at spaces (or rune boundaries when a
+// single word is too long). Empty lines are dropped.
+func splitIRCMessage(content string, maxBytes int) []string {
+	var lines []string
+	for _, raw := range strings.Split(strings.ReplaceAll(content, "\r", ""), "\n") {
+		line := strings.TrimRight(raw, " \t")
+		for len(line) > maxBytes {
+			cut := strings.LastIndex(line[:maxBytes], " ")
+			if cut <= 0 {
+				cut = maxBytes
+				for cut > 0 && !utf8.RuneStart(line[cut]) {
+					cut--
+				}
+			}
+			lines = append(lines, line[:cut])
+			line = strings.TrimLeft(line[cut:], " ")
+		}
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,159 @@
+package channels
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// fakeIRCServer accepts one client, performs SASL and registration, then
+// records every line the client sends.
+func fakeIRCServer(t *testing.T) (addr string, lines chan string, send func(string)) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	lines = make(chan string, 100)
+	connCh := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		connCh <- conn
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			switch {
+			case line == "CAP REQ :sasl":
+				conn.Write([]byte(":srv CAP * ACK :sasl\r\n"))
+			case line == "AUTHENTICATE PLAIN":
+				conn.Write([]byte("AUTHENTICATE +\r\n"))
+			case strings.HasPrefix(line, "AUTHENTICATE "):
+				creds, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "AUTHENTICATE "))
+				if string(creds) == "bot\x00bot\x00hunter2" {
+					conn.Write([]byte(":srv 903 picoclaw :SASL authentication successful\r\n"))
+				} else {
+					conn.Write([]byte(":srv 904 picoclaw :SASL authentication failed\r\n"))
+				}
+			case line == "NICK picoclaw":
+				conn.Write([]byte(":srv 433 * picoclaw :Nickname is already in use\r\n"))
+			case line == "CAP END":
+			case strings.HasPrefix(line, "USER "):
+			case line == "NICK picoclaw_":
+				conn.Write([]byte(":srv 001 picoclaw_ :Welcome\r\n"))
+			default:
+				lines <- line
+			}
+		}
+	}()
+
+	return ln.Addr().String(), lines, func(s string) {
+		select {
+		case conn := <-connCh:
+			connCh <- conn
+			conn.Write([]byte(s + "\r\n"))
+		case <-time.After(2 * time.Second):
+			t.Fatal("no client connected")
+		}
+	}
+}
+
+func expectLine(t *testing.T, lines chan string, want string) {
+	t.Helper()
+	select {
+	case got := <-lines:
+		if got != want {
+			t.Fatalf("expected %q, got %q", want, got)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timed out waiting for %q", want)
+	}
+}
+
+func TestIRCChannel(t *testing.T) {
+	addr, lines, send := fakeIRCServer(t)
+	mb := bus.NewMessageBus()
+	ch, _ := NewIRCChannel(config.IRCConfig{
+		Server:             addr,
+		Nick:               "picoclaw",
+		SASLUser:           "bot",
+		SASLPassword:       "hunter2",
+		Channels:           config.FlexibleStringSlice{"#home"},
+		GroupTriggerPrefix: []string{"!ask"},
+		MessageDelay:       10,
+	}, mb)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := ch.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer ch.Stop(ctx)
+
+	expectLine(t, lines, "JOIN #home")
+	if ch.currentNick() != "picoclaw_" {
+		t.Errorf("nick collision not handled: %q", ch.currentNick())
+	}
+
+	send(":srv PING :abc")
+	expectLine(t, lines, "PONG :abc")
+
+	send(":alice!a@host PRIVMSG #home :just chatting")
+	send(":alice!a@host PRIVMSG #home :picoclaw_: what's the weather?")
+	send(":bob!b@host PRIVMSG #home :!ask tell a joke")
+	send(":alice!a@host PRIVMSG picoclaw_ :hi in private")
+
+	for _, want := range []struct{ chatID, content string }{
+		{"#home", "what's the weather?"},
+		{"#home", "tell a joke"},
+		{"alice", "hi in private"},
+	} {
+		msg, ok := mb.ConsumeInbound(ctx)
+		if !ok || msg.ChatID != want.chatID || msg.Content != want.content {
+			t.Fatalf("expected %+v, got %+v", want, msg)
+		}
+	}
+
+	long := strings.Repeat("word ", 100) + "\nsecond line"
+	if err := ch.Send(ctx, bus.OutboundMessage{ChatID: "#home", Content: long}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case got := <-lines:
+			if !strings.HasPrefix(got, "PRIVMSG #home :") || len(got) > 420 {
+				t.Errorf("bad line %d: %q", i, got)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("line %d not sent", i)
+		}
+	}
+}
+
+func TestSplitIRCMessage(t *testing.T) {
+	got := splitIRCMessage("short\n\n"+strings.Repeat("é", 30), 20)
+	if len(got) != 4 || got[0] != "short" {
+		t.Fatalf("unexpected split: %q", got)
+	}
+	for _, line := range got {
+		if len(line) > 20 || !utf8.ValidString(line) {
+			t.Errorf("bad line %q", line)
+		}
+	}
+}
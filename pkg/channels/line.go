@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -19,6 +21,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/voice"
 )
 
 const (
@@ -30,6 +33,8 @@ const (
 	lineBotInfoEndpoint  = lineAPIBase + "/info"
 	lineLoadingEndpoint  = lineAPIBase + "/chat/loading/start"
 	lineReplyTokenMaxAge = 25 * time.Second
+	lineMediaPath        = "/line/media/" // where voice notes are served for LINE to fetch
+	lineMediaTTL         = 10 * time.Minute
 )
 
 type replyTokenEntry struct {
@@ -49,6 +54,8 @@ type LINEChannel struct {
 	botDisplayName string   // Bot's display name for text-based mention detection
 	replyTokens    sync.Map // chatID -> replyTokenEntry
 	quoteTokens    sync.Map // chatID -> quoteToken (string)
+	quotes         *sentLog // message ID -> quoteToken, for explicit replies
+	media          sync.Map // token -> local audio file served under lineMediaPath
 	ctx            context.Context
 	cancel         context.CancelFunc
 }
@@ -60,10 +67,12 @@ func NewLINEChannel(cfg config.LINEConfig, messageBus *bus.MessageBus) (*LINECha
 	}
 
 	base := NewBaseChannel("line", cfg, messageBus, cfg.AllowFrom)
+	base.SetGroupPolicy(cfg.Groups, config.GroupPolicyConfig{})
 
 	return &LINEChannel{
 		BaseChannel: base,
 		config:      cfg,
+		quotes:      newSentLog(),
 	}, nil
 }
 
@@ -92,6 +101,7 @@ func (c *LINEChannel) Start(ctx context.Context) error {
 		path = "/webhook/line"
 	}
 	mux.HandleFunc(path, c.webhookHandler)
+	mux.HandleFunc(lineMediaPath, c.mediaHandler)
 
 	addr := fmt.Sprintf("%s:%d", c.config.WebhookHost, c.config.WebhookPort)
 	c.httpServer = &http.Server{
@@ -234,9 +244,14 @@ type lineEvent struct {
 	ReplyToken string          `json:"replyToken"`
 	Source     lineSource      `json:"source"`
 	Message    json.RawMessage `json:"message"`
+	Postback   *linePostback   `json:"postback"`
 	Timestamp  int64           `json:"timestamp"`
 }
 
+type linePostback struct {
+	Data string `json:"data"`
+}
+
 type lineSource struct {
 	Type    string `json:"type"` // "user", "group", "room"
 	UserID  string `json:"userId"`
@@ -265,6 +280,10 @@ type lineMentionee struct {
 }
 
 func (c *LINEChannel) processEvent(event lineEvent) {
+	if event.Type == "postback" && event.Postback != nil {
+		c.handlePostback(event)
+		return
+	}
 	if event.Type != "message" {
 		logger.DebugCF("line", "Ignoring non-message event", map[string]interface{}{
 			"type": event.Type,
@@ -284,12 +303,22 @@ func (c *LINEChannel) processEvent(event lineEvent) {
 		return
 	}
 
-	// In group chats, only respond when the bot is mentioned
-	if isGroup && !c.isBotMentioned(msg) {
-		logger.DebugCF("line", "Ignoring group message without mention", map[string]interface{}{
-			"chat_id": chatID,
+	// In group chats, the group policy decides whether to respond
+	var groupText string
+	if isGroup {
+		var reply bool
+		groupText, reply = c.GroupReply(GroupMessage{
+			SenderID:  senderID,
+			ChatID:    chatID,
+			Content:   c.stripBotMention(msg.Text, msg),
+			Mentioned: c.isBotMentioned(msg),
 		})
-		return
+		if !reply {
+			logger.DebugCF("line", "Ignoring group message", map[string]interface{}{
+				"chat_id": chatID,
+			})
+			return
+		}
 	}
 
 	// Store reply token for later use
@@ -303,6 +332,7 @@ func (c *LINEChannel) processEvent(event lineEvent) {
 	// Store quote token for quoting the original message in reply
 	if msg.QuoteToken != "" {
 		c.quoteTokens.Store(chatID, msg.QuoteToken)
+		c.quotes.add(msg.ID, sentMessage{chatID: chatID, content: msg.QuoteToken})
 	}
 
 	var content string
@@ -323,9 +353,8 @@ func (c *LINEChannel) processEvent(event lineEvent) {
 	switch msg.Type {
 	case "text":
 		content = msg.Text
-		// Strip bot mention from text in group chats
 		if isGroup {
-			content = c.stripBotMention(content, msg)
+			content = groupText
 		}
 	case "image":
 		localPath := c.downloadContent(msg.ID, "image.jpg")
@@ -364,6 +393,10 @@ func (c *LINEChannel) processEvent(event lineEvent) {
 		"platform":    "line",
 		"source_type": event.Source.Type,
 		"message_id":  msg.ID,
+		"peer_kind":   peerKind(isGroup),
+	}
+	if msg.Type == "audio" {
+		metadata[bus.MetadataVoice] = "true"
 	}
 
 	logger.DebugCF("line", "Received message", map[string]interface{}{
@@ -380,6 +413,29 @@ func (c *LINEChannel) processEvent(event lineEvent) {
 	c.HandleMessage(senderID, chatID, content, mediaPaths, metadata)
 }
 
+// handlePostback routes a quick-reply button press to the agent. LINE
+// reports neither the button's label nor the message it was attached to.
+func (c *LINEChannel) handlePostback(event lineEvent) {
+	chatID := c.resolveChatID(event.Source)
+	if event.ReplyToken != "" {
+		c.replyTokens.Store(chatID, replyTokenEntry{
+			token:     event.ReplyToken,
+			timestamp: time.Now(),
+		})
+	}
+	if !c.IsAllowed(event.Source.UserID) {
+		return
+	}
+
+	// Show typing/loading indicator (requires user ID, not group ID)
+	c.sendLoading(event.Source.UserID)
+
+	c.HandleAction(event.Source.UserID, chatID, "", event.Postback.Data, "", map[string]string{
+		"platform":    "line",
+		"source_type": event.Source.Type,
+	})
+}
+
 // isBotMentioned checks if the bot is mentioned in the message.
 // It first checks the mention metadata (userId match), then falls back
 // to text-based detection using the bot's display name, since LINE may
@@ -491,12 +547,35 @@ func (c *LINEChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	if qt, ok := c.quoteTokens.LoadAndDelete(msg.ChatID); ok {
 		quoteToken = qt.(string)
 	}
+	if msg.ReplyTo != "" {
+		if quoted, ok := c.quotes.get(msg.ReplyTo); ok {
+			quoteToken = quoted.content
+		}
+	}
+	// Voice notes go first as audio messages; the rest follows as usual
+	var messages []map[string]interface{}
+	var attachments []bus.Attachment
+	for _, a := range msg.Attachments {
+		if !a.Voice {
+			attachments = append(attachments, a)
+			continue
+		}
+		audio, err := c.audioMessage(ctx, a)
+		if err != nil {
+			return fmt.Errorf("failed to prepare voice note: %w", err)
+		}
+		messages = append(messages, audio)
+	}
+	msg.Attachments = attachments
+	if len(messages) == 0 || strings.TrimSpace(msg.Content) != "" || len(attachments) > 0 {
+		messages = append(messages, buildMessages(msg, quoteToken)...)
+	}
 
 	// Try reply token first (free, valid for ~25 seconds)
 	if entry, ok := c.replyTokens.LoadAndDelete(msg.ChatID); ok {
 		tokenEntry := entry.(replyTokenEntry)
 		if time.Since(tokenEntry.timestamp) < lineReplyTokenMaxAge {
-			if err := c.sendReply(ctx, tokenEntry.token, msg.Content, quoteToken); err == nil {
+			if err := c.sendReply(ctx, tokenEntry.token, messages); err == nil {
 				logger.DebugCF("line", "Message sent via Reply API", map[string]interface{}{
 					"chat_id": msg.ChatID,
 					"quoted":  quoteToken != "",
@@ -508,12 +587,135 @@ func (c *LINEChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	}
 
 	// Fall back to Push API
-	return c.sendPush(ctx, msg.ChatID, msg.Content, quoteToken)
+	return c.sendPush(ctx, msg.ChatID, messages)
+}
+
+// Capabilities reports what LINE renders natively: image attachments,
+// quoted replies and quick-reply buttons, plus voice notes when public_url
+// says where LINE can fetch them. LINE can't edit or unsend.
+func (c *LINEChannel) Capabilities() Capabilities {
+	return Capabilities{Attachments: true, Replies: true, Actions: true, Voice: c.config.PublicURL != ""}
+}
+
+// audioMessage builds an audio message for a voice note. LINE only takes
+// audio by HTTPS URL, so the note is converted to M4A and served from the
+// webhook server for a while.
+func (c *LINEChannel) audioMessage(ctx context.Context, a bus.Attachment) (map[string]interface{}, error) {
+	path, err := voice.Convert(ctx, a.Path, ".m4a")
+	if err != nil {
+		return nil, err
+	}
+	duration, err := voice.Duration(ctx, path)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	token := hex.EncodeToString(b)
+	c.media.Store(token, path)
+	time.AfterFunc(lineMediaTTL, func() {
+		c.media.Delete(token)
+		os.Remove(path)
+	})
+
+	return map[string]interface{}{
+		"type":               "audio",
+		"originalContentUrl": strings.TrimRight(c.config.PublicURL, "/") + lineMediaPath + token + ".m4a",
+		"duration":           duration.Milliseconds(),
+	}, nil
+}
+
+// mediaHandler serves the voice notes audioMessage hosts.
+func (c *LINEChannel) mediaHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, lineMediaPath), ".m4a")
+	path, ok := c.media.Load(token)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "audio/mp4")
+	http.ServeFile(w, r, path.(string))
+}
+
+const (
+	lineMaxMessages      = 5  // message objects per reply or push
+	lineMaxQuickReplies  = 13 // quick reply buttons per message
+	lineMaxActionLabel   = 20
+	lineMaxPostbackBytes = 300
+)
+
+// buildMessages renders msg as LINE message objects. HTTPS images become
+// image messages; other attachments are listed in the text, which carries
+// the quote token. Buttons become quick replies on the last message.
+func buildMessages(msg bus.OutboundMessage, quoteToken string) []map[string]interface{} {
+	content := msg.Content
+	var messages []map[string]interface{}
+	for _, a := range msg.Attachments {
+		filename, mimeType := attachmentInfo(a)
+		if strings.HasPrefix(a.Path, "https://") && strings.HasPrefix(mimeType, "image/") && len(messages) < lineMaxMessages-1 {
+			messages = append(messages, map[string]interface{}{
+				"type":               "image",
+				"originalContentUrl": a.Path,
+				"previewImageUrl":    a.Path,
+			})
+			if a.Caption != "" {
+				content = appendParagraph(content, a.Caption)
+			}
+			continue
+		}
+		line := fmt.Sprintf("[file: %s]", filename)
+		if isRemoteMedia(a.Path) {
+			line = a.Path
+		}
+		content = appendParagraph(content, strings.TrimSpace(a.Caption+"\n"+line))
+	}
+	if strings.TrimSpace(content) != "" || len(messages) == 0 {
+		messages = append(messages, buildTextMessage(content, quoteToken))
+	}
+
+	if items := lineQuickReplyItems(msg.Actions); len(items) > 0 {
+		messages[len(messages)-1]["quickReply"] = map[string]interface{}{"items": items}
+	}
+	return messages
+}
+
+func lineQuickReplyItems(actions []bus.Action) []map[string]interface{} {
+	var items []map[string]interface{}
+	for _, a := range actions {
+		if len(items) == lineMaxQuickReplies {
+			break
+		}
+		label := a.Label
+		if r := []rune(label); len(r) > lineMaxActionLabel {
+			label = string(r[:lineMaxActionLabel])
+		}
+		action := map[string]interface{}{"type": "postback", "label": label, "displayText": a.Label}
+		if a.URL != "" {
+			action = map[string]interface{}{"type": "uri", "label": label, "uri": a.URL}
+		} else {
+			data := actionDataPrefix + a.Data
+			if len(data) > lineMaxPostbackBytes {
+				data = data[:lineMaxPostbackBytes]
+			}
+			action["data"] = data
+		}
+		items = append(items, map[string]interface{}{"type": "action", "action": action})
+	}
+	return items
 }
 
 // buildTextMessage creates a text message object, optionally with quoteToken.
-func buildTextMessage(content, quoteToken string) map[string]string {
-	msg := map[string]string{
+func buildTextMessage(content, quoteToken string) map[string]interface{} {
+	msg := map[string]interface{}{
 		"type": "text",
 		"text": content,
 	}
@@ -524,20 +726,20 @@ func buildTextMessage(content, quoteToken string) map[string]string {
 }
 
 // sendReply sends a message using the LINE Reply API.
-func (c *LINEChannel) sendReply(ctx context.Context, replyToken, content, quoteToken string) error {
+func (c *LINEChannel) sendReply(ctx context.Context, replyToken string, messages []map[string]interface{}) error {
 	payload := map[string]interface{}{
 		"replyToken": replyToken,
-		"messages":   []map[string]string{buildTextMessage(content, quoteToken)},
+		"messages":   messages,
 	}
 
 	return c.callAPI(ctx, lineReplyEndpoint, payload)
 }
 
 // sendPush sends a message using the LINE Push API.
-func (c *LINEChannel) sendPush(ctx context.Context, to, content, quoteToken string) error {
+func (c *LINEChannel) sendPush(ctx context.Context, to string, messages []map[string]interface{}) error {
 	payload := map[string]interface{}{
 		"to":       to,
-		"messages": []map[string]string{buildTextMessage(content, quoteToken)},
+		"messages": messages,
 	}
 
 	return c.callAPI(ctx, linePushEndpoint, payload)
@@ -15,6 +15,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/voice"
 )
 
 type Manager struct {
@@ -23,6 +24,12 @@ type Manager struct {
 	config       *config.Config
 	dispatchTask *asyncTask
 	mu           sync.RWMutex
+
+	healthMu sync.Mutex
+	health   map[string]*channelHealth
+	alert    AlertFunc
+
+	tts voice.Synthesizer
 }
 
 type asyncTask struct {
@@ -189,6 +196,97 @@ func (m *Manager) initChannels() error {
 		}
 	}
 
+	if m.config.Channels.Matrix.Enabled && m.config.Channels.Matrix.AccessToken != "" {
+		logger.DebugC("channels", "Attempting to initialize Matrix channel")
+		matrix, err := NewMatrixChannel(m.config.Channels.Matrix, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Matrix channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["matrix"] = matrix
+			logger.InfoC("channels", "Matrix channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.Email.Enabled && m.config.Channels.Email.IMAPHost != "" {
+		logger.DebugC("channels", "Attempting to initialize Email channel")
+		email, err := NewEmailChannel(m.config.Channels.Email, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Email channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["email"] = email
+			logger.InfoC("channels", "Email channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.MQTT.Enabled && m.config.Channels.MQTT.Broker != "" {
+		logger.DebugC("channels", "Attempting to initialize MQTT channel")
+		mqttCh, err := NewMQTTChannel(m.config.Channels.MQTT, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize MQTT channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["mqtt"] = mqttCh
+			logger.InfoC("channels", "MQTT channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.IRC.Enabled && m.config.Channels.IRC.Server != "" {
+		logger.DebugC("channels", "Attempting to initialize IRC channel")
+		irc, err := NewIRCChannel(m.config.Channels.IRC, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize IRC channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["irc"] = irc
+			logger.InfoC("channels", "IRC channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.Signal.Enabled && m.config.Channels.Signal.URL != "" {
+		logger.DebugC("channels", "Attempting to initialize Signal channel")
+		signal, err := NewSignalChannel(m.config.Channels.Signal, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Signal channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["signal"] = signal
+			logger.InfoC("channels", "Signal channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.Mattermost.Enabled && m.config.Channels.Mattermost.Token != "" {
+		logger.DebugC("channels", "Attempting to initialize Mattermost channel")
+		mattermost, err := NewMattermostChannel(m.config.Channels.Mattermost, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Mattermost channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["mattermost"] = mattermost
+			logger.InfoC("channels", "Mattermost channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.RocketChat.Enabled && m.config.Channels.RocketChat.Token != "" {
+		logger.DebugC("channels", "Attempting to initialize Rocket.Chat channel")
+		rocketChat, err := NewRocketChatChannel(m.config.Channels.RocketChat, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Rocket.Chat channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["rocketchat"] = rocketChat
+			logger.InfoC("channels", "Rocket.Chat channel enabled successfully")
+		}
+	}
+
 	logger.InfoCF("channels", "Channel initialization completed", map[string]interface{}{
 		"enabled_channels": len(m.channels),
 	})
@@ -211,6 +309,9 @@ func (m *Manager) StartAll(ctx context.Context) error {
 	m.dispatchTask = &asyncTask{cancel: cancel}
 
 	go m.dispatchOutbound(dispatchCtx)
+	if m.config.Channels.Supervisor.Enabled {
+		go m.supervise(dispatchCtx)
+	}
 
 	for name, channel := range m.channels {
 		logger.InfoCF("channels", "Starting channel", map[string]interface{}{
@@ -285,12 +386,45 @@ func (m *Manager) dispatchOutbound(ctx context.Context) {
 				continue
 			}
 
-			if err := channel.Send(ctx, msg); err != nil {
+			caps := ChannelCapabilities(channel)
+			msg, deliver := DegradeOutbound(msg, caps)
+			if !deliver {
+				logger.DebugCF("channels", "Channel can't delete messages, skipping", map[string]interface{}{
+					"channel": msg.Channel,
+				})
+				continue
+			}
+
+			err := m.send(ctx, channel, msg, caps)
+			if err != nil {
 				logger.ErrorCF("channels", "Error sending message to channel", map[string]interface{}{
 					"channel": msg.Channel,
 					"error":   err.Error(),
 				})
 			}
+			m.recordSend(msg.Channel, err)
+		}
+	}
+}
+
+// SetRateLimiter hands the inbound rate limiter to every channel.
+func (m *Manager) SetRateLimiter(limiter RateLimiter) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, channel := range m.channels {
+		if ch, ok := channel.(interface{ SetRateLimiter(RateLimiter) }); ok {
+			ch.SetRateLimiter(limiter)
+		}
+	}
+}
+
+// SetAccessPolicy hands the central access policy to every channel.
+func (m *Manager) SetAccessPolicy(access AccessPolicy) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, channel := range m.channels {
+		if ch, ok := channel.(interface{ SetAccessPolicy(AccessPolicy) }); ok {
+			ch.SetAccessPolicy(access)
 		}
 	}
 }
@@ -303,14 +437,12 @@ func (m *Manager) GetChannel(name string) (Channel, bool) {
 }
 
 func (m *Manager) GetStatus() map[string]interface{} {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
 	status := make(map[string]interface{})
-	for name, channel := range m.channels {
+	for name, health := range m.Health() {
 		status[name] = map[string]interface{}{
 			"enabled": true,
-			"running": channel.IsRunning(),
+			"running": health.Running,
+			"healthy": health.Healthy,
 		}
 	}
 	return status
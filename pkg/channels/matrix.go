@@ -0,0 +1,654 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// MatrixChannel connects to a Matrix homeserver through the client-server API.
+//
+// End-to-end encrypted rooms are supported by pointing Homeserver at an
+// E2EE-aware proxy such as pantalaimon, which decrypts events before they
+// reach the bot and encrypts outgoing messages. Encrypted events that arrive
+// undecrypted are logged and skipped.
+type MatrixChannel struct {
+	*BaseChannel
+	config     config.MatrixConfig
+	homeserver string
+	userID     string
+	client     *http.Client
+	ctx        context.Context
+	cancel     context.CancelFunc
+	since      string
+	txnCounter atomic.Int64
+	directRoom sync.Map // roomID -> bool (true for 1:1 rooms)
+	warnedE2EE sync.Map // roomID -> struct{}
+}
+
+type matrixEvent struct {
+	Type           string          `json:"type"`
+	Sender         string          `json:"sender"`
+	EventID        string          `json:"event_id"`
+	StateKey       *string         `json:"state_key,omitempty"`
+	Content        json.RawMessage `json:"content"`
+	OriginServerTS int64           `json:"origin_server_ts"`
+}
+
+type matrixSyncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join   map[string]matrixJoinedRoom  `json:"join"`
+		Invite map[string]matrixInvitedRoom `json:"invite"`
+	} `json:"rooms"`
+}
+
+type matrixJoinedRoom struct {
+	Summary struct {
+		JoinedMemberCount *int `json:"m.joined_member_count"`
+	} `json:"summary"`
+	Timeline struct {
+		Events []matrixEvent `json:"events"`
+	} `json:"timeline"`
+}
+
+type matrixInvitedRoom struct {
+	InviteState struct {
+		Events []matrixEvent `json:"events"`
+	} `json:"invite_state"`
+}
+
+type matrixMessageContent struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	FormattedBody string `json:"formatted_body,omitempty"`
+	URL           string `json:"url,omitempty"`
+	Info          *struct {
+		MimeType string `json:"mimetype"`
+	} `json:"info,omitempty"`
+	Mentions *struct {
+		UserIDs []string `json:"user_ids"`
+	} `json:"m.mentions,omitempty"`
+	RelatesTo *matrixRelation `json:"m.relates_to,omitempty"`
+}
+
+type matrixRelation struct {
+	RelType   string `json:"rel_type,omitempty"`
+	EventID   string `json:"event_id,omitempty"`
+	Key       string `json:"key,omitempty"`
+	InReplyTo *struct {
+		EventID string `json:"event_id"`
+	} `json:"m.in_reply_to,omitempty"`
+}
+
+// NewMatrixChannel creates a new Matrix channel instance.
+func NewMatrixChannel(cfg config.MatrixConfig, messageBus *bus.MessageBus) (*MatrixChannel, error) {
+	if cfg.Homeserver == "" || cfg.AccessToken == "" {
+		return nil, fmt.Errorf("matrix homeserver and access_token are required")
+	}
+
+	base := NewBaseChannel("matrix", cfg, messageBus, cfg.AllowFrom)
+	base.SetGroupPolicy(cfg.Groups, requireMentionPolicy(cfg.RequireMention, nil))
+
+	return &MatrixChannel{
+		BaseChannel: base,
+		config:      cfg,
+		homeserver:  strings.TrimRight(cfg.Homeserver, "/"),
+		userID:      cfg.UserID,
+		client:      &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+// Start verifies the access token and launches the sync loop.
+func (c *MatrixChannel) Start(ctx context.Context) error {
+	logger.InfoC("matrix", "Starting Matrix channel")
+
+	var whoami struct {
+		UserID string `json:"user_id"`
+	}
+	if err := c.request(ctx, http.MethodGet, "/_matrix/client/v3/account/whoami", nil, nil, &whoami); err != nil {
+		return fmt.Errorf("matrix whoami failed: %w", err)
+	}
+	c.userID = whoami.UserID
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	c.setRunning(true)
+	go c.syncLoop()
+
+	logger.InfoCF("matrix", "Matrix channel connected", map[string]interface{}{
+		"user_id":    c.userID,
+		"homeserver": c.homeserver,
+	})
+	return nil
+}
+
+// Stop ends the sync loop.
+func (c *MatrixChannel) Stop(ctx context.Context) error {
+	logger.InfoC("matrix", "Stopping Matrix channel")
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.setRunning(false)
+	return nil
+}
+
+// Send posts a text message to a room, uploading any media first.
+func (c *MatrixChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("matrix channel not running")
+	}
+	if msg.ChatID == "" {
+		return fmt.Errorf("room ID is empty")
+	}
+
+	for _, media := range msg.Media {
+		if err := c.sendMedia(ctx, msg.ChatID, media); err != nil {
+			logger.ErrorCF("matrix", "Failed to send media", map[string]interface{}{
+				"room_id": msg.ChatID,
+				"error":   err.Error(),
+			})
+		}
+	}
+
+	if strings.TrimSpace(msg.Content) == "" {
+		return nil
+	}
+
+	eventID, err := c.sendEvent(ctx, msg.ChatID, "m.room.message", map[string]interface{}{
+		"msgtype": "m.text",
+		"body":    msg.Content,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send matrix message: %w", err)
+	}
+	c.RecordSent(msg.ChatID, eventID, msg.Content)
+	c.setTyping(msg.ChatID, false)
+	return nil
+}
+
+func (c *MatrixChannel) syncLoop() {
+	backoff := 2 * time.Second
+	maxBackoff := 2 * time.Minute
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		default:
+		}
+
+		resp, err := c.sync(c.ctx)
+		if err != nil {
+			if c.ctx.Err() != nil {
+				return
+			}
+			logger.WarnCF("matrix", "Sync failed, retrying", map[string]interface{}{
+				"error":   err.Error(),
+				"backoff": backoff.String(),
+			})
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+		backoff = 2 * time.Second
+
+		// The first sync returns recent history; only act on what comes after it.
+		initial := c.since == ""
+		c.since = resp.NextBatch
+		c.processSync(resp, initial)
+	}
+}
+
+func (c *MatrixChannel) sync(ctx context.Context) (*matrixSyncResponse, error) {
+	query := url.Values{}
+	query.Set("timeout", "30000")
+	if c.since != "" {
+		query.Set("since", c.since)
+	} else {
+		query.Set("filter", `{"room":{"timeline":{"limit":1}}}`)
+	}
+
+	var resp matrixSyncResponse
+	if err := c.request(ctx, http.MethodGet, "/_matrix/client/v3/sync", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *MatrixChannel) processSync(resp *matrixSyncResponse, initial bool) {
+	for roomID, room := range resp.Rooms.Invite {
+		c.handleInvite(roomID, room)
+	}
+
+	for roomID, room := range resp.Rooms.Join {
+		if n := room.Summary.JoinedMemberCount; n != nil {
+			c.directRoom.Store(roomID, *n <= 2)
+		}
+		if initial {
+			continue
+		}
+		for _, ev := range room.Timeline.Events {
+			c.handleEvent(roomID, ev)
+		}
+	}
+}
+
+// handleInvite joins rooms the bot is invited to by allowed users.
+func (c *MatrixChannel) handleInvite(roomID string, room matrixInvitedRoom) {
+	var inviter string
+	var isDirect bool
+	for _, ev := range room.InviteState.Events {
+		if ev.Type != "m.room.member" || ev.StateKey == nil || *ev.StateKey != c.userID {
+			continue
+		}
+		var member struct {
+			Membership string `json:"membership"`
+			IsDirect   bool   `json:"is_direct"`
+		}
+		if json.Unmarshal(ev.Content, &member) == nil && member.Membership == "invite" {
+			inviter = ev.Sender
+			isDirect = member.IsDirect
+		}
+	}
+	if inviter == "" {
+		return
+	}
+
+	if !c.config.AutoJoin || !c.IsAllowed(inviter) {
+		logger.InfoCF("matrix", "Ignoring room invite", map[string]interface{}{
+			"room_id": roomID,
+			"inviter": inviter,
+		})
+		return
+	}
+
+	path := "/_matrix/client/v3/join/" + url.PathEscape(roomID)
+	if err := c.request(c.ctx, http.MethodPost, path, nil, map[string]interface{}{}, nil); err != nil {
+		logger.ErrorCF("matrix", "Failed to join room", map[string]interface{}{
+			"room_id": roomID,
+			"error":   err.Error(),
+		})
+		return
+	}
+	if isDirect {
+		c.directRoom.Store(roomID, true)
+	}
+	logger.InfoCF("matrix", "Joined room", map[string]interface{}{
+		"room_id": roomID,
+		"inviter": inviter,
+		"direct":  isDirect,
+	})
+}
+
+func (c *MatrixChannel) handleEvent(roomID string, ev matrixEvent) {
+	if ev.Sender == c.userID {
+		return
+	}
+
+	switch ev.Type {
+	case "m.room.message":
+		c.handleMessage(roomID, ev)
+	case "m.reaction":
+		var content matrixMessageContent
+		if json.Unmarshal(ev.Content, &content) == nil && content.RelatesTo != nil &&
+			content.RelatesTo.RelType == "m.annotation" {
+			c.HandleReaction(ev.Sender, roomID, content.RelatesTo.EventID, content.RelatesTo.Key, false)
+		}
+	case "m.room.encrypted":
+		if _, warned := c.warnedE2EE.LoadOrStore(roomID, struct{}{}); !warned {
+			logger.WarnCF("matrix", "Received encrypted event; point homeserver at an E2EE proxy such as pantalaimon to read encrypted rooms",
+				map[string]interface{}{"room_id": roomID})
+		}
+	}
+}
+
+func (c *MatrixChannel) handleMessage(roomID string, ev matrixEvent) {
+	var content matrixMessageContent
+	if err := json.Unmarshal(ev.Content, &content); err != nil {
+		return
+	}
+	// Edits arrive as new events; the original was already handled
+	if content.RelatesTo != nil && content.RelatesTo.RelType == "m.replace" {
+		return
+	}
+
+	senderID := ev.Sender
+	isDirect := c.isDirect(roomID)
+	if isDirect && !c.IsAllowed(senderID) {
+		logger.DebugCF("matrix", "Message rejected by allowlist", map[string]interface{}{
+			"sender_id": senderID,
+		})
+		return
+	}
+
+	var groupText string
+	if !isDirect {
+		var reply bool
+		groupText, reply = c.GroupReply(GroupMessage{
+			SenderID:  senderID,
+			ChatID:    roomID,
+			Content:   c.stripMention(content.Body),
+			Mentioned: c.isMentioned(content),
+		})
+		if !reply {
+			return
+		}
+	}
+
+	var text string
+	var mediaPaths []string
+	localFiles := []string{}
+
+	defer func() {
+		for _, file := range localFiles {
+			if err := os.Remove(file); err != nil {
+				logger.DebugCF("matrix", "Failed to cleanup temp file", map[string]interface{}{
+					"file":  file,
+					"error": err.Error(),
+				})
+			}
+		}
+	}()
+
+	switch content.MsgType {
+	case "m.text", "m.notice", "m.emote":
+		text = content.Body
+		if !isDirect {
+			text = groupText
+		}
+	case "m.image", "m.audio", "m.video", "m.file":
+		kind := strings.TrimPrefix(content.MsgType, "m.")
+		if localPath := c.downloadMedia(content.URL, content.Body); localPath != "" {
+			localFiles = append(localFiles, localPath)
+			mediaPaths = append(mediaPaths, localPath)
+		}
+		text = fmt.Sprintf("[%s: %s]", kind, content.Body)
+	default:
+		return
+	}
+
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+
+	metadata := map[string]string{
+		"platform":   "matrix",
+		"message_id": ev.EventID,
+		"room_id":    roomID,
+		"is_direct":  fmt.Sprintf("%t", isDirect),
+		"peer_kind":  peerKind(!isDirect),
+	}
+
+	logger.DebugCF("matrix", "Received message", map[string]interface{}{
+		"sender_id": senderID,
+		"room_id":   roomID,
+		"preview":   utils.Truncate(text, 50),
+	})
+
+	c.setTyping(roomID, true)
+	c.HandleMessage(senderID, roomID, text, mediaPaths, metadata)
+}
+
+func (c *MatrixChannel) isDirect(roomID string) bool {
+	v, ok := c.directRoom.Load(roomID)
+	return ok && v.(bool)
+}
+
+// isMentioned checks intentional mentions, replies to the bot, pills linking
+// the bot and plain-text mentions of its MXID or localpart as a whole word.
+func (c *MatrixChannel) isMentioned(content matrixMessageContent) bool {
+	if content.Mentions != nil {
+		for _, id := range content.Mentions.UserIDs {
+			if id == c.userID {
+				return true
+			}
+		}
+	}
+	if content.RelatesTo != nil && content.RelatesTo.InReplyTo != nil {
+		if _, ok := c.sent.get(content.RelatesTo.InReplyTo.EventID); ok {
+			return true
+		}
+	}
+	userID := strings.ToLower(c.userID)
+	if formatted := strings.ToLower(content.FormattedBody); formatted != "" {
+		if strings.Contains(formatted, "matrix.to/#/"+userID) ||
+			strings.Contains(formatted, "matrix.to/#/"+strings.Replace(userID, "@", "%40", 1)) {
+			return true
+		}
+	}
+	body := strings.ToLower(content.Body)
+	if strings.Contains(body, userID) {
+		return true
+	}
+	if local := c.localpart(); local != "" && containsWord(body, local) {
+		return true
+	}
+	return false
+}
+
+// containsWord reports whether word occurs in s with no letter or digit
+// directly before or after it, so "bot" doesn't match "robot".
+func containsWord(s, word string) bool {
+	for offset := 0; ; {
+		idx := strings.Index(s[offset:], word)
+		if idx < 0 {
+			return false
+		}
+		start := offset + idx
+		end := start + len(word)
+		before, _ := utf8.DecodeLastRuneInString(s[:start])
+		after, _ := utf8.DecodeRuneInString(s[end:])
+		if !isWordRune(before) && !isWordRune(after) {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+func isWordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+}
+
+// stripMention removes a leading "@bot:server" or "bot:" style mention.
+func (c *MatrixChannel) stripMention(text string) string {
+	text = strings.ReplaceAll(text, c.userID, "")
+	trimmed := strings.TrimSpace(text)
+	if local := c.localpart(); local != "" && strings.HasPrefix(strings.ToLower(trimmed), local) {
+		rest := trimmed[len(local):]
+		if strings.HasPrefix(rest, ":") || strings.HasPrefix(rest, ",") {
+			trimmed = rest[1:]
+		}
+	}
+	return strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(trimmed), ":,"))
+}
+
+func (c *MatrixChannel) localpart() string {
+	local := strings.TrimPrefix(c.userID, "@")
+	if idx := strings.Index(local, ":"); idx > 0 {
+		local = local[:idx]
+	}
+	return strings.ToLower(local)
+}
+
+// downloadMedia fetches an mxc:// URI, preferring authenticated media.
+func (c *MatrixChannel) downloadMedia(mxc, filename string) string {
+	serverAndID, ok := strings.CutPrefix(mxc, "mxc://")
+	if !ok || serverAndID == "" {
+		return ""
+	}
+	if filename == "" {
+		filename = "file"
+	}
+	opts := utils.DownloadOptions{
+		LoggerPrefix: "matrix",
+		ExtraHeaders: map[string]string{"Authorization": "Bearer " + c.config.AccessToken},
+	}
+	if path := utils.DownloadFile(c.homeserver+"/_matrix/client/v1/media/download/"+serverAndID, filename, opts); path != "" {
+		return path
+	}
+	// Homeservers without authenticated media (pre Matrix 1.11)
+	return utils.DownloadFile(c.homeserver+"/_matrix/media/v3/download/"+serverAndID, filename, opts)
+}
+
+// sendMedia uploads a local file or URL and posts it as an image or file event.
+func (c *MatrixChannel) sendMedia(ctx context.Context, roomID, media string) error {
+	localPath := media
+	if strings.HasPrefix(media, "http://") || strings.HasPrefix(media, "https://") {
+		localPath = utils.DownloadFileSimple(media, filepath.Base(media))
+		if localPath == "" {
+			return fmt.Errorf("failed to download %s", media)
+		}
+		defer os.Remove(localPath)
+	}
+
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return err
+	}
+	filename := filepath.Base(localPath)
+	mimeType := mime.TypeByExtension(filepath.Ext(filename))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+
+	contentURI, err := c.upload(ctx, filename, mimeType, data)
+	if err != nil {
+		return err
+	}
+
+	msgType := "m.file"
+	if strings.HasPrefix(mimeType, "image/") {
+		msgType = "m.image"
+	}
+	_, err = c.sendEvent(ctx, roomID, "m.room.message", map[string]interface{}{
+		"msgtype": msgType,
+		"body":    filename,
+		"url":     contentURI,
+		"info": map[string]interface{}{
+			"mimetype": mimeType,
+			"size":     len(data),
+		},
+	})
+	return err
+}
+
+func (c *MatrixChannel) upload(ctx context.Context, filename, mimeType string, data []byte) (string, error) {
+	endpoint := c.homeserver + "/_matrix/media/v3/upload?filename=" + url.QueryEscape(filename)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.AccessToken)
+	req.Header.Set("Content-Type", mimeType)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("upload failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("matrix upload error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var out struct {
+		ContentURI string `json:"content_uri"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	return out.ContentURI, nil
+}
+
+func (c *MatrixChannel) sendEvent(ctx context.Context, roomID, eventType string, content interface{}) (string, error) {
+	txnID := fmt.Sprintf("picoclaw-%d-%d", time.Now().UnixNano(), c.txnCounter.Add(1))
+	path := fmt.Sprintf("/_matrix/client/v3/rooms/%s/send/%s/%s",
+		url.PathEscape(roomID), url.PathEscape(eventType), url.PathEscape(txnID))
+
+	var out struct {
+		EventID string `json:"event_id"`
+	}
+	if err := c.request(ctx, http.MethodPut, path, nil, content, &out); err != nil {
+		return "", err
+	}
+	return out.EventID, nil
+}
+
+func (c *MatrixChannel) setTyping(roomID string, typing bool) {
+	path := fmt.Sprintf("/_matrix/client/v3/rooms/%s/typing/%s", url.PathEscape(roomID), url.PathEscape(c.userID))
+	body := map[string]interface{}{"typing": typing}
+	if typing {
+		body["timeout"] = 30000
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := c.request(ctx, http.MethodPut, path, nil, body, nil); err != nil {
+		logger.DebugCF("matrix", "Failed to set typing", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// request performs an authenticated client-server API call.
+func (c *MatrixChannel) request(ctx context.Context, method, path string, query url.Values, payload, out interface{}) error {
+	endpoint := c.homeserver + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal payload: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.AccessToken)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("matrix API error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
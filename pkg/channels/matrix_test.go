@@ -0,0 +1,184 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+const matrixBotID = "@picoclaw:example.org"
+
+// fakeHomeserver serves just enough of the client-server API for MatrixChannel.
+type fakeHomeserver struct {
+	mu     sync.Mutex
+	syncs  int
+	joined []string
+	sent   []map[string]interface{}
+}
+
+func (f *fakeHomeserver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	path := r.URL.Path
+	switch {
+	case path == "/_matrix/client/v3/account/whoami":
+		json.NewEncoder(w).Encode(map[string]string{"user_id": matrixBotID})
+	case path == "/_matrix/client/v3/sync":
+		f.mu.Lock()
+		f.syncs++
+		n := f.syncs
+		f.mu.Unlock()
+		switch n {
+		case 1:
+			// Initial sync: history must be ignored
+			io.WriteString(w, `{"next_batch":"s1","rooms":{"join":{"!old:example.org":{"timeline":{"events":[
+				{"type":"m.room.message","sender":"@alice:example.org","event_id":"$old","content":{"msgtype":"m.text","body":"old"}}]}}}}}`)
+		case 2:
+			io.WriteString(w, `{"next_batch":"s2","rooms":{
+				"invite":{"!dm:example.org":{"invite_state":{"events":[
+					{"type":"m.room.member","sender":"@alice:example.org","state_key":"`+matrixBotID+`","content":{"membership":"invite","is_direct":true}}]}},
+					"!spam:example.org":{"invite_state":{"events":[
+					{"type":"m.room.member","sender":"@mallory:example.org","state_key":"`+matrixBotID+`","content":{"membership":"invite"}}]}}},
+				"join":{"!group:example.org":{"summary":{"m.joined_member_count":5},"timeline":{"events":[
+					{"type":"m.room.message","sender":"@alice:example.org","event_id":"$1","content":{"msgtype":"m.text","body":"no mention here"}},
+					{"type":"m.room.message","sender":"@mallory:example.org","event_id":"$2","content":{"msgtype":"m.text","body":"picoclaw: hi"}},
+					{"type":"m.room.message","sender":"@alice:example.org","event_id":"$3","content":{"msgtype":"m.text","body":"picoclaw: what time is it?"}}]}}}}}`)
+		default:
+			select {
+			case <-r.Context().Done():
+			case <-time.After(50 * time.Millisecond):
+			}
+			io.WriteString(w, `{"next_batch":"s3"}`)
+		}
+	case strings.HasPrefix(path, "/_matrix/client/v3/join/"):
+		f.mu.Lock()
+		f.joined = append(f.joined, strings.TrimPrefix(path, "/_matrix/client/v3/join/"))
+		f.mu.Unlock()
+		io.WriteString(w, `{}`)
+	case strings.Contains(path, "/send/m.room.message/"):
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		body["_path"] = path
+		f.mu.Lock()
+		f.sent = append(f.sent, body)
+		f.mu.Unlock()
+		io.WriteString(w, `{"event_id":"$reply"}`)
+	case strings.Contains(path, "/typing/"):
+		io.WriteString(w, `{}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestMatrixChannel(t *testing.T) {
+	hs := &fakeHomeserver{}
+	srv := httptest.NewServer(hs)
+	defer srv.Close()
+
+	msgBus := bus.NewMessageBus()
+	ch, err := NewMatrixChannel(config.MatrixConfig{
+		Enabled:        true,
+		Homeserver:     srv.URL,
+		AccessToken:    "token",
+		AutoJoin:       true,
+		RequireMention: true,
+		AllowFrom:      config.FlexibleStringSlice{"@alice:example.org"},
+	}, msgBus)
+	if err != nil {
+		t.Fatalf("NewMatrixChannel failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ch.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer ch.Stop(context.Background())
+
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("expected an inbound message")
+	}
+	if msg.SenderID != "@alice:example.org" || msg.ChatID != "!group:example.org" {
+		t.Errorf("unexpected sender/chat: %s %s", msg.SenderID, msg.ChatID)
+	}
+	if msg.Content != "what time is it?" {
+		t.Errorf("mention should be stripped, got %q", msg.Content)
+	}
+	if msg.Metadata["message_id"] != "$3" || msg.Metadata["is_direct"] != "false" {
+		t.Errorf("unexpected metadata: %v", msg.Metadata)
+	}
+
+	if err := ch.Send(ctx, bus.OutboundMessage{Channel: "matrix", ChatID: "!group:example.org", Content: "noon"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if len(hs.joined) != 1 || hs.joined[0] != "!dm:example.org" {
+		t.Errorf("expected to join only the allowed invite, got %v", hs.joined)
+	}
+	if len(hs.sent) != 1 || hs.sent[0]["body"] != "noon" || hs.sent[0]["msgtype"] != "m.text" {
+		t.Errorf("unexpected sent events: %v", hs.sent)
+	}
+	if !ch.isDirect("!dm:example.org") || ch.isDirect("!group:example.org") {
+		t.Error("direct room tracking is wrong")
+	}
+	if _, ok := ch.sent.get("$reply"); !ok {
+		t.Error("sent event should be recorded for reaction feedback")
+	}
+}
+
+func TestMatrixStripMention(t *testing.T) {
+	ch := &MatrixChannel{userID: matrixBotID}
+	cases := map[string]string{
+		"picoclaw: hello":         "hello",
+		"PicoClaw, hello":         "hello",
+		matrixBotID + " hello":    "hello",
+		"hello " + matrixBotID:    "hello",
+		"tell picoclaw something": "tell picoclaw something",
+	}
+	for in, want := range cases {
+		if got := ch.stripMention(in); got != want {
+			t.Errorf("stripMention(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMatrixIsMentioned(t *testing.T) {
+	ch := &MatrixChannel{userID: matrixBotID}
+	cases := []struct {
+		content matrixMessageContent
+		want    bool
+	}{
+		{matrixMessageContent{Body: "picoclaw: hello"}, true},
+		{matrixMessageContent{Body: "hey PicoClaw, status?"}, true},
+		{matrixMessageContent{Body: "ask " + matrixBotID}, true},
+		{matrixMessageContent{Body: "the picoclaws are here"}, false},
+		{matrixMessageContent{Body: "mypicoclaw broke"}, false},
+		{matrixMessageContent{
+			Body:          "Pico: hello",
+			FormattedBody: `<a href="https://matrix.to/#/@picoclaw:example.org">Pico</a>: hello`,
+		}, true},
+		{matrixMessageContent{
+			Body:          "Pico: hello",
+			FormattedBody: `<a href="https://matrix.to/#/%40picoclaw:example.org">Pico</a>: hello`,
+		}, true},
+	}
+	for _, tc := range cases {
+		if got := ch.isMentioned(tc.content); got != tc.want {
+			t.Errorf("isMentioned(%q) = %v, want %v", tc.content.Body, got, tc.want)
+		}
+	}
+}
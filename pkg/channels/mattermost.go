@@ -0,0 +1,660 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+// mattermostMaxMessage stays below Mattermost's 16383 character post limit.
+const mattermostMaxMessage = 16000
+
+// MattermostChannel connects as a bot account: events arrive over the
+// WebSocket API and replies are posted through REST. Chat IDs follow the
+// Slack layout, "channelID" or "channelID/rootPostID" for threads.
+type MattermostChannel struct {
+	*BaseChannel
+	config      config.MattermostConfig
+	baseURL     string
+	client      *http.Client
+	botUserID   string
+	botUsername string
+	transcriber *voice.GroqTranscriber
+	ctx         context.Context
+	cancel      context.CancelFunc
+	httpServer  *http.Server
+	threads     sync.Map // rootID -> struct{} for threads the bot replied in
+
+	connMu  sync.Mutex
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	seq     int64
+}
+
+type mattermostEvent struct {
+	Event     string                 `json:"event"`
+	Data      map[string]interface{} `json:"data"`
+	Broadcast struct {
+		ChannelID string `json:"channel_id"`
+	} `json:"broadcast"`
+}
+
+// str returns a string field of the event data; posts, reactions and
+// mention lists arrive as JSON encoded strings.
+func (e mattermostEvent) str(key string) string {
+	s, _ := e.Data[key].(string)
+	return s
+}
+
+type mattermostPost struct {
+	ID        string `json:"id"`
+	UserID    string `json:"user_id"`
+	ChannelID string `json:"channel_id"`
+	RootID    string `json:"root_id"`
+	Message   string `json:"message"`
+	Type      string `json:"type"`
+	Props     struct {
+		FromBot     interface{} `json:"from_bot"`
+		FromWebhook interface{} `json:"from_webhook"`
+	} `json:"props"`
+	Metadata struct {
+		Files []mattermostFileInfo `json:"files"`
+	} `json:"metadata"`
+}
+
+type mattermostFileInfo struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	MimeType string `json:"mime_type"`
+}
+
+type mattermostReaction struct {
+	UserID    string `json:"user_id"`
+	PostID    string `json:"post_id"`
+	EmojiName string `json:"emoji_name"`
+}
+
+func NewMattermostChannel(cfg config.MattermostConfig, messageBus *bus.MessageBus) (*MattermostChannel, error) {
+	if cfg.URL == "" || cfg.Token == "" {
+		return nil, fmt.Errorf("mattermost url and token are required")
+	}
+
+	base := NewBaseChannel("mattermost", cfg, messageBus, cfg.AllowFrom)
+	base.SetGroupPolicy(cfg.Groups, requireMentionPolicy(cfg.RequireMention, nil))
+
+	return &MattermostChannel{
+		BaseChannel: base,
+		config:      cfg,
+		baseURL:     strings.TrimRight(cfg.URL, "/"),
+		client:      &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+func (c *MattermostChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
+	c.transcriber = transcriber
+}
+
+func (c *MattermostChannel) Start(ctx context.Context) error {
+	logger.InfoC("mattermost", "Starting Mattermost channel")
+
+	var me struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	}
+	if err := c.api(ctx, http.MethodGet, "/api/v4/users/me", nil, &me); err != nil {
+		return fmt.Errorf("mattermost auth failed: %w", err)
+	}
+	c.botUserID = me.ID
+	c.botUsername = me.Username
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	c.setRunning(true)
+	go c.connectLoop()
+
+	if c.config.SlashCommandToken != "" {
+		c.startSlashCommandServer()
+	}
+
+	logger.InfoCF("mattermost", "Mattermost bot connected", map[string]interface{}{
+		"bot_user_id": c.botUserID,
+		"username":    c.botUsername,
+	})
+	return nil
+}
+
+func (c *MattermostChannel) Stop(ctx context.Context) error {
+	logger.InfoC("mattermost", "Stopping Mattermost channel")
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.connMu.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.connMu.Unlock()
+	if c.httpServer != nil {
+		c.httpServer.Shutdown(ctx)
+	}
+	c.setRunning(false)
+	return nil
+}
+
+func (c *MattermostChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("mattermost channel not running")
+	}
+
+	channelID, rootID := parseSlackChatID(msg.ChatID)
+	if channelID == "" {
+		return fmt.Errorf("invalid mattermost chat ID: %s", msg.ChatID)
+	}
+
+	if rootID != "" {
+		c.threads.Store(rootID, struct{}{})
+	}
+
+	var fileIDs []string
+	for _, media := range msg.Media {
+		id, err := c.uploadFile(ctx, channelID, media)
+		if err != nil {
+			logger.ErrorCF("mattermost", "Failed to upload media", map[string]interface{}{
+				"media": media,
+				"error": err.Error(),
+			})
+			continue
+		}
+		fileIDs = append(fileIDs, id)
+	}
+
+	chunks := splitMessage(msg.Content, mattermostMaxMessage)
+	for i, chunk := range chunks {
+		post := map[string]interface{}{
+			"channel_id": channelID,
+			"root_id":    rootID,
+			"message":    chunk,
+		}
+		// Attachments go with the first post
+		if i == 0 && len(fileIDs) > 0 {
+			post["file_ids"] = fileIDs
+		}
+		if strings.TrimSpace(chunk) == "" && post["file_ids"] == nil {
+			continue
+		}
+
+		var created mattermostPost
+		if err := c.api(ctx, http.MethodPost, "/api/v4/posts", post, &created); err != nil {
+			return fmt.Errorf("failed to send mattermost message: %w", err)
+		}
+		c.RecordSent(msg.ChatID, created.ID, chunk)
+	}
+
+	logger.DebugCF("mattermost", "Message sent", map[string]interface{}{
+		"channel_id": channelID,
+		"root_id":    rootID,
+	})
+	return nil
+}
+
+// api performs a REST call authenticated with the bot token.
+func (c *MattermostChannel) api(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.do(req, out)
+}
+
+func (c *MattermostChannel) do(req *http.Request, out interface{}) error {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&apiErr)
+		return fmt.Errorf("mattermost API returned HTTP %d: %s", resp.StatusCode, apiErr.Message)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+func (c *MattermostChannel) uploadFile(ctx context.Context, channelID, media string) (string, error) {
+	body, contentType, err := multipartMedia("files", media, map[string]string{"channel_id": channelID})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/v4/files", body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.Token)
+	req.Header.Set("Content-Type", contentType)
+
+	var resp struct {
+		FileInfos []mattermostFileInfo `json:"file_infos"`
+	}
+	if err := c.do(req, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.FileInfos) == 0 {
+		return "", fmt.Errorf("upload returned no file")
+	}
+	return resp.FileInfos[0].ID, nil
+}
+
+func (c *MattermostChannel) connectLoop() {
+	backoff := 2 * time.Second
+	maxBackoff := 2 * time.Minute
+
+	for {
+		connected, err := c.listen()
+		if c.ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = 2 * time.Second
+		}
+		logger.WarnCF("mattermost", "WebSocket connection lost, reconnecting", map[string]interface{}{
+			"error":   err.Error(),
+			"backoff": backoff.String(),
+		})
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// listen runs one WebSocket connection until it drops.
+func (c *MattermostChannel) listen() (bool, error) {
+	wsURL, err := websocketURL(c.baseURL, "/api/v4/websocket")
+	if err != nil {
+		return false, err
+	}
+	dialer := websocket.Dialer{HandshakeTimeout: 15 * time.Second}
+	header := http.Header{"Authorization": []string{"Bearer " + c.config.Token}}
+	conn, _, err := dialer.DialContext(c.ctx, wsURL, header)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	c.connMu.Lock()
+	c.conn = conn
+	c.connMu.Unlock()
+	defer func() {
+		c.connMu.Lock()
+		if c.conn == conn {
+			c.conn = nil
+		}
+		c.connMu.Unlock()
+	}()
+
+	// Servers that ignore the upgrade header authenticate with a challenge
+	if err := c.writeAction("authentication_challenge", map[string]string{"token": c.config.Token}); err != nil {
+		return false, err
+	}
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return true, err
+		}
+		var ev mattermostEvent
+		if json.Unmarshal(data, &ev) != nil || ev.Event == "" {
+			continue
+		}
+		switch ev.Event {
+		case "posted":
+			c.handlePosted(ev)
+		case "reaction_added":
+			c.handleReactionAdded(ev)
+		}
+	}
+}
+
+func (c *MattermostChannel) writeAction(action string, data interface{}) error {
+	c.connMu.Lock()
+	conn := c.conn
+	c.connMu.Unlock()
+	if conn == nil {
+		return fmt.Errorf("mattermost websocket not connected")
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.seq++
+	return conn.WriteJSON(map[string]interface{}{"seq": c.seq, "action": action, "data": data})
+}
+
+func (c *MattermostChannel) handleReactionAdded(ev mattermostEvent) {
+	var r mattermostReaction
+	if json.Unmarshal([]byte(ev.str("reaction")), &r) != nil || r.UserID == c.botUserID {
+		return
+	}
+	c.HandleReaction(r.UserID, ev.Broadcast.ChannelID, r.PostID, r.EmojiName, false)
+}
+
+func (c *MattermostChannel) handlePosted(ev mattermostEvent) {
+	var post mattermostPost
+	if err := json.Unmarshal([]byte(ev.str("post")), &post); err != nil {
+		return
+	}
+	if post.UserID == c.botUserID || post.Type != "" || post.Props.FromBot != nil || post.Props.FromWebhook != nil {
+		return
+	}
+
+	senderID := post.UserID
+	if name := strings.TrimPrefix(ev.str("sender_name"), "@"); name != "" {
+		senderID += "|" + name
+	}
+	isDirect := ev.str("channel_type") == "D"
+	if !c.IsAllowed(senderID) && (isDirect || !c.IsAllowedChat(post.ChannelID)) {
+		logger.DebugCF("mattermost", "Message rejected by allowlist", map[string]interface{}{
+			"user_id": post.UserID,
+		})
+		return
+	}
+
+	mentioned := c.isMentioned(ev.str("mentions"), post.Message)
+
+	// Mentions outside a thread start one on the triggering post, like Slack
+	chatID := post.ChannelID
+	switch {
+	case post.RootID != "":
+		chatID = post.ChannelID + "/" + post.RootID
+	case !isDirect && mentioned:
+		chatID = post.ChannelID + "/" + post.ID
+	}
+
+	content := c.stripBotMention(post.Message)
+	if !isDirect {
+		text, reply := c.GroupReply(GroupMessage{
+			SenderID:   senderID,
+			SenderName: strings.TrimPrefix(ev.str("sender_name"), "@"),
+			ChatID:     chatID,
+			GroupID:    post.ChannelID,
+			Content:    content,
+			Mentioned:  mentioned,
+			ReplyToBot: c.isBotThread(post.RootID),
+		})
+		if !reply {
+			return
+		}
+		content = text
+	}
+
+	var mediaPaths []string
+	localFiles := []string{}
+	defer func() {
+		for _, file := range localFiles {
+			if err := os.Remove(file); err != nil {
+				logger.DebugCF("mattermost", "Failed to cleanup temp file", map[string]interface{}{
+					"file":  file,
+					"error": err.Error(),
+				})
+			}
+		}
+	}()
+
+	for _, file := range post.Metadata.Files {
+		localPath := utils.DownloadFile(c.baseURL+"/api/v4/files/"+url.PathEscape(file.ID), file.Name, utils.DownloadOptions{
+			LoggerPrefix: "mattermost",
+			ExtraHeaders: map[string]string{"Authorization": "Bearer " + c.config.Token},
+		})
+		if localPath == "" {
+			content = appendContent(content, fmt.Sprintf("[file: %s]", file.Name))
+			continue
+		}
+		localFiles = append(localFiles, localPath)
+
+		if utils.IsAudioFile(file.Name, file.MimeType) {
+			content = appendContent(content, c.transcribe(localPath, file.Name))
+			continue
+		}
+		mediaPaths = append(mediaPaths, localPath)
+		content = appendContent(content, fmt.Sprintf("[file: %s]", file.Name))
+	}
+
+	if strings.TrimSpace(content) == "" {
+		return
+	}
+
+	metadata := map[string]string{
+		"platform":     "mattermost",
+		"message_id":   post.ID,
+		"channel_id":   post.ChannelID,
+		"root_id":      post.RootID,
+		"channel_type": ev.str("channel_type"),
+		"user_name":    strings.TrimPrefix(ev.str("sender_name"), "@"),
+		"peer_kind":    peerKind(!isDirect),
+	}
+	if mentioned {
+		metadata["is_mention"] = "true"
+	}
+
+	logger.DebugCF("mattermost", "Received message", map[string]interface{}{
+		"sender_id": senderID,
+		"chat_id":   chatID,
+		"preview":   utils.Truncate(content, 50),
+	})
+
+	_, parentID := parseSlackChatID(chatID)
+	c.writeAction("user_typing", map[string]string{"channel_id": post.ChannelID, "parent_id": parentID})
+	c.HandleMessage(senderID, chatID, content, mediaPaths, metadata)
+}
+
+// isMentioned checks the server-computed mention list, falling back to an
+// @username match in the text.
+func (c *MattermostChannel) isMentioned(mentions, message string) bool {
+	var ids []string
+	if json.Unmarshal([]byte(mentions), &ids) == nil {
+		for _, id := range ids {
+			if id == c.botUserID {
+				return true
+			}
+		}
+	}
+	return c.botUsername != "" && strings.Contains(strings.ToLower(message), "@"+strings.ToLower(c.botUsername))
+}
+
+// isBotThread reports whether the bot has replied in a thread, so
+// follow-ups in it don't need another mention.
+func (c *MattermostChannel) isBotThread(rootID string) bool {
+	if rootID == "" {
+		return false
+	}
+	_, ok := c.threads.Load(rootID)
+	return ok
+}
+
+func (c *MattermostChannel) stripBotMention(text string) string {
+	if c.botUsername == "" {
+		return strings.TrimSpace(text)
+	}
+	mention := "@" + strings.ToLower(c.botUsername)
+	for {
+		idx := strings.Index(strings.ToLower(text), mention)
+		if idx < 0 {
+			break
+		}
+		text = text[:idx] + text[idx+len(mention):]
+	}
+	return strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(text), ":,"))
+}
+
+func (c *MattermostChannel) transcribe(localPath, name string) string {
+	if c.transcriber == nil || !c.transcriber.IsAvailable() {
+		return fmt.Sprintf("[audio: %s]", name)
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, transcriptionTimeout)
+	defer cancel()
+	result, err := c.transcriber.Transcribe(ctx, localPath)
+	if err != nil {
+		logger.ErrorCF("mattermost", "Voice transcription failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return fmt.Sprintf("[audio: %s (transcription failed)]", name)
+	}
+	return fmt.Sprintf("[audio transcription: %s]", result.Text)
+}
+
+// startSlashCommandServer serves the request URL of a Mattermost custom
+// slash command. The reply is posted to the channel like any other message.
+func (c *MattermostChannel) startSlashCommandServer() {
+	mux := http.NewServeMux()
+	path := c.config.WebhookPath
+	if path == "" {
+		path = "/webhook/mattermost"
+	}
+	mux.HandleFunc(path, c.handleSlashCommand)
+
+	addr := fmt.Sprintf("%s:%d", c.config.WebhookHost, c.config.WebhookPort)
+	c.httpServer = &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+
+	go func() {
+		logger.InfoCF("mattermost", "Slash command server listening", map[string]interface{}{
+			"addr": addr,
+			"path": path,
+		})
+		if err := c.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.ErrorCF("mattermost", "Slash command server error", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}()
+}
+
+func (c *MattermostChannel) handleSlashCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.PostForm.Get("token")), []byte(c.config.SlashCommandToken)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	senderID := r.PostForm.Get("user_id")
+	if name := r.PostForm.Get("user_name"); name != "" {
+		senderID += "|" + name
+	}
+	channelID := r.PostForm.Get("channel_id")
+	content := r.PostForm.Get("text")
+	if strings.TrimSpace(content) == "" {
+		content = "help"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !c.IsAllowed(senderID) {
+		json.NewEncoder(w).Encode(map[string]string{"response_type": "ephemeral", "text": "You are not allowed to use this command."})
+		return
+	}
+	w.Write([]byte("{}"))
+
+	metadata := map[string]string{
+		"channel_id": channelID,
+		"platform":   "mattermost",
+		"is_command": "true",
+		"command":    r.PostForm.Get("command"),
+		"trigger_id": r.PostForm.Get("trigger_id"),
+	}
+
+	logger.DebugCF("mattermost", "Slash command received", map[string]interface{}{
+		"sender_id": senderID,
+		"command":   r.PostForm.Get("command"),
+		"text":      utils.Truncate(content, 50),
+	})
+
+	c.HandleMessage(senderID, channelID, content, nil, metadata)
+}
+
+// websocketURL turns an http(s) base URL into the ws(s) URL for path.
+func websocketURL(base, path string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http":
+		u.Scheme = "ws"
+	default:
+		return "", fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + path
+	return u.String(), nil
+}
+
+// multipartMedia builds a multipart body holding one outbound media item
+// under field, plus any extra form fields.
+func multipartMedia(field, media string, fields map[string]string) (io.Reader, string, error) {
+	filename, _, data, err := loadOutboundMedia(media)
+	if err != nil {
+		return nil, "", err
+	}
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		if v != "" {
+			w.WriteField(k, v)
+		}
+	}
+	part, err := w.CreateFormFile(field, filename)
+	if err != nil {
+		return nil, "", err
+	}
+	part.Write(data)
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return &buf, w.FormDataContentType(), nil
+}
@@ -0,0 +1,247 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// fakeMattermost serves the REST and WebSocket endpoints the channel uses.
+// Events written to events are pushed to the connected client.
+type fakeMattermost struct {
+	*httptest.Server
+	events chan string
+	mu     sync.Mutex
+	posts  []map[string]interface{}
+}
+
+func newFakeMattermost(t *testing.T) *fakeMattermost {
+	t.Helper()
+	f := &fakeMattermost{events: make(chan string, 10)}
+	upgrader := websocket.Upgrader{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/users/me", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			http.Error(w, `{"message":"invalid token"}`, http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"id":"bot1","username":"picobot"}`))
+	})
+	mux.HandleFunc("/api/v4/websocket", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var challenge struct {
+			Action string            `json:"action"`
+			Data   map[string]string `json:"data"`
+		}
+		if conn.ReadJSON(&challenge) != nil || challenge.Action != "authentication_challenge" || challenge.Data["token"] != "tok" {
+			return
+		}
+		go func() {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case ev := <-f.events:
+				conn.WriteMessage(websocket.TextMessage, []byte(ev))
+			}
+		}
+	})
+	mux.HandleFunc("/api/v4/posts", func(w http.ResponseWriter, r *http.Request) {
+		var post map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&post)
+		f.mu.Lock()
+		f.posts = append(f.posts, post)
+		id := fmt.Sprintf("sent%d", len(f.posts))
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]string{"id": id})
+	})
+	mux.HandleFunc("/api/v4/files", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil || r.FormValue("channel_id") == "" {
+			http.Error(w, `{"message":"bad upload"}`, http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"file_infos":[{"id":"file9"}]}`))
+	})
+	mux.HandleFunc("/api/v4/files/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("PNG data"))
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeMattermost) sentPosts() []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]map[string]interface{}(nil), f.posts...)
+}
+
+func mattermostPosted(channelType string, post map[string]interface{}, mentions ...string) string {
+	postJSON, _ := json.Marshal(post)
+	data := map[string]interface{}{
+		"post":         string(postJSON),
+		"channel_type": channelType,
+		"sender_name":  "@alice",
+		"set_online":   true,
+	}
+	if len(mentions) > 0 {
+		m, _ := json.Marshal(mentions)
+		data["mentions"] = string(m)
+	}
+	ev, _ := json.Marshal(map[string]interface{}{
+		"event":     "posted",
+		"data":      data,
+		"broadcast": map[string]string{"channel_id": post["channel_id"].(string)},
+	})
+	return string(ev)
+}
+
+func TestMattermostChannel(t *testing.T) {
+	server := newFakeMattermost(t)
+	mb := bus.NewMessageBus()
+	ch, err := NewMattermostChannel(config.MattermostConfig{
+		URL:            server.URL,
+		Token:          "tok",
+		RequireMention: true,
+	}, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := ch.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer ch.Stop(ctx)
+
+	server.events <- mattermostPosted("D", map[string]interface{}{
+		"id": "p1", "user_id": "u1", "channel_id": "dm1", "message": "hello",
+		"metadata": map[string]interface{}{"files": []map[string]string{{"id": "f1", "name": "cat.png", "mime_type": "image/png"}}},
+	})
+	server.events <- mattermostPosted("O", map[string]interface{}{"id": "p2", "user_id": "u1", "channel_id": "town", "message": "just chatting"})
+	server.events <- mattermostPosted("O", map[string]interface{}{"id": "p3", "user_id": "u1", "channel_id": "town", "message": "@picobot what's up?"}, "bot1")
+	server.events <- mattermostPosted("O", map[string]interface{}{"id": "p4", "user_id": "bot1", "channel_id": "town", "message": "my own echo"})
+
+	msg, ok := mb.ConsumeInbound(ctx)
+	if !ok || msg.ChatID != "dm1" || msg.Content != "hello\n[file: cat.png]" || len(msg.Media) != 1 {
+		t.Fatalf("unexpected DM: %+v", msg)
+	}
+	if msg.SenderID != "u1|alice" || msg.SessionKey != "mattermost:dm1" {
+		t.Errorf("sender/session = %q / %q", msg.SenderID, msg.SessionKey)
+	}
+	msg, ok = mb.ConsumeInbound(ctx)
+	if !ok || msg.ChatID != "town/p3" || msg.Content != "what's up?" {
+		t.Fatalf("unexpected mention: %+v", msg)
+	}
+
+	if err := ch.Send(ctx, bus.OutboundMessage{ChatID: "town/p3", Content: "all good"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	posts := server.sentPosts()
+	if len(posts) != 1 || posts[0]["channel_id"] != "town" || posts[0]["root_id"] != "p3" || posts[0]["message"] != "all good" {
+		t.Fatalf("posts = %+v", posts)
+	}
+
+	// Follow-ups in a thread the bot replied in don't need a mention
+	server.events <- mattermostPosted("O", map[string]interface{}{"id": "p5", "user_id": "u1", "channel_id": "town", "root_id": "p3", "message": "and tomorrow?"})
+	msg, ok = mb.ConsumeInbound(ctx)
+	if !ok || msg.ChatID != "town/p3" || msg.Content != "and tomorrow?" {
+		t.Fatalf("unexpected thread follow-up: %+v", msg)
+	}
+
+	feedback := make(chan bus.FeedbackEvent, 1)
+	mb.SetFeedbackHandler(func(ev bus.FeedbackEvent) { feedback <- ev })
+	reaction, _ := json.Marshal(map[string]string{"user_id": "u1", "post_id": "sent1", "emoji_name": "+1"})
+	ev, _ := json.Marshal(map[string]interface{}{
+		"event":     "reaction_added",
+		"data":      map[string]string{"reaction": string(reaction)},
+		"broadcast": map[string]string{"channel_id": "town"},
+	})
+	server.events <- string(ev)
+	select {
+	case fb := <-feedback:
+		if fb.ChatID != "town/p3" || fb.Score != 1 {
+			t.Errorf("feedback = %+v", fb)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("reaction not reported")
+	}
+}
+
+func TestMattermostSlashCommand(t *testing.T) {
+	mb := bus.NewMessageBus()
+	ch, _ := NewMattermostChannel(config.MattermostConfig{
+		URL:               "http://127.0.0.1",
+		Token:             "tok",
+		SlashCommandToken: "cmdtok",
+	}, mb)
+
+	post := func(token, text string) *httptest.ResponseRecorder {
+		form := url.Values{"token": {token}, "user_id": {"u1"}, "user_name": {"alice"}, "channel_id": {"town"}, "command": {"/ask"}, "text": {text}}
+		req := httptest.NewRequest(http.MethodPost, "/webhook/mattermost", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		ch.handleSlashCommand(rec, req)
+		return rec
+	}
+
+	if rec := post("wrong", "hi"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("bad token: status %d", rec.Code)
+	}
+	if rec := post("cmdtok", "summarize the day"); rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	msg, ok := mb.ConsumeInbound(ctx)
+	if !ok || msg.ChatID != "town" || msg.Content != "summarize the day" || msg.Metadata["command"] != "/ask" {
+		t.Fatalf("unexpected command message: %+v", msg)
+	}
+}
+
+func TestMattermostUploadAttachment(t *testing.T) {
+	server := newFakeMattermost(t)
+	ch, _ := NewMattermostChannel(config.MattermostConfig{URL: server.URL, Token: "tok"}, bus.NewMessageBus())
+	ch.setRunning(true)
+
+	path := filepath.Join(t.TempDir(), "chart.png")
+	if err := os.WriteFile(path, []byte("PNG"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "town", Content: "chart", Media: []string{path}}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	posts := server.sentPosts()
+	if len(posts) != 1 {
+		t.Fatalf("posts = %+v", posts)
+	}
+	if ids, _ := posts[0]["file_ids"].([]interface{}); len(ids) != 1 || ids[0] != "file9" {
+		t.Errorf("file_ids = %v", posts[0]["file_ids"])
+	}
+}
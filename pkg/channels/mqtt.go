@@ -0,0 +1,341 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/mqtt"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// MQTTChannel subscribes to configured topics (Zigbee2MQTT, Tasmota, ...)
+// and turns selected messages into agent messages. Retained messages are
+// treated as state, not events, and never reach the agent.
+type MQTTChannel struct {
+	*BaseChannel
+	config config.MQTTConfig
+	topics []*mqttTopic
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	clientMu sync.Mutex
+	client   *mqtt.Client
+
+	mu        sync.Mutex
+	pending   map[string]*mqttPending // topic -> debounced message
+	delivered map[string]time.Time    // topic -> last delivery
+}
+
+type mqttTopic struct {
+	cfg      config.MQTTTopicConfig
+	filter   *template.Template
+	template *template.Template
+	chatID   *template.Template
+}
+
+type mqttPending struct {
+	timer *time.Timer
+	msg   mqtt.Message
+}
+
+// NewMQTTChannel creates an MQTT channel; templates are parsed up front.
+func NewMQTTChannel(cfg config.MQTTConfig, messageBus *bus.MessageBus) (*MQTTChannel, error) {
+	if cfg.Broker == "" {
+		return nil, fmt.Errorf("mqtt broker is required")
+	}
+
+	topics := make([]*mqttTopic, 0, len(cfg.Topics))
+	for _, tc := range cfg.Topics {
+		t := &mqttTopic{cfg: tc}
+		var err error
+		if t.filter, err = parseEventTemplate("filter", tc.Filter); err != nil {
+			return nil, fmt.Errorf("mqtt topic %s: filter: %w", tc.Topic, err)
+		}
+		if t.template, err = parseEventTemplate("template", tc.Template); err != nil {
+			return nil, fmt.Errorf("mqtt topic %s: template: %w", tc.Topic, err)
+		}
+		if t.chatID, err = parseEventTemplate("chat_id", tc.ChatID); err != nil {
+			return nil, fmt.Errorf("mqtt topic %s: chat_id: %w", tc.Topic, err)
+		}
+		topics = append(topics, t)
+	}
+
+	return &MQTTChannel{
+		BaseChannel: NewBaseChannel("mqtt", cfg, messageBus, nil), // access is controlled by the broker
+		config:      cfg,
+		topics:      topics,
+		pending:     make(map[string]*mqttPending),
+		delivered:   make(map[string]time.Time),
+	}, nil
+}
+
+// Start connects in the background and keeps reconnecting until Stop.
+func (c *MQTTChannel) Start(ctx context.Context) error {
+	logger.InfoC("mqtt", "Starting MQTT channel")
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	c.setRunning(true)
+	go c.connectLoop()
+	return nil
+}
+
+// Stop disconnects from the broker and drops pending debounced messages.
+func (c *MQTTChannel) Stop(ctx context.Context) error {
+	logger.InfoC("mqtt", "Stopping MQTT channel")
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.clientMu.Lock()
+	if c.client != nil {
+		c.client.Close()
+	}
+	c.clientMu.Unlock()
+
+	c.mu.Lock()
+	for topic, p := range c.pending {
+		p.timer.Stop()
+		delete(c.pending, topic)
+	}
+	c.mu.Unlock()
+
+	c.setRunning(false)
+	return nil
+}
+
+// Send publishes the agent's reply to reply_topic, if configured.
+func (c *MQTTChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if c.config.ReplyTopic == "" {
+		logger.DebugCF("mqtt", "MQTT outbound (no reply_topic, logged only)", map[string]interface{}{
+			"chat_id":     msg.ChatID,
+			"content_len": len(msg.Content),
+		})
+		return nil
+	}
+
+	c.clientMu.Lock()
+	client := c.client
+	c.clientMu.Unlock()
+	if client == nil {
+		return fmt.Errorf("mqtt not connected")
+	}
+
+	payload, _ := json.Marshal(map[string]string{"chat_id": msg.ChatID, "content": msg.Content})
+	return client.Publish(c.config.ReplyTopic, payload, false)
+}
+
+func (c *MQTTChannel) connectLoop() {
+	backoff := 2 * time.Second
+	maxBackoff := 2 * time.Minute
+
+	for {
+		connected, err := c.session()
+		if c.ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = 2 * time.Second
+		}
+		logger.WarnCF("mqtt", "MQTT connection lost, reconnecting", map[string]interface{}{
+			"error":   err.Error(),
+			"backoff": backoff.String(),
+		})
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// session runs one broker connection until it drops, reporting whether it
+// got as far as subscribing so the next attempt starts from a short backoff.
+func (c *MQTTChannel) session() (bool, error) {
+	dialCtx, cancel := context.WithTimeout(c.ctx, 30*time.Second)
+	defer cancel()
+	client, err := mqtt.Dial(dialCtx, mqtt.Options{
+		Broker:   c.config.Broker,
+		ClientID: c.config.ClientID,
+		Username: c.config.Username,
+		Password: c.config.Password,
+	}, c.handleMessage)
+	if err != nil {
+		return false, err
+	}
+
+	filters := make([]string, 0, len(c.topics))
+	for _, t := range c.topics {
+		filters = append(filters, t.cfg.Topic)
+	}
+	if len(filters) > 0 {
+		if err := client.Subscribe(dialCtx, filters...); err != nil {
+			client.Close()
+			return false, err
+		}
+	}
+
+	c.clientMu.Lock()
+	c.client = client
+	c.clientMu.Unlock()
+	logger.InfoCF("mqtt", "MQTT channel connected", map[string]interface{}{
+		"broker": c.config.Broker,
+		"topics": filters,
+	})
+
+	select {
+	case <-c.ctx.Done():
+		client.Close()
+	case <-client.Done():
+	}
+
+	c.clientMu.Lock()
+	if c.client == client {
+		c.client = nil
+	}
+	c.clientMu.Unlock()
+	return true, client.Err()
+}
+
+// handleMessage runs on the client's read loop: it only debounces, leaving
+// filtering, rendering and rate limiting to deliver.
+func (c *MQTTChannel) handleMessage(msg mqtt.Message) {
+	if msg.Retained || msg.Topic == c.config.ReplyTopic {
+		return
+	}
+	t := c.match(msg.Topic)
+	if t == nil {
+		return
+	}
+
+	if t.cfg.Debounce <= 0 {
+		c.deliver(t, msg)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.pending[msg.Topic]; ok {
+		p.msg = msg
+		p.timer.Reset(time.Duration(t.cfg.Debounce) * time.Second)
+		return
+	}
+	p := &mqttPending{msg: msg}
+	p.timer = time.AfterFunc(time.Duration(t.cfg.Debounce)*time.Second, func() {
+		c.mu.Lock()
+		latest := p.msg
+		delete(c.pending, msg.Topic)
+		c.mu.Unlock()
+		c.deliver(t, latest)
+	})
+	c.pending[msg.Topic] = p
+}
+
+func (c *MQTTChannel) match(topic string) *mqttTopic {
+	for _, t := range c.topics {
+		if mqtt.Match(t.cfg.Topic, topic) {
+			return t
+		}
+	}
+	return nil
+}
+
+func (c *MQTTChannel) deliver(t *mqttTopic, msg mqtt.Message) {
+	inbound, keep, err := t.message(msg)
+	if err != nil {
+		logger.ErrorCF("mqtt", "MQTT topic template failed", map[string]interface{}{
+			"topic": msg.Topic,
+			"error": err.Error(),
+		})
+		return
+	}
+	if !keep {
+		return
+	}
+
+	if t.cfg.MinInterval > 0 {
+		c.mu.Lock()
+		last, seen := c.delivered[msg.Topic]
+		if seen && time.Since(last) < time.Duration(t.cfg.MinInterval)*time.Second {
+			c.mu.Unlock()
+			logger.DebugCF("mqtt", "MQTT message rate limited", map[string]interface{}{"topic": msg.Topic})
+			return
+		}
+		c.delivered[msg.Topic] = time.Now()
+		c.mu.Unlock()
+	}
+
+	logger.InfoCF("mqtt", "MQTT event", map[string]interface{}{
+		"topic":   msg.Topic,
+		"channel": inbound.Channel,
+		"preview": utils.Truncate(inbound.Content, 80),
+	})
+	c.bus.PublishInbound(inbound)
+}
+
+// message renders the inbound message for msg, or keep=false when the
+// filter or template leaves nothing to send.
+func (t *mqttTopic) message(msg mqtt.Message) (inbound bus.InboundMessage, keep bool, err error) {
+	raw := string(msg.Payload)
+	var payload interface{} = raw
+	var decoded interface{}
+	if json.Unmarshal(msg.Payload, &decoded) == nil {
+		payload = decoded
+	}
+	data := map[string]interface{}{"topic": msg.Topic, "payload": payload, "raw": raw}
+
+	if t.filter != nil {
+		verdict, err := renderEventTemplate(t.filter, data, nil)
+		if err != nil || !templateVerdict(verdict) {
+			return inbound, false, err
+		}
+	}
+
+	content, err := renderEventTemplate(t.template, data, nil)
+	if err != nil {
+		return inbound, false, err
+	}
+	if t.template == nil {
+		content = fmt.Sprintf("%s: %s", msg.Topic, utils.Truncate(raw, 2000))
+	}
+	if content == "" {
+		return inbound, false, nil
+	}
+
+	inbound = bus.InboundMessage{
+		SenderID: "mqtt:" + msg.Topic,
+		Content:  fmt.Sprintf("[MQTT: %s] %s", msg.Topic, content),
+		Metadata: map[string]string{
+			"platform": "mqtt",
+			"topic":    msg.Topic,
+		},
+	}
+
+	if t.cfg.Channel != "" {
+		chatID, err := renderEventTemplate(t.chatID, data, nil)
+		if err != nil {
+			return inbound, false, err
+		}
+		if chatID == "" {
+			return inbound, false, fmt.Errorf("chat_id is required with channel %q", t.cfg.Channel)
+		}
+		inbound.Channel = t.cfg.Channel
+		inbound.ChatID = chatID
+		inbound.SessionKey = fmt.Sprintf("%s:%s", inbound.Channel, chatID)
+		return inbound, true, nil
+	}
+
+	// Session file names can't contain "/", so topics are sanitized.
+	inbound.Channel = "mqtt"
+	inbound.ChatID = sanitizeWebhookSession(msg.Topic)
+	inbound.SessionKey = "mqtt:" + inbound.ChatID
+	return inbound, true, nil
+}
@@ -0,0 +1,119 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/mqtt"
+	"github.com/sipeed/picoclaw/pkg/mqtt/mqtttest"
+)
+
+func TestMQTTChannel(t *testing.T) {
+	broker := mqtttest.NewBroker()
+	defer broker.Close()
+	broker.Publish("zigbee2mqtt/door", []byte(`{"contact":false}`), true) // retained state is ignored
+
+	mb := bus.NewMessageBus()
+	ch, err := NewMQTTChannel(config.MQTTConfig{
+		Broker:     broker.URL,
+		ClientID:   "picoclaw-test",
+		ReplyTopic: "picoclaw/reply",
+		Topics: []config.MQTTTopicConfig{
+			{
+				Topic:    "zigbee2mqtt/+",
+				Filter:   `{{if eq .payload.contact false}}true{{end}}`,
+				Template: `{{.topic}} opened`,
+			},
+			{
+				Topic:    "home/temperature",
+				Debounce: 1,
+				Channel:  "telegram",
+				ChatID:   "42",
+			},
+		},
+	}, mb)
+	if err != nil {
+		t.Fatalf("NewMQTTChannel: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ch.Start(ctx)
+	defer ch.Stop(ctx)
+
+	waitFor(t, func() bool {
+		ch.clientMu.Lock()
+		defer ch.clientMu.Unlock()
+		return ch.client != nil
+	})
+
+	broker.Publish("zigbee2mqtt/door", []byte(`{"contact":true}`), false) // filtered out
+	broker.Publish("zigbee2mqtt/door", []byte(`{"contact":false}`), false)
+	for _, temp := range []string{"20.1", "20.4", "21.0"} {
+		broker.Publish("home/temperature", []byte(temp), false)
+	}
+
+	msg, ok := mb.ConsumeInbound(ctx)
+	if !ok || msg.Content != "[MQTT: zigbee2mqtt/door] zigbee2mqtt/door opened" || msg.ChatID != "zigbee2mqtt_door" || msg.Channel != "mqtt" {
+		t.Fatalf("unexpected door message: %+v", msg)
+	}
+	msg, ok = mb.ConsumeInbound(ctx)
+	if !ok || msg.Content != "[MQTT: home/temperature] home/temperature: 21.0" || msg.Channel != "telegram" || msg.ChatID != "42" {
+		t.Fatalf("expected only the latest debounced reading, got %+v", msg)
+	}
+
+	if err := ch.Send(ctx, bus.OutboundMessage{Channel: "mqtt", ChatID: "zigbee2mqtt_door", Content: "Door is open"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	waitFor(t, func() bool {
+		for _, m := range broker.Received() {
+			if m.Topic == "picoclaw/reply" {
+				var reply map[string]string
+				json.Unmarshal(m.Payload, &reply)
+				return reply["content"] == "Door is open"
+			}
+		}
+		return false
+	})
+}
+
+func TestMQTTMinInterval(t *testing.T) {
+	mb := bus.NewMessageBus()
+	ch, _ := NewMQTTChannel(config.MQTTConfig{
+		Broker: "tcp://127.0.0.1:1",
+		Topics: []config.MQTTTopicConfig{{Topic: "sensors/#", MinInterval: 60}},
+	}, mb)
+
+	t1 := ch.match("sensors/motion")
+	for i := 0; i < 3; i++ {
+		ch.deliver(t1, mqtt.Message{Topic: "sensors/motion", Payload: []byte("on")})
+	}
+	ch.deliver(t1, mqtt.Message{Topic: "sensors/other", Payload: []byte("on")})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	count := 0
+	for {
+		if _, ok := mb.ConsumeInbound(ctx); !ok {
+			break
+		}
+		count++
+	}
+	if count != 2 {
+		t.Errorf("expected one message per topic, got %d", count)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
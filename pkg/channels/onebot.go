@@ -93,6 +93,7 @@ type oneBotSendGroupMsgParams struct {
 
 func NewOneBotChannel(cfg config.OneBotConfig, messageBus *bus.MessageBus) (*OneBotChannel, error) {
 	base := NewBaseChannel("onebot", cfg, messageBus, cfg.AllowFrom)
+	base.SetGroupPolicy(cfg.Groups, config.GroupPolicyConfig{Prefixes: cfg.GroupTriggerPrefix})
 
 	const dedupSize = 1024
 	return &OneBotChannel{
@@ -572,6 +573,7 @@ func (c *OneBotChannel) handleMessage(evt *oneBotEvent) {
 	switch evt.MessageType {
 	case "private":
 		chatID = "private:" + senderID
+		metadata["peer_kind"] = "direct"
 		logger.InfoCF("onebot", "Received private message", map[string]interface{}{
 			"sender":     senderID,
 			"message_id": evt.MessageID,
@@ -583,6 +585,7 @@ func (c *OneBotChannel) handleMessage(evt *oneBotEvent) {
 		groupIDStr := strconv.FormatInt(evt.GroupID, 10)
 		chatID = "group:" + groupIDStr
 		metadata["group_id"] = groupIDStr
+		metadata["peer_kind"] = "group"
 
 		senderUserID, _ := parseJSONInt64(evt.Sender.UserID)
 		if senderUserID > 0 {
@@ -595,7 +598,14 @@ func (c *OneBotChannel) handleMessage(evt *oneBotEvent) {
 			metadata["sender_name"] = evt.Sender.Nickname
 		}
 
-		triggered, strippedContent := c.checkGroupTrigger(content, evt.IsBotMentioned)
+		strippedContent, triggered := c.GroupReply(GroupMessage{
+			SenderID:   senderID,
+			SenderName: metadata["sender_name"],
+			ChatID:     chatID,
+			GroupID:    groupIDStr,
+			Content:    content,
+			Mentioned:  evt.IsBotMentioned,
+		})
 		if !triggered {
 			logger.DebugCF("onebot", "Group message ignored (no trigger)", map[string]interface{}{
 				"sender":       senderID,
@@ -667,20 +677,3 @@ func truncate(s string, n int) string {
 	}
 	return string(runes[:n]) + "..."
 }
-
-func (c *OneBotChannel) checkGroupTrigger(content string, isBotMentioned bool) (triggered bool, strippedContent string) {
-	if isBotMentioned {
-		return true, strings.TrimSpace(content)
-	}
-
-	for _, prefix := range c.config.GroupTriggerPrefix {
-		if prefix == "" {
-			continue
-		}
-		if strings.HasPrefix(content, prefix) {
-			return true, strings.TrimSpace(strings.TrimPrefix(content, prefix))
-		}
-	}
-
-	return false, content
-}
@@ -0,0 +1,158 @@
+package channels
+
+import (
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// Capabilities lists the rich outbound fields a channel renders natively.
+type Capabilities struct {
+	Attachments bool // files with filename, MIME type and caption
+	Replies     bool // replying to a specific message (ReplyTo)
+	Actions     bool // inline buttons
+	Edit        bool // editing a previously sent message (EditID)
+	Delete      bool // deleting a previously sent message (DeleteID)
+	Voice       bool // voice notes (attachments with Voice set), even without Attachments
+}
+
+// actionDataPrefix marks button payloads that belong to an outbound action
+// rather than one of a channel's built-in menus.
+const actionDataPrefix = "act:"
+
+// RichChannel is implemented by channels that render some of the rich
+// outbound fields. Channels without it only get Content and Media.
+type RichChannel interface {
+	Capabilities() Capabilities
+}
+
+// ChannelCapabilities returns what ch can render natively.
+func ChannelCapabilities(ch Channel) Capabilities {
+	if rc, ok := ch.(RichChannel); ok {
+		return rc.Capabilities()
+	}
+	return Capabilities{}
+}
+
+// DegradeOutbound rewrites the fields caps doesn't cover: attachments move
+// to Media with their captions folded into the text, buttons become a text
+// list, edits are sent as new messages and unsupported replies are dropped.
+// Voice notes stay attachments on channels that can play them.
+// It returns false when nothing is left to send (a delete the channel can't
+// perform).
+func DegradeOutbound(msg bus.OutboundMessage, caps Capabilities) (bus.OutboundMessage, bool) {
+	if msg.DeleteID != "" {
+		return msg, caps.Delete
+	}
+	if msg.EditID != "" && !caps.Edit {
+		msg.EditID = ""
+	}
+	if msg.ReplyTo != "" && !caps.Replies {
+		msg.ReplyTo = ""
+	}
+
+	if len(msg.Attachments) > 0 && !caps.Attachments {
+		media := append([]string(nil), msg.Media...)
+		var kept []bus.Attachment
+		for _, a := range msg.Attachments {
+			if a.Voice && caps.Voice {
+				kept = append(kept, a)
+				continue
+			}
+			media = append(media, a.Path)
+			if a.Caption != "" {
+				msg.Content = appendParagraph(msg.Content, a.Caption)
+			}
+		}
+		msg.Media = media
+		msg.Attachments = kept
+	}
+
+	if len(msg.Actions) > 0 && !caps.Actions {
+		lines := make([]string, 0, len(msg.Actions))
+		for _, a := range msg.Actions {
+			if a.URL != "" {
+				lines = append(lines, fmt.Sprintf("• %s: %s", a.Label, a.URL))
+			} else {
+				lines = append(lines, "• "+a.Label)
+			}
+		}
+		msg.Content = appendParagraph(msg.Content, strings.Join(lines, "\n"))
+		msg.Actions = nil
+	}
+	return msg, true
+}
+
+func appendParagraph(content, text string) string {
+	if strings.TrimSpace(content) == "" {
+		return text
+	}
+	return content + "\n\n" + text
+}
+
+// attachmentInfo fills in an attachment's filename and MIME type from its path.
+func attachmentInfo(a bus.Attachment) (filename, mimeType string) {
+	filename = a.Filename
+	if filename == "" {
+		filename = filepath.Base(strings.SplitN(a.Path, "?", 2)[0])
+	}
+	mimeType = a.MIMEType
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(filepath.Ext(filename))
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return filename, mimeType
+}
+
+// isRemoteMedia reports whether a media path is a URL rather than a local file.
+func isRemoteMedia(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// resolveSentID maps bus.LastSentID to the newest message recorded for
+// chatID; other IDs are returned unchanged.
+func (c *BaseChannel) resolveSentID(chatID, id string) string {
+	if id != bus.LastSentID {
+		return id
+	}
+	return c.sent.last(chatID)
+}
+
+// HandleAction turns a press on one of our buttons into an inbound message.
+// data is the payload as the platform reports it; payloads without
+// actionDataPrefix belong to something else and are left to the caller,
+// which is told so by the false return. promptID is the message the button
+// was on, used to quote the question back to the agent.
+func (c *BaseChannel) HandleAction(senderID, chatID, promptID, data, label string, metadata map[string]string) bool {
+	data, ok := strings.CutPrefix(data, actionDataPrefix)
+	if !ok {
+		return false
+	}
+	if label == "" {
+		label = data
+	}
+
+	content := fmt.Sprintf("[Button %q pressed", label)
+	if data != label {
+		content += fmt.Sprintf(" (data: %s)", data)
+	}
+	if sent, ok := c.sent.get(promptID); ok && promptID != "" {
+		content += fmt.Sprintf(" on your message %q", utils.Truncate(sent.content, 200))
+	}
+	content += "]"
+
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	metadata["action_data"] = data
+	metadata["action_label"] = label
+	metadata["prompt_id"] = promptID
+	c.HandleMessage(senderID, chatID, content, nil, metadata)
+	return true
+}
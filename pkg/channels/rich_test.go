@@ -0,0 +1,193 @@
+package channels
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestDegradeOutbound(t *testing.T) {
+	msg := bus.OutboundMessage{
+		ChatID:      "c1",
+		Content:     "Here is the report",
+		Media:       []string{"/tmp/old.png"},
+		Attachments: []bus.Attachment{{Path: "/tmp/report.pdf", Caption: "Q3 numbers"}},
+		Actions:     []bus.Action{{Label: "Approve", Data: "approve"}, {Label: "Docs", URL: "https://example.com"}},
+		ReplyTo:     "m7",
+		EditID:      "m8",
+	}
+
+	got, ok := DegradeOutbound(msg, Capabilities{})
+	if !ok {
+		t.Fatal("plain message should still be delivered")
+	}
+	want := "Here is the report\n\nQ3 numbers\n\n• Approve\n• Docs: https://example.com"
+	if got.Content != want {
+		t.Errorf("content = %q, want %q", got.Content, want)
+	}
+	if len(got.Media) != 2 || got.Media[1] != "/tmp/report.pdf" || len(msg.Media) != 1 {
+		t.Errorf("media = %v (original %v)", got.Media, msg.Media)
+	}
+	if got.Attachments != nil || got.Actions != nil || got.ReplyTo != "" || got.EditID != "" {
+		t.Errorf("rich fields left behind: %+v", got)
+	}
+
+	full := Capabilities{Attachments: true, Replies: true, Actions: true, Edit: true, Delete: true}
+	if got, _ := DegradeOutbound(msg, full); got.Content != msg.Content || len(got.Actions) != 2 || got.EditID != "m8" {
+		t.Errorf("capable channel got a rewritten message: %+v", got)
+	}
+
+	del := bus.OutboundMessage{ChatID: "c1", DeleteID: "m8"}
+	if _, ok := DegradeOutbound(del, Capabilities{}); ok {
+		t.Error("delete should be dropped when unsupported")
+	}
+	if _, ok := DegradeOutbound(del, full); !ok {
+		t.Error("delete should be delivered when supported")
+	}
+}
+
+func TestResolveSentID(t *testing.T) {
+	ch := NewBaseChannel("test", nil, bus.NewMessageBus(), nil)
+	if got := ch.resolveSentID("c1", bus.LastSentID); got != "" {
+		t.Errorf("nothing sent yet, got %q", got)
+	}
+	ch.RecordSent("c1", "m1", "first")
+	ch.RecordSent("c2", "m2", "other chat")
+	ch.RecordSent("c1", "m3", "second")
+	if got := ch.resolveSentID("c1", bus.LastSentID); got != "m3" {
+		t.Errorf("last in c1 = %q, want m3", got)
+	}
+	if got := ch.resolveSentID("c2", bus.LastSentID); got != "m2" {
+		t.Errorf("last in c2 = %q, want m2", got)
+	}
+	if got := ch.resolveSentID("c1", "m1"); got != "m1" {
+		t.Errorf("explicit ID rewritten to %q", got)
+	}
+}
+
+func TestAttachmentInfo(t *testing.T) {
+	name, mimeType := attachmentInfo(bus.Attachment{Path: "https://example.com/a/chart.png?sig=1"})
+	if name != "chart.png" || mimeType != "image/png" {
+		t.Errorf("got %q %q", name, mimeType)
+	}
+	name, mimeType = attachmentInfo(bus.Attachment{Path: "/tmp/x", Filename: "notes", MIMEType: "text/plain"})
+	if name != "notes" || mimeType != "text/plain" {
+		t.Errorf("got %q %q", name, mimeType)
+	}
+	if _, mimeType = attachmentInfo(bus.Attachment{Path: "/tmp/blob"}); mimeType != "application/octet-stream" {
+		t.Errorf("fallback MIME type = %q", mimeType)
+	}
+}
+
+func TestTelegramActionKeyboard(t *testing.T) {
+	if telegramActionKeyboard(nil) != nil {
+		t.Error("no actions should give no keyboard")
+	}
+	kb := telegramActionKeyboard([]bus.Action{
+		{Label: "Yes", Data: "yes"},
+		{Label: "Docs", URL: "https://example.com"},
+		{Label: "Long", Data: strings.Repeat("x", 100)},
+	})
+	if len(kb.InlineKeyboard) != 3 {
+		t.Fatalf("rows = %d", len(kb.InlineKeyboard))
+	}
+	if b := kb.InlineKeyboard[0][0]; b.CallbackData != "act:yes" || b.Text != "Yes" {
+		t.Errorf("button = %+v", b)
+	}
+	if b := kb.InlineKeyboard[1][0]; b.URL != "https://example.com" || b.CallbackData != "" {
+		t.Errorf("link button = %+v", b)
+	}
+	if b := kb.InlineKeyboard[2][0]; len(b.CallbackData) != 64 {
+		t.Errorf("callback data not truncated: %d bytes", len(b.CallbackData))
+	}
+}
+
+func TestDiscordActionComponents(t *testing.T) {
+	actions := make([]bus.Action, 6)
+	for i := range actions {
+		actions[i] = bus.Action{Label: "b", Data: "d"}
+	}
+	actions[5].URL = "https://example.com"
+	rows := discordActionComponents(actions)
+	if len(rows) != 2 {
+		t.Fatalf("rows = %d, want 2", len(rows))
+	}
+	second := rows[1].(discordgo.ActionsRow).Components[0].(discordgo.Button)
+	if second.Style != discordgo.LinkButton || second.URL != "https://example.com" || second.CustomID != "" {
+		t.Errorf("link button = %+v", second)
+	}
+	if first := rows[0].(discordgo.ActionsRow).Components[0].(discordgo.Button); first.CustomID != "act:d" {
+		t.Errorf("custom ID = %q", first.CustomID)
+	}
+}
+
+func TestLINEBuildMessages(t *testing.T) {
+	msgs := buildMessages(bus.OutboundMessage{
+		Content: "Look",
+		Attachments: []bus.Attachment{
+			{Path: "https://example.com/cat.jpg"},
+			{Path: "/tmp/report.pdf", Caption: "Report"},
+		},
+		Actions: []bus.Action{{Label: "A very long button label here", Data: "more"}},
+	}, "qt1")
+	if len(msgs) != 2 || msgs[0]["type"] != "image" || msgs[0]["originalContentUrl"] != "https://example.com/cat.jpg" {
+		t.Fatalf("messages = %+v", msgs)
+	}
+	text := msgs[1]
+	if text["text"] != "Look\n\nReport\n[file: report.pdf]" || text["quoteToken"] != "qt1" {
+		t.Errorf("text message = %+v", text)
+	}
+	items := text["quickReply"].(map[string]interface{})["items"].([]map[string]interface{})
+	action := items[0]["action"].(map[string]interface{})
+	if action["type"] != "postback" || action["data"] != "act:more" || len([]rune(action["label"].(string))) != 20 {
+		t.Errorf("quick reply = %+v", action)
+	}
+
+	// Buttons ride on the image when there is no text
+	msgs = buildMessages(bus.OutboundMessage{
+		Attachments: []bus.Attachment{{Path: "https://example.com/cat.jpg"}},
+		Actions:     []bus.Action{{Label: "Site", URL: "https://example.com"}},
+	}, "")
+	if len(msgs) != 1 || msgs[0]["quickReply"] == nil {
+		t.Errorf("messages = %+v", msgs)
+	}
+}
+
+func TestHandleAction(t *testing.T) {
+	mb := bus.NewMessageBus()
+	ch := NewBaseChannel("test", nil, mb, []string{"42"})
+	ch.RecordSent("c1", "m1", "Which calendar event do you mean?")
+
+	if ch.HandleAction("42", "c1", "m1", "model:gpt", "", nil) {
+		t.Error("payloads without the action prefix belong to other handlers")
+	}
+	if !ch.HandleAction("42", "c1", "m1", "act:evt-2", "Dentist 10:00", nil) {
+		t.Fatal("action not handled")
+	}
+	ch.HandleAction("7", "c1", "m1", "act:evt-1", "", nil) // not allowed
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := mb.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message")
+	}
+	want := `[Button "Dentist 10:00" pressed (data: evt-2) on your message "Which calendar event do you mean?"]`
+	if msg.Content != want || msg.ChatID != "c1" || msg.SessionKey != "test:c1" {
+		t.Errorf("message = %+v", msg)
+	}
+	if msg.Metadata["action_data"] != "evt-2" || msg.Metadata["prompt_id"] != "m1" || msg.Metadata["action_label"] != "Dentist 10:00" {
+		t.Errorf("metadata = %v", msg.Metadata)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if msg, ok := mb.ConsumeInbound(ctx); ok {
+		t.Errorf("disallowed sender got through: %+v", msg)
+	}
+}
@@ -0,0 +1,579 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+// rocketChatMaxMessage matches Rocket.Chat's default Message_MaxAllowedSize.
+const rocketChatMaxMessage = 5000
+
+// RocketChatChannel connects as a bot user with a personal access token:
+// messages arrive over the DDP realtime API and replies are posted through
+// REST. Chat IDs follow the Slack layout, "roomID" or "roomID/threadID".
+type RocketChatChannel struct {
+	*BaseChannel
+	config      config.RocketChatConfig
+	baseURL     string
+	client      *http.Client
+	botUsername string
+	transcriber *voice.GroqTranscriber
+	ctx         context.Context
+	cancel      context.CancelFunc
+	threads     sync.Map // threadID -> struct{} for threads the bot replied in
+	seen        *sentLog // message IDs already handled
+
+	connMu  sync.Mutex
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	// Reactions arrive as updates of the whole message, so the reactions
+	// already seen on the bot's messages are remembered to spot new ones.
+	reactionsMu sync.Mutex
+	reactions   map[string]map[string]bool // messageID -> "emoji|username"
+}
+
+type rocketChatMessage struct {
+	ID       string `json:"_id"`
+	RoomID   string `json:"rid"`
+	Msg      string `json:"msg"`
+	ThreadID string `json:"tmid"`
+	Type     string `json:"t"`
+	User     struct {
+		ID       string `json:"_id"`
+		Username string `json:"username"`
+		Name     string `json:"name"`
+	} `json:"u"`
+	Mentions []struct {
+		ID       string `json:"_id"`
+		Username string `json:"username"`
+	} `json:"mentions"`
+	Files     []rocketChatFile                   `json:"files"`
+	File      *rocketChatFile                    `json:"file"`
+	Reactions map[string]rocketChatReactionUsers `json:"reactions"`
+	EditedAt  interface{}                        `json:"editedAt"`
+	Bot       interface{}                        `json:"bot"`
+}
+
+type rocketChatFile struct {
+	ID   string `json:"_id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type rocketChatReactionUsers struct {
+	Usernames []string `json:"usernames"`
+}
+
+type rocketChatRoomInfo struct {
+	RoomType string `json:"roomType"`
+}
+
+type ddpMessage struct {
+	Msg        string          `json:"msg"`
+	ID         string          `json:"id"`
+	Collection string          `json:"collection"`
+	Error      json.RawMessage `json:"error"`
+	Fields     struct {
+		EventName string            `json:"eventName"`
+		Args      []json.RawMessage `json:"args"`
+	} `json:"fields"`
+}
+
+func NewRocketChatChannel(cfg config.RocketChatConfig, messageBus *bus.MessageBus) (*RocketChatChannel, error) {
+	if cfg.URL == "" || cfg.UserID == "" || cfg.Token == "" {
+		return nil, fmt.Errorf("rocketchat url, user_id and token are required")
+	}
+
+	base := NewBaseChannel("rocketchat", cfg, messageBus, cfg.AllowFrom)
+	base.SetGroupPolicy(cfg.Groups, requireMentionPolicy(cfg.RequireMention, nil))
+
+	return &RocketChatChannel{
+		BaseChannel: base,
+		config:      cfg,
+		baseURL:     strings.TrimRight(cfg.URL, "/"),
+		client:      &http.Client{Timeout: 60 * time.Second},
+		seen:        newSentLog(),
+		reactions:   make(map[string]map[string]bool),
+	}, nil
+}
+
+func (c *RocketChatChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
+	c.transcriber = transcriber
+}
+
+func (c *RocketChatChannel) Start(ctx context.Context) error {
+	logger.InfoC("rocketchat", "Starting Rocket.Chat channel")
+
+	var me struct {
+		Username string `json:"username"`
+	}
+	if err := c.api(ctx, http.MethodGet, "/api/v1/me", nil, &me); err != nil {
+		return fmt.Errorf("rocketchat auth failed: %w", err)
+	}
+	c.botUsername = me.Username
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	c.setRunning(true)
+	go c.connectLoop()
+
+	logger.InfoCF("rocketchat", "Rocket.Chat bot connected", map[string]interface{}{
+		"user_id":  c.config.UserID,
+		"username": c.botUsername,
+	})
+	return nil
+}
+
+func (c *RocketChatChannel) Stop(ctx context.Context) error {
+	logger.InfoC("rocketchat", "Stopping Rocket.Chat channel")
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.connMu.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.connMu.Unlock()
+	c.setRunning(false)
+	return nil
+}
+
+func (c *RocketChatChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("rocketchat channel not running")
+	}
+
+	roomID, threadID := parseSlackChatID(msg.ChatID)
+	if roomID == "" {
+		return fmt.Errorf("invalid rocketchat chat ID: %s", msg.ChatID)
+	}
+	if threadID != "" {
+		c.threads.Store(threadID, struct{}{})
+	}
+
+	for _, media := range msg.Media {
+		if err := c.uploadFile(ctx, roomID, threadID, media); err != nil {
+			logger.ErrorCF("rocketchat", "Failed to upload media", map[string]interface{}{
+				"media": media,
+				"error": err.Error(),
+			})
+		}
+	}
+
+	if strings.TrimSpace(msg.Content) == "" {
+		return nil
+	}
+	for _, chunk := range splitMessage(msg.Content, rocketChatMaxMessage) {
+		message := map[string]string{"rid": roomID, "msg": chunk}
+		if threadID != "" {
+			message["tmid"] = threadID
+		}
+		var resp struct {
+			Message rocketChatMessage `json:"message"`
+		}
+		if err := c.api(ctx, http.MethodPost, "/api/v1/chat.sendMessage", map[string]interface{}{"message": message}, &resp); err != nil {
+			return fmt.Errorf("failed to send rocketchat message: %w", err)
+		}
+		c.RecordSent(msg.ChatID, resp.Message.ID, chunk)
+	}
+
+	logger.DebugCF("rocketchat", "Message sent", map[string]interface{}{
+		"room_id":   roomID,
+		"thread_id": threadID,
+	})
+	return nil
+}
+
+// api performs a REST call authenticated with the personal access token.
+func (c *RocketChatChannel) api(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.do(req, out)
+}
+
+func (c *RocketChatChannel) do(req *http.Request, out interface{}) error {
+	req.Header.Set("X-User-Id", c.config.UserID)
+	req.Header.Set("X-Auth-Token", c.config.Token)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&apiErr)
+		return fmt.Errorf("rocketchat API returned HTTP %d: %s", resp.StatusCode, apiErr.Error)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+func (c *RocketChatChannel) uploadFile(ctx context.Context, roomID, threadID, media string) error {
+	body, contentType, err := multipartMedia("file", media, map[string]string{"tmid": threadID})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/v1/rooms.upload/"+url.PathEscape(roomID), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return c.do(req, nil)
+}
+
+func (c *RocketChatChannel) connectLoop() {
+	backoff := 2 * time.Second
+	maxBackoff := 2 * time.Minute
+
+	for {
+		connected, err := c.listen()
+		if c.ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = 2 * time.Second
+		}
+		logger.WarnCF("rocketchat", "Realtime connection lost, reconnecting", map[string]interface{}{
+			"error":   err.Error(),
+			"backoff": backoff.String(),
+		})
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// listen runs one DDP session: connect, log in with the token, subscribe to
+// messages in all of the bot's rooms and dispatch them until the socket drops.
+func (c *RocketChatChannel) listen() (bool, error) {
+	wsURL, err := websocketURL(c.baseURL, "/websocket")
+	if err != nil {
+		return false, err
+	}
+	dialer := websocket.Dialer{HandshakeTimeout: 15 * time.Second}
+	conn, _, err := dialer.DialContext(c.ctx, wsURL, nil)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	c.connMu.Lock()
+	c.conn = conn
+	c.connMu.Unlock()
+	defer func() {
+		c.connMu.Lock()
+		if c.conn == conn {
+			c.conn = nil
+		}
+		c.connMu.Unlock()
+	}()
+
+	steps := []map[string]interface{}{
+		{"msg": "connect", "version": "1", "support": []string{"1"}},
+		{"msg": "method", "method": "login", "id": "login", "params": []interface{}{map[string]string{"resume": c.config.Token}}},
+		{"msg": "sub", "id": "messages", "name": "stream-room-messages", "params": []interface{}{"__my_messages__", false}},
+	}
+	waitFor := []string{"connected", "login", "messages"}
+	if err := c.write(steps[0]); err != nil {
+		return false, err
+	}
+
+	step := 0
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return step == len(steps), err
+		}
+		var msg ddpMessage
+		if json.Unmarshal(data, &msg) != nil {
+			continue
+		}
+
+		switch msg.Msg {
+		case "ping":
+			c.write(map[string]string{"msg": "pong"})
+			continue
+		case "failed":
+			return false, fmt.Errorf("rocketchat rejected DDP version")
+		case "nosub":
+			return false, fmt.Errorf("rocketchat subscription refused: %s", msg.Error)
+		case "result":
+			if len(msg.Error) > 0 && string(msg.Error) != "null" {
+				return false, fmt.Errorf("rocketchat login failed: %s", msg.Error)
+			}
+		case "changed":
+			if msg.Collection == "stream-room-messages" {
+				c.handleStreamMessage(msg.Fields.Args)
+			}
+			continue
+		}
+
+		if step < len(steps) && (msg.Msg == waitFor[step] || msg.ID == waitFor[step] ||
+			(msg.Msg == "ready" && waitFor[step] == "messages")) {
+			step++
+			if step < len(steps) {
+				if err := c.write(steps[step]); err != nil {
+					return false, err
+				}
+			} else {
+				logger.InfoC("rocketchat", "Subscribed to room messages")
+			}
+		}
+	}
+}
+
+func (c *RocketChatChannel) write(v interface{}) error {
+	c.connMu.Lock()
+	conn := c.conn
+	c.connMu.Unlock()
+	if conn == nil {
+		return fmt.Errorf("rocketchat websocket not connected")
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return conn.WriteJSON(v)
+}
+
+func (c *RocketChatChannel) handleStreamMessage(args []json.RawMessage) {
+	if len(args) == 0 {
+		return
+	}
+	var msg rocketChatMessage
+	if json.Unmarshal(args[0], &msg) != nil {
+		return
+	}
+	var room rocketChatRoomInfo
+	if len(args) > 1 {
+		json.Unmarshal(args[1], &room)
+	}
+
+	if msg.User.ID == c.config.UserID {
+		c.handleReactions(msg)
+		return
+	}
+	// Edits, reactions and thread replies re-deliver the whole message
+	if _, dup := c.seen.get(msg.ID); dup || msg.EditedAt != nil {
+		return
+	}
+	c.seen.add(msg.ID, sentMessage{})
+	// System messages (joins, topic changes, ...) carry a type
+	if msg.Type != "" || msg.Bot != nil {
+		return
+	}
+	c.handleMessage(msg, room)
+}
+
+// handleReactions reports reactions newly added to one of the bot's messages.
+func (c *RocketChatChannel) handleReactions(msg rocketChatMessage) {
+	if _, tracked := c.sent.get(msg.ID); !tracked {
+		return
+	}
+
+	c.reactionsMu.Lock()
+	seen := c.reactions[msg.ID]
+	if seen == nil {
+		seen = make(map[string]bool)
+		if len(c.reactions) >= maxTrackedMessages {
+			c.reactions = make(map[string]map[string]bool)
+		}
+		c.reactions[msg.ID] = seen
+	}
+	var added [][2]string
+	for emoji, r := range msg.Reactions {
+		for _, username := range r.Usernames {
+			key := emoji + "|" + username
+			if !seen[key] && username != c.botUsername {
+				added = append(added, [2]string{emoji, username})
+			}
+			seen[key] = true
+		}
+	}
+	c.reactionsMu.Unlock()
+
+	for _, a := range added {
+		c.HandleReaction(a[1], msg.RoomID, msg.ID, strings.Trim(a[0], ":"), true)
+	}
+}
+
+func (c *RocketChatChannel) handleMessage(msg rocketChatMessage, room rocketChatRoomInfo) {
+	senderID := msg.User.ID
+	if msg.User.Username != "" {
+		senderID += "|" + msg.User.Username
+	}
+	isDirect := room.RoomType == "d"
+	if !c.IsAllowed(senderID) && (isDirect || !c.IsAllowedChat(msg.RoomID)) {
+		logger.DebugCF("rocketchat", "Message rejected by allowlist", map[string]interface{}{
+			"user_id": msg.User.ID,
+		})
+		return
+	}
+
+	mentioned := c.isMentioned(msg)
+	inBotThread := false
+	if msg.ThreadID != "" {
+		_, inBotThread = c.threads.Load(msg.ThreadID)
+	}
+
+	// Mentions outside a thread start one on the triggering message, like Slack
+	chatID := msg.RoomID
+	switch {
+	case msg.ThreadID != "":
+		chatID = msg.RoomID + "/" + msg.ThreadID
+	case !isDirect && mentioned:
+		chatID = msg.RoomID + "/" + msg.ID
+	}
+
+	content := c.stripBotMention(msg.Msg)
+	if !isDirect {
+		text, reply := c.GroupReply(GroupMessage{
+			SenderID:   senderID,
+			SenderName: msg.User.Username,
+			ChatID:     chatID,
+			GroupID:    msg.RoomID,
+			Content:    content,
+			Mentioned:  mentioned,
+			ReplyToBot: inBotThread,
+		})
+		if !reply {
+			return
+		}
+		content = text
+	}
+
+	var mediaPaths []string
+	localFiles := []string{}
+	defer func() {
+		for _, file := range localFiles {
+			if err := os.Remove(file); err != nil {
+				logger.DebugCF("rocketchat", "Failed to cleanup temp file", map[string]interface{}{
+					"file":  file,
+					"error": err.Error(),
+				})
+			}
+		}
+	}()
+
+	files := msg.Files
+	if len(files) == 0 && msg.File != nil {
+		files = []rocketChatFile{*msg.File}
+	}
+	for _, file := range files {
+		fileURL := fmt.Sprintf("%s/file-upload/%s/%s", c.baseURL, url.PathEscape(file.ID), url.PathEscape(file.Name))
+		localPath := utils.DownloadFile(fileURL, file.Name, utils.DownloadOptions{
+			LoggerPrefix: "rocketchat",
+			ExtraHeaders: map[string]string{
+				"X-User-Id":    c.config.UserID,
+				"X-Auth-Token": c.config.Token,
+			},
+		})
+		if localPath == "" {
+			content = appendContent(content, fmt.Sprintf("[file: %s]", file.Name))
+			continue
+		}
+		localFiles = append(localFiles, localPath)
+
+		if utils.IsAudioFile(file.Name, file.Type) {
+			content = appendContent(content, c.transcribe(localPath, file.Name))
+			continue
+		}
+		mediaPaths = append(mediaPaths, localPath)
+		content = appendContent(content, fmt.Sprintf("[file: %s]", file.Name))
+	}
+
+	if strings.TrimSpace(content) == "" {
+		return
+	}
+
+	metadata := map[string]string{
+		"platform":   "rocketchat",
+		"message_id": msg.ID,
+		"room_id":    msg.RoomID,
+		"thread_id":  msg.ThreadID,
+		"room_type":  room.RoomType,
+		"user_name":  msg.User.Username,
+		"peer_kind":  peerKind(!isDirect),
+	}
+	if mentioned {
+		metadata["is_mention"] = "true"
+	}
+
+	logger.DebugCF("rocketchat", "Received message", map[string]interface{}{
+		"sender_id": senderID,
+		"chat_id":   chatID,
+		"preview":   utils.Truncate(content, 50),
+	})
+
+	c.HandleMessage(senderID, chatID, content, mediaPaths, metadata)
+}
+
+func (c *RocketChatChannel) isMentioned(msg rocketChatMessage) bool {
+	for _, m := range msg.Mentions {
+		if m.ID == c.config.UserID {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *RocketChatChannel) stripBotMention(text string) string {
+	if c.botUsername != "" {
+		text = strings.ReplaceAll(text, "@"+c.botUsername, "")
+	}
+	return strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(text), ":,"))
+}
+
+func (c *RocketChatChannel) transcribe(localPath, name string) string {
+	if c.transcriber == nil || !c.transcriber.IsAvailable() {
+		return fmt.Sprintf("[audio: %s]", name)
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, transcriptionTimeout)
+	defer cancel()
+	result, err := c.transcriber.Transcribe(ctx, localPath)
+	if err != nil {
+		logger.ErrorCF("rocketchat", "Voice transcription failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return fmt.Sprintf("[audio: %s (transcription failed)]", name)
+	}
+	return fmt.Sprintf("[audio transcription: %s]", result.Text)
+}
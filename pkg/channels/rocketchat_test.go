@@ -0,0 +1,207 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// fakeRocketChat speaks enough DDP to log in and subscribe, then pushes
+// messages written to events as stream-room-messages updates.
+type fakeRocketChat struct {
+	*httptest.Server
+	events chan map[string]interface{}
+	mu     sync.Mutex
+	sent   []map[string]string
+}
+
+func newFakeRocketChat(t *testing.T) *fakeRocketChat {
+	t.Helper()
+	f := &fakeRocketChat{events: make(chan map[string]interface{}, 10)}
+	upgrader := websocket.Upgrader{}
+	authed := func(r *http.Request) bool {
+		return r.Header.Get("X-User-Id") == "bot1" && r.Header.Get("X-Auth-Token") == "tok"
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/me", func(w http.ResponseWriter, r *http.Request) {
+		if !authed(r) {
+			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"_id":"bot1","username":"picobot"}`))
+	})
+	mux.HandleFunc("/api/v1/chat.sendMessage", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Message map[string]string `json:"message"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		f.mu.Lock()
+		f.sent = append(f.sent, req.Message)
+		id := fmt.Sprintf("sent%d", len(f.sent))
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": map[string]string{"_id": id}})
+	})
+	mux.HandleFunc("/websocket", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var writeMu sync.Mutex
+		write := func(v interface{}) {
+			writeMu.Lock()
+			conn.WriteJSON(v)
+			writeMu.Unlock()
+		}
+		go func() {
+			for {
+				var msg map[string]interface{}
+				if conn.ReadJSON(&msg) != nil {
+					return
+				}
+				switch msg["msg"] {
+				case "connect":
+					write(map[string]interface{}{"msg": "ping"})
+					write(map[string]interface{}{"msg": "connected", "session": "s1"})
+				case "method":
+					params, _ := msg["params"].([]interface{})
+					if login, _ := params[0].(map[string]interface{}); login["resume"] != "tok" {
+						write(map[string]interface{}{"msg": "result", "id": msg["id"], "error": map[string]string{"error": "403"}})
+						continue
+					}
+					write(map[string]interface{}{"msg": "result", "id": msg["id"], "result": map[string]string{"id": "bot1"}})
+				case "sub":
+					write(map[string]interface{}{"msg": "ready", "subs": []interface{}{msg["id"]}})
+				}
+			}
+		}()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case ev := <-f.events:
+				room := map[string]string{"roomType": ev["roomType"].(string)}
+				delete(ev, "roomType")
+				write(map[string]interface{}{
+					"msg":        "changed",
+					"collection": "stream-room-messages",
+					"id":         "id",
+					"fields":     map[string]interface{}{"eventName": "__my_messages__", "args": []interface{}{ev, room}},
+				})
+			}
+		}
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeRocketChat) sentMessages() []map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]map[string]string(nil), f.sent...)
+}
+
+func rocketChatMsg(id, roomType, rid, text string, extra map[string]interface{}) map[string]interface{} {
+	msg := map[string]interface{}{
+		"_id":      id,
+		"rid":      rid,
+		"msg":      text,
+		"u":        map[string]string{"_id": "u1", "username": "alice"},
+		"roomType": roomType,
+	}
+	for k, v := range extra {
+		msg[k] = v
+	}
+	return msg
+}
+
+func TestRocketChatChannel(t *testing.T) {
+	server := newFakeRocketChat(t)
+	mb := bus.NewMessageBus()
+	ch, err := NewRocketChatChannel(config.RocketChatConfig{
+		URL:            server.URL,
+		UserID:         "bot1",
+		Token:          "tok",
+		RequireMention: true,
+	}, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := ch.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer ch.Stop(ctx)
+
+	mention := map[string]interface{}{"mentions": []map[string]string{{"_id": "bot1", "username": "picobot"}}}
+	server.events <- rocketChatMsg("m1", "d", "dm1", "hello", nil)
+	server.events <- rocketChatMsg("m1", "d", "dm1", "hello", map[string]interface{}{"tcount": 1}) // re-delivery
+	server.events <- rocketChatMsg("m2", "c", "general", "just chatting", nil)
+	server.events <- rocketChatMsg("m3", "c", "general", "@picobot what's up?", mention)
+	server.events <- rocketChatMsg("m4", "c", "general", "", map[string]interface{}{"t": "uj"})
+
+	msg, ok := mb.ConsumeInbound(ctx)
+	if !ok || msg.ChatID != "dm1" || msg.Content != "hello" || msg.SenderID != "u1|alice" {
+		t.Fatalf("unexpected DM: %+v", msg)
+	}
+	msg, ok = mb.ConsumeInbound(ctx)
+	if !ok || msg.ChatID != "general/m3" || msg.Content != "what's up?" || msg.SessionKey != "rocketchat:general/m3" {
+		t.Fatalf("unexpected mention: %+v", msg)
+	}
+
+	if err := ch.Send(ctx, bus.OutboundMessage{ChatID: "general/m3", Content: "all good"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	sent := server.sentMessages()
+	if len(sent) != 1 || sent[0]["rid"] != "general" || sent[0]["tmid"] != "m3" || sent[0]["msg"] != "all good" {
+		t.Fatalf("sent = %+v", sent)
+	}
+
+	server.events <- rocketChatMsg("m5", "c", "general", "and tomorrow?", map[string]interface{}{"tmid": "m3"})
+	msg, ok = mb.ConsumeInbound(ctx)
+	if !ok || msg.ChatID != "general/m3" || msg.Content != "and tomorrow?" {
+		t.Fatalf("unexpected thread follow-up: %+v", msg)
+	}
+
+	feedback := make(chan bus.FeedbackEvent, 2)
+	mb.SetFeedbackHandler(func(ev bus.FeedbackEvent) { feedback <- ev })
+	reacted := func(users ...string) map[string]interface{} {
+		return map[string]interface{}{
+			"_id":       "sent1",
+			"rid":       "general",
+			"tmid":      "m3",
+			"msg":       "all good",
+			"u":         map[string]string{"_id": "bot1", "username": "picobot"},
+			"reactions": map[string]interface{}{":+1:": map[string]interface{}{"usernames": users}},
+			"roomType":  "c",
+		}
+	}
+	server.events <- reacted("alice")
+	server.events <- reacted("alice") // unchanged, must not count twice
+	select {
+	case fb := <-feedback:
+		if fb.ChatID != "general/m3" || fb.Score != 1 || fb.SenderID != "alice" {
+			t.Errorf("feedback = %+v", fb)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("reaction not reported")
+	}
+	select {
+	case fb := <-feedback:
+		t.Errorf("duplicate feedback: %+v", fb)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
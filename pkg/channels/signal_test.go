@@ -0,0 +1,209 @@
+package channels
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+type signalRPCCall struct {
+	Method string
+	Params map[string]interface{}
+}
+
+// fakeSignalDaemon mimics signal-cli's HTTP daemon: events written to the
+// returned channel are streamed as SSE, and JSON-RPC calls are recorded.
+type fakeSignalDaemon struct {
+	*httptest.Server
+	events chan string
+	mu     sync.Mutex
+	calls  []signalRPCCall
+}
+
+func newFakeSignalDaemon(t *testing.T) *fakeSignalDaemon {
+	t.Helper()
+	d := &fakeSignalDaemon{events: make(chan string, 10)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/events", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("account") != "+10000000000" {
+			http.Error(w, "unknown account", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case ev := <-d.events:
+				fmt.Fprintf(w, "event:receive\ndata:%s\n\n", ev)
+				w.(http.Flusher).Flush()
+			}
+		}
+	})
+	mux.HandleFunc("/api/v1/rpc", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     int64                  `json:"id"`
+			Method string                 `json:"method"`
+			Params map[string]interface{} `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		d.mu.Lock()
+		d.calls = append(d.calls, signalRPCCall{Method: req.Method, Params: req.Params})
+		d.mu.Unlock()
+
+		var result interface{} = map[string]interface{}{}
+		switch req.Method {
+		case "send":
+			result = map[string]interface{}{"timestamp": 1700000000999}
+		case "getAttachment":
+			result = map[string]interface{}{"data": base64.StdEncoding.EncodeToString([]byte("image bytes"))}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	})
+	d.Server = httptest.NewServer(mux)
+	t.Cleanup(d.Close)
+	return d
+}
+
+func (d *fakeSignalDaemon) callsTo(method string) []signalRPCCall {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var out []signalRPCCall
+	for _, c := range d.calls {
+		if c.Method == method {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func signalEvent(source, groupID string, dataMessage map[string]interface{}) string {
+	if groupID != "" {
+		dataMessage["groupInfo"] = map[string]interface{}{"groupId": groupID, "type": "DELIVER"}
+	}
+	ev, _ := json.Marshal(map[string]interface{}{
+		"account": "+10000000000",
+		"envelope": map[string]interface{}{
+			"source":       source,
+			"sourceNumber": source,
+			"sourceUuid":   "uuid-" + source,
+			"sourceName":   "Alice",
+			"timestamp":    dataMessage["timestamp"],
+			"dataMessage":  dataMessage,
+		},
+	})
+	return string(ev)
+}
+
+func TestSignalChannel(t *testing.T) {
+	daemon := newFakeSignalDaemon(t)
+	mb := bus.NewMessageBus()
+	ch, err := NewSignalChannel(config.SignalConfig{
+		URL:                daemon.URL,
+		Account:            "+10000000000",
+		RequireMention:     true,
+		GroupTriggerPrefix: []string{"!ask"},
+	}, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ch.Start(ctx)
+	defer ch.Stop(ctx)
+
+	groupID := "ab+c/de="
+	daemon.events <- signalEvent("+15550001111", "", map[string]interface{}{"timestamp": 1, "message": "hello"})
+	daemon.events <- signalEvent("+15550001111", groupID, map[string]interface{}{"timestamp": 2, "message": "just chatting"})
+	daemon.events <- signalEvent("+15550001111", groupID, map[string]interface{}{
+		"timestamp": 3,
+		"message":   "\uFFFC what's up?",
+		"mentions":  []map[string]interface{}{{"number": "+10000000000", "start": 0, "length": 1}},
+	})
+	daemon.events <- signalEvent("+15550001111", groupID, map[string]interface{}{"timestamp": 4, "message": "!ask tell a joke"})
+	daemon.events <- signalEvent("+15550001111", "", map[string]interface{}{
+		"timestamp":   5,
+		"attachments": []map[string]interface{}{{"id": "att1", "contentType": "image/png", "filename": "cat.png"}},
+	})
+
+	wantGroupChat := "group:ab-c_de"
+	for _, want := range []struct{ chatID, content string }{
+		{"+15550001111", "hello"},
+		{wantGroupChat, "what's up?"},
+		{wantGroupChat, "tell a joke"},
+		{"+15550001111", "[image: cat.png]"},
+	} {
+		msg, ok := mb.ConsumeInbound(ctx)
+		if !ok || msg.ChatID != want.chatID || msg.Content != want.content {
+			t.Fatalf("expected %+v, got %+v", want, msg)
+		}
+		if msg.SessionKey != "signal:"+want.chatID {
+			t.Errorf("session key = %q", msg.SessionKey)
+		}
+		if want.content == "[image: cat.png]" && (len(msg.Media) != 1 || filepath.Ext(msg.Media[0]) != ".png") {
+			t.Errorf("attachment not passed as media: %v", msg.Media)
+		}
+	}
+	if calls := daemon.callsTo("getAttachment"); len(calls) != 1 || calls[0].Params["recipient"] != "+15550001111" {
+		t.Errorf("getAttachment calls = %+v", calls)
+	}
+
+	media := filepath.Join(t.TempDir(), "report.txt")
+	os.WriteFile(media, []byte("report"), 0o600)
+	if err := ch.Send(ctx, bus.OutboundMessage{ChatID: wantGroupChat, Content: "here you go", Media: []string{media}}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	sends := daemon.callsTo("send")
+	if len(sends) != 1 {
+		t.Fatalf("expected one send, got %d", len(sends))
+	}
+	params := sends[0].Params
+	if params["groupId"] != groupID || params["message"] != "here you go" || params["account"] != "+10000000000" {
+		t.Errorf("send params = %+v", params)
+	}
+	attachments, _ := params["attachment"].([]interface{})
+	if len(attachments) != 1 || !strings.HasPrefix(attachments[0].(string), "data:text/plain;filename=report.txt;base64,") {
+		t.Errorf("attachments = %v", attachments)
+	}
+
+	feedback := make(chan bus.FeedbackEvent, 1)
+	mb.SetFeedbackHandler(func(ev bus.FeedbackEvent) { feedback <- ev })
+	daemon.events <- signalEvent("+15550001111", groupID, map[string]interface{}{
+		"timestamp": 6,
+		"reaction": map[string]interface{}{
+			"emoji":               "👍",
+			"targetAuthorNumber":  "+10000000000",
+			"targetSentTimestamp": 1700000000999,
+		},
+	})
+	select {
+	case ev := <-feedback:
+		if ev.ChatID != wantGroupChat || ev.Score != 1 || ev.Content != "here you go" {
+			t.Errorf("feedback = %+v", ev)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("reaction not reported")
+	}
+}
+
+func TestSignalGroupIDRoundTrip(t *testing.T) {
+	for _, id := range []string{"ab+c/de=", "YWJjZA==", "YWJj", "+/+/+/+/", "1t6mcDWGaMA7yRDgOqgrZ3JXBONuXtsd/MAdg2ftV1E="} {
+		if got := signalGroupID(signalChatGroupID(id)); got != id {
+			t.Errorf("round trip %q -> %q", id, got)
+		}
+	}
+}
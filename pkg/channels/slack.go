@@ -49,6 +49,8 @@ func NewSlackChannel(cfg config.SlackConfig, messageBus *bus.MessageBus) (*Slack
 	socketClient := socketmode.New(api)
 
 	base := NewBaseChannel("slack", cfg, messageBus, cfg.AllowFrom)
+	// Slack answered every channel message before group policies existed
+	base.SetGroupPolicy(cfg.Groups, config.GroupPolicyConfig{Trigger: []string{GroupTriggerAlways}})
 
 	return &SlackChannel{
 		BaseChannel:  base,
@@ -117,18 +119,53 @@ func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 		return fmt.Errorf("invalid slack chat ID: %s", msg.ChatID)
 	}
 
+	if msg.DeleteID != "" {
+		if _, _, err := c.api.DeleteMessageContext(ctx, channelID, c.resolveSentID(msg.ChatID, msg.DeleteID)); err != nil {
+			return fmt.Errorf("failed to delete slack message: %w", err)
+		}
+		return nil
+	}
+
 	opts := []slack.MsgOption{
 		slack.MsgOptionText(msg.Content, false),
 	}
+	if len(msg.Actions) > 0 {
+		opts = append(opts, slack.MsgOptionBlocks(slackActionBlocks(msg.Content, msg.Actions)...))
+	}
+
+	if msg.EditID != "" {
+		ts := c.resolveSentID(msg.ChatID, msg.EditID)
+		if _, _, _, err := c.api.UpdateMessageContext(ctx, channelID, ts, opts...); err != nil {
+			return fmt.Errorf("failed to edit slack message: %w", err)
+		}
+		c.RecordSent(msg.ChatID, ts, msg.Content)
+		return nil
+	}
+
+	// Replying to a specific message starts (or continues) its thread
+	if msg.ReplyTo != "" {
+		threadTS = msg.ReplyTo
+	}
+	if len(msg.Attachments) > 0 {
+		var err error
+		if msg.Content, err = c.uploadAttachments(ctx, channelID, threadTS, msg); err != nil {
+			return err
+		}
+		if msg.Content == "" {
+			return nil
+		}
+		opts[0] = slack.MsgOptionText(msg.Content, false)
+	}
 
 	if threadTS != "" {
 		opts = append(opts, slack.MsgOptionTS(threadTS))
 	}
 
-	_, _, err := c.api.PostMessageContext(ctx, channelID, opts...)
+	_, ts, err := c.api.PostMessageContext(ctx, channelID, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to send slack message: %w", err)
 	}
+	c.RecordSent(msg.ChatID, ts, msg.Content)
 
 	if ref, ok := c.pendingAcks.LoadAndDelete(msg.ChatID); ok {
 		msgRef := ref.(slackMessageRef)
@@ -146,6 +183,111 @@ func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 	return nil
 }
 
+// Capabilities reports that Slack renders every rich outbound field.
+func (c *SlackChannel) Capabilities() Capabilities {
+	return Capabilities{Attachments: true, Replies: true, Actions: true, Edit: true, Delete: true, Voice: true}
+}
+
+// uploadAttachments uploads local attachments to the channel and returns the
+// text still to be posted: remote attachments are linked rather than
+// re-uploaded, and failed uploads are mentioned by name. A voice note that
+// fails is an error, so it can be sent as text instead.
+func (c *SlackChannel) uploadAttachments(ctx context.Context, channelID, threadTS string, msg bus.OutboundMessage) (string, error) {
+	content := msg.Content
+	for _, a := range msg.Attachments {
+		filename, _ := attachmentInfo(a)
+		if isRemoteMedia(a.Path) {
+			content = appendParagraph(content, strings.TrimSpace(a.Caption+" "+a.Path))
+			continue
+		}
+		if err := c.uploadFile(ctx, channelID, threadTS, filename, a); err != nil {
+			if a.Voice {
+				return "", fmt.Errorf("failed to upload voice note: %w", err)
+			}
+			logger.ErrorCF("slack", "Failed to upload attachment", map[string]interface{}{
+				"file":  filename,
+				"error": err.Error(),
+			})
+			content = appendParagraph(content, fmt.Sprintf("[file: %s]", filename))
+		}
+	}
+	return content, nil
+}
+
+func (c *SlackChannel) uploadFile(ctx context.Context, channelID, threadTS, filename string, a bus.Attachment) error {
+	f, err := os.Open(a.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	_, err = c.api.UploadFileV2Context(ctx, slack.UploadFileV2Parameters{
+		Reader:          f,
+		FileSize:        int(info.Size()),
+		Filename:        filename,
+		Title:           filename,
+		InitialComment:  a.Caption,
+		Channel:         channelID,
+		ThreadTimestamp: threadTS,
+	})
+	return err
+}
+
+// slackSectionLimit is the max text length of a section block.
+const slackSectionLimit = 3000
+
+// slackActionBlocks renders content as section blocks followed by a row of
+// buttons. Clicks carry the prefixed action Data as the button value.
+func slackActionBlocks(content string, actions []bus.Action) []slack.Block {
+	var blocks []slack.Block
+	if strings.TrimSpace(content) != "" {
+		for _, chunk := range splitMessage(content, slackSectionLimit) {
+			blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, chunk, false, false), nil, nil))
+		}
+	}
+	elements := make([]slack.BlockElement, 0, len(actions))
+	for i, a := range actions {
+		button := slack.NewButtonBlockElement(fmt.Sprintf("act_%d", i), "", slack.NewTextBlockObject(slack.PlainTextType, a.Label, false, false))
+		if a.URL != "" {
+			button = button.WithURL(a.URL)
+		} else {
+			button.Value = actionDataPrefix + a.Data
+		}
+		elements = append(elements, button)
+	}
+	return append(blocks, slack.NewActionBlock("actions", elements...))
+}
+
+// handleBlockActions routes presses on our buttons to the agent and strips
+// the buttons from the message so the same choice can't be made twice. Link
+// buttons also report a press but carry no value, so they are ignored.
+func (c *SlackChannel) handleBlockActions(callback slack.InteractionCallback) {
+	if callback.Type != slack.InteractionTypeBlockActions || !c.IsAllowed(callback.User.ID) {
+		return
+	}
+	channelID := callback.Channel.ID
+	if channelID == "" {
+		channelID = callback.Container.ChannelID
+	}
+	chatID := channelID
+	if threadTS := callback.Message.ThreadTimestamp; threadTS != "" {
+		chatID = channelID + "/" + threadTS
+	}
+
+	for _, action := range callback.ActionCallback.BlockActions {
+		handled := c.HandleAction(callback.User.ID, chatID, callback.Message.Timestamp, action.Value, action.Text.Text, map[string]string{
+			"channel_id": channelID,
+			"platform":   "slack",
+		})
+		if handled {
+			c.api.UpdateMessageContext(c.ctx, channelID, callback.Message.Timestamp, slack.MsgOptionText(callback.Message.Text, false))
+		}
+	}
+}
+
 func (c *SlackChannel) eventLoop() {
 	for {
 		select {
@@ -164,6 +306,9 @@ func (c *SlackChannel) eventLoop() {
 				if event.Request != nil {
 					c.socketClient.Ack(*event.Request)
 				}
+				if callback, ok := event.Data.(slack.InteractionCallback); ok {
+					c.handleBlockActions(callback)
+				}
 			}
 		}
 	}
@@ -184,9 +329,21 @@ func (c *SlackChannel) handleEventsAPI(event socketmode.Event) {
 		c.handleMessageEvent(ev)
 	case *slackevents.AppMentionEvent:
 		c.handleAppMention(ev)
+	case *slackevents.ReactionAddedEvent:
+		c.handleReactionAdded(ev)
 	}
 }
 
+// handleReactionAdded records reactions to the bot's messages as feedback.
+// Slack reports the reacted message's author, so untracked bot messages
+// (e.g. sent before a restart) still count.
+func (c *SlackChannel) handleReactionAdded(ev *slackevents.ReactionAddedEvent) {
+	if ev.User == c.botUserID || ev.Item.Type != "message" {
+		return
+	}
+	c.HandleReaction(ev.User, ev.Item.Channel, ev.Item.Timestamp, ev.Reaction, ev.ItemUser == c.botUserID)
+}
+
 func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 	if ev.User == c.botUserID || ev.User == "" {
 		return
@@ -198,14 +355,6 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 		return
 	}
 
-	// 检查白名单，避免为被拒绝的用户下载附件
-	if !c.IsAllowed(ev.User) {
-		logger.DebugCF("slack", "Message rejected by allowlist", map[string]interface{}{
-			"user_id": ev.User,
-		})
-		return
-	}
-
 	senderID := ev.User
 	channelID := ev.Channel
 	threadTS := ev.ThreadTimeStamp
@@ -216,6 +365,31 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 		chatID = channelID + "/" + threadTS
 	}
 
+	content := c.stripBotMention(ev.Text)
+	if ev.ChannelType != "im" {
+		// Mentions also arrive as app_mention events, handled there
+		if c.botUserID != "" && strings.Contains(ev.Text, "<@"+c.botUserID+">") {
+			return
+		}
+		text, reply := c.GroupReply(GroupMessage{
+			SenderID:   senderID,
+			ChatID:     chatID,
+			GroupID:    channelID,
+			Content:    content,
+			ReplyToBot: threadTS != "" && c.sent.last(chatID) != "",
+		})
+		if !reply {
+			return
+		}
+		content = text
+	} else if !c.IsAllowed(ev.User) {
+		// 检查白名单，避免为被拒绝的用户下载附件
+		logger.DebugCF("slack", "Message rejected by allowlist", map[string]interface{}{
+			"user_id": ev.User,
+		})
+		return
+	}
+
 	c.api.AddReaction("eyes", slack.ItemRef{
 		Channel:   channelID,
 		Timestamp: messageTS,
@@ -226,9 +400,6 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 		Timestamp: messageTS,
 	})
 
-	content := ev.Text
-	content = c.stripBotMention(content)
-
 	var mediaPaths []string
 	localFiles := []string{} // 跟踪需要清理的本地文件
 
@@ -244,8 +415,10 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 		}
 	}()
 
+	hasAudio := false
 	if ev.Message != nil && len(ev.Message.Files) > 0 {
 		for _, file := range ev.Message.Files {
+			hasAudio = hasAudio || utils.IsAudioFile(file.Name, file.Mimetype)
 			localPath := c.downloadSlackFile(file)
 			if localPath == "" {
 				continue
@@ -279,6 +452,10 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 		"channel_id": channelID,
 		"thread_ts":  threadTS,
 		"platform":   "slack",
+		"peer_kind":  peerKind(ev.ChannelType != "im"),
+	}
+	if hasAudio {
+		metadata[bus.MetadataVoice] = "true"
 	}
 
 	logger.DebugCF("slack", "Received message", map[string]interface{}{
@@ -308,6 +485,17 @@ func (c *SlackChannel) handleAppMention(ev *slackevents.AppMentionEvent) {
 		chatID = channelID + "/" + messageTS
 	}
 
+	content, reply := c.GroupReply(GroupMessage{
+		SenderID:  senderID,
+		ChatID:    chatID,
+		GroupID:   channelID,
+		Content:   c.stripBotMention(ev.Text),
+		Mentioned: true,
+	})
+	if !reply {
+		return
+	}
+
 	c.api.AddReaction("eyes", slack.ItemRef{
 		Channel:   channelID,
 		Timestamp: messageTS,
@@ -318,8 +506,6 @@ func (c *SlackChannel) handleAppMention(ev *slackevents.AppMentionEvent) {
 		Timestamp: messageTS,
 	})
 
-	content := c.stripBotMention(ev.Text)
-
 	if strings.TrimSpace(content) == "" {
 		return
 	}
@@ -330,6 +516,7 @@ func (c *SlackChannel) handleAppMention(ev *slackevents.AppMentionEvent) {
 		"thread_ts":  threadTS,
 		"platform":   "slack",
 		"is_mention": "true",
+		"peer_kind":  "group",
 	}
 
 	c.HandleMessage(senderID, chatID, content, nil, metadata)
@@ -0,0 +1,114 @@
+package channels
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+// speechTimeout bounds synthesis, which holds up every outbound message.
+const speechTimeout = 30 * time.Second
+
+// SetSynthesizer enables spoken replies on channels that can send voice
+// notes.
+func (m *Manager) SetSynthesizer(tts voice.Synthesizer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tts = tts
+}
+
+// send delivers msg on channel: as a voice note when it asks to be spoken
+// and that works out, as text otherwise.
+func (m *Manager) send(ctx context.Context, channel Channel, msg bus.OutboundMessage, caps Capabilities) error {
+	speech := msg.Speech
+	msg.Speech = nil
+	if speech == nil || !caps.Voice || !speakable(msg, m.config.TTS.MaxChars) {
+		return channel.Send(ctx, msg)
+	}
+
+	path, err := m.synthesize(ctx, msg.Content, speech)
+	if err != nil {
+		logger.ErrorCF("channels", "TTS failed, falling back to text", map[string]interface{}{
+			"channel": msg.Channel,
+			"error":   err.Error(),
+		})
+		return channel.Send(ctx, msg)
+	}
+	if path == "" {
+		return channel.Send(ctx, msg)
+	}
+
+	spoken := msg
+	spoken.Content = ""
+	spoken.Attachments = []bus.Attachment{{Path: path, Filename: "voice.ogg", MIMEType: "audio/ogg", Voice: true}}
+	err = channel.Send(ctx, spoken)
+	os.Remove(path)
+	if err == nil {
+		return nil
+	}
+	logger.ErrorCF("channels", "Voice note failed, falling back to text", map[string]interface{}{
+		"channel": msg.Channel,
+		"error":   err.Error(),
+	})
+	return channel.Send(ctx, msg)
+}
+
+// synthesize speaks text into an Ogg/Opus file. It returns "" without a
+// synthesizer.
+func (m *Manager) synthesize(ctx context.Context, text string, speech *bus.Speech) (string, error) {
+	m.mu.RLock()
+	tts := m.tts
+	m.mu.RUnlock()
+	if tts == nil {
+		return "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, speechTimeout)
+	defer cancel()
+	path, err := tts.Synthesize(ctx, stripMarkdown(text), voice.SpeechOptions{
+		Voice:    speech.Voice,
+		Language: speech.Language,
+	})
+	if err != nil {
+		return "", err
+	}
+	return voice.ToVoiceNote(ctx, path)
+}
+
+// speakable reports whether a message reads well aloud: plain text of at
+// most maxChars (0 is unlimited) and nothing that only works on screen.
+func speakable(msg bus.OutboundMessage, maxChars int) bool {
+	if msg.EditID != "" || msg.DeleteID != "" || len(msg.Actions) > 0 || len(msg.Attachments) > 0 || len(msg.Media) > 0 {
+		return false
+	}
+	if containsCode(msg.Content) {
+		return false
+	}
+	text := stripMarkdown(msg.Content)
+	return text != "" && (maxChars <= 0 || len([]rune(text)) <= maxChars)
+}
+
+// stripMarkdown removes markdown formatting to get plain text length.
+func stripMarkdown(text string) string {
+	text = reCodeBlock.ReplaceAllString(text, "")
+	text = reInlineCode.ReplaceAllString(text, "")
+	text = reBold.ReplaceAllString(text, "$1")
+	text = reUnderBold.ReplaceAllString(text, "$1")
+	text = reItalic.ReplaceAllString(text, "$1")
+	text = reStrike.ReplaceAllString(text, "$1")
+	text = reLink.ReplaceAllString(text, "$1")
+	text = reHeading.ReplaceAllString(text, "")
+	text = reListItem.ReplaceAllString(text, "")
+	text = strings.TrimSpace(text)
+	return text
+}
+
+// containsCode checks if the message has code blocks or inline code.
+func containsCode(text string) bool {
+	return strings.Contains(text, "```") || reInlineCode.MatchString(text)
+}
@@ -0,0 +1,145 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+// fakeSynthesizer writes an .ogg file, so no conversion is needed.
+type fakeSynthesizer struct {
+	err  error
+	text string
+	opts voice.SpeechOptions
+}
+
+func (s *fakeSynthesizer) Synthesize(ctx context.Context, text string, opts voice.SpeechOptions) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	s.text, s.opts = text, opts
+	f, err := os.CreateTemp("", "speech_test_*.ogg")
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	return f.Name(), nil
+}
+
+// recordingChannel keeps what it is sent, failing voice notes on request.
+type recordingChannel struct {
+	*BaseChannel
+	sent      []bus.OutboundMessage
+	voiceErr  error
+	voicePath string
+}
+
+func (c *recordingChannel) Start(ctx context.Context) error { return nil }
+func (c *recordingChannel) Stop(ctx context.Context) error  { return nil }
+
+func (c *recordingChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	c.sent = append(c.sent, msg)
+	for _, a := range msg.Attachments {
+		if a.Voice {
+			c.voicePath = a.Path
+			if _, err := os.Stat(a.Path); err != nil {
+				return err
+			}
+			return c.voiceErr
+		}
+	}
+	return nil
+}
+
+func newSpeakingManager(tts voice.Synthesizer) *Manager {
+	m := &Manager{config: &config.Config{TTS: config.TTSConfig{MaxChars: 40}}}
+	m.SetSynthesizer(tts)
+	return m
+}
+
+func TestManagerSendSpeaks(t *testing.T) {
+	tts := &fakeSynthesizer{}
+	m := newSpeakingManager(tts)
+	ch := &recordingChannel{BaseChannel: NewBaseChannel("rec", nil, bus.NewMessageBus(), nil)}
+	ctx := context.Background()
+
+	msg := bus.OutboundMessage{Channel: "rec", ChatID: "1", Content: "**Sure**, see you at 5.", Speech: &bus.Speech{Language: "en-US"}}
+	if err := m.send(ctx, ch, msg, Capabilities{Voice: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ch.sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(ch.sent))
+	}
+	got := ch.sent[0]
+	if got.Content != "" || len(got.Attachments) != 1 || !got.Attachments[0].Voice || got.Speech != nil {
+		t.Errorf("sent %+v, want a voice note alone", got)
+	}
+	if tts.text != "Sure, see you at 5." || tts.opts.Language != "en-US" {
+		t.Errorf("synthesized %q with %+v", tts.text, tts.opts)
+	}
+	if _, err := os.Stat(ch.voicePath); !os.IsNotExist(err) {
+		t.Error("voice note not removed after sending")
+	}
+}
+
+func TestManagerSendFallsBackToText(t *testing.T) {
+	ctx := context.Background()
+	speech := &bus.Speech{}
+	tests := []struct {
+		name string
+		tts  voice.Synthesizer
+		caps Capabilities
+		msg  bus.OutboundMessage
+		sent int // Send calls, including a failed voice note
+	}{
+		{"not asked", &fakeSynthesizer{}, Capabilities{Voice: true}, bus.OutboundMessage{Content: "Hi"}, 1},
+		{"no synthesizer", nil, Capabilities{Voice: true}, bus.OutboundMessage{Content: "Hi", Speech: speech}, 1},
+		{"channel can't", &fakeSynthesizer{}, Capabilities{}, bus.OutboundMessage{Content: "Hi", Speech: speech}, 1},
+		{"too long", &fakeSynthesizer{}, Capabilities{Voice: true}, bus.OutboundMessage{Content: strings.Repeat("word ", 10), Speech: speech}, 1},
+		{"code", &fakeSynthesizer{}, Capabilities{Voice: true}, bus.OutboundMessage{Content: "Run `ls`", Speech: speech}, 1},
+		{"buttons", &fakeSynthesizer{}, Capabilities{Voice: true}, bus.OutboundMessage{Content: "Pick one", Actions: []bus.Action{{Label: "A"}}, Speech: speech}, 1},
+		{"engine fails", &fakeSynthesizer{err: errors.New("offline")}, Capabilities{Voice: true}, bus.OutboundMessage{Content: "Hi", Speech: speech}, 1},
+	}
+	for _, tt := range tests {
+		m := newSpeakingManager(tt.tts)
+		ch := &recordingChannel{BaseChannel: NewBaseChannel("rec", nil, bus.NewMessageBus(), nil)}
+		if err := m.send(ctx, ch, tt.msg, tt.caps); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		last := ch.sent[len(ch.sent)-1]
+		if len(ch.sent) != tt.sent || last.Content != tt.msg.Content || last.Speech != nil || len(last.Attachments) > 0 {
+			t.Errorf("%s: sent %+v", tt.name, ch.sent)
+		}
+	}
+
+	// A voice note the platform rejects is sent again as text
+	m := newSpeakingManager(&fakeSynthesizer{})
+	ch := &recordingChannel{BaseChannel: NewBaseChannel("rec", nil, bus.NewMessageBus(), nil), voiceErr: errors.New("upload failed")}
+	if err := m.send(ctx, ch, bus.OutboundMessage{Content: "Hi", Speech: speech}, Capabilities{Voice: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ch.sent) != 2 || ch.sent[1].Content != "Hi" || len(ch.sent[1].Attachments) > 0 {
+		t.Errorf("after a failed voice note sent %+v", ch.sent)
+	}
+}
+
+func TestDegradeOutboundKeepsVoiceNotes(t *testing.T) {
+	msg := bus.OutboundMessage{Attachments: []bus.Attachment{
+		{Path: "/tmp/voice.ogg", Voice: true},
+		{Path: "/tmp/report.pdf"},
+	}}
+	got, _ := DegradeOutbound(msg, Capabilities{Voice: true})
+	if len(got.Attachments) != 1 || !got.Attachments[0].Voice || len(got.Media) != 1 || got.Media[0] != "/tmp/report.pdf" {
+		t.Errorf("voice-only channel got %+v", got)
+	}
+	got, _ = DegradeOutbound(msg, Capabilities{})
+	if len(got.Attachments) != 0 || len(got.Media) != 2 {
+		t.Errorf("text-only channel got %+v", got)
+	}
+}
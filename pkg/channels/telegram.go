@@ -8,8 +8,8 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -50,8 +50,10 @@ type TelegramChannel struct {
 	transcriber  *voice.GroqTranscriber
 	placeholders sync.Map // chatID -> messageID
 	stopThinking sync.Map // chatID -> thinkingCancel
-	voiceInput   sync.Map // chatID -> bool (true if last input was voice/audio)
 	adminUserID  string   // admin user ID for /join, /leave commands
+	pollMu       sync.Mutex
+	pollCancel   context.CancelFunc // stops polling, including reconnect attempts
+	pollDone     chan struct{}      // closed once the current poller has let go of the bot
 }
 
 var defaultModels = []string{
@@ -84,26 +86,26 @@ func (c *thinkingCancel) Cancel() {
 }
 
 func NewTelegramChannel(cfg config.TelegramConfig, bus *bus.MessageBus, appConfig *config.Config) (*TelegramChannel, error) {
-	var opts []telego.BotOption
-
+	// net/http, unlike telego's default fasthttp, aborts a long poll when
+	// its context is cancelled, so Stop doesn't wait out the poll timeout
+	client := &http.Client{}
 	if cfg.Proxy != "" {
 		proxyURL, parseErr := url.Parse(cfg.Proxy)
 		if parseErr != nil {
 			return nil, fmt.Errorf("invalid proxy URL %q: %w", cfg.Proxy, parseErr)
 		}
-		opts = append(opts, telego.WithHTTPClient(&http.Client{
-			Transport: &http.Transport{
-				Proxy: http.ProxyURL(proxyURL),
-			},
-		}))
+		client.Transport = &http.Transport{
+			Proxy: http.ProxyURL(proxyURL),
+		}
 	}
 
-	bot, err := telego.NewBot(cfg.Token, opts...)
+	bot, err := telego.NewBot(cfg.Token, telego.WithHTTPClient(client))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create telegram bot: %w", err)
 	}
 
 	base := NewBaseChannel("telegram", cfg, bus, cfg.AllowFrom)
+	base.SetGroupPolicy(cfg.Groups, config.GroupPolicyConfig{})
 
 	return &TelegramChannel{
 		BaseChannel:  base,
@@ -132,7 +134,16 @@ func (c *TelegramChannel) SetAdminUserID(id string) {
 func (c *TelegramChannel) Start(ctx context.Context) error {
 	logger.InfoC("telegram", "Starting Telegram bot (polling mode)...")
 
-	if err := c.startPolling(ctx); err != nil {
+	// Polling runs under its own context so Stop can end it, and any
+	// reconnect in progress, before a restart polls again
+	c.stopPolling(ctx)
+	pollCtx, cancel := context.WithCancel(ctx)
+	c.pollMu.Lock()
+	c.pollCancel = cancel
+	c.pollMu.Unlock()
+
+	if err := c.startPolling(pollCtx); err != nil {
+		cancel()
 		return err
 	}
 
@@ -140,38 +151,50 @@ func (c *TelegramChannel) Start(ctx context.Context) error {
 }
 
 func (c *TelegramChannel) startPolling(ctx context.Context) error {
+	// Checked under pollMu so a poller never starts after stopPolling
+	c.pollMu.Lock()
+	if err := ctx.Err(); err != nil {
+		c.pollMu.Unlock()
+		return err
+	}
 	updates, err := c.bot.UpdatesViaLongPolling(ctx, &telego.GetUpdatesParams{
 		Timeout:        30,
-		AllowedUpdates: []string{"message", "callback_query"},
+		AllowedUpdates: []string{"message", "callback_query", "message_reaction"},
 	})
 	if err != nil {
+		c.pollMu.Unlock()
 		return fmt.Errorf("failed to start long polling: %w", err)
 	}
+	done := make(chan struct{})
+	c.pollDone = done
+	c.pollMu.Unlock()
 
 	c.setRunning(true)
 	logger.InfoCF("telegram", "Telegram bot connected", map[string]interface{}{
 		"username": c.bot.Username(),
 	})
 
+	// telego closes updates once it stops polling, on cancellation too
 	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case update, ok := <-updates:
-				if !ok {
-					logger.WarnC("telegram", "Updates channel closed, attempting reconnect...")
-					c.setRunning(false)
-					c.reconnectPolling(ctx)
-					return
-				}
-				if update.CallbackQuery != nil {
-					c.handleCallbackQuery(ctx, update)
-				} else if update.Message != nil {
-					c.handleMessage(ctx, update)
-				}
+		for update := range updates {
+			if ctx.Err() != nil {
+				continue
 			}
+			if update.CallbackQuery != nil {
+				c.handleCallbackQuery(ctx, update)
+			} else if update.MessageReaction != nil {
+				c.handleReaction(update.MessageReaction)
+			} else if update.Message != nil {
+				c.handleMessage(ctx, update)
+			}
+		}
+		close(done)
+		if ctx.Err() != nil {
+			return
 		}
+		logger.WarnC("telegram", "Updates channel closed, attempting reconnect...")
+		c.setRunning(false)
+		c.reconnectPolling(ctx)
 	}()
 
 	return nil
@@ -208,12 +231,30 @@ func (c *TelegramChannel) reconnectPolling(ctx context.Context) {
 
 func (c *TelegramChannel) Stop(ctx context.Context) error {
 	logger.InfoC("telegram", "Stopping Telegram bot...")
+	c.stopPolling(ctx)
 	c.setRunning(false)
 	return nil
 }
 
-// ttsMaxChars is the max plain-text length for a response to be sent as voice.
-const ttsMaxChars = 300
+// stopPolling cancels polling and any reconnect in progress, and waits for
+// the poller to finish, as Telegram answers a second one with 409 Conflict.
+func (c *TelegramChannel) stopPolling(ctx context.Context) {
+	c.pollMu.Lock()
+	if c.pollCancel != nil {
+		c.pollCancel()
+		c.pollCancel = nil
+	}
+	done := c.pollDone
+	c.pollMu.Unlock()
+
+	if done == nil {
+		return
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
 
 func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	if !c.IsRunning() {
@@ -233,7 +274,7 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		c.stopThinking.Delete(msg.ChatID)
 	}
 
-	// Delete placeholder before sending voice or text
+	// Delete placeholder before sending the reply
 	if pID, ok := c.placeholders.Load(msg.ChatID); ok {
 		c.placeholders.Delete(msg.ChatID)
 		_ = c.bot.DeleteMessage(ctx, &telego.DeleteMessageParams{
@@ -242,6 +283,23 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		})
 	}
 
+	if msg.DeleteID != "" {
+		messageID, err := strconv.Atoi(c.resolveSentID(msg.ChatID, msg.DeleteID))
+		if err != nil {
+			return fmt.Errorf("invalid message ID to delete: %q", msg.DeleteID)
+		}
+		return c.bot.DeleteMessage(ctx, &telego.DeleteMessageParams{ChatID: tu.ID(chatID), MessageID: messageID})
+	}
+	if msg.EditID != "" {
+		return c.editMessage(ctx, chatID, msg)
+	}
+
+	replyTo := telegramReplyParameters(msg.ReplyTo)
+	keyboard := telegramActionKeyboard(msg.Actions)
+	if len(msg.Attachments) > 0 {
+		return c.sendAttachments(ctx, chatID, msg, replyTo, keyboard)
+	}
+
 	// Send media as photos or documents based on file type
 	if len(msg.Media) > 0 {
 		for _, mediaURL := range msg.Media {
@@ -255,13 +313,14 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 					photoParams.Caption = markdownToTelegramHTML(msg.Content)
 					photoParams.ParseMode = telego.ModeHTML
 				}
-				if _, photoErr := c.bot.SendPhoto(ctx, photoParams); photoErr != nil {
+				if sent, photoErr := c.bot.SendPhoto(ctx, photoParams); photoErr != nil {
 					logger.ErrorCF("telegram", "Failed to send photo, falling back to text", map[string]interface{}{
 						"error": photoErr.Error(),
 						"url":   mediaURL,
 					})
 					break // fall through to text send below
 				} else {
+					c.RecordSent(msg.ChatID, fmt.Sprintf("%d", sent.MessageID), msg.Content)
 					return nil
 				}
 			} else {
@@ -274,106 +333,236 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 					docParams.Caption = markdownToTelegramHTML(msg.Content)
 					docParams.ParseMode = telego.ModeHTML
 				}
-				if _, docErr := c.bot.SendDocument(ctx, docParams); docErr != nil {
+				if sent, docErr := c.bot.SendDocument(ctx, docParams); docErr != nil {
 					logger.ErrorCF("telegram", "Failed to send document, falling back to text", map[string]interface{}{
 						"error": docErr.Error(),
 						"url":   mediaURL,
 					})
 					break // fall through to text send below
 				} else {
+					c.RecordSent(msg.ChatID, fmt.Sprintf("%d", sent.MessageID), msg.Content)
 					return nil
 				}
 			}
 		}
 	}
 
-	// Only reply with voice if the user sent a voice/audio message
-	if _, wasVoice := c.voiceInput.LoadAndDelete(msg.ChatID); wasVoice {
-		plainText := stripMarkdown(msg.Content)
-		if len(plainText) > 0 && len(plainText) <= ttsMaxChars && !containsCode(msg.Content) {
-			voiceErr := c.sendVoice(ctx, chatID, plainText)
-			if voiceErr == nil {
-				return nil
-			}
-			logger.ErrorCF("telegram", "TTS failed, falling back to text", map[string]interface{}{
-				"error": voiceErr.Error(),
-			})
-		}
-	}
+	return c.sendText(ctx, chatID, msg.ChatID, msg.Content, replyTo, keyboard)
+}
 
-	// Send as text, splitting if necessary (Telegram limit: 4096 chars)
-	htmlContent := markdownToTelegramHTML(msg.Content)
+// sendText sends content as HTML, splitting if necessary (Telegram limit:
+// 4096 chars). The first chunk carries the reply and the last the buttons.
+func (c *TelegramChannel) sendText(ctx context.Context, chatID int64, rawChatID, content string, replyTo *telego.ReplyParameters, keyboard *telego.InlineKeyboardMarkup) error {
+	htmlContent := markdownToTelegramHTML(content)
 	chunks := splitMessage(htmlContent, 4096)
 
-	for _, chunk := range chunks {
+	for i, chunk := range chunks {
 		tgMsg := tu.Message(tu.ID(chatID), chunk)
 		tgMsg.ParseMode = telego.ModeHTML
+		if i == 0 {
+			tgMsg.ReplyParameters = replyTo
+		}
+		if i == len(chunks)-1 && keyboard != nil {
+			tgMsg.ReplyMarkup = keyboard
+		}
 
-		if _, err = c.bot.SendMessage(ctx, tgMsg); err != nil {
+		sent, err := c.bot.SendMessage(ctx, tgMsg)
+		if err != nil {
 			logger.ErrorCF("telegram", "HTML parse failed, falling back to plain text", map[string]interface{}{
 				"error": err.Error(),
 			})
 			tgMsg.ParseMode = ""
-			if _, err = c.bot.SendMessage(ctx, tgMsg); err != nil {
+			if sent, err = c.bot.SendMessage(ctx, tgMsg); err != nil {
 				return err
 			}
 		}
+		c.RecordSent(rawChatID, fmt.Sprintf("%d", sent.MessageID), content)
 	}
 
 	return nil
 }
 
-// sendVoice converts text to speech and sends as a Telegram voice message.
-func (c *TelegramChannel) sendVoice(ctx context.Context, chatID int64, text string) error {
-	tmpMP3 := filepath.Join(os.TempDir(), fmt.Sprintf("chango_tts_%d.mp3", time.Now().UnixNano()))
-	tmpFile := filepath.Join(os.TempDir(), fmt.Sprintf("chango_tts_%d.ogg", time.Now().UnixNano()))
-	defer os.Remove(tmpMP3)
-	defer os.Remove(tmpFile)
+// Capabilities reports that Telegram renders every rich outbound field.
+func (c *TelegramChannel) Capabilities() Capabilities {
+	return Capabilities{Attachments: true, Replies: true, Actions: true, Edit: true, Delete: true, Voice: true}
+}
+
+// telegramCaptionLimit is the max caption length of a media message.
+const telegramCaptionLimit = 1024
+
+// sendAttachments sends each attachment with the method matching its MIME
+// type. The text becomes the last attachment's caption when it fits and is
+// sent as a follow-up message otherwise.
+func (c *TelegramChannel) sendAttachments(ctx context.Context, chatID int64, msg bus.OutboundMessage, replyTo *telego.ReplyParameters, keyboard *telego.InlineKeyboardMarkup) error {
+	content := msg.Content
+	for i, a := range msg.Attachments {
+		caption := a.Caption
+		last := i == len(msg.Attachments)-1
+		if last && caption == "" && len(markdownToTelegramHTML(content)) <= telegramCaptionLimit {
+			caption, content = content, ""
+		}
+		var markup *telego.InlineKeyboardMarkup
+		if last && content == "" {
+			markup = keyboard
+		}
+
+		sent, err := c.sendAttachment(ctx, chatID, a, caption, replyTo, markup)
+		if err != nil {
+			return err
+		}
+		replyTo = nil
+		c.RecordSent(msg.ChatID, fmt.Sprintf("%d", sent.MessageID), caption)
+	}
 
-	// Use edge-tts CLI directly (installed via pip in container)
-	ttsCmd := exec.CommandContext(ctx, "edge-tts", "--voice", "es-AR-TomasNeural", "--text", text, "--write-media", tmpMP3)
-	if output, err := ttsCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("edge-tts failed: %w: %s", err, string(output))
+	if strings.TrimSpace(content) == "" {
+		return nil
 	}
+	return c.sendText(ctx, chatID, msg.ChatID, content, nil, keyboard)
+}
 
-	// Convert MP3 to OGG for Telegram voice
-	ffCmd := exec.CommandContext(ctx, "ffmpeg", "-y", "-i", tmpMP3, "-c:a", "libopus", "-b:a", "64k", tmpFile)
-	if output, err := ffCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("ffmpeg failed: %w: %s", err, string(output))
+func (c *TelegramChannel) sendAttachment(ctx context.Context, chatID int64, a bus.Attachment, caption string, replyTo *telego.ReplyParameters, keyboard *telego.InlineKeyboardMarkup) (*telego.Message, error) {
+	filename, mimeType := attachmentInfo(a)
+
+	var file telego.InputFile
+	if isRemoteMedia(a.Path) {
+		file = tu.FileFromURL(a.Path)
+	} else {
+		f, err := os.Open(a.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open attachment: %w", err)
+		}
+		defer f.Close()
+		file = tu.File(tu.NameReader(f, filename))
 	}
 
-	voiceFile, err := os.Open(tmpFile)
+	parseMode := ""
+	if caption != "" {
+		caption = markdownToTelegramHTML(caption)
+		parseMode = telego.ModeHTML
+	}
+	// A nil *InlineKeyboardMarkup would still serialize as reply_markup: null
+	var markup telego.ReplyMarkup
+	if keyboard != nil {
+		markup = keyboard
+	}
+
+	switch {
+	case a.Voice:
+		return c.bot.SendVoice(ctx, &telego.SendVoiceParams{
+			ChatID: tu.ID(chatID), Voice: file, Caption: caption, ParseMode: parseMode,
+			ReplyParameters: replyTo, ReplyMarkup: markup,
+		})
+	case strings.HasPrefix(mimeType, "image/") && mimeType != "image/gif":
+		return c.bot.SendPhoto(ctx, &telego.SendPhotoParams{
+			ChatID: tu.ID(chatID), Photo: file, Caption: caption, ParseMode: parseMode,
+			ReplyParameters: replyTo, ReplyMarkup: markup,
+		})
+	case strings.HasPrefix(mimeType, "video/"):
+		return c.bot.SendVideo(ctx, &telego.SendVideoParams{
+			ChatID: tu.ID(chatID), Video: file, Caption: caption, ParseMode: parseMode,
+			ReplyParameters: replyTo, ReplyMarkup: markup,
+		})
+	case strings.HasPrefix(mimeType, "audio/"):
+		return c.bot.SendAudio(ctx, &telego.SendAudioParams{
+			ChatID: tu.ID(chatID), Audio: file, Caption: caption, ParseMode: parseMode,
+			ReplyParameters: replyTo, ReplyMarkup: markup,
+		})
+	default:
+		return c.bot.SendDocument(ctx, &telego.SendDocumentParams{
+			ChatID: tu.ID(chatID), Document: file, Caption: caption, ParseMode: parseMode,
+			ReplyParameters: replyTo, ReplyMarkup: markup,
+		})
+	}
+}
+
+// editMessage replaces the text and buttons of a message we sent earlier.
+func (c *TelegramChannel) editMessage(ctx context.Context, chatID int64, msg bus.OutboundMessage) error {
+	rawID := c.resolveSentID(msg.ChatID, msg.EditID)
+	messageID, err := strconv.Atoi(rawID)
 	if err != nil {
-		return fmt.Errorf("opening voice file: %w", err)
+		return fmt.Errorf("invalid message ID to edit: %q", msg.EditID)
 	}
-	defer voiceFile.Close()
 
-	voiceParams := &telego.SendVoiceParams{
-		ChatID: tu.ID(chatID),
-		Voice:  telego.InputFile{File: voiceFile},
+	params := &telego.EditMessageTextParams{
+		ChatID:      tu.ID(chatID),
+		MessageID:   messageID,
+		Text:        markdownToTelegramHTML(msg.Content),
+		ParseMode:   telego.ModeHTML,
+		ReplyMarkup: telegramActionKeyboard(msg.Actions),
 	}
-	_, err = c.bot.SendVoice(ctx, voiceParams)
-	return err
+	if _, err := c.bot.EditMessageText(ctx, params); err != nil {
+		logger.ErrorCF("telegram", "HTML parse failed, falling back to plain text", map[string]interface{}{
+			"error": err.Error(),
+		})
+		params.Text = msg.Content
+		params.ParseMode = ""
+		if _, err := c.bot.EditMessageText(ctx, params); err != nil {
+			return err
+		}
+	}
+	c.RecordSent(msg.ChatID, rawID, msg.Content)
+	return nil
 }
 
-// stripMarkdown removes markdown formatting to get plain text length.
-func stripMarkdown(text string) string {
-	text = reCodeBlock.ReplaceAllString(text, "")
-	text = reInlineCode.ReplaceAllString(text, "")
-	text = reBold.ReplaceAllString(text, "$1")
-	text = reUnderBold.ReplaceAllString(text, "$1")
-	text = reItalic.ReplaceAllString(text, "$1")
-	text = reStrike.ReplaceAllString(text, "$1")
-	text = reLink.ReplaceAllString(text, "$1")
-	text = reHeading.ReplaceAllString(text, "")
-	text = reListItem.ReplaceAllString(text, "")
-	text = strings.TrimSpace(text)
-	return text
+// telegramActionKeyboard builds an inline keyboard with one button per row.
+// Telegram limits callback data to 64 bytes.
+func telegramActionKeyboard(actions []bus.Action) *telego.InlineKeyboardMarkup {
+	if len(actions) == 0 {
+		return nil
+	}
+	rows := make([][]telego.InlineKeyboardButton, 0, len(actions))
+	for _, a := range actions {
+		button := tu.InlineKeyboardButton(a.Label)
+		if a.URL != "" {
+			button = button.WithURL(a.URL)
+		} else {
+			data := actionDataPrefix + a.Data
+			if len(data) > 64 {
+				data = data[:64]
+			}
+			button = button.WithCallbackData(data)
+		}
+		rows = append(rows, tu.InlineKeyboardRow(button))
+	}
+	return tu.InlineKeyboard(rows...)
 }
 
-// containsCode checks if the message has code blocks or inline code.
-func containsCode(text string) bool {
-	return strings.Contains(text, "```") || reInlineCode.MatchString(text)
+func telegramReplyParameters(replyTo string) *telego.ReplyParameters {
+	messageID, err := strconv.Atoi(replyTo)
+	if err != nil || messageID == 0 {
+		return nil
+	}
+	return &telego.ReplyParameters{MessageID: messageID}
+}
+
+// handleReaction records a user's reaction to one of our messages as feedback.
+// Only newly added emoji count; removing a reaction is not treated as feedback.
+func (c *TelegramChannel) handleReaction(reaction *telego.MessageReactionUpdated) {
+	if reaction.User == nil {
+		return // anonymous group admin
+	}
+
+	old := make(map[string]bool, len(reaction.OldReaction))
+	for _, r := range reaction.OldReaction {
+		if emoji, ok := r.(*telego.ReactionTypeEmoji); ok {
+			old[emoji.Emoji] = true
+		}
+	}
+
+	senderID := fmt.Sprintf("%d", reaction.User.ID)
+	if reaction.User.Username != "" {
+		senderID = fmt.Sprintf("%d|%s", reaction.User.ID, reaction.User.Username)
+	}
+	chatID := fmt.Sprintf("%d", reaction.Chat.ID)
+	messageID := fmt.Sprintf("%d", reaction.MessageID)
+
+	for _, r := range reaction.NewReaction {
+		emoji, ok := r.(*telego.ReactionTypeEmoji)
+		if !ok || old[emoji.Emoji] {
+			continue
+		}
+		c.HandleReaction(senderID, chatID, messageID, emoji.Emoji, false)
+	}
 }
 
 func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Update) {
@@ -396,7 +585,14 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 	chatID := message.Chat.ID
 	chatIDStr := fmt.Sprintf("%d", chatID)
 	isGroup := message.Chat.Type != "private"
-	isAdmin := c.adminUserID != "" && userID == c.adminUserID
+	// Roles from the central access policy decide who may run /join and
+	// /leave; without one it's the configured admin user
+	isAdmin := func(command string) bool {
+		if c.access != nil {
+			return c.AllowsCommand(senderID, command)
+		}
+		return c.adminUserID != "" && userID == c.adminUserID
+	}
 
 	// Handle /join command — admin adds this group to the allowlist
 	cmdText := strings.TrimSpace(message.Text)
@@ -404,7 +600,7 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 	if idx := strings.Index(cmdText, "@"); idx > 0 {
 		cmdText = cmdText[:idx]
 	}
-	if isGroup && isAdmin && cmdText == "/join" {
+	if isGroup && cmdText == "/join" && isAdmin(cmdText) {
 		c.AddToAllowList(chatIDStr)
 		// Persist to config
 		if c.configPath != "" && c.appConfig != nil {
@@ -429,7 +625,7 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 	}
 
 	// Handle /leave command — admin removes this group from the allowlist
-	if isGroup && isAdmin && cmdText == "/leave" {
+	if isGroup && cmdText == "/leave" && isAdmin(cmdText) {
 		c.RemoveFromAllowList(chatIDStr)
 		// Persist to config
 		if c.configPath != "" && c.appConfig != nil {
@@ -454,17 +650,26 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 		if !c.IsAllowedChat(chatIDStr) {
 			return
 		}
-		// Only respond when mentioned or replied to
 		botUsername := c.bot.Username()
 		mentioned := botUsername != "" && strings.Contains(message.Text, "@"+botUsername)
 		repliedToBot := message.ReplyToMessage != nil && message.ReplyToMessage.From != nil && message.ReplyToMessage.From.IsBot
-		if !mentioned && !repliedToBot {
+		// Strip the mention from the text so the LLM gets clean input
+		if mentioned {
+			message.Text = strings.TrimSpace(strings.ReplaceAll(message.Text, "@"+botUsername, ""))
+		}
+		text, reply := c.GroupReply(GroupMessage{
+			SenderID:   senderID,
+			SenderName: user.FirstName,
+			ChatID:     chatIDStr,
+			Content:    message.Text,
+			Mentioned:  mentioned,
+			ReplyToBot: repliedToBot,
+		})
+		if !reply {
 			return
 		}
-		// Strip the mention from the text so the LLM gets clean input
-		if mentioned && botUsername != "" {
-			message.Text = strings.ReplaceAll(message.Text, "@"+botUsername, "")
-			message.Text = strings.TrimSpace(message.Text)
+		if message.Text != "" {
+			message.Text = text
 		}
 	} else {
 		// Private chat: check user allowlist as before
@@ -480,13 +685,13 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 	c.chatIDs[senderID] = chatID
 
 	// Intercept bare /provider command → show inline keyboard
-	if text := strings.TrimSpace(message.Text); text == "/provider" {
+	if text := strings.TrimSpace(message.Text); text == "/provider" && c.AllowsCommand(senderID, text) {
 		c.sendProviderMenu(ctx, chatID)
 		return
 	}
 
 	// Intercept bare /model command → show inline keyboard
-	if text := strings.TrimSpace(message.Text); text == "/model" {
+	if text := strings.TrimSpace(message.Text); text == "/model" && c.AllowsCommand(senderID, text) {
 		c.sendModelMenu(ctx, chatID)
 		return
 	}
@@ -557,15 +762,6 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 		}
 	}
 
-	// Track whether this input is voice/audio for TTS response
-	isVoiceInput := message.Voice != nil || message.Audio != nil
-	voiceKey := fmt.Sprintf("%d", chatID)
-	if isVoiceInput {
-		c.voiceInput.Store(voiceKey, true)
-	} else {
-		c.voiceInput.Delete(voiceKey)
-	}
-
 	if message.Voice != nil {
 		voicePath := c.downloadFile(ctx, message.Voice.FileID, ".ogg")
 		if voicePath != "" {
@@ -691,6 +887,10 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 		"username":   user.Username,
 		"first_name": user.FirstName,
 		"is_group":   fmt.Sprintf("%t", message.Chat.Type != "private"),
+		"peer_kind":  peerKind(message.Chat.Type != "private"),
+	}
+	if message.Voice != nil || message.Audio != nil {
+		metadata[bus.MetadataVoice] = "true"
 	}
 
 	c.HandleMessage(senderID, fmt.Sprintf("%d", chatID), content, mediaPaths, metadata)
@@ -828,6 +1028,10 @@ func (c *TelegramChannel) handleCallbackQuery(ctx context.Context, update telego
 	if query == nil {
 		return
 	}
+	if strings.HasPrefix(query.Data, actionDataPrefix) {
+		c.handleActionQuery(ctx, query)
+		return
+	}
 
 	var command, displayText, answerText string
 	switch {
@@ -1030,3 +1234,42 @@ func escapeHTML(text string) string {
 	text = strings.ReplaceAll(text, ">", "&gt;")
 	return text
 }
+
+// handleActionQuery routes a press on an outbound action button to the agent
+// and removes the keyboard so the same choice can't be made twice.
+func (c *TelegramChannel) handleActionQuery(ctx context.Context, query *telego.CallbackQuery) {
+	userID := fmt.Sprintf("%d", query.From.ID)
+	senderID := userID
+	if query.From.Username != "" {
+		senderID = fmt.Sprintf("%s|%s", userID, query.From.Username)
+	}
+
+	// Messages older than 48h are inaccessible and can't be edited
+	msg, ok := query.Message.(*telego.Message)
+	if !ok || !c.IsAllowed(senderID) {
+		_ = c.bot.AnswerCallbackQuery(ctx, tu.CallbackQuery(query.ID))
+		return
+	}
+
+	var label string
+	if msg.ReplyMarkup != nil {
+		for _, row := range msg.ReplyMarkup.InlineKeyboard {
+			for _, button := range row {
+				if button.CallbackData == query.Data {
+					label = button.Text
+				}
+			}
+		}
+	}
+
+	_ = c.bot.AnswerCallbackQuery(ctx, tu.CallbackQuery(query.ID).WithText("\u2705 "+label))
+	_, _ = c.bot.EditMessageReplyMarkup(ctx, &telego.EditMessageReplyMarkupParams{
+		ChatID:    tu.ID(msg.Chat.ID),
+		MessageID: msg.MessageID,
+	})
+
+	c.HandleAction(senderID, fmt.Sprintf("%d", msg.Chat.ID), fmt.Sprintf("%d", msg.MessageID), query.Data, label, map[string]string{
+		"user_id":  userID,
+		"username": query.From.Username,
+	})
+}
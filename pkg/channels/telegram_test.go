@@ -0,0 +1,89 @@
+package channels
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mymmrac/telego"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// fakeTelegramAPI answers getUpdates after a short wait, counting them.
+type fakeTelegramAPI struct {
+	mu    sync.Mutex
+	polls int
+}
+
+func (f *fakeTelegramAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !strings.HasSuffix(r.URL.Path, "/getUpdates") {
+		w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"bot","username":"bot"}}`))
+		return
+	}
+
+	f.mu.Lock()
+	f.polls++
+	f.mu.Unlock()
+
+	select {
+	case <-r.Context().Done():
+	case <-time.After(20 * time.Millisecond):
+	}
+	w.Write([]byte(`{"ok":true,"result":[]}`))
+}
+
+func (f *fakeTelegramAPI) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.polls
+}
+
+func TestTelegramStopStartPollsOnce(t *testing.T) {
+	api := &fakeTelegramAPI{}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	bot, err := telego.NewBot("123456:"+strings.Repeat("a", 35),
+		telego.WithAPIServer(srv.URL), telego.WithHTTPClient(srv.Client()), telego.WithDiscardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &TelegramChannel{
+		BaseChannel: NewBaseChannel("telegram", nil, bus.NewMessageBus(), nil),
+		bot:         bot,
+		chatIDs:     make(map[string]int64),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The supervisor restarts a channel with Stop then Start; telego refuses
+	// to poll again while the old poller still runs, and Telegram would
+	// answer both with 409 Conflict
+	for i := 0; i < 3; i++ {
+		if err := c.Start(ctx); err != nil {
+			t.Fatalf("restart %d: %v", i, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		if err := c.Stop(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if c.IsRunning() {
+			t.Fatal("running after Stop")
+		}
+	}
+
+	stopped := api.count()
+	if stopped == 0 {
+		t.Fatal("never polled")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if polls := api.count(); polls != stopped {
+		t.Errorf("still polling after Stop: %d polls, %d when stopped", polls, stopped)
+	}
+}
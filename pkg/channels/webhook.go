@@ -1,14 +1,22 @@
 package channels
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/logger"
@@ -16,28 +24,75 @@ import (
 )
 
 // WebhookChannel receives external events via HTTP POST and routes them to the agent.
-// Responses from the agent are logged but not sent back (fire-and-forget);
-// the agent's response will be routed to the last active channel (e.g. Telegram) via the bus.
+// By default events are fire-and-forget: responses from the agent are logged only.
+// A payload with "wait": true holds the HTTP request open until the agent replies,
+// and one with "callback_url" gets the reply POSTed there instead.
 type WebhookChannel struct {
 	*BaseChannel
 	config     config.WebhookConfig
 	httpServer *http.Server
+	client     *http.Client
+	routes     []*webhookRoute
+
+	mu      sync.Mutex
+	pending map[string]*webhookWaiter // chatID -> request awaiting a reply
 }
 
 type webhookPayload struct {
 	Source   string            `json:"source"`
-	Event   string            `json:"event"`
-	Content string            `json:"content"`
+	Event    string            `json:"event"`
+	Content  string            `json:"content"`
 	Metadata map[string]string `json:"metadata,omitempty"`
+
+	Wait        bool   `json:"wait,omitempty"`
+	CallbackURL string `json:"callback_url,omitempty"`
+	Session     string `json:"session,omitempty"` // reuse to continue a conversation
+}
+
+// webhookWaiter is a request waiting for the agent's reply, either on the
+// open HTTP request (reply) or to be delivered to callbackURL.
+type webhookWaiter struct {
+	reply       chan string
+	callbackURL string
+	payload     webhookPayload
+	session     string
+	timer       *time.Timer
+}
+
+type webhookReply struct {
+	Status   string `json:"status"`
+	Session  string `json:"session,omitempty"`
+	Source   string `json:"source,omitempty"`
+	Event    string `json:"event,omitempty"`
+	Response string `json:"response,omitempty"`
 }
 
+const (
+	webhookMaxBody             = 1 << 20
+	webhookSignatureTolerance  = 5 * time.Minute
+	defaultWebhookTimeout      = 120
+	defaultWebhookSignatureHdr = "X-Hub-Signature-256"
+)
+
 // NewWebhookChannel creates a new webhook channel instance.
 func NewWebhookChannel(cfg config.WebhookConfig, messageBus *bus.MessageBus) (*WebhookChannel, error) {
 	base := NewBaseChannel("webhook", cfg, messageBus, nil) // no allowList, auth is via bearer token
 
+	routes := make([]*webhookRoute, 0, len(cfg.Routes))
+	for _, rc := range cfg.Routes {
+		route, err := newWebhookRoute(rc)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+
 	return &WebhookChannel{
 		BaseChannel: base,
 		config:      cfg,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		routes:      routes,
+		pending:     make(map[string]*webhookWaiter),
 	}, nil
 }
 
@@ -51,6 +106,9 @@ func (c *WebhookChannel) Start(ctx context.Context) error {
 		path = "/webhook/inbound"
 	}
 	mux.HandleFunc(path, c.handler)
+	for _, route := range c.routes {
+		mux.HandleFunc(route.cfg.Path, c.handleRoute(route))
+	}
 
 	addr := fmt.Sprintf("%s:%d", c.config.Host, c.config.Port)
 	c.httpServer = &http.Server{
@@ -60,8 +118,9 @@ func (c *WebhookChannel) Start(ctx context.Context) error {
 
 	go func() {
 		logger.InfoCF("webhook", "Webhook server listening", map[string]interface{}{
-			"addr": addr,
-			"path": path,
+			"addr":   addr,
+			"path":   path,
+			"routes": len(c.routes),
 		})
 		if err := c.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			logger.ErrorCF("webhook", "Webhook server error", map[string]interface{}{
@@ -94,11 +153,64 @@ func (c *WebhookChannel) Stop(ctx context.Context) error {
 	return nil
 }
 
-// Send logs outbound messages (webhook is fire-and-forget, responses go to other channels).
+// Send hands the agent's reply to the request waiting on msg.ChatID, if any.
+// Replies to fire-and-forget events are only logged.
 func (c *WebhookChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
-	logger.DebugCF("webhook", "Webhook outbound (logged only)", map[string]interface{}{
-		"chat_id":     msg.ChatID,
-		"content_len": len(msg.Content),
+	c.mu.Lock()
+	waiter, ok := c.pending[msg.ChatID]
+	if ok {
+		delete(c.pending, msg.ChatID)
+		waiter.timer.Stop()
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		logger.DebugCF("webhook", "Webhook outbound (logged only)", map[string]interface{}{
+			"chat_id":     msg.ChatID,
+			"content_len": len(msg.Content),
+		})
+		return nil
+	}
+
+	if waiter.callbackURL == "" {
+		waiter.reply <- msg.Content
+		return nil
+	}
+	return c.postCallback(ctx, waiter, msg.Content)
+}
+
+// postCallback delivers a reply to the callback URL given in the payload,
+// signed the same way inbound requests are when an HMAC secret is set.
+func (c *WebhookChannel) postCallback(ctx context.Context, waiter *webhookWaiter, content string) error {
+	body, _ := json.Marshal(webhookReply{
+		Status:   "ok",
+		Session:  waiter.session,
+		Source:   waiter.payload.Source,
+		Event:    waiter.payload.Event,
+		Response: content,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, waiter.callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("webhook callback: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.config.HMACSecret != "" {
+		req.Header.Set(c.signatureHeader(), "sha256="+signWebhook(c.config.HMACSecret, body))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook callback: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook callback: %s returned %d", waiter.callbackURL, resp.StatusCode)
+	}
+
+	logger.InfoCF("webhook", "Delivered reply to callback", map[string]interface{}{
+		"session": waiter.session,
+		"status":  resp.StatusCode,
 	})
 	return nil
 }
@@ -110,18 +222,7 @@ func (c *WebhookChannel) handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate bearer token if configured
-	if c.config.Secret != "" {
-		auth := r.Header.Get("Authorization")
-		expected := "Bearer " + c.config.Secret
-		if !strings.EqualFold(auth, expected) {
-			logger.WarnC("webhook", "Invalid or missing bearer token")
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-	}
-
-	body, err := io.ReadAll(r.Body)
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, webhookMaxBody))
 	if err != nil {
 		logger.ErrorCF("webhook", "Failed to read request body", map[string]interface{}{
 			"error": err.Error(),
@@ -130,6 +231,12 @@ func (c *WebhookChannel) handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !c.authorized(r, body) {
+		logger.WarnC("webhook", "Invalid or missing bearer token or signature")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	var payload webhookPayload
 	if err := json.Unmarshal(body, &payload); err != nil {
 		logger.ErrorCF("webhook", "Failed to parse webhook payload", map[string]interface{}{
@@ -150,22 +257,215 @@ func (c *WebhookChannel) handler(w http.ResponseWriter, r *http.Request) {
 		"preview": utils.Truncate(payload.Content, 80),
 	})
 
-	// Return 200 OK immediately
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"status":"ok"}`))
+	if payload.CallbackURL != "" {
+		if u, err := url.Parse(payload.CallbackURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			http.Error(w, "callback_url must be an http(s) URL", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !payload.Wait && payload.CallbackURL == "" {
+		// Return 200 OK immediately
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"ok"}`))
+
+		// Process event asynchronously
+		go c.processEvent(payload, fmt.Sprintf("webhook:%s:%s", payload.Source, payload.Event))
+		return
+	}
+
+	// Replies are matched to requests by chat ID, so each waiting request
+	// gets its own session unless the caller names one to continue.
+	session := sanitizeWebhookSession(payload.Session)
+	if session == "" {
+		session = uuid.NewString()
+	}
+	chatID := fmt.Sprintf("webhook:%s:%s:%s", payload.Source, payload.Event, session)
+
+	waiter := &webhookWaiter{
+		reply:   make(chan string, 1),
+		payload: payload,
+		session: session,
+	}
+	if !payload.Wait {
+		waiter.callbackURL = payload.CallbackURL
+	}
+	if !c.addWaiter(chatID, waiter) {
+		http.Error(w, "a request for this session is already in progress", http.StatusConflict)
+		return
+	}
+
+	c.processEvent(payload, chatID)
+
+	w.Header().Set("Content-Type", "application/json")
+	if waiter.callbackURL != "" {
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(webhookReply{Status: "accepted", Session: session})
+		return
+	}
+
+	select {
+	case reply := <-waiter.reply:
+		json.NewEncoder(w).Encode(webhookReply{
+			Status:   "ok",
+			Session:  session,
+			Source:   payload.Source,
+			Event:    payload.Event,
+			Response: reply,
+		})
+	case <-waiter.timer.C:
+		c.removeWaiter(chatID, waiter)
+		w.WriteHeader(http.StatusGatewayTimeout)
+		json.NewEncoder(w).Encode(webhookReply{Status: "timeout", Session: session})
+	case <-r.Context().Done():
+		c.removeWaiter(chatID, waiter)
+	}
+}
+
+// addWaiter registers a request awaiting a reply on chatID. It fails if
+// another request for the same session is still waiting.
+func (c *WebhookChannel) addWaiter(chatID string, waiter *webhookWaiter) bool {
+	timeout := time.Duration(c.config.ResponseTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout * time.Second
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, busy := c.pending[chatID]; busy {
+		return false
+	}
+	c.pending[chatID] = waiter
+	if waiter.callbackURL != "" {
+		// Nobody reads the timer channel for callbacks; just forget the request.
+		waiter.timer = time.AfterFunc(timeout, func() {
+			if c.removeWaiter(chatID, waiter) {
+				logger.WarnCF("webhook", "No reply before timeout, dropping callback", map[string]interface{}{
+					"session": waiter.session,
+				})
+			}
+		})
+	} else {
+		waiter.timer = time.NewTimer(timeout)
+	}
+	return true
+}
 
-	// Process event asynchronously
-	go c.processEvent(payload)
+// removeWaiter unregisters waiter if it is still pending on chatID.
+func (c *WebhookChannel) removeWaiter(chatID string, waiter *webhookWaiter) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending[chatID] != waiter {
+		return false
+	}
+	delete(c.pending, chatID)
+	waiter.timer.Stop()
+	return true
+}
+
+// authorized checks the channel's bearer secret and/or HMAC signature.
+func (c *WebhookChannel) authorized(r *http.Request, body []byte) bool {
+	return checkWebhookAuth(r, body, c.config.Secret, c.config.HMACSecret, c.config.SignatureHeader)
+}
+
+// checkWebhookAuth accepts a request carrying the bearer secret or a valid
+// HMAC signature in sigHeader. When both are configured either one is
+// enough; with neither, every request is accepted.
+func checkWebhookAuth(r *http.Request, body []byte, secret, hmacSecret, sigHeader string) bool {
+	if secret == "" && hmacSecret == "" {
+		return true
+	}
+	if secret != "" && strings.EqualFold(r.Header.Get("Authorization"), "Bearer "+secret) {
+		return true
+	}
+	if hmacSecret != "" {
+		if sigHeader == "" {
+			sigHeader = defaultWebhookSignatureHdr
+		}
+		return verifyWebhookSignature(hmacSecret, r.Header.Get(sigHeader), body, time.Now())
+	}
+	return false
+}
+
+func (c *WebhookChannel) signatureHeader() string {
+	if c.config.SignatureHeader != "" {
+		return c.config.SignatureHeader
+	}
+	return defaultWebhookSignatureHdr
+}
+
+func signWebhook(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyWebhookSignature accepts GitHub-style "sha256=<hex>", a bare hex
+// digest, or Stripe-style "t=<unix>,v1=<hex>" where the signed payload is
+// "<t>.<body>" and t must be within webhookSignatureTolerance of now.
+func verifyWebhookSignature(secret, header string, body []byte, now time.Time) bool {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return false
+	}
+
+	if strings.Contains(header, "v1=") {
+		var ts string
+		var sigs []string
+		for _, part := range strings.Split(header, ",") {
+			k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch k {
+			case "t":
+				ts = v
+			case "v1":
+				sigs = append(sigs, v)
+			}
+		}
+		unix, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return false
+		}
+		if d := now.Sub(time.Unix(unix, 0)); d > webhookSignatureTolerance || d < -webhookSignatureTolerance {
+			return false
+		}
+		expected := signWebhook(secret, append([]byte(ts+"."), body...))
+		for _, sig := range sigs {
+			if hmac.Equal([]byte(strings.ToLower(sig)), []byte(expected)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	sig := strings.ToLower(strings.TrimPrefix(header, "sha256="))
+	return hmac.Equal([]byte(sig), []byte(signWebhook(secret, body)))
+}
+
+// sanitizeWebhookSession keeps caller-chosen session names safe for use in
+// chat IDs and session file names.
+func sanitizeWebhookSession(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if b.Len() >= 64 {
+			break
+		}
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
 }
 
 // processEvent routes the webhook payload to the agent via the message bus.
-func (c *WebhookChannel) processEvent(payload webhookPayload) {
+func (c *WebhookChannel) processEvent(payload webhookPayload, chatID string) {
 	// Build a descriptive message for the agent
 	content := fmt.Sprintf("[Webhook: %s/%s] %s", payload.Source, payload.Event, payload.Content)
 
 	// Use source as sender ID, event type as part of chat ID
 	senderID := fmt.Sprintf("webhook:%s", payload.Source)
-	chatID := fmt.Sprintf("webhook:%s:%s", payload.Source, payload.Event)
 
 	metadata := map[string]string{
 		"platform": "webhook",
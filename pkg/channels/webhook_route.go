@@ -0,0 +1,264 @@
+package channels
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// webhookRoute maps arbitrary JSON posted to its path (GitHub, Alertmanager,
+// Home Assistant, ...) to an agent message using Go templates. The decoded
+// body is the template's dot; request headers are available through
+// {{header "X-GitHub-Event"}}.
+type webhookRoute struct {
+	cfg     config.WebhookRouteConfig
+	filter  *template.Template
+	content *template.Template
+	session *template.Template
+	chatID  *template.Template
+}
+
+// eventTemplateFuncs are available to webhook route and MQTT topic templates.
+var eventTemplateFuncs = template.FuncMap{
+	"header": func(string) string { return "" }, // rebound per request
+	"json": func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return string(data)
+	},
+	"truncate": func(n int, v interface{}) string { return utils.Truncate(fmt.Sprint(v), n) },
+	"default": func(def, v interface{}) interface{} {
+		if v == nil || fmt.Sprint(v) == "" {
+			return def
+		}
+		return v
+	},
+	"join": func(sep string, v interface{}) string {
+		items, _ := v.([]interface{})
+		parts := make([]string, 0, len(items))
+		for _, item := range items {
+			parts = append(parts, fmt.Sprint(item))
+		}
+		return strings.Join(parts, sep)
+	},
+	"lower":     func(v interface{}) string { return strings.ToLower(fmt.Sprint(v)) },
+	"upper":     func(v interface{}) string { return strings.ToUpper(fmt.Sprint(v)) },
+	"contains":  func(sub string, v interface{}) bool { return strings.Contains(fmt.Sprint(v), sub) },
+	"hasPrefix": func(prefix string, v interface{}) bool { return strings.HasPrefix(fmt.Sprint(v), prefix) },
+}
+
+func newWebhookRoute(cfg config.WebhookRouteConfig) (*webhookRoute, error) {
+	if cfg.Name == "" || cfg.Path == "" {
+		return nil, fmt.Errorf("webhook route needs a name and a path")
+	}
+	route := &webhookRoute{cfg: cfg}
+	for _, t := range []struct {
+		dst  **template.Template
+		name string
+		text string
+	}{
+		{&route.filter, "filter", cfg.Filter},
+		{&route.content, "template", cfg.Template},
+		{&route.session, "session", cfg.Session},
+		{&route.chatID, "chat_id", cfg.ChatID},
+	} {
+		tmpl, err := parseEventTemplate(t.name, t.text)
+		if err != nil {
+			return nil, fmt.Errorf("webhook route %s: %s: %w", cfg.Name, t.name, err)
+		}
+		*t.dst = tmpl
+	}
+	return route, nil
+}
+
+// parseEventTemplate parses text, returning nil for an empty template.
+func parseEventTemplate(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	return template.New(name).Funcs(eventTemplateFuncs).Parse(text)
+}
+
+// renderEventTemplate executes tmpl against data, with header backing the
+// header function. Missing fields render as empty; a nil tmpl renders "".
+func renderEventTemplate(tmpl *template.Template, data interface{}, header http.Header) (string, error) {
+	if tmpl == nil {
+		return "", nil
+	}
+	t, err := tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	t.Funcs(template.FuncMap{"header": header.Get})
+	var out strings.Builder
+	if err := t.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.ReplaceAll(out.String(), "<no value>", "")), nil
+}
+
+// templateVerdict reports whether a rendered filter template lets an event through.
+func templateVerdict(s string) bool {
+	return s != "" && s != "false" && s != "0"
+}
+
+// handleRoute serves one configured route. Events are fire-and-forget: the
+// sender gets 202 (or 204 when filtered out) and the agent's reply goes to
+// the route's delivery channel, if any.
+func (c *WebhookChannel) handleRoute(route *webhookRoute) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, webhookMaxBody))
+		if err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+
+		secret, hmacSecret, sigHeader := route.cfg.Secret, route.cfg.HMACSecret, route.cfg.SignatureHeader
+		if secret == "" && hmacSecret == "" {
+			secret, hmacSecret, sigHeader = c.config.Secret, c.config.HMACSecret, c.config.SignatureHeader
+		}
+		if !checkWebhookAuth(r, body, secret, hmacSecret, sigHeader) {
+			logger.WarnCF("webhook", "Invalid or missing bearer token or signature", map[string]interface{}{
+				"route": route.cfg.Name,
+			})
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		data, err := decodeWebhookBody(r.Header.Get("Content-Type"), body)
+		if err != nil {
+			logger.ErrorCF("webhook", "Failed to parse webhook payload", map[string]interface{}{
+				"route": route.cfg.Name,
+				"error": err.Error(),
+			})
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+
+		msg, keep, err := route.message(data, r.Header)
+		if err != nil {
+			logger.ErrorCF("webhook", "Webhook route template failed", map[string]interface{}{
+				"route": route.cfg.Name,
+				"error": err.Error(),
+			})
+			http.Error(w, "template error", http.StatusUnprocessableEntity)
+			return
+		}
+		if !keep {
+			logger.DebugCF("webhook", "Webhook event filtered out", map[string]interface{}{
+				"route": route.cfg.Name,
+			})
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		logger.InfoCF("webhook", "Received routed webhook event", map[string]interface{}{
+			"route":   route.cfg.Name,
+			"channel": msg.Channel,
+			"preview": utils.Truncate(msg.Content, 80),
+		})
+		c.bus.PublishInbound(msg)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"status":"accepted"}`))
+	}
+}
+
+// message builds the inbound message for an event, or reports keep=false
+// when the filter or the content template leaves nothing to send.
+func (r *webhookRoute) message(data interface{}, header http.Header) (msg bus.InboundMessage, keep bool, err error) {
+	if r.filter != nil {
+		verdict, err := renderEventTemplate(r.filter, data, header)
+		if err != nil {
+			return msg, false, err
+		}
+		if !templateVerdict(verdict) {
+			return msg, false, nil
+		}
+	}
+
+	content, err := renderEventTemplate(r.content, data, header)
+	if err != nil {
+		return msg, false, err
+	}
+	if r.content == nil {
+		raw, _ := json.Marshal(data)
+		content = utils.Truncate(string(raw), 4000)
+	}
+	if content == "" {
+		return msg, false, nil
+	}
+
+	session, err := renderEventTemplate(r.session, data, header)
+	if err != nil {
+		return msg, false, err
+	}
+	session = sanitizeWebhookSession(session)
+
+	msg = bus.InboundMessage{
+		SenderID: "webhook:" + r.cfg.Name,
+		Content:  fmt.Sprintf("[Webhook: %s] %s", r.cfg.Name, content),
+		Metadata: map[string]string{
+			"platform": "webhook",
+			"route":    r.cfg.Name,
+		},
+	}
+
+	if r.cfg.Channel != "" {
+		// Deliver the reply to another channel's chat; by default the event
+		// joins that chat's own session so follow-ups there have context.
+		chatID, err := renderEventTemplate(r.chatID, data, header)
+		if err != nil {
+			return msg, false, err
+		}
+		if chatID == "" {
+			return msg, false, fmt.Errorf("chat_id is required with channel %q", r.cfg.Channel)
+		}
+		msg.Channel = r.cfg.Channel
+		msg.ChatID = chatID
+		msg.SessionKey = fmt.Sprintf("%s:%s", msg.Channel, chatID)
+		if session != "" {
+			msg.SessionKey = fmt.Sprintf("webhook:%s:%s", r.cfg.Name, session)
+		}
+		return msg, true, nil
+	}
+
+	msg.Channel = "webhook"
+	msg.ChatID = "webhook:" + r.cfg.Name
+	if session != "" {
+		msg.ChatID += ":" + session
+	}
+	msg.SessionKey = "webhook:" + msg.ChatID
+	return msg, true, nil
+}
+
+// decodeWebhookBody parses a JSON body, or the "payload" field of a
+// form-encoded one (GitHub's application/x-www-form-urlencoded option).
+func decodeWebhookBody(contentType string, body []byte) (interface{}, error) {
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, err
+		}
+		body = []byte(form.Get("payload"))
+	}
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,231 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// echoAgent answers every inbound webhook message the way AgentLoop.Run would.
+func echoAgent(ctx context.Context, mb *bus.MessageBus, ch *WebhookChannel) {
+	for {
+		msg, ok := mb.ConsumeInbound(ctx)
+		if !ok {
+			return
+		}
+		ch.Send(ctx, bus.OutboundMessage{Channel: msg.Channel, ChatID: msg.ChatID, Content: "echo " + msg.Content})
+	}
+}
+
+func newTestWebhook(t *testing.T, cfg config.WebhookConfig) (*WebhookChannel, *httptest.Server, *bus.MessageBus) {
+	t.Helper()
+	mb := bus.NewMessageBus()
+	ch, _ := NewWebhookChannel(cfg, mb)
+	srv := httptest.NewServer(http.HandlerFunc(ch.handler))
+	t.Cleanup(srv.Close)
+	return ch, srv, mb
+}
+
+func TestWebhookWaitReturnsReply(t *testing.T) {
+	ch, srv, mb := newTestWebhook(t, config.WebhookConfig{Secret: "s3cret", ResponseTimeout: 5})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go echoAgent(ctx, mb, ch)
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"source":"ci","event":"build","content":"status?","wait":true,"session":"job 7"}`))
+	req.Header.Set("Authorization", "Bearer s3cret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var reply webhookReply
+	json.NewDecoder(resp.Body).Decode(&reply)
+	if resp.StatusCode != http.StatusOK || reply.Response != "echo [Webhook: ci/build] status?" {
+		t.Fatalf("unexpected reply %d %+v", resp.StatusCode, reply)
+	}
+	if reply.Session != "job_7" {
+		t.Errorf("session not sanitized: %q", reply.Session)
+	}
+}
+
+func TestWebhookWaitTimeout(t *testing.T) {
+	_, srv, _ := newTestWebhook(t, config.WebhookConfig{ResponseTimeout: 1})
+
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(`{"source":"ci","content":"hello","wait":true}`))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("expected 504, got %d", resp.StatusCode)
+	}
+}
+
+func TestWebhookCallback(t *testing.T) {
+	got := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- r
+		bodies <- body
+	}))
+	defer callback.Close()
+
+	ch, srv, mb := newTestWebhook(t, config.WebhookConfig{HMACSecret: "key", ResponseTimeout: 5})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go echoAgent(ctx, mb, ch)
+
+	body := `{"source":"ci","content":"deploy","callback_url":"` + callback.URL + `"}`
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+	req.Header.Set("X-Hub-Signature-256", "sha256="+signWebhook("key", []byte(body)))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", resp.StatusCode)
+	}
+
+	select {
+	case r := <-got:
+		payload := <-bodies
+		var reply webhookReply
+		json.Unmarshal(payload, &reply)
+		if reply.Response != "echo [Webhook: ci/] deploy" {
+			t.Errorf("unexpected callback payload: %s", payload)
+		}
+		if !verifyWebhookSignature("key", r.Header.Get("X-Hub-Signature-256"), payload, time.Now()) {
+			t.Error("callback is not signed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback not delivered")
+	}
+}
+
+func TestWebhookAuth(t *testing.T) {
+	_, srv, _ := newTestWebhook(t, config.WebhookConfig{Secret: "s3cret", HMACSecret: "key"})
+	body := `{"source":"gh","content":"push"}`
+
+	for name, header := range map[string][2]string{
+		"bearer":    {"Authorization", "Bearer s3cret"},
+		"signature": {"X-Hub-Signature-256", "sha256=" + signWebhook("key", []byte(body))},
+		"wrong":     {"X-Hub-Signature-256", "sha256=" + signWebhook("other", []byte(body))},
+		"missing":   {"X-Other", "x"},
+	} {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+		req.Header.Set(header[0], header[1])
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", name, err)
+		}
+		resp.Body.Close()
+		wantOK := name == "bearer" || name == "signature"
+		if (resp.StatusCode == http.StatusOK) != wantOK {
+			t.Errorf("%s: unexpected status %d", name, resp.StatusCode)
+		}
+	}
+}
+
+func TestVerifyWebhookSignatureStripe(t *testing.T) {
+	body := []byte(`{"id":"evt_1"}`)
+	now := time.Unix(1700000000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	sig := signWebhook("whsec", append([]byte(ts+"."), body...))
+
+	if !verifyWebhookSignature("whsec", "t="+ts+",v1=bad,v1="+sig, body, now) {
+		t.Error("valid Stripe-style signature rejected")
+	}
+	if verifyWebhookSignature("whsec", "t="+ts+",v1="+sig, body, now.Add(10*time.Minute)) {
+		t.Error("stale timestamp accepted")
+	}
+}
+
+func TestWebhookRoutes(t *testing.T) {
+	mb := bus.NewMessageBus()
+	ch, err := NewWebhookChannel(config.WebhookConfig{Routes: []config.WebhookRouteConfig{
+		{
+			Name:       "github",
+			Path:       "/hooks/github",
+			HMACSecret: "gh",
+			Filter:     `{{if eq (header "X-GitHub-Event") "push"}}true{{end}}`,
+			Template:   `{{.pusher.name}} pushed {{len .commits}} commit(s) to {{.repository.full_name}}: {{join "; " .messages}}`,
+			Session:    `{{.repository.full_name}}`,
+		},
+		{
+			Name:     "alerts",
+			Path:     "/hooks/alertmanager",
+			Template: `{{range .alerts}}[{{.status}}] {{.labels.alertname}} {{end}}`,
+			Channel:  "telegram",
+			ChatID:   "12345",
+		},
+	}}, mb)
+	if err != nil {
+		t.Fatalf("NewWebhookChannel: %v", err)
+	}
+	mux := http.NewServeMux()
+	for _, route := range ch.routes {
+		mux.HandleFunc(route.cfg.Path, ch.handleRoute(route))
+	}
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	post := func(path, event, body string) int {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-GitHub-Event", event)
+		req.Header.Set("X-Hub-Signature-256", "sha256="+signWebhook("gh", []byte(body)))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	push := `{"pusher":{"name":"ana"},"repository":{"full_name":"acme/app"},"commits":[{},{}],"messages":["fix","docs"]}`
+	if status := post("/hooks/github", "watch", push); status != http.StatusNoContent {
+		t.Errorf("filtered event: expected 204, got %d", status)
+	}
+	if status := post("/hooks/github", "push", push); status != http.StatusAccepted {
+		t.Fatalf("push event: expected 202, got %d", status)
+	}
+	if status := post("/hooks/alertmanager", "", `{"alerts":[{"status":"firing","labels":{"alertname":"DiskFull"}}]}`); status != http.StatusAccepted {
+		t.Fatalf("alert event: expected 202, got %d", status)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, _ := mb.ConsumeInbound(ctx)
+	if msg.Content != "[Webhook: github] ana pushed 2 commit(s) to acme/app: fix; docs" ||
+		msg.Channel != "webhook" || msg.ChatID != "webhook:github:acme_app" {
+		t.Errorf("unexpected github message: %+v", msg)
+	}
+	msg, _ = mb.ConsumeInbound(ctx)
+	if msg.Content != "[Webhook: alerts] [firing] DiskFull" ||
+		msg.Channel != "telegram" || msg.ChatID != "12345" || msg.SessionKey != "telegram:12345" {
+		t.Errorf("unexpected alert message: %+v", msg)
+	}
+}
+
+func TestDecodeWebhookBodyForm(t *testing.T) {
+	data, err := decodeWebhookBody("application/x-www-form-urlencoded", []byte("payload=%7B%22zen%22%3A%22hi%22%7D"))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if data.(map[string]interface{})["zen"] != "hi" {
+		t.Errorf("unexpected data: %v", data)
+	}
+}
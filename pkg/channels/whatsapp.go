@@ -2,9 +2,11 @@ package channels
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
+	"os"
 	"sync"
 	"time"
 
@@ -54,7 +56,7 @@ func (c *WhatsAppChannel) Start(ctx context.Context) error {
 	c.setRunning(true)
 	log.Println("WhatsApp channel connected")
 
-	go c.listen(ctx)
+	go c.listen(ctx, conn)
 
 	return nil
 }
@@ -86,12 +88,51 @@ func (c *WhatsAppChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		return fmt.Errorf("whatsapp connection not established")
 	}
 
-	payload := map[string]interface{}{
+	for _, a := range msg.Attachments {
+		if a.Voice {
+			if err := c.sendAudio(msg.ChatID, a); err != nil {
+				return err
+			}
+		}
+	}
+	if msg.Content == "" && len(msg.Attachments) > 0 {
+		return nil
+	}
+
+	return c.write(map[string]interface{}{
 		"type":    "message",
 		"to":      msg.ChatID,
 		"content": msg.Content,
+	})
+}
+
+// Capabilities reports that WhatsApp only renders voice notes beyond text.
+func (c *WhatsAppChannel) Capabilities() Capabilities {
+	return Capabilities{Voice: true}
+}
+
+// sendAudio sends a voice note through the bridge, which has to understand
+// the "audio" message type to deliver it.
+func (c *WhatsAppChannel) sendAudio(chatID string, a bus.Attachment) error {
+	data, err := os.ReadFile(a.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read voice note: %w", err)
+	}
+	_, mimeType := attachmentInfo(a)
+	if mimeType == "audio/ogg" {
+		mimeType = "audio/ogg; codecs=opus"
 	}
+	return c.write(map[string]interface{}{
+		"type":     "audio",
+		"to":       chatID,
+		"data":     base64.StdEncoding.EncodeToString(data),
+		"mimetype": mimeType,
+		"ptt":      true,
+	})
+}
 
+// write sends one payload to the bridge. Must be called with mu held.
+func (c *WhatsAppChannel) write(payload map[string]interface{}) error {
 	data, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal message: %w", err)
@@ -104,26 +145,33 @@ func (c *WhatsAppChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 	return nil
 }
 
-func (c *WhatsAppChannel) listen(ctx context.Context) {
+// HealthCheck reports whether the bridge connection is still up.
+func (c *WhatsAppChannel) HealthCheck(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected {
+		return fmt.Errorf("whatsapp bridge connection lost")
+	}
+	return nil
+}
+
+// listen reads from conn until it fails or ctx is done. A failed read
+// marks the channel disconnected so the supervisor can reconnect it.
+func (c *WhatsAppChannel) listen(ctx context.Context, conn *websocket.Conn) {
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			c.mu.Lock()
-			conn := c.conn
-			c.mu.Unlock()
-
-			if conn == nil {
-				time.Sleep(1 * time.Second)
-				continue
-			}
-
 			_, message, err := conn.ReadMessage()
 			if err != nil {
 				log.Printf("WhatsApp read error: %v", err)
-				time.Sleep(2 * time.Second)
-				continue
+				c.mu.Lock()
+				if c.conn == conn {
+					c.connected = false
+				}
+				c.mu.Unlock()
+				return
 			}
 
 			var msg map[string]interface{}
@@ -161,16 +209,21 @@ func (c *WhatsAppChannel) handleIncomingMessage(msg map[string]interface{}) {
 	}
 
 	var mediaPaths []string
+	hasAudio := false
 	if mediaData, ok := msg["media"].([]interface{}); ok {
 		mediaPaths = make([]string, 0, len(mediaData))
 		for _, m := range mediaData {
 			if path, ok := m.(string); ok {
 				mediaPaths = append(mediaPaths, path)
+				hasAudio = hasAudio || utils.IsAudioFile(path, "")
 			}
 		}
 	}
 
 	metadata := make(map[string]string)
+	if ptt, _ := msg["ptt"].(bool); ptt || hasAudio {
+		metadata[bus.MetadataVoice] = "true"
+	}
 	if messageID, ok := msg["id"].(string); ok {
 		metadata["message_id"] = messageID
 	}
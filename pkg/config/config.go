@@ -44,16 +44,21 @@ func (f *FlexibleStringSlice) UnmarshalJSON(data []byte) error {
 }
 
 type Config struct {
-	Agents    AgentsConfig    `json:"agents"`
-	Channels  ChannelsConfig  `json:"channels"`
-	Providers ProvidersConfig `json:"providers"`
-	Gateway   GatewayConfig   `json:"gateway"`
-	Tools     ToolsConfig     `json:"tools"`
-	Heartbeat HeartbeatConfig `json:"heartbeat"`
-	Devices   DevicesConfig   `json:"devices"`
-	Sentinel  SentinelConfig  `json:"sentinel"`
-	Council   CouncilConfig   `json:"council"`
-	mu        sync.RWMutex
+	Agents      AgentsConfig      `json:"agents"`
+	Channels    ChannelsConfig    `json:"channels"`
+	Providers   ProvidersConfig   `json:"providers"`
+	Gateway     GatewayConfig     `json:"gateway"`
+	Tools       ToolsConfig       `json:"tools"`
+	Heartbeat   HeartbeatConfig   `json:"heartbeat"`
+	Devices     DevicesConfig     `json:"devices"`
+	Sentinel    SentinelConfig    `json:"sentinel"`
+	Council     CouncilConfig     `json:"council"`
+	Knowledge   KnowledgeConfig   `json:"knowledge"`
+	Experiments ExperimentsConfig `json:"experiments"`
+	Permissions PermissionsConfig `json:"permissions"`
+	RateLimits  RateLimitsConfig  `json:"rate_limits"`
+	TTS         TTSConfig         `json:"tts"`
+	mu          sync.RWMutex
 }
 
 type AgentsConfig struct {
@@ -61,28 +66,95 @@ type AgentsConfig struct {
 }
 
 type AgentDefaults struct {
-	Workspace           string   `json:"workspace" env:"PICOCLAW_AGENTS_DEFAULTS_WORKSPACE"`
-	RestrictToWorkspace bool     `json:"restrict_to_workspace" env:"PICOCLAW_AGENTS_DEFAULTS_RESTRICT_TO_WORKSPACE"`
-	Provider            string   `json:"provider" env:"PICOCLAW_AGENTS_DEFAULTS_PROVIDER"`
-	Model               string   `json:"model" env:"PICOCLAW_AGENTS_DEFAULTS_MODEL"`
-	AvailableModels     []string `json:"available_models,omitempty"`
-	MaxTokens           int      `json:"max_tokens" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS"`
-	Temperature         float64  `json:"temperature" env:"PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
-	MaxToolIterations   int      `json:"max_tool_iterations" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
+	Workspace           string              `json:"workspace" env:"PICOCLAW_AGENTS_DEFAULTS_WORKSPACE"`
+	RestrictToWorkspace bool                `json:"restrict_to_workspace" env:"PICOCLAW_AGENTS_DEFAULTS_RESTRICT_TO_WORKSPACE"`
+	Provider            string              `json:"provider" env:"PICOCLAW_AGENTS_DEFAULTS_PROVIDER"`
+	Model               string              `json:"model" env:"PICOCLAW_AGENTS_DEFAULTS_MODEL"`
+	AvailableModels     []string            `json:"available_models,omitempty"`
+	MaxTokens           int                 `json:"max_tokens" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS"`
+	Temperature         float64             `json:"temperature" env:"PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
+	MaxToolIterations   int                 `json:"max_tool_iterations" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
+	Summarization       SummarizationConfig `json:"summarization"`
+	SessionScope        string              `json:"session_scope" env:"PICOCLAW_AGENTS_DEFAULTS_SESSION_SCOPE"` // "chat" (default) or "user": one session per person across channels in direct chats
+	Coalesce            CoalesceConfig      `json:"coalesce"`
+}
+
+// CoalesceConfig merges bursts of messages from one sender into a single
+// turn. Per-channel entries override the defaults field by field.
+type CoalesceConfig struct {
+	CoalescePolicyConfig
+	Channels map[string]CoalescePolicyConfig `json:"channels,omitempty"` // keyed by channel name
+}
+
+// CoalescePolicyConfig holds one set of coalescing options.
+type CoalescePolicyConfig struct {
+	WindowMS  int   `json:"window_ms,omitempty"`   // quiet time to wait for more messages; 0 inherits, -1 turns waiting off
+	MaxWaitMS int   `json:"max_wait_ms,omitempty"` // longest the first message may wait; 0 is four windows
+	Interrupt *bool `json:"interrupt,omitempty"`   // a new message cancels the sender's turn in progress and joins it
+}
+
+// SummarizationConfig controls when session history is condensed and how
+// much of it is kept verbatim. Zero values fall back to the defaults.
+type SummarizationConfig struct {
+	KeepLast         int `json:"keep_last" env:"PICOCLAW_AGENTS_DEFAULTS_SUMMARIZATION_KEEP_LAST"`                 // messages kept verbatim after summarizing
+	MessageThreshold int `json:"message_threshold" env:"PICOCLAW_AGENTS_DEFAULTS_SUMMARIZATION_MESSAGE_THRESHOLD"` // summarize when history exceeds this many messages
+	TokenPercent     int `json:"token_percent" env:"PICOCLAW_AGENTS_DEFAULTS_SUMMARIZATION_TOKEN_PERCENT"`         // ...or exceeds this % of the context window
+	ChunkSize        int `json:"chunk_size" env:"PICOCLAW_AGENTS_DEFAULTS_SUMMARIZATION_CHUNK_SIZE"`               // messages per chunk summary
+	MaxChunks        int `json:"max_chunks" env:"PICOCLAW_AGENTS_DEFAULTS_SUMMARIZATION_MAX_CHUNKS"`               // chunk summaries kept before rolling into the digest
+	MaxOutcomes      int `json:"max_outcomes" env:"PICOCLAW_AGENTS_DEFAULTS_SUMMARIZATION_MAX_OUTCOMES"`           // key tool outcomes remembered per session
+}
+
+// WithDefaults returns a copy with zero fields replaced by default values.
+func (s SummarizationConfig) WithDefaults() SummarizationConfig {
+	if s.KeepLast <= 0 {
+		s.KeepLast = 4
+	}
+	if s.MessageThreshold <= 0 {
+		s.MessageThreshold = 20
+	}
+	if s.TokenPercent <= 0 || s.TokenPercent > 100 {
+		s.TokenPercent = 75
+	}
+	if s.ChunkSize <= 0 {
+		s.ChunkSize = 10
+	}
+	if s.MaxChunks <= 0 {
+		s.MaxChunks = 4
+	}
+	if s.MaxOutcomes <= 0 {
+		s.MaxOutcomes = 30
+	}
+	return s
 }
 
 type ChannelsConfig struct {
-	WhatsApp WhatsAppConfig `json:"whatsapp"`
-	Telegram TelegramConfig `json:"telegram"`
-	Feishu   FeishuConfig   `json:"feishu"`
-	Discord  DiscordConfig  `json:"discord"`
-	MaixCam  MaixCamConfig  `json:"maixcam"`
-	QQ       QQConfig       `json:"qq"`
-	DingTalk DingTalkConfig `json:"dingtalk"`
-	Slack    SlackConfig    `json:"slack"`
-	LINE     LINEConfig     `json:"line"`
-	OneBot   OneBotConfig   `json:"onebot"`
-	Webhook  WebhookConfig  `json:"webhook"`
+	WhatsApp   WhatsAppConfig   `json:"whatsapp"`
+	Telegram   TelegramConfig   `json:"telegram"`
+	Feishu     FeishuConfig     `json:"feishu"`
+	Discord    DiscordConfig    `json:"discord"`
+	MaixCam    MaixCamConfig    `json:"maixcam"`
+	QQ         QQConfig         `json:"qq"`
+	DingTalk   DingTalkConfig   `json:"dingtalk"`
+	Slack      SlackConfig      `json:"slack"`
+	LINE       LINEConfig       `json:"line"`
+	OneBot     OneBotConfig     `json:"onebot"`
+	Webhook    WebhookConfig    `json:"webhook"`
+	Matrix     MatrixConfig     `json:"matrix"`
+	Email      EmailConfig      `json:"email"`
+	MQTT       MQTTConfig       `json:"mqtt"`
+	IRC        IRCConfig        `json:"irc"`
+	Signal     SignalConfig     `json:"signal"`
+	Mattermost MattermostConfig `json:"mattermost"`
+	RocketChat RocketChatConfig `json:"rocketchat"`
+	Supervisor SupervisorConfig `json:"supervisor"`
+}
+
+// SupervisorConfig controls the channel health checks and automatic restarts.
+type SupervisorConfig struct {
+	Enabled           bool `json:"enabled" env:"PICOCLAW_CHANNELS_SUPERVISOR_ENABLED"`
+	IntervalSeconds   int  `json:"interval_seconds" env:"PICOCLAW_CHANNELS_SUPERVISOR_INTERVAL_SECONDS"`       // between health checks
+	MaxBackoffSeconds int  `json:"max_backoff_seconds" env:"PICOCLAW_CHANNELS_SUPERVISOR_MAX_BACKOFF_SECONDS"` // longest wait between restart attempts
+	AlertAfter        int  `json:"alert_after" env:"PICOCLAW_CHANNELS_SUPERVISOR_ALERT_AFTER"`                 // failed restarts before the owner is told; 0 never alerts
 }
 
 type WhatsAppConfig struct {
@@ -95,6 +167,7 @@ type TelegramConfig struct {
 	Enabled   bool                `json:"enabled" env:"PICOCLAW_CHANNELS_TELEGRAM_ENABLED"`
 	Token     string              `json:"token" env:"PICOCLAW_CHANNELS_TELEGRAM_TOKEN"`
 	Proxy     string              `json:"proxy" env:"PICOCLAW_CHANNELS_TELEGRAM_PROXY"`
+	Groups    GroupsConfig        `json:"groups"`
 	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_TELEGRAM_ALLOW_FROM"`
 }
 
@@ -110,6 +183,7 @@ type FeishuConfig struct {
 type DiscordConfig struct {
 	Enabled   bool                `json:"enabled" env:"PICOCLAW_CHANNELS_DISCORD_ENABLED"`
 	Token     string              `json:"token" env:"PICOCLAW_CHANNELS_DISCORD_TOKEN"`
+	Groups    GroupsConfig        `json:"groups"`
 	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_DISCORD_ALLOW_FROM"`
 }
 
@@ -138,6 +212,7 @@ type SlackConfig struct {
 	Enabled   bool                `json:"enabled" env:"PICOCLAW_CHANNELS_SLACK_ENABLED"`
 	BotToken  string              `json:"bot_token" env:"PICOCLAW_CHANNELS_SLACK_BOT_TOKEN"`
 	AppToken  string              `json:"app_token" env:"PICOCLAW_CHANNELS_SLACK_APP_TOKEN"`
+	Groups    GroupsConfig        `json:"groups"`
 	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_SLACK_ALLOW_FROM"`
 }
 
@@ -148,6 +223,8 @@ type LINEConfig struct {
 	WebhookHost        string              `json:"webhook_host" env:"PICOCLAW_CHANNELS_LINE_WEBHOOK_HOST"`
 	WebhookPort        int                 `json:"webhook_port" env:"PICOCLAW_CHANNELS_LINE_WEBHOOK_PORT"`
 	WebhookPath        string              `json:"webhook_path" env:"PICOCLAW_CHANNELS_LINE_WEBHOOK_PATH"`
+	PublicURL          string              `json:"public_url" env:"PICOCLAW_CHANNELS_LINE_PUBLIC_URL"` // https address of the webhook server; needed for voice replies
+	Groups             GroupsConfig        `json:"groups"`
 	AllowFrom          FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_LINE_ALLOW_FROM"`
 }
 
@@ -157,15 +234,154 @@ type OneBotConfig struct {
 	AccessToken        string              `json:"access_token" env:"PICOCLAW_CHANNELS_ONEBOT_ACCESS_TOKEN"`
 	ReconnectInterval  int                 `json:"reconnect_interval" env:"PICOCLAW_CHANNELS_ONEBOT_RECONNECT_INTERVAL"`
 	GroupTriggerPrefix []string            `json:"group_trigger_prefix" env:"PICOCLAW_CHANNELS_ONEBOT_GROUP_TRIGGER_PREFIX"`
+	Groups             GroupsConfig        `json:"groups"`
 	AllowFrom          FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_ONEBOT_ALLOW_FROM"`
 }
 
+type MatrixConfig struct {
+	Enabled        bool                `json:"enabled" env:"PICOCLAW_CHANNELS_MATRIX_ENABLED"`
+	Homeserver     string              `json:"homeserver" env:"PICOCLAW_CHANNELS_MATRIX_HOMESERVER"` // point at pantalaimon for E2E encrypted rooms
+	UserID         string              `json:"user_id" env:"PICOCLAW_CHANNELS_MATRIX_USER_ID"`
+	AccessToken    string              `json:"access_token" env:"PICOCLAW_CHANNELS_MATRIX_ACCESS_TOKEN"`
+	AutoJoin       bool                `json:"auto_join" env:"PICOCLAW_CHANNELS_MATRIX_AUTO_JOIN"`
+	RequireMention bool                `json:"require_mention" env:"PICOCLAW_CHANNELS_MATRIX_REQUIRE_MENTION"`
+	Groups         GroupsConfig        `json:"groups"`
+	AllowFrom      FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_MATRIX_ALLOW_FROM"`
+}
+
+type EmailConfig struct {
+	Enabled      bool                `json:"enabled" env:"PICOCLAW_CHANNELS_EMAIL_ENABLED"`
+	IMAPHost     string              `json:"imap_host" env:"PICOCLAW_CHANNELS_EMAIL_IMAP_HOST"`
+	IMAPPort     int                 `json:"imap_port" env:"PICOCLAW_CHANNELS_EMAIL_IMAP_PORT"`
+	IMAPTLS      bool                `json:"imap_tls" env:"PICOCLAW_CHANNELS_EMAIL_IMAP_TLS"` // implicit TLS; when false STARTTLS is used if offered
+	Username     string              `json:"username" env:"PICOCLAW_CHANNELS_EMAIL_USERNAME"`
+	Password     string              `json:"password" env:"PICOCLAW_CHANNELS_EMAIL_PASSWORD"`
+	Mailbox      string              `json:"mailbox" env:"PICOCLAW_CHANNELS_EMAIL_MAILBOX"`
+	PollInterval int                 `json:"poll_interval" env:"PICOCLAW_CHANNELS_EMAIL_POLL_INTERVAL"` // seconds, used when the server lacks IDLE
+	SMTPHost     string              `json:"smtp_host" env:"PICOCLAW_CHANNELS_EMAIL_SMTP_HOST"`
+	SMTPPort     int                 `json:"smtp_port" env:"PICOCLAW_CHANNELS_EMAIL_SMTP_PORT"`
+	SMTPUsername string              `json:"smtp_username" env:"PICOCLAW_CHANNELS_EMAIL_SMTP_USERNAME"` // defaults to username
+	SMTPPassword string              `json:"smtp_password" env:"PICOCLAW_CHANNELS_EMAIL_SMTP_PASSWORD"`
+	From         string              `json:"from" env:"PICOCLAW_CHANNELS_EMAIL_FROM"` // defaults to username
+	AllowFrom    FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_EMAIL_ALLOW_FROM"`
+}
+
+type IRCConfig struct {
+	Enabled            bool                `json:"enabled" env:"PICOCLAW_CHANNELS_IRC_ENABLED"`
+	Server             string              `json:"server" env:"PICOCLAW_CHANNELS_IRC_SERVER"` // host:port
+	TLS                bool                `json:"tls" env:"PICOCLAW_CHANNELS_IRC_TLS"`
+	Nick               string              `json:"nick" env:"PICOCLAW_CHANNELS_IRC_NICK"`
+	Username           string              `json:"username" env:"PICOCLAW_CHANNELS_IRC_USERNAME"`
+	RealName           string              `json:"real_name" env:"PICOCLAW_CHANNELS_IRC_REAL_NAME"`
+	Password           string              `json:"password" env:"PICOCLAW_CHANNELS_IRC_PASSWORD"` // server password (PASS)
+	SASLUser           string              `json:"sasl_user" env:"PICOCLAW_CHANNELS_IRC_SASL_USER"`
+	SASLPassword       string              `json:"sasl_password" env:"PICOCLAW_CHANNELS_IRC_SASL_PASSWORD"`
+	Channels           FlexibleStringSlice `json:"channels" env:"PICOCLAW_CHANNELS_IRC_CHANNELS"` // "#chan" or "#chan key"
+	GroupTriggerPrefix []string            `json:"group_trigger_prefix" env:"PICOCLAW_CHANNELS_IRC_GROUP_TRIGGER_PREFIX"`
+	MessageDelay       int                 `json:"message_delay" env:"PICOCLAW_CHANNELS_IRC_MESSAGE_DELAY"` // ms between lines after a short burst
+	ReconnectInterval  int                 `json:"reconnect_interval" env:"PICOCLAW_CHANNELS_IRC_RECONNECT_INTERVAL"`
+	Groups             GroupsConfig        `json:"groups"`
+	AllowFrom          FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_IRC_ALLOW_FROM"` // nicks
+}
+
+type SignalConfig struct {
+	Enabled            bool                `json:"enabled" env:"PICOCLAW_CHANNELS_SIGNAL_ENABLED"`
+	URL                string              `json:"url" env:"PICOCLAW_CHANNELS_SIGNAL_URL"`         // signal-cli daemon --http address
+	Account            string              `json:"account" env:"PICOCLAW_CHANNELS_SIGNAL_ACCOUNT"` // bot's number, e.g. +15551234567
+	RequireMention     bool                `json:"require_mention" env:"PICOCLAW_CHANNELS_SIGNAL_REQUIRE_MENTION"`
+	GroupTriggerPrefix []string            `json:"group_trigger_prefix" env:"PICOCLAW_CHANNELS_SIGNAL_GROUP_TRIGGER_PREFIX"`
+	Groups             GroupsConfig        `json:"groups"`
+	AllowFrom          FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_SIGNAL_ALLOW_FROM"` // numbers or UUIDs
+}
+
+type MattermostConfig struct {
+	Enabled           bool                `json:"enabled" env:"PICOCLAW_CHANNELS_MATTERMOST_ENABLED"`
+	URL               string              `json:"url" env:"PICOCLAW_CHANNELS_MATTERMOST_URL"`
+	Token             string              `json:"token" env:"PICOCLAW_CHANNELS_MATTERMOST_TOKEN"` // bot access token
+	RequireMention    bool                `json:"require_mention" env:"PICOCLAW_CHANNELS_MATTERMOST_REQUIRE_MENTION"`
+	SlashCommandToken string              `json:"slash_command_token" env:"PICOCLAW_CHANNELS_MATTERMOST_SLASH_COMMAND_TOKEN"`
+	WebhookHost       string              `json:"webhook_host" env:"PICOCLAW_CHANNELS_MATTERMOST_WEBHOOK_HOST"`
+	WebhookPort       int                 `json:"webhook_port" env:"PICOCLAW_CHANNELS_MATTERMOST_WEBHOOK_PORT"`
+	WebhookPath       string              `json:"webhook_path" env:"PICOCLAW_CHANNELS_MATTERMOST_WEBHOOK_PATH"`
+	Groups            GroupsConfig        `json:"groups"`
+	AllowFrom         FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_MATTERMOST_ALLOW_FROM"` // user IDs or usernames
+}
+
+type RocketChatConfig struct {
+	Enabled        bool                `json:"enabled" env:"PICOCLAW_CHANNELS_ROCKETCHAT_ENABLED"`
+	URL            string              `json:"url" env:"PICOCLAW_CHANNELS_ROCKETCHAT_URL"`
+	UserID         string              `json:"user_id" env:"PICOCLAW_CHANNELS_ROCKETCHAT_USER_ID"`
+	Token          string              `json:"token" env:"PICOCLAW_CHANNELS_ROCKETCHAT_TOKEN"` // personal access token
+	RequireMention bool                `json:"require_mention" env:"PICOCLAW_CHANNELS_ROCKETCHAT_REQUIRE_MENTION"`
+	Groups         GroupsConfig        `json:"groups"`
+	AllowFrom      FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_ROCKETCHAT_ALLOW_FROM"` // user IDs or usernames
+}
+
+// GroupPolicyConfig decides when a channel answers in group chats. Empty
+// fields keep the channel's default.
+type GroupPolicyConfig struct {
+	Trigger   []string            `json:"trigger,omitempty"`    // any of "mention", "reply", "prefix", "always"
+	Prefixes  []string            `json:"prefixes,omitempty"`   // used by "prefix", e.g. "!bot"
+	AllowFrom FlexibleStringSlice `json:"allow_from,omitempty"` // who may trigger replies; everyone the channel allows when empty
+	Cooldown  int                 `json:"cooldown,omitempty"`   // min seconds between replies in one group
+	Passive   *bool               `json:"passive,omitempty"`    // keep untriggered messages in the session as context
+}
+
+// GroupsConfig is a channel's group policy plus per-group overrides keyed by
+// the group's chat ID (e.g. a Telegram chat ID or Slack channel ID).
+type GroupsConfig struct {
+	GroupPolicyConfig
+	Overrides map[string]GroupPolicyConfig `json:"overrides,omitempty"`
+}
+
+type MQTTConfig struct {
+	Enabled    bool              `json:"enabled" env:"PICOCLAW_CHANNELS_MQTT_ENABLED"`
+	Broker     string            `json:"broker" env:"PICOCLAW_CHANNELS_MQTT_BROKER"` // tcp://host:1883 or mqtts://host:8883
+	ClientID   string            `json:"client_id" env:"PICOCLAW_CHANNELS_MQTT_CLIENT_ID"`
+	Username   string            `json:"username" env:"PICOCLAW_CHANNELS_MQTT_USERNAME"`
+	Password   string            `json:"password" env:"PICOCLAW_CHANNELS_MQTT_PASSWORD"`
+	ReplyTopic string            `json:"reply_topic" env:"PICOCLAW_CHANNELS_MQTT_REPLY_TOPIC"` // agent replies to MQTT events are published here
+	Topics     []MQTTTopicConfig `json:"topics"`
+}
+
+// MQTTTopicConfig selects messages on a topic filter to hand to the agent.
+// Filter, Template and ChatID are Go templates over {topic, payload, raw}.
+type MQTTTopicConfig struct {
+	Topic       string `json:"topic"`        // may use + and # wildcards
+	Filter      string `json:"filter"`       // message dropped unless it renders non-empty and not "false"
+	Template    string `json:"template"`     // message content; "topic: payload" when empty
+	Debounce    int    `json:"debounce"`     // seconds of quiet before the latest message is delivered
+	MinInterval int    `json:"min_interval"` // seconds; at most one message per topic in this window
+	Channel     string `json:"channel"`      // deliver the reply to this channel, e.g. "telegram"
+	ChatID      string `json:"chat_id"`      // chat on Channel
+}
+
 type WebhookConfig struct {
-	Enabled bool   `json:"enabled" env:"PICOCLAW_CHANNELS_WEBHOOK_ENABLED"`
-	Host    string `json:"host" env:"PICOCLAW_CHANNELS_WEBHOOK_HOST"`
-	Port    int    `json:"port" env:"PICOCLAW_CHANNELS_WEBHOOK_PORT"`
-	Path    string `json:"path" env:"PICOCLAW_CHANNELS_WEBHOOK_PATH"`
-	Secret  string `json:"secret" env:"PICOCLAW_CHANNELS_WEBHOOK_SECRET"`
+	Enabled         bool   `json:"enabled" env:"PICOCLAW_CHANNELS_WEBHOOK_ENABLED"`
+	Host            string `json:"host" env:"PICOCLAW_CHANNELS_WEBHOOK_HOST"`
+	Port            int    `json:"port" env:"PICOCLAW_CHANNELS_WEBHOOK_PORT"`
+	Path            string `json:"path" env:"PICOCLAW_CHANNELS_WEBHOOK_PATH"`
+	Secret          string `json:"secret" env:"PICOCLAW_CHANNELS_WEBHOOK_SECRET"`
+	HMACSecret      string `json:"hmac_secret" env:"PICOCLAW_CHANNELS_WEBHOOK_HMAC_SECRET"`
+	SignatureHeader string `json:"signature_header" env:"PICOCLAW_CHANNELS_WEBHOOK_SIGNATURE_HEADER"`
+	ResponseTimeout int    `json:"response_timeout" env:"PICOCLAW_CHANNELS_WEBHOOK_RESPONSE_TIMEOUT"` // seconds
+
+	Routes []WebhookRouteConfig `json:"routes"`
+}
+
+// WebhookRouteConfig maps arbitrary JSON posted to Path onto an agent message.
+// Filter, Template, Session and ChatID are Go templates over the decoded body.
+type WebhookRouteConfig struct {
+	Name            string `json:"name"`
+	Path            string `json:"path"`
+	Secret          string `json:"secret"`           // falls back to the channel's secret
+	HMACSecret      string `json:"hmac_secret"`      // falls back to the channel's hmac_secret
+	SignatureHeader string `json:"signature_header"` // default X-Hub-Signature-256
+	Filter          string `json:"filter"`           // event dropped unless it renders non-empty and not "false"
+	Template        string `json:"template"`         // message content; raw JSON when empty
+	Session         string `json:"session"`          // optional session name
+	Channel         string `json:"channel"`          // deliver the reply to this channel, e.g. "telegram"
+	ChatID          string `json:"chat_id"`          // chat on Channel
 }
 
 type HeartbeatConfig struct {
@@ -183,6 +399,85 @@ type SentinelConfig struct {
 	IntervalSeconds int  `json:"interval_seconds" env:"PICOCLAW_SENTINEL_INTERVAL_SECONDS"`
 }
 
+// KnowledgeConfig controls ingestion of files, URLs and feeds into knowledge topics.
+type KnowledgeConfig struct {
+	IngestIntervalMinutes int `json:"ingest_interval_minutes" env:"PICOCLAW_KNOWLEDGE_INGEST_INTERVAL_MINUTES"` // inbox scan / refresh check interval
+	RefreshHours          int `json:"refresh_hours" env:"PICOCLAW_KNOWLEDGE_REFRESH_HOURS"`                     // default refresh interval for new sources
+	TopicTTLHours         int `json:"topic_ttl_hours" env:"PICOCLAW_KNOWLEDGE_TOPIC_TTL_HOURS"`                 // default TTL for researched topics (0 = never stale)
+}
+
+// ExperimentsConfig controls automatic evaluation of behavioral hypotheses.
+type ExperimentsConfig struct {
+	Enabled                 bool    `json:"enabled" env:"PICOCLAW_EXPERIMENTS_ENABLED"`
+	EvaluationIntervalHours int     `json:"evaluation_interval_hours" env:"PICOCLAW_EXPERIMENTS_EVALUATION_INTERVAL_HOURS"`
+	BaselineDays            int     `json:"baseline_days" env:"PICOCLAW_EXPERIMENTS_BASELINE_DAYS"` // days before a hypothesis starts used as its baseline
+	MinTurns                int     `json:"min_turns" env:"PICOCLAW_EXPERIMENTS_MIN_TURNS"`         // turns needed in each window for a conclusive score
+	Threshold               float64 `json:"threshold" env:"PICOCLAW_EXPERIMENTS_THRESHOLD"`         // relative change needed to accept or reject
+	MinCycles               int     `json:"min_cycles" env:"PICOCLAW_EXPERIMENTS_MIN_CYCLES"`       // evaluations before a hypothesis can be accepted
+	MinFeedback             int     `json:"min_feedback" env:"PICOCLAW_EXPERIMENTS_MIN_FEEDBACK"`   // reactions needed in each window to score feedback
+}
+
+// PermissionsConfig assigns roles to people across all channels. Without
+// any users or roles configured everyone keeps full access.
+type PermissionsConfig struct {
+	DefaultRole string                `json:"default_role,omitempty"` // role of senders without an assignment; "member" when empty
+	Users       map[string]string     `json:"users,omitempty"`        // "channel:senderID" or user ID (see /link) -> role
+	Roles       map[string]RoleConfig `json:"roles,omitempty"`        // replace the built-in owner/admin/member/guest roles or add new ones
+}
+
+// RoleConfig lists what a role may use. "*" in a list allows everything.
+type RoleConfig struct {
+	Tools       []string `json:"tools,omitempty"`
+	DenyTools   []string `json:"deny_tools,omitempty"`
+	Commands    []string `json:"commands,omitempty"`     // slash commands such as "/model"
+	Agents      []string `json:"agents,omitempty"`       // "main", "subagent", "council"
+	DailyTokens int      `json:"daily_tokens,omitempty"` // LLM tokens per person per day; 0 is unlimited
+}
+
+// RateLimitsConfig throttles inbound messages before they reach the agent.
+// The top-level limits apply everywhere; per-channel and then per-role
+// entries override them field by field.
+type RateLimitsConfig struct {
+	RateLimitConfig
+	Channels map[string]RateLimitConfig `json:"channels,omitempty"` // keyed by channel name
+	Roles    map[string]RateLimitConfig `json:"roles,omitempty"`    // keyed by role, see PermissionsConfig
+}
+
+// RateLimitConfig holds one set of limits. Zero means unlimited, or
+// inherited in an override; -1 lifts an inherited limit.
+type RateLimitConfig struct {
+	SenderPerMinute    int    `json:"sender_per_minute,omitempty"`
+	ChatPerMinute      int    `json:"chat_per_minute,omitempty"`
+	SenderTokensPerDay int    `json:"sender_tokens_per_day,omitempty"`
+	ChatTokensPerDay   int    `json:"chat_tokens_per_day,omitempty"`
+	MaxQueued          int    `json:"max_queued,omitempty"` // messages per chat waiting for the agent
+	Reply              string `json:"reply,omitempty"`      // sent once per minute to a throttled sender
+}
+
+// TTSConfig picks the engine that speaks replies as voice notes, which
+// happens when the user sent one or asked for audio.
+type TTSConfig struct {
+	Engine   string          `json:"engine" env:"PICOCLAW_TTS_ENGINE"`       // "edge-tts", "piper" or "openai"; empty turns voice replies off
+	Voice    string          `json:"voice" env:"PICOCLAW_TTS_VOICE"`         // default voice; each engine has its own when empty
+	Language string          `json:"language" env:"PICOCLAW_TTS_LANGUAGE"`   // picks a voice for this language when voice is empty, e.g. "en-US"
+	MaxChars int             `json:"max_chars" env:"PICOCLAW_TTS_MAX_CHARS"` // longer replies stay text; 0 is unlimited
+	Piper    PiperTTSConfig  `json:"piper"`
+	OpenAI   OpenAITTSConfig `json:"openai"`
+}
+
+// PiperTTSConfig runs Piper locally, for speech without any network access.
+type PiperTTSConfig struct {
+	Binary string `json:"binary" env:"PICOCLAW_TTS_PIPER_BINARY"` // "piper" on PATH when empty
+	Model  string `json:"model" env:"PICOCLAW_TTS_PIPER_MODEL"`   // .onnx voice, or a directory of them named after their voices
+}
+
+// OpenAITTSConfig calls an OpenAI-compatible /audio/speech endpoint.
+type OpenAITTSConfig struct {
+	APIKey  string `json:"api_key" env:"PICOCLAW_TTS_OPENAI_API_KEY"`
+	APIBase string `json:"api_base" env:"PICOCLAW_TTS_OPENAI_API_BASE"` // https://api.openai.com/v1 when empty
+	Model   string `json:"model" env:"PICOCLAW_TTS_OPENAI_MODEL"`
+}
+
 type CouncilMemberConfig struct {
 	Name        string `json:"name"`
 	Token       string `json:"token"`
@@ -237,8 +532,23 @@ type ProviderConfig struct {
 }
 
 type GatewayConfig struct {
-	Host string `json:"host" env:"PICOCLAW_GATEWAY_HOST"`
-	Port int    `json:"port" env:"PICOCLAW_GATEWAY_PORT"`
+	Host  string             `json:"host" env:"PICOCLAW_GATEWAY_HOST"`
+	Port  int                `json:"port" env:"PICOCLAW_GATEWAY_PORT"`
+	API   GatewayAPIConfig   `json:"api"`
+	WebUI GatewayWebUIConfig `json:"web_ui"`
+}
+
+// GatewayAPIConfig configures the OpenAI-compatible /v1 endpoints.
+type GatewayAPIConfig struct {
+	Enabled   bool              `json:"enabled" env:"PICOCLAW_GATEWAY_API_ENABLED"`
+	APIKeys   map[string]string `json:"api_keys" env:"PICOCLAW_GATEWAY_API_KEYS"` // key name -> bearer token; each name gets its own session
+	ModelName string            `json:"model_name" env:"PICOCLAW_GATEWAY_API_MODEL_NAME"`
+}
+
+// GatewayWebUIConfig configures the built-in web chat and admin dashboard.
+type GatewayWebUIConfig struct {
+	Enabled bool   `json:"enabled" env:"PICOCLAW_GATEWAY_WEB_UI_ENABLED"`
+	Token   string `json:"token" env:"PICOCLAW_GATEWAY_WEB_UI_TOKEN"` // login token; the UI stays disabled without one
 }
 
 type BraveConfig struct {
@@ -269,9 +579,17 @@ type GoogleConfig struct {
 	ImpersonateEmail   string `json:"impersonate_email"`
 }
 
+// MQTTToolConfig enables the mqtt tool, which uses the broker settings of
+// channels.mqtt.
+type MQTTToolConfig struct {
+	Enabled       bool                `json:"enabled" env:"PICOCLAW_TOOLS_MQTT_ENABLED"`
+	PublishTopics FlexibleStringSlice `json:"publish_topics" env:"PICOCLAW_TOOLS_MQTT_PUBLISH_TOPICS"` // topic filters the agent may publish to; empty allows all
+}
+
 type ToolsConfig struct {
 	Web    WebToolsConfig `json:"web"`
 	Google GoogleConfig   `json:"google"`
+	MQTT   MQTTToolConfig `json:"mqtt"`
 }
 
 func DefaultConfig() *Config {
@@ -285,6 +603,14 @@ func DefaultConfig() *Config {
 				MaxTokens:           8192,
 				Temperature:         0.7,
 				MaxToolIterations:   20,
+				Summarization: SummarizationConfig{
+					KeepLast:         4,
+					MessageThreshold: 20,
+					TokenPercent:     75,
+					ChunkSize:        10,
+					MaxChunks:        4,
+					MaxOutcomes:      30,
+				},
 			},
 		},
 		Channels: ChannelsConfig{
@@ -353,11 +679,79 @@ func DefaultConfig() *Config {
 				AllowFrom:          FlexibleStringSlice{},
 			},
 			Webhook: WebhookConfig{
-				Enabled: false,
-				Host:    "0.0.0.0",
-				Port:    18792,
-				Path:    "/webhook/inbound",
-				Secret:  "",
+				Enabled:         false,
+				Host:            "0.0.0.0",
+				Port:            18792,
+				Path:            "/webhook/inbound",
+				Secret:          "",
+				HMACSecret:      "",
+				SignatureHeader: "X-Hub-Signature-256",
+				ResponseTimeout: 120,
+				Routes:          []WebhookRouteConfig{},
+			},
+			Matrix: MatrixConfig{
+				Enabled:        false,
+				Homeserver:     "",
+				UserID:         "",
+				AccessToken:    "",
+				AutoJoin:       true,
+				RequireMention: true,
+				AllowFrom:      FlexibleStringSlice{},
+			},
+			Email: EmailConfig{
+				Enabled:      false,
+				IMAPHost:     "",
+				IMAPPort:     993,
+				IMAPTLS:      true,
+				Mailbox:      "INBOX",
+				PollInterval: 60,
+				SMTPHost:     "",
+				SMTPPort:     587,
+				AllowFrom:    FlexibleStringSlice{},
+			},
+			MQTT: MQTTConfig{
+				Enabled:    false,
+				Broker:     "",
+				ClientID:   "picoclaw",
+				ReplyTopic: "",
+				Topics:     []MQTTTopicConfig{},
+			},
+			IRC: IRCConfig{
+				Enabled:            false,
+				Server:             "irc.libera.chat:6697",
+				TLS:                true,
+				Nick:               "picoclaw",
+				Channels:           FlexibleStringSlice{},
+				GroupTriggerPrefix: []string{},
+				MessageDelay:       1000,
+				ReconnectInterval:  10,
+				AllowFrom:          FlexibleStringSlice{},
+			},
+			Signal: SignalConfig{
+				Enabled:            false,
+				URL:                "http://127.0.0.1:8080",
+				RequireMention:     true,
+				GroupTriggerPrefix: []string{},
+				AllowFrom:          FlexibleStringSlice{},
+			},
+			Mattermost: MattermostConfig{
+				Enabled:        false,
+				RequireMention: true,
+				WebhookHost:    "0.0.0.0",
+				WebhookPort:    18793,
+				WebhookPath:    "/webhook/mattermost",
+				AllowFrom:      FlexibleStringSlice{},
+			},
+			RocketChat: RocketChatConfig{
+				Enabled:        false,
+				RequireMention: true,
+				AllowFrom:      FlexibleStringSlice{},
+			},
+			Supervisor: SupervisorConfig{
+				Enabled:           true,
+				IntervalSeconds:   60,
+				MaxBackoffSeconds: 600,
+				AlertAfter:        3,
 			},
 		},
 		Providers: ProvidersConfig{
@@ -375,6 +769,15 @@ func DefaultConfig() *Config {
 		Gateway: GatewayConfig{
 			Host: "0.0.0.0",
 			Port: 18790,
+			API: GatewayAPIConfig{
+				Enabled:   false,
+				APIKeys:   map[string]string{},
+				ModelName: "picoclaw",
+			},
+			WebUI: GatewayWebUIConfig{
+				Enabled: false,
+				Token:   "",
+			},
 		},
 		Tools: ToolsConfig{
 			Web: WebToolsConfig{
@@ -393,6 +796,10 @@ func DefaultConfig() *Config {
 					MaxResults: 5,
 				},
 			},
+			MQTT: MQTTToolConfig{
+				Enabled:       false,
+				PublishTopics: FlexibleStringSlice{},
+			},
 		},
 		Heartbeat: HeartbeatConfig{
 			Enabled:  true,
@@ -409,6 +816,27 @@ func DefaultConfig() *Config {
 		Council: CouncilConfig{
 			Enabled: false,
 		},
+		Knowledge: KnowledgeConfig{
+			IngestIntervalMinutes: 10,
+			RefreshHours:          24,
+			TopicTTLHours:         720,
+		},
+		Experiments: ExperimentsConfig{
+			Enabled:                 true,
+			EvaluationIntervalHours: 168,
+			BaselineDays:            7,
+			MinTurns:                20,
+			Threshold:               0.1,
+			MinCycles:               2,
+			MinFeedback:             3,
+		},
+		TTS: TTSConfig{
+			Engine:   "edge-tts",
+			MaxChars: 300,
+			OpenAI: OpenAITTSConfig{
+				Model: "tts-1",
+			},
+		},
 	}
 }
 
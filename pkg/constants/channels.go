@@ -7,6 +7,8 @@ var InternalChannels = map[string]bool{
 	"cli":      true,
 	"system":   true,
 	"subagent": true,
+	"api":      true,
+	"web":      true,
 }
 
 // IsInternalChannel returns true if the channel is an internal channel.
@@ -0,0 +1,288 @@
+package experiments
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Metric names a hypothesis can be scored on.
+const (
+	MetricResponseLength = "response_length"
+	MetricCorrections    = "corrections"
+	MetricToolUsage      = "tool_usage"
+	MetricFeedback       = "feedback"
+)
+
+// Evaluation verdicts.
+const (
+	VerdictAccept       = "accept"
+	VerdictReject       = "reject"
+	VerdictContinue     = "continue"
+	VerdictInconclusive = "inconclusive"
+)
+
+// Evaluation is the result of scoring one hypothesis for one cycle.
+type Evaluation struct {
+	At          string  `json:"at"`
+	Metric      string  `json:"metric"`
+	Baseline    float64 `json:"baseline"`
+	Trial       float64 `json:"trial"`
+	Improvement float64 `json:"improvement"` // relative change toward the goal (0.1 = 10% better)
+	Turns       int     `json:"turns"`       // trial-window turns the score is based on
+	Verdict     string  `json:"verdict"`
+	Reason      string  `json:"reason"`
+}
+
+// EvalConfig tunes the evaluator.
+type EvalConfig struct {
+	BaselineDays int     // days before a hypothesis started used as its baseline
+	MinTurns     int     // minimum turns in each window for a conclusive score
+	MinFeedback  int     // minimum reactions in each window for the feedback metric
+	Threshold    float64 // relative improvement (or regression) needed to accept (or reject)
+	MinCycles    int     // evaluations required before a hypothesis can be accepted
+}
+
+func (c EvalConfig) withDefaults() EvalConfig {
+	if c.BaselineDays <= 0 {
+		c.BaselineDays = 7
+	}
+	if c.MinTurns <= 0 {
+		c.MinTurns = 20
+	}
+	if c.MinFeedback <= 0 {
+		c.MinFeedback = 3
+	}
+	if c.Threshold <= 0 {
+		c.Threshold = 0.1
+	}
+	if c.MinCycles <= 0 {
+		c.MinCycles = 2
+	}
+	return c
+}
+
+// categoryMetrics picks the metric for hypotheses that don't name one.
+var categoryMetrics = map[string]string{
+	"tone":        MetricFeedback,
+	"memory":      MetricCorrections,
+	"tool_usage":  MetricToolUsage,
+	"proactivity": MetricFeedback,
+}
+
+// metricGoals is the default direction of improvement for each metric.
+var metricGoals = map[string]string{
+	MetricResponseLength: "decrease",
+	MetricCorrections:    "decrease",
+	MetricToolUsage:      "increase",
+	MetricFeedback:       "increase",
+}
+
+// metricFloors keep relative changes meaningful when the baseline is near zero.
+var metricFloors = map[string]float64{
+	MetricResponseLength: 50,
+	MetricCorrections:    0.05,
+	MetricToolUsage:      0.1,
+	MetricFeedback:       0.2,
+}
+
+// Evaluator periodically scores active hypotheses against a baseline window
+// and accepts or rejects them.
+type Evaluator struct {
+	store   *Store
+	metrics *Metrics
+	cfg     EvalConfig
+	report  func(report string)
+}
+
+// NewEvaluator creates an Evaluator over the given store and metrics.
+func NewEvaluator(store *Store, metrics *Metrics, cfg EvalConfig) *Evaluator {
+	return &Evaluator{
+		store:   store,
+		metrics: metrics,
+		cfg:     cfg.withDefaults(),
+	}
+}
+
+// SetReportCallback sets the function that delivers evaluation reports to the owner.
+func (e *Evaluator) SetReportCallback(fn func(report string)) {
+	e.report = fn
+}
+
+// Start runs Evaluate every interval until ctx is done.
+func (e *Evaluator) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 7 * 24 * time.Hour
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				e.Evaluate(time.Now())
+			}
+		}
+	}()
+}
+
+// Evaluate scores every active hypothesis, records the results, expires
+// hypotheses that ran out of cycles and sends a report if anything was evaluated.
+func (e *Evaluator) Evaluate(now time.Time) []Evaluation {
+	active := e.store.GetActive()
+	if len(active) == 0 {
+		return nil
+	}
+	e.metrics.Flush()
+
+	var results []Evaluation
+	var lines []string
+	for _, h := range active {
+		ev := e.evaluate(h, now)
+		if err := e.store.RecordEvaluation(h.ID, ev); err != nil {
+			logger.WarnCF("experiments", "Failed to record evaluation",
+				map[string]interface{}{"id": h.ID, "error": err.Error()})
+			continue
+		}
+		logger.InfoCF("experiments", "Hypothesis evaluated",
+			map[string]interface{}{
+				"id":          h.ID,
+				"metric":      ev.Metric,
+				"improvement": ev.Improvement,
+				"verdict":     ev.Verdict,
+			})
+		results = append(results, ev)
+		lines = append(lines, formatEvaluation(h, ev))
+	}
+
+	if expired := e.store.ExpireOld(); expired > 0 {
+		lines = append(lines, fmt.Sprintf("⌛ %d hypothesis(es) expired without a conclusive result.", expired))
+	}
+
+	if len(lines) > 0 && e.report != nil {
+		e.report("🧪 Experiment evaluation\n\n" + strings.Join(lines, "\n\n"))
+	}
+	return results
+}
+
+// evaluate compares the hypothesis' trial window (since it was created)
+// against the BaselineDays before it.
+func (e *Evaluator) evaluate(h Hypothesis, now time.Time) Evaluation {
+	metric, goal := metricFor(h)
+	ev := Evaluation{
+		At:     now.Format(time.RFC3339),
+		Metric: metric,
+	}
+
+	created, err := time.Parse(time.RFC3339, h.CreatedAt)
+	if err != nil {
+		ev.Verdict = VerdictInconclusive
+		ev.Reason = "invalid created_at"
+		return ev
+	}
+
+	baseline := e.metrics.Window(created.AddDate(0, 0, -e.cfg.BaselineDays), created)
+	trial := e.metrics.Window(created, now.AddDate(0, 0, 1))
+	ev.Baseline = metricValue(baseline, metric)
+	ev.Trial = metricValue(trial, metric)
+	ev.Turns = trial.Turns
+
+	if baseline.Turns < e.cfg.MinTurns || trial.Turns < e.cfg.MinTurns {
+		ev.Verdict = VerdictInconclusive
+		ev.Reason = fmt.Sprintf("not enough data (baseline %d turns, trial %d turns, need %d)",
+			baseline.Turns, trial.Turns, e.cfg.MinTurns)
+		return ev
+	}
+	if metric == MetricFeedback && (baseline.FeedbackCount < e.cfg.MinFeedback || trial.FeedbackCount < e.cfg.MinFeedback) {
+		ev.Verdict = VerdictInconclusive
+		ev.Reason = fmt.Sprintf("not enough reactions (baseline %d, trial %d, need %d)",
+			baseline.FeedbackCount, trial.FeedbackCount, e.cfg.MinFeedback)
+		return ev
+	}
+
+	ev.Improvement = improvement(ev.Baseline, ev.Trial, metricFloors[metric], goal)
+
+	// Guardrail: whatever the target metric, a clear rise in corrections
+	// means the adjustment is hurting.
+	if metric != MetricCorrections {
+		if regress := improvement(baseline.CorrectionRate, trial.CorrectionRate, metricFloors[MetricCorrections], "decrease"); regress <= -2*e.cfg.Threshold {
+			ev.Verdict = VerdictReject
+			ev.Reason = fmt.Sprintf("user corrections rose from %.2f to %.2f per turn", baseline.CorrectionRate, trial.CorrectionRate)
+			return ev
+		}
+	}
+
+	switch {
+	case ev.Improvement <= -e.cfg.Threshold:
+		ev.Verdict = VerdictReject
+		ev.Reason = fmt.Sprintf("%s got %.0f%% worse", metric, -ev.Improvement*100)
+	case ev.Improvement >= e.cfg.Threshold && h.CycleCount+1 >= e.cfg.MinCycles:
+		ev.Verdict = VerdictAccept
+		ev.Reason = fmt.Sprintf("%s improved %.0f%%", metric, ev.Improvement*100)
+	case ev.Improvement >= e.cfg.Threshold:
+		ev.Verdict = VerdictContinue
+		ev.Reason = fmt.Sprintf("%s improved %.0f%%, confirming over another cycle", metric, ev.Improvement*100)
+	default:
+		ev.Verdict = VerdictContinue
+		ev.Reason = fmt.Sprintf("%s changed %+.0f%%, below the %.0f%% threshold", metric, ev.Improvement*100, e.cfg.Threshold*100)
+	}
+	return ev
+}
+
+// metricFor resolves the metric and goal for a hypothesis, falling back to
+// category and metric defaults.
+func metricFor(h Hypothesis) (string, string) {
+	metric := h.Metric
+	if _, ok := metricGoals[metric]; !ok {
+		metric = categoryMetrics[h.Category]
+		if metric == "" {
+			metric = MetricFeedback
+		}
+	}
+	goal := h.Goal
+	if goal != "increase" && goal != "decrease" {
+		goal = metricGoals[metric]
+	}
+	return metric, goal
+}
+
+func metricValue(s Summary, metric string) float64 {
+	switch metric {
+	case MetricResponseLength:
+		return s.AvgResponseChars
+	case MetricCorrections:
+		return s.CorrectionRate
+	case MetricToolUsage:
+		return s.ToolCallsPerTurn
+	default:
+		return s.FeedbackScore
+	}
+}
+
+// improvement returns the relative change from baseline to trial, signed so
+// that positive means progress toward goal.
+func improvement(baseline, trial, floor float64, goal string) float64 {
+	change := (trial - baseline) / math.Max(math.Abs(baseline), floor)
+	if goal == "decrease" {
+		change = -change
+	}
+	return change
+}
+
+func formatEvaluation(h Hypothesis, ev Evaluation) string {
+	icon := map[string]string{
+		VerdictAccept:       "✅",
+		VerdictReject:       "❌",
+		VerdictContinue:     "🔁",
+		VerdictInconclusive: "❔",
+	}[ev.Verdict]
+	return fmt.Sprintf("%s %s [%s]\n%s: %.2f → %.2f (%+.0f%%) — %s (cycle %d/%d)",
+		icon, h.Title, ev.Verdict, ev.Metric, ev.Baseline, ev.Trial, ev.Improvement*100,
+		ev.Reason, h.CycleCount+1, h.MaxCycles)
+}
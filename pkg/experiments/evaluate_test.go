@@ -0,0 +1,116 @@
+package experiments
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// seedDays writes the same DayMetrics for each day in [from, to).
+func seedDays(m *Metrics, from, to time.Time, day DayMetrics) {
+	for d := from; d.Before(to); d = d.AddDate(0, 0, 1) {
+		dm := day
+		dm.Date = d.Format("2006-01-02")
+		m.data.Days = append(m.data.Days, &dm)
+	}
+}
+
+func setupEvaluation(t *testing.T, h Hypothesis, baseline, trial DayMetrics) (*Store, *Evaluator, time.Time) {
+	t.Helper()
+	dir := t.TempDir()
+	store := NewStore(dir)
+	metrics := NewMetrics(dir)
+
+	now := time.Now()
+	created := now.AddDate(0, 0, -7)
+	h.CreatedAt = created.Format(time.RFC3339)
+	if err := store.Add(h); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	seedDays(metrics, created.AddDate(0, 0, -7), created, baseline)
+	seedDays(metrics, created, now.AddDate(0, 0, 1), trial)
+
+	return store, NewEvaluator(store, metrics, EvalConfig{MinCycles: 1}), now
+}
+
+func TestEvaluateAccept(t *testing.T) {
+	store, eval, now := setupEvaluation(t,
+		Hypothesis{ID: "concise", Title: "Be concise", Category: "tone", Metric: MetricResponseLength},
+		DayMetrics{Turns: 10, ResponseChars: 10 * 800},
+		DayMetrics{Turns: 10, ResponseChars: 10 * 400},
+	)
+
+	var report string
+	eval.SetReportCallback(func(r string) { report = r })
+
+	results := eval.Evaluate(now)
+	if len(results) != 1 || results[0].Verdict != VerdictAccept {
+		t.Fatalf("expected accept, got %+v", results)
+	}
+	if results[0].Improvement < 0.45 {
+		t.Errorf("expected ~50%% improvement, got %.2f", results[0].Improvement)
+	}
+
+	h := store.GetAll()[0]
+	if h.Status != "accepted" || h.CycleCount != 1 || len(h.Evaluations) != 1 {
+		t.Errorf("unexpected hypothesis state: status=%s cycles=%d evals=%d", h.Status, h.CycleCount, len(h.Evaluations))
+	}
+	if !strings.Contains(report, "Be concise") {
+		t.Errorf("report should mention the hypothesis, got %q", report)
+	}
+}
+
+func TestEvaluateRejectOnCorrections(t *testing.T) {
+	store, eval, now := setupEvaluation(t,
+		Hypothesis{ID: "tools", Title: "Use more tools", Category: "tool_usage"},
+		DayMetrics{Turns: 10, ToolCalls: 5, Corrections: 0},
+		DayMetrics{Turns: 10, ToolCalls: 20, Corrections: 4},
+	)
+
+	results := eval.Evaluate(now)
+	if len(results) != 1 || results[0].Verdict != VerdictReject {
+		t.Fatalf("expected reject from the corrections guardrail, got %+v", results)
+	}
+	if store.GetAll()[0].Status != "rejected" {
+		t.Errorf("expected rejected status, got %s", store.GetAll()[0].Status)
+	}
+}
+
+func TestEvaluateInconclusive(t *testing.T) {
+	store, eval, now := setupEvaluation(t,
+		Hypothesis{ID: "fb", Title: "Ask follow-ups", Category: "proactivity"},
+		DayMetrics{Turns: 10},
+		DayMetrics{Turns: 10, PositiveFeedback: 1},
+	)
+
+	results := eval.Evaluate(now)
+	if len(results) != 1 || results[0].Verdict != VerdictInconclusive {
+		t.Fatalf("expected inconclusive without reactions, got %+v", results)
+	}
+	h := store.GetAll()[0]
+	if h.Status != "active" || h.CycleCount != 1 {
+		t.Errorf("inconclusive evaluation should keep the hypothesis active and count the cycle: %+v", h)
+	}
+}
+
+func TestMetricsRecordAndWindow(t *testing.T) {
+	m := NewMetrics(t.TempDir())
+	m.RecordTurn("Hola, ¿cómo estás?", 100, 0)
+	m.RecordTurn("No, eso no es lo que pedí", 300, 2)
+	m.RecordFeedback(true)
+	m.RecordFeedback(false)
+	m.RecordFeedback(true)
+
+	now := time.Now()
+	s := m.Window(now.AddDate(0, 0, -1), now.AddDate(0, 0, 1))
+	if s.Turns != 2 || s.AvgResponseChars != 200 || s.ToolCallsPerTurn != 1 {
+		t.Errorf("unexpected summary: %+v", s)
+	}
+	if s.CorrectionRate != 0.5 {
+		t.Errorf("expected correction rate 0.5, got %.2f", s.CorrectionRate)
+	}
+	if s.FeedbackCount != 3 || s.FeedbackScore < 0.33 || s.FeedbackScore > 0.34 {
+		t.Errorf("unexpected feedback: count=%d score=%.2f", s.FeedbackCount, s.FeedbackScore)
+	}
+}
@@ -0,0 +1,241 @@
+package experiments
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// DayMetrics aggregates the interaction signals observed on a single day.
+type DayMetrics struct {
+	Date             string `json:"date"` // "2006-01-02"
+	Turns            int    `json:"turns"`
+	ResponseChars    int64  `json:"response_chars"`
+	Corrections      int    `json:"corrections"`
+	ToolCalls        int    `json:"tool_calls"`
+	PositiveFeedback int    `json:"positive_feedback"`
+	NegativeFeedback int    `json:"negative_feedback"`
+}
+
+// Summary condenses a window of DayMetrics into comparable rates.
+type Summary struct {
+	Days             int
+	Turns            int
+	AvgResponseChars float64
+	CorrectionRate   float64 // corrections per turn
+	ToolCallsPerTurn float64
+	FeedbackCount    int
+	FeedbackScore    float64 // (positive - negative) / feedback count, in [-1, 1]
+}
+
+// metricsData is the on-disk format.
+type metricsData struct {
+	Days []*DayMetrics `json:"days"`
+}
+
+// Metrics records per-day interaction signals used to evaluate hypotheses.
+// It follows the telemetry tracker's model: mutex-only hot path, periodic flush.
+type Metrics struct {
+	mu       sync.Mutex
+	data     *metricsData
+	filePath string
+	dirty    bool
+}
+
+// metricsRetentionDays bounds how far back baselines can look.
+const metricsRetentionDays = 120
+
+// NewMetrics creates a recorder that persists to workspace/state/experiment_metrics.json.
+func NewMetrics(workspace string) *Metrics {
+	m := &Metrics{
+		filePath: filepath.Join(workspace, "state", "experiment_metrics.json"),
+		data:     &metricsData{},
+	}
+	m.load()
+	return m
+}
+
+// Start begins periodic flushing every 60 seconds.
+func (m *Metrics) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(60 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.Flush()
+			}
+		}
+	}()
+}
+
+// Stop performs a final flush.
+func (m *Metrics) Stop() {
+	m.Flush()
+}
+
+// RecordTurn records one answered user message. userMessage is checked for
+// signs that the user is correcting the previous answer.
+func (m *Metrics) RecordTurn(userMessage string, responseChars, toolCalls int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	day := m.getOrCreateDay(time.Now().Format("2006-01-02"))
+	day.Turns++
+	day.ResponseChars += int64(responseChars)
+	day.ToolCalls += toolCalls
+	if IsCorrection(userMessage) {
+		day.Corrections++
+	}
+	m.dirty = true
+}
+
+// RecordFeedback records an explicit positive or negative reaction.
+func (m *Metrics) RecordFeedback(positive bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	day := m.getOrCreateDay(time.Now().Format("2006-01-02"))
+	if positive {
+		day.PositiveFeedback++
+	} else {
+		day.NegativeFeedback++
+	}
+	m.dirty = true
+}
+
+// Window summarizes the days in [from, to).
+func (m *Metrics) Window(from, to time.Time) Summary {
+	fromDate := from.Format("2006-01-02")
+	toDate := to.Format("2006-01-02")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var total DayMetrics
+	var s Summary
+	for _, d := range m.data.Days {
+		if d.Date < fromDate || d.Date >= toDate {
+			continue
+		}
+		s.Days++
+		total.Turns += d.Turns
+		total.ResponseChars += d.ResponseChars
+		total.Corrections += d.Corrections
+		total.ToolCalls += d.ToolCalls
+		total.PositiveFeedback += d.PositiveFeedback
+		total.NegativeFeedback += d.NegativeFeedback
+	}
+	return summarize(s, total)
+}
+
+func summarize(s Summary, total DayMetrics) Summary {
+	s.Turns = total.Turns
+	if total.Turns > 0 {
+		s.AvgResponseChars = float64(total.ResponseChars) / float64(total.Turns)
+		s.CorrectionRate = float64(total.Corrections) / float64(total.Turns)
+		s.ToolCallsPerTurn = float64(total.ToolCalls) / float64(total.Turns)
+	}
+	s.FeedbackCount = total.PositiveFeedback + total.NegativeFeedback
+	if s.FeedbackCount > 0 {
+		s.FeedbackScore = float64(total.PositiveFeedback-total.NegativeFeedback) / float64(s.FeedbackCount)
+	}
+	return s
+}
+
+// Flush writes data to disk if dirty. Prunes days older than the retention window.
+func (m *Metrics) Flush() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.dirty {
+		return
+	}
+
+	m.prune(metricsRetentionDays)
+	m.dirty = false
+
+	data, err := json.MarshalIndent(m.data, "", "  ")
+	if err != nil {
+		logger.ErrorCF("experiments", "Failed to marshal metrics", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	os.MkdirAll(filepath.Dir(m.filePath), 0755)
+	tmpPath := m.filePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		logger.ErrorCF("experiments", "Failed to write metrics", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err := os.Rename(tmpPath, m.filePath); err != nil {
+		logger.ErrorCF("experiments", "Failed to rename metrics", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+func (m *Metrics) load() {
+	data, err := os.ReadFile(m.filePath)
+	if err != nil {
+		return // File doesn't exist yet, start fresh
+	}
+
+	var md metricsData
+	if err := json.Unmarshal(data, &md); err != nil {
+		logger.WarnCF("experiments", "Failed to parse experiment metrics, starting fresh",
+			map[string]interface{}{"error": err.Error()})
+		return
+	}
+	m.data = &md
+}
+
+func (m *Metrics) getOrCreateDay(date string) *DayMetrics {
+	for _, d := range m.data.Days {
+		if d.Date == date {
+			return d
+		}
+	}
+	day := &DayMetrics{Date: date}
+	m.data.Days = append(m.data.Days, day)
+	return day
+}
+
+func (m *Metrics) prune(keepDays int) {
+	cutoff := time.Now().AddDate(0, 0, -keepDays).Format("2006-01-02")
+	kept := make([]*DayMetrics, 0, len(m.data.Days))
+	for _, d := range m.data.Days {
+		if d.Date >= cutoff {
+			kept = append(kept, d)
+		}
+	}
+	m.data.Days = kept
+}
+
+// correctionMarkers are phrases that, at the start of a message, usually mean
+// the user is correcting the previous answer.
+var correctionMarkers = []string{
+	"no,", "no.", "no!", "nope", "eso no", "no es eso", "no era eso", "no es así", "no es correcto",
+	"incorrecto", "te equivocaste", "estás equivocado", "estas equivocado", "mal,", "error,",
+	"that's wrong", "thats wrong", "that's not", "not what i", "wrong", "incorrect", "you're wrong",
+	"i said", "te dije", "ya te dije", "de nuevo no",
+}
+
+// IsCorrection reports whether a user message looks like a correction.
+func IsCorrection(message string) bool {
+	msg := strings.ToLower(strings.TrimSpace(message))
+	if msg == "" {
+		return false
+	}
+	for _, marker := range correctionMarkers {
+		if strings.HasPrefix(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
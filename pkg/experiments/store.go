@@ -24,6 +24,10 @@ type Hypothesis struct {
 	EvaluatedAt string `json:"evaluated_at,omitempty"`
 	CycleCount  int    `json:"cycle_count"`
 	MaxCycles   int    `json:"max_cycles"` // default 4 (~1 month of weekly evaluations)
+
+	Metric      string       `json:"metric,omitempty"` // response_length, corrections, tool_usage, feedback (default by category)
+	Goal        string       `json:"goal,omitempty"`   // increase | decrease (default by metric)
+	Evaluations []Evaluation `json:"evaluations,omitempty"`
 }
 
 // Store manages behavioral experiments.
@@ -153,6 +157,31 @@ func (s *Store) Update(id string, status string, evaluatedAt string, cycleCount
 	return ErrNotFound
 }
 
+// RecordEvaluation appends an evaluation result to a hypothesis, advances its
+// cycle count and applies the verdict.
+func (s *Store) RecordEvaluation(id string, ev Evaluation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.hypotheses {
+		h := &s.hypotheses[i]
+		if h.ID != id {
+			continue
+		}
+		h.Evaluations = append(h.Evaluations, ev)
+		h.EvaluatedAt = ev.At
+		h.CycleCount++
+		switch ev.Verdict {
+		case VerdictAccept:
+			h.Status = "accepted"
+		case VerdictReject:
+			h.Status = "rejected"
+		}
+		return s.save()
+	}
+	return ErrNotFound
+}
+
 // ExpireOld marks hypotheses as expired if they've exceeded their MaxCycles.
 func (s *Store) ExpireOld() int {
 	s.mu.Lock()
@@ -0,0 +1,99 @@
+package feedback
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// Stats counts feedback events.
+type Stats struct {
+	Positive int
+	Negative int
+}
+
+// Store appends feedback events to workspace/state/feedback.jsonl.
+type Store struct {
+	filePath string
+	mu       sync.Mutex
+}
+
+// NewStore creates a feedback Store.
+func NewStore(workspace string) *Store {
+	stateDir := filepath.Join(workspace, "state")
+	os.MkdirAll(stateDir, 0755)
+	return &Store{filePath: filepath.Join(stateDir, "feedback.jsonl")}
+}
+
+// Record appends an event to the log.
+func (s *Store) Record(ev bus.FeedbackEvent) error {
+	if ev.Timestamp == 0 {
+		ev.Timestamp = time.Now().Unix()
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Since returns events recorded at or after t, oldest first.
+func (s *Store) Since(t time.Time) ([]bus.FeedbackEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	cutoff := t.Unix()
+	var events []bus.FeedbackEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev bus.FeedbackEvent
+		if json.Unmarshal(scanner.Bytes(), &ev) != nil {
+			continue
+		}
+		if ev.Timestamp >= cutoff {
+			events = append(events, ev)
+		}
+	}
+	return events, scanner.Err()
+}
+
+// StatsSince counts positive and negative events recorded at or after t.
+func (s *Store) StatsSince(t time.Time) (Stats, error) {
+	events, err := s.Since(t)
+	if err != nil {
+		return Stats{}, err
+	}
+	var st Stats
+	for _, ev := range events {
+		if ev.Score > 0 {
+			st.Positive++
+		} else if ev.Score < 0 {
+			st.Negative++
+		}
+	}
+	return st, nil
+}
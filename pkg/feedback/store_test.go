@@ -0,0 +1,40 @@
+package feedback
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestRecordAndStats(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	old := time.Now().Add(-48 * time.Hour).Unix()
+	events := []bus.FeedbackEvent{
+		{Channel: "telegram", Reaction: "👍", Score: 1, Timestamp: old},
+		{Channel: "telegram", Reaction: "👍", Score: 1},
+		{Channel: "slack", Reaction: "-1", Score: -1},
+	}
+	for _, ev := range events {
+		if err := store.Record(ev); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+
+	recent, err := store.Since(time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("Since failed: %v", err)
+	}
+	if len(recent) != 2 {
+		t.Fatalf("expected 2 recent events, got %d", len(recent))
+	}
+
+	stats, err := store.StatsSince(time.Time{})
+	if err != nil {
+		t.Fatalf("StatsSince failed: %v", err)
+	}
+	if stats.Positive != 2 || stats.Negative != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
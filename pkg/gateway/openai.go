@@ -0,0 +1,352 @@
+// Package gateway serves the HTTP APIs exposed by `picoclaw gateway`.
+package gateway
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// streamChunkRunes is the size of each content delta in streamed replies.
+const streamChunkRunes = 24
+
+// Agent processes a single user message and returns the reply.
+type Agent interface {
+	ProcessInbound(ctx context.Context, msg bus.InboundMessage) (string, error)
+}
+
+// OpenAIServer exposes the agent as an OpenAI-compatible model at
+// /v1/chat/completions and /v1/models.
+//
+// Clients usually resend the whole conversation on every request, but the
+// agent keeps its own history, so only the last user message is used. Each
+// API key maps to its own session ("api:<key name>"); the request's `user`
+// field or an X-Session-ID header splits it further.
+type OpenAIServer struct {
+	agent     Agent
+	cfg       config.GatewayAPIConfig
+	ctx       context.Context
+	keepAlive time.Duration
+	sessions  sync.Map // sessionKey -> *sync.Mutex
+}
+
+// NewOpenAIServer creates the API server. ctx bounds agent runs, so that a
+// client disconnecting doesn't abort a turn halfway through.
+func NewOpenAIServer(ctx context.Context, agent Agent, cfg config.GatewayAPIConfig) *OpenAIServer {
+	if cfg.ModelName == "" {
+		cfg.ModelName = "picoclaw"
+	}
+	return &OpenAIServer{
+		agent:     agent,
+		cfg:       cfg,
+		ctx:       ctx,
+		keepAlive: 10 * time.Second,
+	}
+}
+
+// Register mounts the API routes on mux.
+func (s *OpenAIServer) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/v1/models", s.handleModels)
+	mux.HandleFunc("/v1/chat/completions", s.handleChatCompletions)
+}
+
+type chatCompletionRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+	User     string        `json:"user"`
+}
+
+type chatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+type chatChoice struct {
+	Index        int        `json:"index"`
+	Message      *chatReply `json:"message,omitempty"`
+	Delta        *chatReply `json:"delta,omitempty"`
+	FinishReason *string    `json:"finish_reason"`
+}
+
+type chatReply struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type chatCompletionResponse struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []chatChoice `json:"choices"`
+}
+
+func (s *OpenAIServer) handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method not allowed")
+		return
+	}
+	if _, ok := s.authenticate(r); !ok {
+		writeError(w, http.StatusUnauthorized, "invalid_api_key", "invalid API key")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"object": "list",
+		"data": []map[string]interface{}{{
+			"id":       s.cfg.ModelName,
+			"object":   "model",
+			"created":  0,
+			"owned_by": "picoclaw",
+		}},
+	})
+}
+
+func (s *OpenAIServer) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method not allowed")
+		return
+	}
+	keyName, ok := s.authenticate(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "invalid_api_key", "invalid API key")
+		return
+	}
+
+	var req chatCompletionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<20)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid JSON body: "+err.Error())
+		return
+	}
+	content := lastUserMessage(req.Messages)
+	if content == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "messages must include a user message")
+		return
+	}
+
+	sessionKey := "api:" + keyName
+	chatID := keyName
+	if sub := sessionSuffix(firstNonEmpty(r.Header.Get("X-Session-ID"), req.User)); sub != "" {
+		sessionKey += ":" + sub
+		chatID += ":" + sub
+	}
+
+	logger.InfoCF("gateway", "Chat completion request", map[string]interface{}{
+		"key":     keyName,
+		"session": sessionKey,
+		"stream":  req.Stream,
+	})
+
+	msg := bus.InboundMessage{
+		Channel:    "api",
+		SenderID:   keyName,
+		ChatID:     chatID,
+		Content:    content,
+		SessionKey: sessionKey,
+		Metadata:   map[string]string{"platform": "openai_api"},
+	}
+
+	id := "chatcmpl-" + uuid.New().String()
+	if req.Stream {
+		s.streamCompletion(w, r, id, msg)
+		return
+	}
+
+	reply, err := s.process(msg)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	stop := "stop"
+	writeJSON(w, http.StatusOK, chatCompletionResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   s.cfg.ModelName,
+		Choices: []chatChoice{{
+			Message:      &chatReply{Role: "assistant", Content: reply},
+			FinishReason: &stop,
+		}},
+	})
+}
+
+// streamCompletion answers with server-sent events. The agent doesn't stream
+// tokens, so keep-alive comments are sent while it works and the finished
+// reply is then streamed in small deltas.
+func (s *OpenAIServer) streamCompletion(w http.ResponseWriter, r *http.Request, id string, msg bus.InboundMessage) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "server_error", "streaming unsupported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	created := time.Now().Unix()
+	send := func(delta chatReply, finish *string) {
+		data, _ := json.Marshal(chatCompletionResponse{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   s.cfg.ModelName,
+			Choices: []chatChoice{{Delta: &delta, FinishReason: finish}},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+	}
+
+	send(chatReply{Role: "assistant"}, nil)
+
+	type result struct {
+		reply string
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		reply, err := s.process(msg)
+		done <- result{reply, err}
+	}()
+
+	ticker := time.NewTicker(s.keepAlive)
+	defer ticker.Stop()
+
+	var res result
+wait:
+	for {
+		select {
+		case res = <-done:
+			break wait
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			// The turn still completes and lands in the session
+			return
+		}
+	}
+
+	if res.err != nil {
+		data, _ := json.Marshal(map[string]interface{}{
+			"error": map[string]string{"message": res.err.Error(), "type": "server_error"},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+	} else {
+		runes := []rune(res.reply)
+		for start := 0; start < len(runes); start += streamChunkRunes {
+			end := min(start+streamChunkRunes, len(runes))
+			send(chatReply{Content: string(runes[start:end])}, nil)
+		}
+		stop := "stop"
+		send(chatReply{}, &stop)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+}
+
+// process runs one turn. The agent runs one turn at a time; the per-session
+// lock keeps requests on the same key in order while they wait.
+func (s *OpenAIServer) process(msg bus.InboundMessage) (string, error) {
+	lock, _ := s.sessions.LoadOrStore(msg.SessionKey, &sync.Mutex{})
+	mu := lock.(*sync.Mutex)
+	mu.Lock()
+	defer mu.Unlock()
+	return s.agent.ProcessInbound(s.ctx, msg)
+}
+
+// authenticate matches the bearer token against the configured keys and
+// returns the key's name.
+func (s *OpenAIServer) authenticate(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+	for name, key := range s.cfg.APIKeys {
+		if key != "" && subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// lastUserMessage returns the text of the final user message, joining the
+// text parts of multimodal content.
+func lastUserMessage(messages []chatMessage) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != "user" {
+			continue
+		}
+		var text string
+		if json.Unmarshal(messages[i].Content, &text) == nil {
+			return strings.TrimSpace(text)
+		}
+		var parts []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}
+		if json.Unmarshal(messages[i].Content, &parts) == nil {
+			var texts []string
+			for _, p := range parts {
+				if p.Type == "text" && p.Text != "" {
+					texts = append(texts, p.Text)
+				}
+			}
+			return strings.TrimSpace(strings.Join(texts, "\n"))
+		}
+		return ""
+	}
+	return ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// sessionSuffix keeps client-chosen session names safe for use in session
+// file names.
+func sessionSuffix(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.', r == '@':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+		if b.Len() >= 64 {
+			break
+		}
+	}
+	return strings.Trim(b.String(), ".")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, errType, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    errType,
+		},
+	})
+}
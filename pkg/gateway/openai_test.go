@@ -0,0 +1,175 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+type stubAgent struct {
+	mu    sync.Mutex
+	msgs  []bus.InboundMessage
+	reply string
+	delay time.Duration
+}
+
+func (a *stubAgent) ProcessInbound(ctx context.Context, msg bus.InboundMessage) (string, error) {
+	time.Sleep(a.delay)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.msgs = append(a.msgs, msg)
+	return a.reply, nil
+}
+
+func newTestServer(agent Agent) *httptest.Server {
+	api := NewOpenAIServer(context.Background(), agent, config.GatewayAPIConfig{
+		Enabled: true,
+		APIKeys: map[string]string{"webui": "secret-token"},
+	})
+	mux := http.NewServeMux()
+	api.Register(mux)
+	return httptest.NewServer(mux)
+}
+
+func post(t *testing.T, url, token, body string, header map[string]string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	return resp
+}
+
+func TestChatCompletionsAuth(t *testing.T) {
+	srv := newTestServer(&stubAgent{reply: "hi"})
+	defer srv.Close()
+
+	resp := post(t, srv.URL+"/v1/chat/completions", "wrong", `{"messages":[{"role":"user","content":"hello"}]}`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 with a bad key, got %d", resp.StatusCode)
+	}
+}
+
+func TestChatCompletions(t *testing.T) {
+	agent := &stubAgent{reply: "It is noon."}
+	srv := newTestServer(agent)
+	defer srv.Close()
+
+	body := `{"model":"picoclaw","messages":[
+		{"role":"system","content":"be brief"},
+		{"role":"user","content":"earlier question"},
+		{"role":"assistant","content":"earlier answer"},
+		{"role":"user","content":[{"type":"text","text":"What time is it?"}]}]}`
+	resp := post(t, srv.URL+"/v1/chat/completions", "secret-token", body, map[string]string{"X-Session-ID": "../editor"})
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+
+	var out chatCompletionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if out.Object != "chat.completion" || len(out.Choices) != 1 || out.Choices[0].Message.Content != "It is noon." {
+		t.Errorf("unexpected response: %+v", out)
+	}
+
+	msg := agent.msgs[0]
+	if msg.Content != "What time is it?" {
+		t.Errorf("only the last user message should be forwarded, got %q", msg.Content)
+	}
+	if msg.Channel != "api" || msg.SessionKey != "api:webui:_editor" {
+		t.Errorf("unexpected session mapping: %s %s", msg.Channel, msg.SessionKey)
+	}
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	reply := strings.Repeat("streamed reply ", 5)
+	agent := &stubAgent{reply: reply, delay: 30 * time.Millisecond}
+	api := NewOpenAIServer(context.Background(), agent, config.GatewayAPIConfig{
+		APIKeys: map[string]string{"webui": "secret-token"},
+	})
+	api.keepAlive = 10 * time.Millisecond
+	mux := http.NewServeMux()
+	api.Register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp := post(t, srv.URL+"/v1/chat/completions", "secret-token",
+		`{"stream":true,"user":"alice","messages":[{"role":"user","content":"go"}]}`, nil)
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	var content strings.Builder
+	var sawKeepAlive, sawDone, sawStop bool
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, ": keep-alive"):
+			sawKeepAlive = true
+		case line == "data: [DONE]":
+			sawDone = true
+		case strings.HasPrefix(line, "data: "):
+			var chunk chatCompletionResponse
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &chunk); err != nil {
+				t.Fatalf("bad chunk %q: %v", line, err)
+			}
+			content.WriteString(chunk.Choices[0].Delta.Content)
+			if fr := chunk.Choices[0].FinishReason; fr != nil && *fr == "stop" {
+				sawStop = true
+			}
+		}
+	}
+
+	if content.String() != reply {
+		t.Errorf("streamed content = %q, want %q", content.String(), reply)
+	}
+	if !sawKeepAlive || !sawStop || !sawDone {
+		t.Errorf("keep-alive=%v stop=%v done=%v", sawKeepAlive, sawStop, sawDone)
+	}
+	if agent.msgs[0].SessionKey != "api:webui:alice" {
+		t.Errorf("user field should select the session, got %s", agent.msgs[0].SessionKey)
+	}
+}
+
+func TestModels(t *testing.T) {
+	srv := newTestServer(&stubAgent{})
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/v1/models", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&out)
+	if len(out.Data) != 1 || out.Data[0].ID != "picoclaw" {
+		t.Errorf("unexpected models: %+v", out)
+	}
+}
@@ -0,0 +1,277 @@
+// PicoClaw web UI: chat over WebSocket plus read-only admin views.
+(() => {
+  "use strict";
+
+  const $ = (sel) => document.querySelector(sel);
+  const views = ["chat", "sessions", "cron", "reminders", "tasks", "telemetry", "system"];
+  let socket = null;
+
+  async function api(path, options = {}) {
+    const resp = await fetch("api/" + path, { credentials: "same-origin", ...options });
+    if (resp.status === 401) {
+      showLogin();
+      throw new Error("unauthorized");
+    }
+    return resp.json();
+  }
+
+  function el(tag, attrs = {}, ...children) {
+    const node = document.createElement(tag);
+    for (const [k, v] of Object.entries(attrs)) {
+      if (k === "class") node.className = v;
+      else if (k.startsWith("on")) node.addEventListener(k.slice(2), v);
+      else node.setAttribute(k, v);
+    }
+    for (const child of children) {
+      if (child !== null && child !== undefined) node.append(child);
+    }
+    return node;
+  }
+
+  function fmtTime(value) {
+    if (!value) return "";
+    const d = typeof value === "number" ? new Date(value) : new Date(value);
+    return isNaN(d) ? String(value) : d.toLocaleString();
+  }
+
+  function fillTable(table, columns, rows) {
+    table.replaceChildren(el("tr", {}, ...columns.map((c) => el("th", {}, c.label))));
+    if (!rows || rows.length === 0) {
+      table.append(el("tr", {}, el("td", { class: "empty", colspan: columns.length }, "Nothing here yet")));
+      return;
+    }
+    for (const row of rows) {
+      table.append(el("tr", {}, ...columns.map((c) => el("td", {}, String(c.value(row) ?? "")))));
+    }
+  }
+
+  // --- Login ---
+
+  function showLogin() {
+    $("#app").hidden = true;
+    $("#login").hidden = false;
+    if (socket) socket.close();
+  }
+
+  $("#login-form").addEventListener("submit", async (e) => {
+    e.preventDefault();
+    const resp = await fetch("api/login", {
+      method: "POST",
+      credentials: "same-origin",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ token: $("#login-token").value }),
+    });
+    if (!resp.ok) {
+      $("#login-error").textContent = "Invalid token";
+      return;
+    }
+    $("#login-error").textContent = "";
+    $("#login-token").value = "";
+    start();
+  });
+
+  $("#logout").addEventListener("click", async () => {
+    await fetch("api/logout", { method: "POST", credentials: "same-origin" });
+    showLogin();
+  });
+
+  // --- Chat ---
+
+  function chatSession() {
+    let id = localStorage.getItem("picoclaw.session");
+    if (!id) {
+      id = "browser-" + Math.random().toString(36).slice(2, 10);
+      localStorage.setItem("picoclaw.session", id);
+    }
+    return id;
+  }
+
+  function addChatMessage(role, text) {
+    const log = $("#chat-log");
+    log.querySelectorAll(".typing").forEach((n) => n.remove());
+    log.append(el("div", { class: "msg " + role }, text));
+    log.scrollTop = log.scrollHeight;
+  }
+
+  function connectChat() {
+    const proto = location.protocol === "https:" ? "wss:" : "ws:";
+    const base = location.pathname.replace(/[^/]*$/, "");
+    socket = new WebSocket(`${proto}//${location.host}${base}ws?session=${encodeURIComponent(chatSession())}`);
+    socket.onmessage = (ev) => {
+      const msg = JSON.parse(ev.data);
+      if (msg.type === "typing") addChatMessage("typing", "PicoClaw is thinking…");
+      else if (msg.type === "message") addChatMessage("assistant", msg.content);
+      else if (msg.type === "error") addChatMessage("error", msg.content);
+    };
+    socket.onclose = () => {
+      if (!$("#app").hidden) setTimeout(connectChat, 3000);
+    };
+  }
+
+  $("#chat-form").addEventListener("submit", (e) => {
+    e.preventDefault();
+    const text = $("#chat-input").value.trim();
+    if (!text || !socket || socket.readyState !== WebSocket.OPEN) return;
+    socket.send(JSON.stringify({ type: "message", content: text }));
+    addChatMessage("user", text);
+    $("#chat-input").value = "";
+  });
+
+  $("#chat-input").addEventListener("keydown", (e) => {
+    if (e.key === "Enter" && !e.shiftKey) {
+      e.preventDefault();
+      $("#chat-form").requestSubmit();
+    }
+  });
+
+  // --- Admin views ---
+
+  const loaders = {
+    async sessions() {
+      const sessions = await api("sessions");
+      const list = $("#session-list");
+      list.replaceChildren();
+      for (const s of sessions) {
+        const item = el("li", {}, s.key, el("small", {}, `${s.messages} messages · ${fmtTime(s.updated)}`));
+        item.addEventListener("click", () => {
+          list.querySelectorAll("li").forEach((n) => n.classList.remove("active"));
+          item.classList.add("active");
+          showSession(s.key);
+        });
+        list.append(item);
+      }
+    },
+
+    async cron() {
+      fillTable($("#cron-table"), [
+        { label: "Name", value: (j) => j.name },
+        { label: "Schedule", value: (j) => j.schedule.expr || (j.schedule.everyMs ? `every ${j.schedule.everyMs / 1000}s` : fmtTime(j.schedule.atMs)) },
+        { label: "Enabled", value: (j) => (j.enabled ? "yes" : "no") },
+        { label: "Next run", value: (j) => fmtTime(j.state.nextRunAtMs) },
+        { label: "Last status", value: (j) => j.state.lastStatus || "" },
+        { label: "Message", value: (j) => j.payload.message },
+      ], await api("cron"));
+    },
+
+    async reminders() {
+      const reminders = (await api("reminders")).filter((r) => !r.fired);
+      fillTable($("#reminders-table"), [
+        { label: "Due", value: (r) => fmtTime(r.due_at) },
+        { label: "Message", value: (r) => r.message },
+        { label: "Channel", value: (r) => `${r.channel}:${r.chat_id}` },
+      ], reminders);
+    },
+
+    async tasks() {
+      fillTable($("#tasks-table"), [
+        { label: "Title", value: (t) => t.title },
+        { label: "Status", value: (t) => t.status },
+        { label: "Priority", value: (t) => t.priority },
+        { label: "Due", value: (t) => t.due_date },
+        { label: "Tags", value: (t) => (t.tags || []).join(", ") },
+      ], await api("tasks"));
+    },
+
+    async telemetry() {
+      const days = await api("telemetry?days=14");
+      drawChart(days);
+      fillTable($("#telemetry-table"), [
+        { label: "Date", value: (d) => d.date },
+        { label: "Calls", value: (d) => d.totals.calls },
+        { label: "Prompt", value: (d) => d.totals.prompt_tokens },
+        { label: "Completion", value: (d) => d.totals.completion_tokens },
+        { label: "Total", value: (d) => d.totals.total_tokens },
+        { label: "👍/👎", value: (d) => `${d.feedback?.positive || 0}/${d.feedback?.negative || 0}` },
+      ], days.slice().reverse());
+    },
+
+    async system() {
+      const status = await api("status");
+      fillTable($("#info-table"), [
+        { label: "Key", value: (r) => r[0] },
+        { label: "Value", value: (r) => r[1] },
+      ], Object.entries(status.info || {}));
+
+      const channels = $("#channels-table");
+      channels.replaceChildren(el("tr", {}, el("th", {}, "Channel"), el("th", {}, "Status")));
+      for (const [name, st] of Object.entries(status.channels || {})) {
+        channels.append(el("tr", {}, el("td", {}, name),
+          el("td", {}, el("span", { class: "dot" + (st.running ? " ok" : "") }), st.running ? "running" : "stopped")));
+      }
+
+      const s = status.sentinel;
+      fillTable($("#sentinel-table"), [
+        { label: "Metric", value: (r) => r[0] },
+        { label: "Value", value: (r) => r[1] },
+      ], s ? [
+        ["Last check", fmtTime(s.last_check)],
+        ["CPU temperature", `${s.cpu_temp_c.toFixed(1)} °C`],
+        ["RAM", `${s.ram_used_percent.toFixed(0)}% of ${s.ram_total_mb} MB`],
+        ["Disk", `${s.disk_used_percent.toFixed(0)}% (${s.disk_free_gb.toFixed(1)} GB free)`],
+        ["Alerts", (s.alerts || []).join("; ") || "none"],
+      ] : []);
+    },
+  };
+
+  async function showSession(key) {
+    const detail = $("#session-detail");
+    detail.replaceChildren();
+    for (const m of await api("sessions?key=" + encodeURIComponent(key))) {
+      let text = m.content || "";
+      if (m.tool_calls) text += m.tool_calls.map((c) => `→ ${c.function?.name || c.name}(${c.function?.arguments || ""})`).join("\n");
+      const role = m.role === "tool" ? "tool" : m.role === "user" ? "user" : "assistant";
+      detail.append(el("div", { class: "msg " + role }, text));
+    }
+  }
+
+  function drawChart(days) {
+    const ns = "http://www.w3.org/2000/svg";
+    const svg = document.createElementNS(ns, "svg");
+    svg.setAttribute("viewBox", "0 0 700 220");
+    const max = Math.max(1, ...days.map((d) => d.totals.total_tokens));
+    const width = 700 / Math.max(days.length, 1);
+    days.forEach((d, i) => {
+      const h = (d.totals.total_tokens / max) * 180;
+      const rect = document.createElementNS(ns, "rect");
+      rect.setAttribute("x", i * width + 4);
+      rect.setAttribute("y", 195 - h);
+      rect.setAttribute("width", width - 8);
+      rect.setAttribute("height", h);
+      const title = document.createElementNS(ns, "title");
+      title.textContent = `${d.date}: ${d.totals.total_tokens} tokens`;
+      rect.append(title);
+      const label = document.createElementNS(ns, "text");
+      label.setAttribute("x", i * width + 4);
+      label.setAttribute("y", 212);
+      label.textContent = d.date.slice(5);
+      svg.append(rect, label);
+    });
+    $("#telemetry-chart").replaceChildren(svg);
+  }
+
+  // --- Routing ---
+
+  function route() {
+    const view = views.includes(location.hash.slice(1)) ? location.hash.slice(1) : "chat";
+    for (const v of views) {
+      $("#view-" + v).classList.toggle("active", v === view);
+      document.querySelector(`nav a[href="#${v}"]`).classList.toggle("active", v === view);
+    }
+    if (loaders[view]) loaders[view]().catch(() => {});
+  }
+
+  async function start() {
+    try {
+      await api("status");
+    } catch {
+      return;
+    }
+    $("#login").hidden = true;
+    $("#app").hidden = false;
+    connectChat();
+    route();
+  }
+
+  window.addEventListener("hashchange", route);
+  start();
+})();
@@ -0,0 +1,258 @@
+package gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/session"
+	"github.com/sipeed/picoclaw/pkg/telemetry"
+)
+
+//go:embed web
+var webAssets embed.FS
+
+const webSessionCookie = "picoclaw_session"
+
+// SessionStore lists sessions and their history.
+type SessionStore interface {
+	ListSessions() []session.SessionInfo
+	GetHistory(key string) []providers.Message
+}
+
+// CronLister lists scheduled jobs.
+type CronLister interface {
+	ListJobs(includeDisabled bool) []cron.CronJob
+}
+
+// ChannelStatus reports whether each channel is running.
+type ChannelStatus interface {
+	GetStatus() map[string]interface{}
+}
+
+// TelemetrySource provides daily token usage.
+type TelemetrySource interface {
+	GetLastNDays(n int) []*telemetry.DayBucket
+}
+
+// WebUIOptions wires the dashboard to the running services. Any source left
+// nil is shown as unavailable.
+type WebUIOptions struct {
+	Token     string
+	Workspace string
+	Agent     Agent
+	Sessions  SessionStore
+	Cron      CronLister
+	Channels  ChannelStatus
+	Telemetry TelemetrySource
+	Info      func() map[string]interface{} // version, uptime, ...
+}
+
+// WebUI serves the embedded chat UI and admin dashboard under /ui/.
+type WebUI struct {
+	opts     WebUIOptions
+	cookie   string // hex SHA-256 of the token, stored in the session cookie
+	upgrader websocket.Upgrader
+	chat     *OpenAIServer // reuses per-session serialization
+}
+
+// NewWebUI creates the web UI. opts.Token must be non-empty; ctx bounds
+// agent runs started from the chat.
+func NewWebUI(ctx context.Context, opts WebUIOptions) *WebUI {
+	sum := sha256.Sum256([]byte(opts.Token))
+	return &WebUI{
+		opts:   opts,
+		cookie: hex.EncodeToString(sum[:]),
+		chat:   &OpenAIServer{agent: opts.Agent, ctx: ctx},
+	}
+}
+
+// Register mounts the UI routes on mux.
+func (u *WebUI) Register(mux *http.ServeMux) {
+	static, _ := fs.Sub(webAssets, "web")
+	mux.Handle("/ui/", http.StripPrefix("/ui/", http.FileServer(http.FS(static))))
+	mux.HandleFunc("/ui/api/login", u.handleLogin)
+	mux.HandleFunc("/ui/api/logout", u.handleLogout)
+	mux.HandleFunc("/ui/api/status", u.auth(u.handleStatus))
+	mux.HandleFunc("/ui/api/sessions", u.auth(u.handleSessions))
+	mux.HandleFunc("/ui/api/cron", u.auth(u.handleCron))
+	mux.HandleFunc("/ui/api/reminders", u.auth(u.handleWorkspaceFile("reminders.json")))
+	mux.HandleFunc("/ui/api/tasks", u.auth(u.handleWorkspaceFile(filepath.Join("tasks", "tasks.json"))))
+	mux.HandleFunc("/ui/api/telemetry", u.auth(u.handleTelemetry))
+	mux.HandleFunc("/ui/ws", u.auth(u.handleChat))
+}
+
+// auth accepts the session cookie set at login or the token as a bearer header.
+func (u *WebUI) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ok := false
+		if c, err := r.Cookie(webSessionCookie); err == nil {
+			ok = subtle.ConstantTimeCompare([]byte(c.Value), []byte(u.cookie)) == 1
+		}
+		if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found && !ok {
+			ok = subtle.ConstantTimeCompare([]byte(token), []byte(u.opts.Token)) == 1
+		}
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "login required")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (u *WebUI) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method not allowed")
+		return
+	}
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body); err != nil ||
+		subtle.ConstantTimeCompare([]byte(body.Token), []byte(u.opts.Token)) != 1 {
+		logger.WarnCF("gateway", "Web UI login failed", map[string]interface{}{"remote": r.RemoteAddr})
+		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid token")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     webSessionCookie,
+		Value:    u.cookie,
+		Path:     "/ui/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   int((30 * 24 * time.Hour).Seconds()),
+	})
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func (u *WebUI) handleLogout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: webSessionCookie, Value: "", Path: "/ui/", MaxAge: -1})
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func (u *WebUI) handleStatus(w http.ResponseWriter, r *http.Request) {
+	status := map[string]interface{}{}
+	if u.opts.Info != nil {
+		status["info"] = u.opts.Info()
+	}
+	if u.opts.Channels != nil {
+		status["channels"] = u.opts.Channels.GetStatus()
+	}
+	if data, err := os.ReadFile(filepath.Join(u.opts.Workspace, "state", "sentinel.json")); err == nil {
+		status["sentinel"] = json.RawMessage(data)
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleSessions lists sessions, or returns one session's history with ?key=.
+func (u *WebUI) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if u.opts.Sessions == nil {
+		writeJSON(w, http.StatusOK, []session.SessionInfo{})
+		return
+	}
+	if key := r.URL.Query().Get("key"); key != "" {
+		writeJSON(w, http.StatusOK, u.opts.Sessions.GetHistory(key))
+		return
+	}
+	writeJSON(w, http.StatusOK, u.opts.Sessions.ListSessions())
+}
+
+func (u *WebUI) handleCron(w http.ResponseWriter, r *http.Request) {
+	jobs := []cron.CronJob{}
+	if u.opts.Cron != nil {
+		jobs = u.opts.Cron.ListJobs(true)
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// handleWorkspaceFile serves a JSON file owned by a tool, read-only.
+func (u *WebUI) handleWorkspaceFile(rel string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := os.ReadFile(filepath.Join(u.opts.Workspace, rel))
+		if err != nil || !json.Valid(data) {
+			writeJSON(w, http.StatusOK, []interface{}{})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+}
+
+func (u *WebUI) handleTelemetry(w http.ResponseWriter, r *http.Request) {
+	days := 14
+	if n, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && n > 0 && n <= 90 {
+		days = n
+	}
+	buckets := []*telemetry.DayBucket{}
+	if u.opts.Telemetry != nil {
+		buckets = u.opts.Telemetry.GetLastNDays(days)
+	}
+	writeJSON(w, http.StatusOK, buckets)
+}
+
+type wsChatMessage struct {
+	Type    string `json:"type"` // client: "message"; server: "typing", "message", "error"
+	Content string `json:"content"`
+}
+
+// handleChat runs a chat over WebSocket. Each browser conversation is its
+// own session ("web:<session>"), chosen with ?session=.
+func (u *WebUI) handleChat(w http.ResponseWriter, r *http.Request) {
+	if u.opts.Agent == nil {
+		writeError(w, http.StatusServiceUnavailable, "server_error", "agent unavailable")
+		return
+	}
+	conn, err := u.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	chatID := sessionSuffix(r.URL.Query().Get("session"))
+	if chatID == "" {
+		chatID = "default"
+	}
+
+	for {
+		var in wsChatMessage
+		if err := conn.ReadJSON(&in); err != nil {
+			return
+		}
+		if in.Type != "message" || strings.TrimSpace(in.Content) == "" {
+			continue
+		}
+		conn.WriteJSON(wsChatMessage{Type: "typing"})
+
+		reply, err := u.chat.process(bus.InboundMessage{
+			Channel:    "web",
+			SenderID:   "web",
+			ChatID:     chatID,
+			Content:    in.Content,
+			SessionKey: "web:" + chatID,
+			Metadata:   map[string]string{"platform": "web"},
+		})
+		out := wsChatMessage{Type: "message", Content: reply}
+		if err != nil {
+			out = wsChatMessage{Type: "error", Content: err.Error()}
+		}
+		if err := conn.WriteJSON(out); err != nil {
+			return
+		}
+	}
+}
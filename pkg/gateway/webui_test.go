@@ -0,0 +1,144 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/sipeed/picoclaw/pkg/session"
+)
+
+func newWebUIServer(t *testing.T, agent Agent) (*httptest.Server, string) {
+	t.Helper()
+	workspace := t.TempDir()
+	sessions := session.NewSessionManager("")
+	sessions.AddMessage("telegram:42", "user", "hola")
+
+	ui := NewWebUI(context.Background(), WebUIOptions{
+		Token:     "letmein",
+		Workspace: workspace,
+		Agent:     agent,
+		Sessions:  sessions,
+		Info:      func() map[string]interface{} { return map[string]interface{}{"version": "test"} },
+	})
+	mux := http.NewServeMux()
+	ui.Register(mux)
+	return httptest.NewServer(mux), workspace
+}
+
+func login(t *testing.T, srv *httptest.Server, token string) (*http.Client, int) {
+	t.Helper()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	resp, err := client.Post(srv.URL+"/ui/api/login", "application/json", strings.NewReader(`{"token":"`+token+`"}`))
+	if err != nil {
+		t.Fatalf("login request failed: %v", err)
+	}
+	resp.Body.Close()
+	return client, resp.StatusCode
+}
+
+func TestWebUIAuth(t *testing.T) {
+	srv, _ := newWebUIServer(t, &stubAgent{})
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/ui/api/sessions")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without login, got %d", resp.StatusCode)
+	}
+
+	if _, status := login(t, srv, "wrong"); status != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a wrong token, got %d", status)
+	}
+
+	client, status := login(t, srv, "letmein")
+	if status != http.StatusOK {
+		t.Fatalf("login failed with %d", status)
+	}
+	resp, err = client.Get(srv.URL + "/ui/api/sessions")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var sessions []session.SessionInfo
+	json.NewDecoder(resp.Body).Decode(&sessions)
+	if len(sessions) != 1 || sessions[0].Key != "telegram:42" || sessions[0].Messages != 1 {
+		t.Errorf("unexpected sessions: %+v", sessions)
+	}
+}
+
+func TestWebUIAssetsAndFiles(t *testing.T) {
+	srv, workspace := newWebUIServer(t, &stubAgent{})
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/ui/")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "app.js") {
+		t.Errorf("index not served from embedded assets: %d", resp.StatusCode)
+	}
+
+	os.MkdirAll(filepath.Join(workspace, "tasks"), 0755)
+	os.WriteFile(filepath.Join(workspace, "tasks", "tasks.json"), []byte(`[{"id":"t1","title":"Buy milk","status":"pending"}]`), 0644)
+
+	client, _ := login(t, srv, "letmein")
+	for path, want := range map[string]string{
+		"/ui/api/tasks":     "Buy milk",
+		"/ui/api/reminders": "[]",
+		"/ui/api/status":    `"version":"test"`,
+	} {
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("%s failed: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if !strings.Contains(string(body), want) {
+			t.Errorf("%s: expected %q in %s", path, want, body)
+		}
+	}
+}
+
+func TestWebUIChat(t *testing.T) {
+	agent := &stubAgent{reply: "pong"}
+	srv, _ := newWebUIServer(t, agent)
+	defer srv.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ui/ws?session=tab1"
+	if _, _, err := websocket.DefaultDialer.Dial(wsURL, nil); err == nil {
+		t.Fatal("WebSocket should require login")
+	}
+
+	header := http.Header{"Authorization": {"Bearer letmein"}}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(wsChatMessage{Type: "message", Content: "ping"})
+	var typing, reply wsChatMessage
+	conn.ReadJSON(&typing)
+	conn.ReadJSON(&reply)
+	if typing.Type != "typing" || reply.Type != "message" || reply.Content != "pong" {
+		t.Errorf("unexpected frames: %+v %+v", typing, reply)
+	}
+	if agent.msgs[0].SessionKey != "web:tab1" || agent.msgs[0].Channel != "web" {
+		t.Errorf("unexpected session mapping: %+v", agent.msgs[0])
+	}
+}
@@ -0,0 +1,67 @@
+package knowledge
+
+import "strings"
+
+// ContentDiff is a line-level comparison of two versions of a topic.
+type ContentDiff struct {
+	Added   []string
+	Removed []string
+	// ChangeRatio is (added+removed) / (lines in old+new), 0 when identical.
+	ChangeRatio float64
+}
+
+// materialChangeRatio is the share of changed lines above which a refresh is
+// worth telling the user about.
+const materialChangeRatio = 0.15
+
+// IsMaterial reports whether the change is large enough to notify about.
+func (d ContentDiff) IsMaterial() bool {
+	return d.ChangeRatio >= materialChangeRatio
+}
+
+// DiffContent compares two documents line by line, ignoring blank lines,
+// surrounding whitespace and line order.
+func DiffContent(oldContent, newContent string) ContentDiff {
+	oldLines := normalizedLines(oldContent)
+	newLines := normalizedLines(newContent)
+
+	oldSet := make(map[string]bool, len(oldLines))
+	for _, l := range oldLines {
+		oldSet[l] = true
+	}
+	newSet := make(map[string]bool, len(newLines))
+	for _, l := range newLines {
+		newSet[l] = true
+	}
+
+	var d ContentDiff
+	for _, l := range newLines {
+		if !oldSet[l] {
+			d.Added = append(d.Added, l)
+		}
+	}
+	for _, l := range oldLines {
+		if !newSet[l] {
+			d.Removed = append(d.Removed, l)
+		}
+	}
+
+	if total := len(oldLines) + len(newLines); total > 0 {
+		d.ChangeRatio = float64(len(d.Added)+len(d.Removed)) / float64(total)
+	}
+	return d
+}
+
+func normalizedLines(s string) []string {
+	var lines []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" || seen[line] {
+			continue
+		}
+		seen[line] = true
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,1094 @@
+package knowledge
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Source kinds understood by the Ingester.
+const (
+	SourceFile = "file"
+	SourceURL  = "url"
+	SourceFeed = "feed"
+)
+
+const (
+	// chunkChars is the target size of one topic; it stays under the
+	// BuildContext budget so a matching chunk is injected whole.
+	chunkChars = 3000
+	// maxFeedItems is how many of the newest feed entries are kept as topics.
+	maxFeedItems = 20
+	// maxFetchBytes caps downloaded documents.
+	maxFetchBytes = 10 << 20
+	// lockWait is how long to wait for another process (the gateway or a
+	// CLI command) to finish with the sources; lockStale is when a lock
+	// left behind by a crashed one is taken over.
+	lockWait  = 2 * time.Minute
+	lockStale = 30 * time.Minute
+)
+
+// reservedSlugs are the ingester's own directories, never used as source IDs.
+var reservedSlugs = map[string]bool{"inbox": true, "files": true}
+
+// Source is an external document or feed whose content is ingested into topics.
+type Source struct {
+	ID           string   `json:"id"`
+	Kind         string   `json:"kind"`     // "file" | "url" | "feed"
+	Location     string   `json:"location"` // file path or URL
+	Title        string   `json:"title"`
+	RefreshHours int      `json:"refresh_hours"` // 0 = never refresh automatically
+	LastFetched  string   `json:"last_fetched,omitempty"`
+	Checksum     string   `json:"checksum,omitempty"` // of the last extracted text
+	Topics       []string `json:"topics"`             // slugs created from this source
+	Error        string   `json:"error,omitempty"`
+}
+
+// AddOptions tweaks how a new source is registered.
+type AddOptions struct {
+	Feed         bool   // treat the URL as an RSS/Atom feed
+	Title        string // defaults to the file name, page title or feed title
+	RefreshHours int    // 0 uses the ingester's default, negative disables refresh
+}
+
+// Ingester turns files, web pages and feeds into knowledge topics.
+//
+// Layout under workspace/knowledge/:
+//
+//	inbox/         drop files here; they are ingested and moved to files/
+//	files/         originals of ingested files (re-read on refresh)
+//	SOURCES.json   registered sources
+//	SOURCES.lock   held while a process changes sources or their topics
+//	<slug>/        one topic per chunk or feed entry (META.json + KNOWLEDGE.md)
+type Ingester struct {
+	loader              *Loader
+	sourcesPath         string
+	lockPath            string
+	inboxDir            string
+	filesDir            string
+	defaultRefreshHours int
+	client              *http.Client
+	mu                  sync.Mutex
+}
+
+// NewIngester creates an Ingester that writes topics through the given loader.
+func NewIngester(loader *Loader, defaultRefreshHours int) *Ingester {
+	baseDir := loader.GetBaseDir()
+	in := &Ingester{
+		loader:              loader,
+		sourcesPath:         filepath.Join(baseDir, "SOURCES.json"),
+		lockPath:            filepath.Join(baseDir, "SOURCES.lock"),
+		inboxDir:            filepath.Join(baseDir, "inbox"),
+		filesDir:            filepath.Join(baseDir, "files"),
+		defaultRefreshHours: defaultRefreshHours,
+		client:              &http.Client{Timeout: 60 * time.Second},
+	}
+	os.MkdirAll(in.inboxDir, 0755)
+	return in
+}
+
+// InboxDir returns the directory watched for new files.
+func (in *Ingester) InboxDir() string {
+	return in.inboxDir
+}
+
+// Start processes the inbox and refreshes due sources every interval until ctx is done.
+func (in *Ingester) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			in.ProcessInbox(ctx)
+			in.RefreshDue(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// ListSources returns all registered sources.
+func (in *Ingester) ListSources() ([]Source, error) {
+	unlock, err := in.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return in.loadSources()
+}
+
+// Add registers a file path or URL and ingests it immediately.
+func (in *Ingester) Add(ctx context.Context, location string, opts AddOptions) (*Source, error) {
+	unlock, err := in.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	sources, err := in.loadSources()
+	if err != nil {
+		return nil, err
+	}
+
+	src := Source{
+		Location:     location,
+		Title:        opts.Title,
+		RefreshHours: opts.RefreshHours,
+	}
+	if src.RefreshHours == 0 {
+		src.RefreshHours = in.defaultRefreshHours
+	} else if src.RefreshHours < 0 {
+		src.RefreshHours = 0
+	}
+
+	switch {
+	case isURL(location) && opts.Feed:
+		src.Kind = SourceFeed
+	case isURL(location):
+		src.Kind = SourceURL
+	default:
+		abs, err := filepath.Abs(location)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(abs); err != nil {
+			return nil, err
+		}
+		src.Kind = SourceFile
+		src.Location = abs
+	}
+
+	for _, existing := range sources {
+		if existing.Location == src.Location {
+			return nil, fmt.Errorf("source already registered as %q", existing.ID)
+		}
+	}
+
+	base := src.Title
+	if base == "" {
+		base = sourceBaseName(src.Location)
+	}
+	src.ID = uniqueID(slugify(base), sources, in.loader.ListAll())
+
+	if err := in.ingest(ctx, &src, true); err != nil {
+		return nil, err
+	}
+
+	sources = append(sources, src)
+	if err := in.saveSources(sources); err != nil {
+		// Unrecorded topics would never be refreshed or removed
+		for _, slug := range src.Topics {
+			in.loader.RemoveTopic(slug)
+		}
+		return nil, err
+	}
+	return &src, nil
+}
+
+// Remove deletes a source and all its topics, or a single topic by slug.
+func (in *Ingester) Remove(id string) error {
+	unlock, err := in.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	sources, err := in.loadSources()
+	if err != nil {
+		return err
+	}
+
+	for i, src := range sources {
+		if src.ID != id {
+			continue
+		}
+		for _, slug := range src.Topics {
+			in.loader.RemoveTopic(slug)
+		}
+		// Only delete originals we own; never files registered from elsewhere.
+		if src.Kind == SourceFile && filepath.Dir(src.Location) == in.filesDir {
+			os.Remove(src.Location)
+		}
+		sources = append(sources[:i], sources[i+1:]...)
+		return in.saveSources(sources)
+	}
+
+	// Not a source: treat as a topic slug
+	for _, meta := range in.loader.ListAll() {
+		if meta.Slug != id {
+			continue
+		}
+		if err := in.loader.RemoveTopic(id); err != nil {
+			return err
+		}
+		for i := range sources {
+			sources[i].Topics = removeString(sources[i].Topics, id)
+		}
+		return in.saveSources(sources)
+	}
+
+	return fmt.Errorf("no source or topic named %q", id)
+}
+
+// Refresh re-ingests one source, or every source when id is empty,
+// regardless of whether it is due.
+func (in *Ingester) Refresh(ctx context.Context, id string) error {
+	unlock, err := in.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	sources, err := in.loadSources()
+	if err != nil {
+		return err
+	}
+
+	found := false
+	var errs []string
+	for i := range sources {
+		if id != "" && sources[i].ID != id {
+			continue
+		}
+		found = true
+		if err := in.ingest(ctx, &sources[i], false); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", sources[i].ID, err))
+		}
+	}
+	if id != "" && !found {
+		return fmt.Errorf("source %q not found", id)
+	}
+	if err := in.saveSources(sources); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("refresh failed: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// RefreshDue re-ingests sources whose refresh interval has elapsed and
+// returns how many were refreshed.
+func (in *Ingester) RefreshDue(ctx context.Context) int {
+	unlock, err := in.lock()
+	if err != nil {
+		logger.WarnCF("knowledge", "Sources busy, refresh skipped", map[string]interface{}{"error": err.Error()})
+		return 0
+	}
+	defer unlock()
+
+	sources, err := in.loadSources()
+	if err != nil {
+		logger.WarnCF("knowledge", "Failed to load sources", map[string]interface{}{"error": err.Error()})
+		return 0
+	}
+
+	now := time.Now()
+	refreshed := 0
+	for i := range sources {
+		src := &sources[i]
+		if src.RefreshHours <= 0 {
+			continue
+		}
+		if last, err := time.Parse(time.RFC3339, src.LastFetched); err == nil &&
+			now.Sub(last) < time.Duration(src.RefreshHours)*time.Hour {
+			continue
+		}
+		if err := in.ingest(ctx, src, false); err != nil {
+			logger.WarnCF("knowledge", "Source refresh failed",
+				map[string]interface{}{"source": src.ID, "error": err.Error()})
+			continue
+		}
+		refreshed++
+	}
+
+	if err := in.saveSources(sources); err != nil {
+		logger.WarnCF("knowledge", "Failed to save sources", map[string]interface{}{"error": err.Error()})
+	}
+	return refreshed
+}
+
+// ProcessInbox ingests every supported file dropped into the inbox and moves
+// it to files/. Returns the number of files ingested.
+func (in *Ingester) ProcessInbox(ctx context.Context) int {
+	entries, err := os.ReadDir(in.inboxDir)
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if !supportedFile(entry.Name()) {
+			logger.WarnCF("knowledge", "Unsupported inbox file, skipping",
+				map[string]interface{}{"file": entry.Name()})
+			continue
+		}
+
+		if err := os.MkdirAll(in.filesDir, 0755); err != nil {
+			return count
+		}
+		// The original stays in the inbox until it is ingested, so a
+		// failed file is retried on the next pass.
+		inboxPath := filepath.Join(in.inboxDir, entry.Name())
+		dest := uniquePath(filepath.Join(in.filesDir, entry.Name()))
+		if err := copyFile(inboxPath, dest); err != nil {
+			logger.WarnCF("knowledge", "Failed to copy inbox file",
+				map[string]interface{}{"file": entry.Name(), "error": err.Error()})
+			continue
+		}
+
+		src, err := in.Add(ctx, dest, AddOptions{})
+		if err != nil {
+			os.Remove(dest)
+			logger.WarnCF("knowledge", "Inbox ingestion failed",
+				map[string]interface{}{"file": entry.Name(), "error": err.Error()})
+			continue
+		}
+		os.Remove(inboxPath)
+		logger.InfoCF("knowledge", "Inbox file ingested",
+			map[string]interface{}{"file": entry.Name(), "source": src.ID, "topics": len(src.Topics)})
+		count++
+	}
+	return count
+}
+
+// ingest fetches a source and rewrites its topics. Unchanged content is
+// skipped unless force is set. On failure no topics are left behind that
+// src doesn't record. Caller must hold the lock.
+func (in *Ingester) ingest(ctx context.Context, src *Source, force bool) error {
+	var docs []document
+	var err error
+
+	switch src.Kind {
+	case SourceFeed:
+		docs, err = in.fetchFeed(ctx, src)
+	case SourceURL:
+		var doc document
+		doc, err = in.fetchURL(ctx, src.Location)
+		docs = []document{doc}
+	case SourceFile:
+		var doc document
+		doc, err = readFileDocument(ctx, src.Location)
+		docs = []document{doc}
+	default:
+		err = fmt.Errorf("unknown source kind %q", src.Kind)
+	}
+
+	src.LastFetched = Now()
+	if err != nil {
+		src.Error = err.Error()
+		return err
+	}
+	src.Error = ""
+
+	if src.Title == "" && len(docs) > 0 {
+		src.Title = docs[0].title
+		if src.Kind == SourceFeed && docs[0].feedTitle != "" {
+			src.Title = docs[0].feedTitle
+		}
+	}
+
+	h := sha256.New()
+	for _, d := range docs {
+		h.Write([]byte(d.title))
+		h.Write([]byte(d.text))
+	}
+	checksum := hex.EncodeToString(h.Sum(nil))
+	if !force && checksum == src.Checksum {
+		return nil
+	}
+
+	var slugs []string
+	if src.Kind == SourceFeed {
+		slugs, err = in.writeFeedTopics(src, docs)
+	} else {
+		slugs, err = in.writeDocumentTopics(src, docs[0])
+	}
+	if err != nil {
+		for _, slug := range slugs {
+			if !containsString(src.Topics, slug) {
+				in.loader.RemoveTopic(slug)
+			}
+		}
+		return err
+	}
+
+	// Drop topics that no longer exist (fewer chunks, expired feed entries)
+	for _, old := range src.Topics {
+		if !containsString(slugs, old) {
+			in.loader.RemoveTopic(old)
+		}
+	}
+	src.Topics = slugs
+	src.Checksum = checksum
+
+	in.loader.RefreshIndex()
+	return nil
+}
+
+// writeDocumentTopics splits a document into chunks, one topic each. On
+// error it still returns the slugs written so far.
+func (in *Ingester) writeDocumentTopics(src *Source, doc document) ([]string, error) {
+	chunks := chunkText(doc.text, chunkChars)
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("no text extracted from %s", src.Location)
+	}
+
+	title := src.Title
+	if title == "" {
+		title = doc.title
+	}
+
+	slugs := make([]string, 0, len(chunks))
+	for i, chunk := range chunks {
+		slug := src.ID
+		chunkTitle := title
+		if len(chunks) > 1 {
+			slug = fmt.Sprintf("%s-%d", src.ID, i+1)
+			chunkTitle = fmt.Sprintf("%s (%d/%d)", title, i+1, len(chunks))
+		}
+		body := fmt.Sprintf("# %s\n\nSource: %s\n\n%s\n", chunkTitle, src.Location, chunk)
+		if err := in.writeTopic(slug, chunkTitle, src, extractKeywords(title, chunk, 10), body); err != nil {
+			return slugs, err
+		}
+		slugs = append(slugs, slug)
+	}
+	return slugs, nil
+}
+
+// writeFeedTopics stores the newest feed entries, one topic each. On error
+// it still returns the slugs written so far.
+func (in *Ingester) writeFeedTopics(src *Source, docs []document) ([]string, error) {
+	if len(docs) > maxFeedItems {
+		docs = docs[:maxFeedItems]
+	}
+
+	slugs := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		itemSlug := slugify(doc.title)
+		if len(itemSlug) > 50 {
+			itemSlug = strings.Trim(itemSlug[:50], "-")
+		}
+		if itemSlug == "" {
+			// Titles in non-Latin scripts slugify to nothing
+			sum := sha256.Sum256([]byte(doc.link + "\n" + doc.title + "\n" + doc.text))
+			itemSlug = hex.EncodeToString(sum[:])[:12]
+		}
+		slug := src.ID + "-" + itemSlug
+		if containsString(slugs, slug) {
+			continue
+		}
+
+		text := doc.text
+		if runes := []rune(text); len(runes) > chunkChars {
+			text = string(runes[:chunkChars]) + "\n[...truncated]"
+		}
+		body := fmt.Sprintf("# %s\n\nFeed: %s\nLink: %s\n", doc.title, src.Title, doc.link)
+		if doc.published != "" {
+			body += "Published: " + doc.published + "\n"
+		}
+		body += "\n" + text + "\n"
+
+		if err := in.writeTopic(slug, doc.title, src, extractKeywords(doc.title, doc.text, 10), body); err != nil {
+			return slugs, err
+		}
+		slugs = append(slugs, slug)
+	}
+	return slugs, nil
+}
+
+// writeTopic writes KNOWLEDGE.md and META.json, bumping the version of an
+// existing topic. Topics that belong to another source, or were researched,
+// are never overwritten.
+func (in *Ingester) writeTopic(slug, title string, src *Source, keywords []string, body string) error {
+	meta := KnowledgeMeta{
+		Slug:        slug,
+		Title:       title,
+		Description: fmt.Sprintf("Ingested from %s", src.Location),
+		Keywords:    keywords,
+		Status:      "ready",
+		CreatedAt:   Now(),
+		UpdatedAt:   Now(),
+		Version:     1,
+		CharCount:   len(body),
+		AutoInject:  true,
+		Source:      src.ID,
+	}
+	for _, existing := range in.loader.ListAll() {
+		if existing.Slug == slug {
+			if existing.Source != src.ID {
+				return fmt.Errorf("topic %q already exists", slug)
+			}
+			meta.CreatedAt = existing.CreatedAt
+			meta.Version = existing.Version + 1
+			break
+		}
+	}
+
+	if err := in.loader.SaveMeta(meta); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(in.loader.GetBaseDir(), slug, "KNOWLEDGE.md"), []byte(body), 0644)
+}
+
+// lock serializes changes to the sources, across processes too: the gateway
+// and CLI commands each have their own Ingester. The loader's index is
+// reread, as the other process may have changed topics.
+func (in *Ingester) lock() (func(), error) {
+	in.mu.Lock()
+	deadline := time.Now().Add(lockWait)
+	for {
+		f, err := os.OpenFile(in.lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			break
+		}
+		if !os.IsExist(err) {
+			in.mu.Unlock()
+			return nil, err
+		}
+		if info, statErr := os.Stat(in.lockPath); statErr == nil && time.Since(info.ModTime()) > lockStale {
+			logger.WarnCF("knowledge", "Taking over stale sources lock", map[string]interface{}{"path": in.lockPath})
+			os.Remove(in.lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			in.mu.Unlock()
+			return nil, fmt.Errorf("knowledge sources are locked by another process (%s)", in.lockPath)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	in.loader.RefreshIndex()
+	return func() {
+		os.Remove(in.lockPath)
+		in.mu.Unlock()
+	}, nil
+}
+
+func (in *Ingester) loadSources() ([]Source, error) {
+	data, err := os.ReadFile(in.sourcesPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var sources []Source
+	if err := json.Unmarshal(data, &sources); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", filepath.Base(in.sourcesPath), err)
+	}
+	return sources, nil
+}
+
+func (in *Ingester) saveSources(sources []Source) error {
+	if sources == nil {
+		sources = []Source{}
+	}
+	data, err := json.MarshalIndent(sources, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := in.sourcesPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, in.sourcesPath)
+}
+
+// document is extracted text plus whatever metadata the format offered.
+type document struct {
+	title     string
+	text      string
+	link      string
+	published string
+	feedTitle string
+}
+
+func (in *Ingester) get(ctx context.Context, rawURL string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", "picoclaw-knowledge/1.0")
+
+	resp, err := in.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("GET %s: status %d", rawURL, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchBytes))
+	if err != nil {
+		return nil, "", err
+	}
+	return body, resp.Header.Get("Content-Type"), nil
+}
+
+func (in *Ingester) fetchURL(ctx context.Context, rawURL string) (document, error) {
+	body, contentType, err := in.get(ctx, rawURL)
+	if err != nil {
+		return document{}, err
+	}
+
+	switch {
+	case strings.Contains(contentType, "application/pdf") || bytes.HasPrefix(body, []byte("%PDF")):
+		tmp, err := os.CreateTemp("", "picoclaw-knowledge-*.pdf")
+		if err != nil {
+			return document{}, err
+		}
+		defer os.Remove(tmp.Name())
+		_, werr := tmp.Write(body)
+		tmp.Close()
+		if werr != nil {
+			return document{}, werr
+		}
+		text, err := pdfToText(ctx, tmp.Name())
+		return document{title: sourceBaseName(rawURL), text: text, link: rawURL}, err
+	case strings.Contains(contentType, "html") || looksLikeHTML(body):
+		title, text := htmlToText(string(body))
+		if title == "" {
+			title = sourceBaseName(rawURL)
+		}
+		return document{title: title, text: text, link: rawURL}, nil
+	default:
+		return document{title: sourceBaseName(rawURL), text: string(body), link: rawURL}, nil
+	}
+}
+
+func (in *Ingester) fetchFeed(ctx context.Context, src *Source) ([]document, error) {
+	body, _, err := in.get(ctx, src.Location)
+	if err != nil {
+		return nil, err
+	}
+	return parseFeed(body)
+}
+
+// rssFeed covers RSS 2.0; content:encoded is preferred over description.
+type rssFeed struct {
+	Channel struct {
+		Title string `xml:"title"`
+		Items []struct {
+			Title       string `xml:"title"`
+			Link        string `xml:"link"`
+			Description string `xml:"description"`
+			Content     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+			PubDate     string `xml:"pubDate"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+type atomFeed struct {
+	Title   string `xml:"title"`
+	Entries []struct {
+		Title string `xml:"title"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Summary string `xml:"summary"`
+		Content string `xml:"content"`
+		Updated string `xml:"updated"`
+	} `xml:"entry"`
+}
+
+// parseFeed parses an RSS 2.0 or Atom document into one document per entry.
+func parseFeed(data []byte) ([]document, error) {
+	var root struct {
+		XMLName xml.Name
+	}
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("invalid feed: %w", err)
+	}
+
+	var docs []document
+	switch root.XMLName.Local {
+	case "rss":
+		var feed rssFeed
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			return nil, fmt.Errorf("invalid RSS feed: %w", err)
+		}
+		for _, item := range feed.Channel.Items {
+			content := item.Content
+			if content == "" {
+				content = item.Description
+			}
+			_, text := htmlToText(content)
+			docs = append(docs, document{
+				title:     strings.TrimSpace(item.Title),
+				text:      text,
+				link:      strings.TrimSpace(item.Link),
+				published: strings.TrimSpace(item.PubDate),
+				feedTitle: strings.TrimSpace(feed.Channel.Title),
+			})
+		}
+	case "feed":
+		var feed atomFeed
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			return nil, fmt.Errorf("invalid Atom feed: %w", err)
+		}
+		for _, entry := range feed.Entries {
+			content := entry.Content
+			if content == "" {
+				content = entry.Summary
+			}
+			link := ""
+			for _, l := range entry.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					link = l.Href
+					break
+				}
+			}
+			_, text := htmlToText(content)
+			docs = append(docs, document{
+				title:     strings.TrimSpace(entry.Title),
+				text:      text,
+				link:      link,
+				published: strings.TrimSpace(entry.Updated),
+				feedTitle: strings.TrimSpace(feed.Title),
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported feed format <%s>", root.XMLName.Local)
+	}
+	return docs, nil
+}
+
+// readFileDocument extracts text from a Markdown, plain-text, HTML or PDF file.
+func readFileDocument(ctx context.Context, path string) (document, error) {
+	title := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	ext := strings.ToLower(filepath.Ext(path))
+
+	if ext == ".pdf" {
+		text, err := pdfToText(ctx, path)
+		return document{title: title, text: text}, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return document{}, err
+	}
+
+	switch ext {
+	case ".html", ".htm":
+		htmlTitle, text := htmlToText(string(data))
+		if htmlTitle != "" {
+			title = htmlTitle
+		}
+		return document{title: title, text: text}, nil
+	default:
+		text := string(data)
+		// Use the first Markdown heading as the title when present
+		for _, line := range strings.SplitN(text, "\n", 20) {
+			if h, ok := strings.CutPrefix(strings.TrimSpace(line), "# "); ok {
+				title = strings.TrimSpace(h)
+				break
+			}
+		}
+		return document{title: title, text: text}, nil
+	}
+}
+
+// pdfToText shells out to poppler's pdftotext.
+func pdfToText(ctx context.Context, path string) (string, error) {
+	if _, err := exec.LookPath("pdftotext"); err != nil {
+		return "", fmt.Errorf("PDF ingestion requires pdftotext (poppler-utils)")
+	}
+	out, err := exec.CommandContext(ctx, "pdftotext", "-layout", "-enc", "UTF-8", path, "-").Output()
+	if err != nil {
+		return "", fmt.Errorf("pdftotext: %w", err)
+	}
+	return string(out), nil
+}
+
+var (
+	reHTMLTitle  = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	reHTMLDrop   = regexp.MustCompile(`(?is)<(script|style|noscript|nav|footer|header)[^>]*>.*?</(script|style|noscript|nav|footer|header)>`)
+	reHTMLBreak  = regexp.MustCompile(`(?i)<(br|/p|/div|/li|/h[1-6]|/tr|/section|/article)[^>]*>`)
+	reHTMLTag    = regexp.MustCompile(`<[^>]+>`)
+	reBlankLines = regexp.MustCompile(`\n{3,}`)
+	reSpaces     = regexp.MustCompile(`[ \t]+`)
+)
+
+// htmlToText returns the page title and readable text, keeping paragraph
+// breaks so chunking can split on them.
+func htmlToText(s string) (string, string) {
+	title := ""
+	if m := reHTMLTitle.FindStringSubmatch(s); m != nil {
+		title = strings.TrimSpace(html.UnescapeString(m[1]))
+	}
+
+	s = reHTMLDrop.ReplaceAllString(s, "")
+	s = reHTMLBreak.ReplaceAllString(s, "\n\n")
+	s = reHTMLTag.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	s = reSpaces.ReplaceAllString(s, " ")
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	s = reBlankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return title, strings.TrimSpace(s)
+}
+
+// chunkText splits text on paragraph boundaries into chunks of about maxChars.
+// Paragraphs longer than maxChars are hard-split.
+func chunkText(text string, maxChars int) []string {
+	var chunks []string
+	var current strings.Builder
+
+	flush := func() {
+		if c := strings.TrimSpace(current.String()); c != "" {
+			chunks = append(chunks, c)
+		}
+		current.Reset()
+	}
+
+	for _, para := range strings.Split(text, "\n\n") {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+		for len(para) > maxChars {
+			flush()
+			cut := strings.LastIndexAny(para[:maxChars], " \n")
+			if cut <= 0 {
+				cut = maxChars
+			}
+			chunks = append(chunks, strings.TrimSpace(para[:cut]))
+			para = strings.TrimSpace(para[cut:])
+		}
+		if current.Len()+len(para)+2 > maxChars {
+			flush()
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n\n")
+		}
+		current.WriteString(para)
+	}
+	flush()
+	return chunks
+}
+
+var keywordStopWords = map[string]bool{
+	// English
+	"the": true, "and": true, "for": true, "with": true, "that": true, "this": true,
+	"from": true, "are": true, "was": true, "were": true, "have": true, "has": true,
+	"not": true, "but": true, "you": true, "your": true, "can": true, "will": true,
+	"their": true, "there": true, "which": true, "about": true, "into": true, "more": true,
+	"also": true, "when": true, "what": true, "they": true, "them": true, "than": true,
+	"then": true, "these": true, "those": true, "other": true, "some": true, "such": true,
+	"only": true, "its": true, "been": true, "would": true, "could": true, "should": true,
+	// Spanish
+	"los": true, "las": true, "del": true, "una": true, "por": true, "con": true,
+	"para": true, "como": true, "más": true, "pero": true, "sus": true, "que": true,
+	"sobre": true, "este": true, "esta": true, "entre": true, "cuando": true, "muy": true,
+	"sin": true, "también": true, "fue": true, "han": true, "son": true, "desde": true,
+	"todo": true, "todos": true, "puede": true, "donde": true, "hay": true, "porque": true,
+}
+
+// extractKeywords picks title words first, then the most frequent content words.
+func extractKeywords(title, text string, max int) []string {
+	var keywords []string
+	seen := make(map[string]bool)
+
+	add := func(w string) {
+		if !seen[w] && len(keywords) < max {
+			seen[w] = true
+			keywords = append(keywords, w)
+		}
+	}
+
+	for _, w := range keywordTokens(title) {
+		if len(w) >= 3 {
+			add(w)
+		}
+	}
+
+	freq := make(map[string]int)
+	for _, w := range keywordTokens(text) {
+		if len(w) >= 4 {
+			freq[w]++
+		}
+	}
+	words := make([]string, 0, len(freq))
+	for w := range freq {
+		words = append(words, w)
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if freq[words[i]] != freq[words[j]] {
+			return freq[words[i]] > freq[words[j]]
+		}
+		return words[i] < words[j]
+	})
+	for _, w := range words {
+		if freq[w] < 2 {
+			break
+		}
+		add(w)
+	}
+	return keywords
+}
+
+func keywordTokens(s string) []string {
+	var tokens []string
+	for _, w := range strings.Fields(strings.ToLower(s)) {
+		w = strings.Trim(w, ".,!?¿¡;:\"'()[]{}…*#`_-/|<>=")
+		if w == "" || keywordStopWords[w] || strings.ContainsAny(w, "0123456789") {
+			continue
+		}
+		tokens = append(tokens, w)
+	}
+	return tokens
+}
+
+var reNonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify converts a title to a directory-safe slug.
+func slugify(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.NewReplacer(
+		"á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u",
+		"ñ", "n", "ü", "u",
+	).Replace(s)
+	return strings.Trim(reNonSlug.ReplaceAllString(s, "-"), "-")
+}
+
+// uniqueID returns base, or base-2, base-3... if already taken by a source,
+// an existing topic or one of the ingester's directories.
+func uniqueID(base string, sources []Source, topics []KnowledgeMeta) string {
+	if base == "" {
+		base = "source"
+	}
+	taken := make(map[string]bool, len(sources)+len(topics)+len(reservedSlugs))
+	for slug := range reservedSlugs {
+		taken[slug] = true
+	}
+	for _, s := range sources {
+		taken[s.ID] = true
+	}
+	for _, t := range topics {
+		taken[t.Slug] = true
+	}
+	id := base
+	for i := 2; taken[id]; i++ {
+		id = fmt.Sprintf("%s-%d", base, i)
+	}
+	return id
+}
+
+// copyFile copies src to dst, removing a partial dst on failure.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+// uniquePath appends a counter to the file name until it does not exist.
+func uniquePath(path string) string {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return path
+	}
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s-%d%s", stem, i, ext)
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+func sourceBaseName(location string) string {
+	if u, err := url.Parse(location); err == nil && u.Host != "" {
+		name := strings.TrimSuffix(filepath.Base(u.Path), filepath.Ext(u.Path))
+		if name == "" || name == "." || name == "/" {
+			return u.Host
+		}
+		return u.Host + "-" + name
+	}
+	return strings.TrimSuffix(filepath.Base(location), filepath.Ext(location))
+}
+
+func supportedFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".md", ".markdown", ".txt", ".html", ".htm", ".pdf":
+		return true
+	}
+	return false
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+func looksLikeHTML(body []byte) bool {
+	head := strings.ToLower(string(body[:min(len(body), 512)]))
+	return strings.Contains(head, "<!doctype html") || strings.Contains(head, "<html")
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func removeString(list []string, s string) []string {
+	out := list[:0]
+	for _, v := range list {
+		if v != s {
+			out = append(out, v)
+		}
+	}
+	return out
+}
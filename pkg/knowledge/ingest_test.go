@@ -0,0 +1,236 @@
+package knowledge
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestIngester_ProcessInbox(t *testing.T) {
+	loader := NewLoader(t.TempDir())
+	in := NewIngester(loader, 24)
+
+	doc := "# Raspberry Pi Setup\n\nFlash the raspberry image, then configure raspberry networking.\n\nBoot the raspberry and enable ssh."
+	os.WriteFile(filepath.Join(in.InboxDir(), "pi-setup.md"), []byte(doc), 0644)
+
+	if n := in.ProcessInbox(context.Background()); n != 1 {
+		t.Fatalf("ProcessInbox = %d, want 1", n)
+	}
+	if entries, _ := os.ReadDir(in.InboxDir()); len(entries) != 0 {
+		t.Errorf("inbox not emptied: %d entries left", len(entries))
+	}
+
+	sources, err := in.ListSources()
+	if err != nil || len(sources) != 1 {
+		t.Fatalf("ListSources = %v, %v; want 1 source", sources, err)
+	}
+	src := sources[0]
+	if src.Kind != SourceFile || src.Title != "Raspberry Pi Setup" || len(src.Topics) != 1 {
+		t.Errorf("unexpected source: %+v", src)
+	}
+
+	results := loader.FindRelevant("how do I setup my raspberry", 2)
+	if len(results) != 1 || results[0].Source != src.ID {
+		t.Fatalf("FindRelevant = %+v, want the ingested topic", results)
+	}
+
+	if err := in.Remove(src.ID); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if got := len(loader.ListAll()); got != 0 {
+		t.Errorf("topics after remove = %d, want 0", got)
+	}
+}
+
+func TestIngester_KeepsOtherTopics(t *testing.T) {
+	loader := NewLoader(t.TempDir())
+	in := NewIngester(loader, 24)
+	loader.SaveMeta(KnowledgeMeta{Slug: "docker", Title: "Docker", Status: "ready", Version: 3})
+	loader.RefreshIndex()
+
+	dir := t.TempDir()
+	for _, name := range []string{"docker.md", "files.md"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("# Notes\n\nContainers and images."), 0644)
+	}
+
+	src, err := in.Add(context.Background(), filepath.Join(dir, "docker.md"), AddOptions{})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if src.ID == "docker" {
+		t.Fatal("source took the researched topic's slug")
+	}
+	if meta, _ := loader.GetMeta("docker"); meta.Version != 3 || meta.Source != "" {
+		t.Errorf("researched topic changed: %+v", meta)
+	}
+	if err := in.Remove(src.ID); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, ok := loader.GetMeta("docker"); !ok {
+		t.Error("removing the source deleted the researched topic")
+	}
+
+	src, err = in.Add(context.Background(), filepath.Join(dir, "files.md"), AddOptions{})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if src.ID == "files" || src.ID == "inbox" {
+		t.Errorf("source ID %q is one of the ingester's directories", src.ID)
+	}
+}
+
+func TestIngester_ProcessInboxKeepsFailedFiles(t *testing.T) {
+	loader := NewLoader(t.TempDir())
+	in := NewIngester(loader, 24)
+	os.WriteFile(filepath.Join(in.InboxDir(), "empty.md"), nil, 0644)
+
+	if n := in.ProcessInbox(context.Background()); n != 0 {
+		t.Fatalf("ProcessInbox = %d, want 0", n)
+	}
+	if _, err := os.Stat(filepath.Join(in.InboxDir(), "empty.md")); err != nil {
+		t.Errorf("failed file left the inbox: %v", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(loader.GetBaseDir(), "files")); len(entries) != 0 {
+		t.Errorf("failed file stored in files/: %d entries", len(entries))
+	}
+}
+
+func TestIngester_Feed(t *testing.T) {
+	feed := `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Garden News</title>
+<item><title>Tomato pruning</title><link>https://example.com/a</link><description>&lt;p&gt;Prune tomato suckers weekly.&lt;/p&gt;</description></item>
+<item><title>Composting basics</title><link>https://example.com/b</link><description>Compost needs greens and browns.</description></item>
+</channel></rss>`
+	var body = feed
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	loader := NewLoader(t.TempDir())
+	in := NewIngester(loader, 24)
+
+	src, err := in.Add(context.Background(), srv.URL+"/feed.xml", AddOptions{Feed: true})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if src.Title != "Garden News" || len(src.Topics) != 2 {
+		t.Fatalf("unexpected source: %+v", src)
+	}
+
+	content, err := loader.LoadContent(src.Topics[0])
+	if err != nil || !strings.Contains(content, "Prune tomato suckers weekly.") || strings.Contains(content, "<p>") {
+		t.Errorf("unexpected topic content: %q (%v)", content, err)
+	}
+
+	// Dropped entries are removed on refresh
+	body = strings.Replace(feed, `<item><title>Composting basics</title><link>https://example.com/b</link><description>Compost needs greens and browns.</description></item>`, "", 1)
+	if err := in.Refresh(context.Background(), src.ID); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if got := len(loader.ListAll()); got != 1 {
+		t.Errorf("topics after refresh = %d, want 1", got)
+	}
+}
+
+func TestIngester_FeedNonLatin(t *testing.T) {
+	long := strings.Repeat("é", chunkChars+10)
+	feed := `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Garden News</title>
+<item><title>Томаты</title><link>https://example.com/a</link><description>` + long + `</description></item>
+</channel></rss>`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(feed))
+	}))
+	defer srv.Close()
+
+	loader := NewLoader(t.TempDir())
+	in := NewIngester(loader, 24)
+
+	src, err := in.Add(context.Background(), srv.URL+"/feed.xml", AddOptions{Feed: true})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if len(src.Topics) != 1 {
+		t.Fatalf("topics = %v, want the non-Latin item", src.Topics)
+	}
+	content, err := loader.LoadContent(src.Topics[0])
+	if err != nil || !utf8.ValidString(content) || !strings.Contains(content, "[...truncated]") {
+		t.Errorf("item not truncated on a rune boundary: valid=%v (%v)", utf8.ValidString(content), err)
+	}
+}
+
+func TestIngester_FailedAddLeavesNoTopics(t *testing.T) {
+	feed := `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Garden News</title>
+<item><title>Tomato pruning</title><link>https://example.com/a</link><description>Prune weekly.</description></item>
+<item><title>Composting basics</title><link>https://example.com/b</link><description>Greens and browns.</description></item>
+</channel></rss>`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(feed))
+	}))
+	defer srv.Close()
+
+	loader := NewLoader(t.TempDir())
+	in := NewIngester(loader, 24)
+	// The second item collides with a topic of another source
+	loader.SaveMeta(KnowledgeMeta{Slug: "garden-news-composting-basics", Title: "Compost", Status: "ready", Version: 1})
+	loader.RefreshIndex()
+
+	if _, err := in.Add(context.Background(), srv.URL+"/feed.xml", AddOptions{Feed: true, Title: "Garden News"}); err == nil {
+		t.Fatal("Add succeeded despite the collision")
+	}
+	topics := loader.ListAll()
+	if len(topics) != 1 || topics[0].Slug != "garden-news-composting-basics" {
+		t.Errorf("topics after failed add = %+v, want only the existing one", topics)
+	}
+}
+
+func TestIngester_LockAcrossIngesters(t *testing.T) {
+	dir := t.TempDir()
+	gateway := NewIngester(NewLoader(dir), 24)
+	cli := NewIngester(NewLoader(dir), 24)
+
+	unlock, err := gateway.lock()
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		cli.ListSources()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("second ingester did not wait for the lock")
+	case <-time.After(300 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("second ingester still blocked after unlock")
+	}
+}
+
+func TestChunkText(t *testing.T) {
+	para := strings.Repeat("word ", 100)
+	text := strings.Join([]string{para, para, para}, "\n\n")
+
+	chunks := chunkText(text, 1100)
+	if len(chunks) != 2 {
+		t.Fatalf("chunks = %d, want 2", len(chunks))
+	}
+	for _, c := range chunks {
+		if len(c) > 1100 {
+			t.Errorf("chunk exceeds limit: %d chars", len(c))
+		}
+	}
+}
@@ -2,6 +2,7 @@ package knowledge
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
@@ -24,6 +25,22 @@ type KnowledgeMeta struct {
 	Version     int      `json:"version"`
 	CharCount   int      `json:"char_count"`
 	AutoInject  bool     `json:"auto_inject"`
+	Source      string   `json:"source,omitempty"` // ID of the ingested Source this topic came from
+	TTLHours    int      `json:"ttl_hours,omitempty"` // researched topics go stale this long after UpdatedAt (0 = never)
+	Channel     string   `json:"channel,omitempty"`   // where to notify about refreshes
+	ChatID      string   `json:"chat_id,omitempty"`
+}
+
+// IsExpired reports whether the topic's TTL has elapsed since its last update.
+func (m KnowledgeMeta) IsExpired(now time.Time) bool {
+	if m.TTLHours <= 0 {
+		return false
+	}
+	updated, err := time.Parse(time.RFC3339, m.UpdatedAt)
+	if err != nil {
+		return false
+	}
+	return now.Sub(updated) >= time.Duration(m.TTLHours)*time.Hour
 }
 
 // Loader manages knowledge topics stored in workspace/knowledge/.
@@ -107,7 +124,8 @@ func (l *Loader) FindRelevant(message string, maxResults int) []KnowledgeMeta {
 
 	var scored []scoredTopic
 	for _, meta := range l.index {
-		if meta.Status != "ready" || !meta.AutoInject {
+		// Stale topics are still better than nothing until they are refreshed
+		if (meta.Status != "ready" && meta.Status != "stale") || !meta.AutoInject {
 			continue
 		}
 		score := 0
@@ -223,6 +241,72 @@ func (l *Loader) SaveMeta(meta KnowledgeMeta) error {
 	return os.Rename(tmpPath, metaPath)
 }
 
+// MarkStale flags researched topics whose TTL has expired as "stale" and
+// returns every stale researched topic, including ones marked earlier.
+// Ingested topics are skipped; the Ingester keeps those fresh.
+func (l *Loader) MarkStale(now time.Time) []KnowledgeMeta {
+	l.mu.Lock()
+	var stale []KnowledgeMeta
+	var changed []KnowledgeMeta
+	for i := range l.index {
+		meta := &l.index[i]
+		if meta.Source != "" {
+			continue
+		}
+		if meta.Status == "ready" && meta.IsExpired(now) {
+			meta.Status = "stale"
+			changed = append(changed, *meta)
+		}
+		if meta.Status == "stale" {
+			stale = append(stale, *meta)
+		}
+	}
+	l.mu.Unlock()
+
+	for _, meta := range changed {
+		if err := l.SaveMeta(meta); err != nil {
+			logger.WarnCF("knowledge", "Failed to mark topic stale",
+				map[string]interface{}{"slug": meta.Slug, "error": err.Error()})
+			continue
+		}
+		logger.InfoCF("knowledge", "Topic marked stale",
+			map[string]interface{}{"slug": meta.Slug, "updated_at": meta.UpdatedAt, "ttl_hours": meta.TTLHours})
+	}
+	return stale
+}
+
+// GetMeta returns the indexed metadata for a topic.
+func (l *Loader) GetMeta(slug string) (KnowledgeMeta, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, meta := range l.index {
+		if meta.Slug == slug {
+			return meta, true
+		}
+	}
+	return KnowledgeMeta{}, false
+}
+
+// RemoveTopic deletes a topic directory and drops it from the index.
+func (l *Loader) RemoveTopic(slug string) error {
+	if slug == "" || slug == "." || strings.ContainsAny(slug, `/\`) {
+		return fmt.Errorf("invalid topic slug: %q", slug)
+	}
+	if err := os.RemoveAll(filepath.Join(l.baseDir, slug)); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, meta := range l.index {
+		if meta.Slug == slug {
+			l.index = append(l.index[:i], l.index[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
 // GetBaseDir returns the base directory for knowledge topics.
 func (l *Loader) GetBaseDir() string {
 	return l.baseDir
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func setupTestKnowledge(t *testing.T) (*Loader, string) {
@@ -149,3 +150,52 @@ func containsStr(s, substr string) bool {
 	}
 	return false
 }
+
+func TestMarkStale(t *testing.T) {
+	loader, _ := setupTestKnowledge(t)
+
+	meta, _ := loader.GetMeta("historia-antigua")
+	meta.TTLHours = 24
+	meta.UpdatedAt = time.Now().Add(-48 * time.Hour).Format(time.RFC3339)
+	loader.SaveMeta(meta)
+	loader.RefreshIndex()
+
+	stale := loader.MarkStale(time.Now())
+	if len(stale) != 1 || stale[0].Slug != "historia-antigua" {
+		t.Fatalf("expected historia-antigua to be stale, got %+v", stale)
+	}
+
+	// The new status must be persisted and stale topics still injected
+	loader.RefreshIndex()
+	meta, _ = loader.GetMeta("historia-antigua")
+	if meta.Status != "stale" {
+		t.Errorf("expected persisted status stale, got %q", meta.Status)
+	}
+	if len(loader.FindRelevant("historia de roma antigua", 2)) != 1 {
+		t.Error("stale topic should still be relevant")
+	}
+}
+
+func TestMarkStale_NoTTL(t *testing.T) {
+	loader, _ := setupTestKnowledge(t)
+	if stale := loader.MarkStale(time.Now().Add(10000 * time.Hour)); len(stale) != 0 {
+		t.Errorf("topics without TTL should never go stale, got %d", len(stale))
+	}
+}
+
+func TestDiffContent(t *testing.T) {
+	old := "# Precios\n\nBTC: 60000\nETH: 3000\n"
+	same := "# Precios\n\n  BTC: 60000\nETH: 3000\n\n"
+	if d := DiffContent(old, same); len(d.Added) != 0 || len(d.Removed) != 0 || d.IsMaterial() {
+		t.Errorf("whitespace-only change should be empty, got %+v", d)
+	}
+
+	changed := "# Precios\n\nBTC: 65000\nETH: 3000\n"
+	d := DiffContent(old, changed)
+	if len(d.Added) != 1 || d.Added[0] != "BTC: 65000" || len(d.Removed) != 1 {
+		t.Errorf("unexpected diff: %+v", d)
+	}
+	if !d.IsMaterial() {
+		t.Errorf("1 of 3 lines changed should be material, ratio=%.2f", d.ChangeRatio)
+	}
+}
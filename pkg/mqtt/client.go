@@ -0,0 +1,483 @@
+// Package mqtt is a minimal MQTT 3.1.1 client: connect, QoS 0 publish and
+// subscribe, retained messages and keep-alive. It is enough for talking to
+// Zigbee2MQTT, Tasmota and similar home-automation brokers.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Packet types (high nibble of the fixed header).
+const (
+	packetConnect     = 1
+	packetConnack     = 2
+	packetPublish     = 3
+	packetPuback      = 4
+	packetSubscribe   = 8
+	packetSuback      = 9
+	packetUnsubscribe = 10
+	packetUnsuback    = 11
+	packetPingreq     = 12
+	packetPingresp    = 13
+	packetDisconnect  = 14
+)
+
+// ErrClosed is returned by operations on a closed connection.
+var ErrClosed = errors.New("mqtt: connection closed")
+
+// Options configures a connection. Broker is a URL such as
+// tcp://host:1883 or mqtts://host:8883 (also ssl:// and tls://).
+type Options struct {
+	Broker    string
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration // default 60s
+	TLSConfig *tls.Config
+}
+
+// Message is a received PUBLISH.
+type Message struct {
+	Topic    string
+	Payload  []byte
+	Retained bool
+}
+
+// Handler is called from the connection's read loop for each message; it
+// must not block.
+type Handler func(Message)
+
+// Client is a single broker connection. It does not reconnect; callers
+// watch Done and dial again.
+type Client struct {
+	conn      net.Conn
+	keepAlive time.Duration
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  uint16
+	acks    map[uint16]chan []byte
+	handler Handler
+	err     error
+
+	done chan struct{}
+	once sync.Once
+}
+
+// Dial connects to the broker and completes the MQTT handshake. handler
+// receives messages for every subscription made on the client.
+func Dial(ctx context.Context, opts Options, handler Handler) (*Client, error) {
+	addr, useTLS, err := parseBroker(opts.Broker)
+	if err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("mqtt: dial %s: %w", addr, err)
+	}
+	if useTLS {
+		cfg := opts.TLSConfig
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		if cfg.ServerName == "" {
+			cfg = cfg.Clone()
+			cfg.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("mqtt: tls: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	keepAlive := opts.KeepAlive
+	if keepAlive <= 0 {
+		keepAlive = 60 * time.Second
+	}
+	c := &Client{
+		conn:      conn,
+		keepAlive: keepAlive,
+		acks:      make(map[uint16]chan []byte),
+		handler:   handler,
+		done:      make(chan struct{}),
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(30 * time.Second))
+	}
+	r := bufio.NewReader(conn)
+	if err := c.connect(r, opts); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	go c.readLoop(r)
+	go c.pingLoop()
+	return c, nil
+}
+
+func parseBroker(broker string) (addr string, useTLS bool, err error) {
+	if !strings.Contains(broker, "://") {
+		broker = "tcp://" + broker
+	}
+	u, err := url.Parse(broker)
+	if err != nil || u.Host == "" {
+		return "", false, fmt.Errorf("mqtt: invalid broker %q", broker)
+	}
+	port := "1883"
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "ssl", "tls", "mqtts":
+		useTLS = true
+		port = "8883"
+	default:
+		return "", false, fmt.Errorf("mqtt: unsupported scheme %q", u.Scheme)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return net.JoinHostPort(u.Hostname(), port), useTLS, nil
+}
+
+func (c *Client) connect(r *bufio.Reader, opts Options) error {
+	var flags byte = 0x02 // clean session
+	if opts.Username != "" {
+		flags |= 0x80
+		if opts.Password != "" {
+			flags |= 0x40
+		}
+	}
+
+	var body []byte
+	body = appendString(body, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(c.keepAlive/time.Second))
+	body = appendString(body, opts.ClientID)
+	if opts.Username != "" {
+		body = appendString(body, opts.Username)
+		if opts.Password != "" {
+			body = appendString(body, opts.Password)
+		}
+	}
+	if err := c.writePacket(packetConnect<<4, body); err != nil {
+		return err
+	}
+
+	header, payload, err := readPacket(r)
+	if err != nil {
+		return fmt.Errorf("mqtt: connack: %w", err)
+	}
+	if header>>4 != packetConnack || len(payload) < 2 {
+		return fmt.Errorf("mqtt: expected CONNACK, got packet type %d", header>>4)
+	}
+	if code := payload[1]; code != 0 {
+		return fmt.Errorf("mqtt: connection refused: %s", connackReason(code))
+	}
+	return nil
+}
+
+func connackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("code %d", code)
+}
+
+// Publish sends a QoS 0 message.
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	if topic == "" || strings.ContainsAny(topic, "+#") {
+		return fmt.Errorf("mqtt: invalid publish topic %q", topic)
+	}
+	var header byte = packetPublish << 4
+	if retain {
+		header |= 0x01
+	}
+	body := appendString(nil, topic)
+	body = append(body, payload...)
+	return c.writePacket(header, body)
+}
+
+// Subscribe subscribes to topic filters at QoS 0 and waits for the SUBACK.
+func (c *Client) Subscribe(ctx context.Context, filters ...string) error {
+	id, ack := c.newAck()
+	body := binary.BigEndian.AppendUint16(nil, id)
+	for _, f := range filters {
+		body = appendString(body, f)
+		body = append(body, 0)
+	}
+	if err := c.writePacket(packetSubscribe<<4|0x02, body); err != nil {
+		return err
+	}
+	codes, err := c.waitAck(ctx, id, ack)
+	if err != nil {
+		return err
+	}
+	for i, code := range codes {
+		if code == 0x80 && i < len(filters) {
+			return fmt.Errorf("mqtt: subscription to %q refused", filters[i])
+		}
+	}
+	return nil
+}
+
+// Unsubscribe removes subscriptions and waits for the UNSUBACK.
+func (c *Client) Unsubscribe(ctx context.Context, filters ...string) error {
+	id, ack := c.newAck()
+	body := binary.BigEndian.AppendUint16(nil, id)
+	for _, f := range filters {
+		body = appendString(body, f)
+	}
+	if err := c.writePacket(packetUnsubscribe<<4|0x02, body); err != nil {
+		return err
+	}
+	_, err := c.waitAck(ctx, id, ack)
+	return err
+}
+
+// Done is closed when the connection is lost or closed.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err reports why the connection ended.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close sends DISCONNECT and closes the connection.
+func (c *Client) Close() error {
+	c.writePacket(packetDisconnect<<4, nil)
+	c.shutdown(ErrClosed)
+	return nil
+}
+
+func (c *Client) shutdown(err error) {
+	c.once.Do(func() {
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+		c.conn.Close()
+		close(c.done)
+	})
+}
+
+func (c *Client) newAck() (uint16, chan []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	ch := make(chan []byte, 1)
+	c.acks[c.nextID] = ch
+	return c.nextID, ch
+}
+
+func (c *Client) waitAck(ctx context.Context, id uint16, ack chan []byte) ([]byte, error) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.acks, id)
+		c.mu.Unlock()
+	}()
+	select {
+	case payload := <-ack:
+		return payload, nil
+	case <-c.done:
+		return nil, c.Err()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Client) readLoop(r *bufio.Reader) {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+		header, payload, err := readPacket(r)
+		if err != nil {
+			c.shutdown(err)
+			return
+		}
+		switch header >> 4 {
+		case packetPublish:
+			msg, id, err := parsePublish(header, payload)
+			if err != nil {
+				c.shutdown(err)
+				return
+			}
+			if header&0x06 != 0 {
+				c.writePacket(packetPuback<<4, binary.BigEndian.AppendUint16(nil, id))
+			}
+			if c.handler != nil {
+				c.handler(msg)
+			}
+		case packetSuback, packetUnsuback:
+			if len(payload) < 2 {
+				continue
+			}
+			id := binary.BigEndian.Uint16(payload)
+			c.mu.Lock()
+			ack := c.acks[id]
+			c.mu.Unlock()
+			if ack != nil {
+				ack <- payload[2:]
+			}
+		case packetPingresp, packetPuback:
+		}
+	}
+}
+
+func (c *Client) pingLoop() {
+	ticker := time.NewTicker(c.keepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.writePacket(packetPingreq<<4, nil); err != nil {
+				c.shutdown(err)
+				return
+			}
+		}
+	}
+}
+
+func parsePublish(header byte, payload []byte) (Message, uint16, error) {
+	topic, rest, err := readString(payload)
+	if err != nil {
+		return Message{}, 0, err
+	}
+	var id uint16
+	if header&0x06 != 0 {
+		if len(rest) < 2 {
+			return Message{}, 0, errors.New("mqtt: short PUBLISH")
+		}
+		id = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+	return Message{Topic: topic, Payload: rest, Retained: header&0x01 != 0}, id, nil
+}
+
+func (c *Client) writePacket(header byte, body []byte) error {
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+	packet := append([]byte{header}, encodeLength(len(body))...)
+	packet = append(packet, body...)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(packet)
+	return err
+}
+
+// readPacket reads one control packet: fixed header byte and body.
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, mult := 0, 1
+	for i := 0; ; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7f) * mult
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, errors.New("mqtt: malformed remaining length")
+		}
+		mult *= 128
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+func encodeLength(n int) []byte {
+	var out []byte
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if n == 0 {
+			return out
+		}
+	}
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errors.New("mqtt: short string")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errors.New("mqtt: short string")
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+// Match reports whether topic matches filter, honouring the + (one level)
+// and # (remaining levels) wildcards.
+func Match(filter, topic string) bool {
+	fl := strings.Split(filter, "/")
+	tl := strings.Split(topic, "/")
+	for i, f := range fl {
+		if f == "#" {
+			return true
+		}
+		if i >= len(tl) {
+			return false
+		}
+		if f != "+" && f != tl[i] {
+			return false
+		}
+	}
+	return len(fl) == len(tl)
+}
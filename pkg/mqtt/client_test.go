@@ -0,0 +1,89 @@
+package mqtt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/mqtt"
+	"github.com/sipeed/picoclaw/pkg/mqtt/mqtttest"
+)
+
+func TestPublishSubscribe(t *testing.T) {
+	broker := mqtttest.NewBroker()
+	defer broker.Close()
+	broker.Publish("zigbee2mqtt/kitchen", []byte(`{"state":"ON"}`), true)
+
+	got := make(chan mqtt.Message, 4)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := mqtt.Dial(ctx, mqtt.Options{Broker: broker.URL, ClientID: "test"}, func(m mqtt.Message) { got <- m })
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Subscribe(ctx, "zigbee2mqtt/+"); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if m := <-got; m.Topic != "zigbee2mqtt/kitchen" || !m.Retained || string(m.Payload) != `{"state":"ON"}` {
+		t.Errorf("unexpected retained message: %+v", m)
+	}
+
+	if err := client.Publish("zigbee2mqtt/hall", []byte("hello"), false); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	select {
+	case m := <-got:
+		if m.Topic != "zigbee2mqtt/hall" || string(m.Payload) != "hello" || m.Retained {
+			t.Errorf("unexpected message: %+v", m)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("published message not delivered")
+	}
+
+	if err := client.Publish("bad/+", nil, false); err == nil {
+		t.Error("wildcard publish topic accepted")
+	}
+}
+
+func TestDialAuth(t *testing.T) {
+	broker := mqtttest.NewBroker()
+	broker.Username, broker.Password = "ha", "secret"
+	defer broker.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := mqtt.Dial(ctx, mqtt.Options{Broker: broker.URL, Username: "ha", Password: "wrong"}, nil); err == nil {
+		t.Fatal("expected bad credentials to be refused")
+	}
+	client, err := mqtt.Dial(ctx, mqtt.Options{Broker: broker.URL, Username: "ha", Password: "secret"}, nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	client.Close()
+	select {
+	case <-client.Done():
+	case <-time.After(time.Second):
+		t.Error("Done not closed after Close")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, tc := range []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/+", "a/b", true},
+		{"a/+", "a/b/c", false},
+		{"a/#", "a/b/c", true},
+		{"a/#", "a", true},
+		{"#", "x/y", true},
+		{"a/+/c", "a/b/d", false},
+	} {
+		if got := mqtt.Match(tc.filter, tc.topic); got != tc.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tc.filter, tc.topic, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+// Package mqtttest provides an in-memory MQTT 3.1.1 broker for tests, in
+// the spirit of net/http/httptest. It supports QoS 0 publish/subscribe,
+// retained messages, wildcards and keep-alive pings.
+package mqtttest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/mqtt"
+)
+
+// Broker is a running test broker listening on a loopback port.
+type Broker struct {
+	// URL is the broker address in tcp://127.0.0.1:port form.
+	URL string
+
+	// Username and Password, when set, are required from clients.
+	Username string
+	Password string
+
+	ln       net.Listener
+	mu       sync.Mutex
+	sessions map[*session]bool
+	retained map[string][]byte
+	received []mqtt.Message
+	wg       sync.WaitGroup
+}
+
+type session struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+	filters map[string]bool
+}
+
+// NewBroker starts a broker. Call Close when done.
+func NewBroker() *Broker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("mqtttest: " + err.Error())
+	}
+	b := &Broker{
+		URL:      "tcp://" + ln.Addr().String(),
+		ln:       ln,
+		sessions: make(map[*session]bool),
+		retained: make(map[string][]byte),
+	}
+	b.wg.Add(1)
+	go b.accept()
+	return b
+}
+
+// Close stops the broker and drops all connections.
+func (b *Broker) Close() {
+	b.ln.Close()
+	b.mu.Lock()
+	for s := range b.sessions {
+		s.conn.Close()
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+}
+
+// Received returns every message published to the broker so far.
+func (b *Broker) Received() []mqtt.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]mqtt.Message(nil), b.received...)
+}
+
+// Retained returns the retained payload for topic, if any.
+func (b *Broker) Retained(topic string) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p, ok := b.retained[topic]
+	return p, ok
+}
+
+// Publish injects a message as if a device had published it.
+func (b *Broker) Publish(topic string, payload []byte, retain bool) {
+	b.route(mqtt.Message{Topic: topic, Payload: payload, Retained: retain})
+}
+
+func (b *Broker) accept() {
+	defer b.wg.Done()
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			b.serve(conn)
+		}()
+	}
+}
+
+func (b *Broker) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	s := &session{conn: conn, filters: make(map[string]bool)}
+
+	header, body, err := readPacket(r)
+	if err != nil || header>>4 != 1 {
+		return
+	}
+	if !b.checkAuth(body) {
+		s.write(0x20, []byte{0, 4})
+		return
+	}
+	s.write(0x20, []byte{0, 0})
+
+	b.mu.Lock()
+	b.sessions[s] = true
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.sessions, s)
+		b.mu.Unlock()
+	}()
+
+	for {
+		header, body, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		switch header >> 4 {
+		case 3: // PUBLISH
+			topic, rest, err := readString(body)
+			if err != nil {
+				return
+			}
+			if header&0x06 != 0 {
+				rest = rest[2:]
+			}
+			b.route(mqtt.Message{Topic: topic, Payload: append([]byte(nil), rest...), Retained: header&0x01 != 0})
+		case 8: // SUBSCRIBE
+			id, rest := body[:2], body[2:]
+			var codes []byte
+			var filters []string
+			for len(rest) > 0 {
+				f, next, err := readString(rest)
+				if err != nil || len(next) < 1 {
+					return
+				}
+				filters = append(filters, f)
+				codes = append(codes, 0)
+				rest = next[1:]
+			}
+			b.mu.Lock()
+			for _, f := range filters {
+				s.filters[f] = true
+			}
+			b.mu.Unlock()
+			s.write(0x90, append(append([]byte(nil), id...), codes...))
+			b.sendRetained(s, filters)
+		case 10: // UNSUBSCRIBE
+			id, rest := body[:2], body[2:]
+			for len(rest) > 0 {
+				f, next, err := readString(rest)
+				if err != nil {
+					return
+				}
+				b.mu.Lock()
+				delete(s.filters, f)
+				b.mu.Unlock()
+				rest = next
+			}
+			s.write(0xB0, append([]byte(nil), id...))
+		case 12: // PINGREQ
+			s.write(0xD0, nil)
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+func (b *Broker) checkAuth(connect []byte) bool {
+	if b.Username == "" {
+		return true
+	}
+	_, rest, err := readString(connect) // protocol name
+	if err != nil || len(rest) < 4 {
+		return false
+	}
+	flags := rest[1]
+	rest = rest[4:]
+	if _, rest, err = readString(rest); err != nil { // client ID
+		return false
+	}
+	var user, pass string
+	if flags&0x80 != 0 {
+		if user, rest, err = readString(rest); err != nil {
+			return false
+		}
+	}
+	if flags&0x40 != 0 {
+		if pass, _, err = readString(rest); err != nil {
+			return false
+		}
+	}
+	return user == b.Username && pass == b.Password
+}
+
+func (b *Broker) route(msg mqtt.Message) {
+	b.mu.Lock()
+	b.received = append(b.received, mqtt.Message{Topic: msg.Topic, Payload: msg.Payload, Retained: msg.Retained})
+	if msg.Retained {
+		if len(msg.Payload) == 0 {
+			delete(b.retained, msg.Topic)
+		} else {
+			b.retained[msg.Topic] = msg.Payload
+		}
+	}
+	var targets []*session
+	for s := range b.sessions {
+		for f := range s.filters {
+			if mqtt.Match(f, msg.Topic) {
+				targets = append(targets, s)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	for _, s := range targets {
+		s.write(0x30, publishBody(msg.Topic, msg.Payload))
+	}
+}
+
+func (b *Broker) sendRetained(s *session, filters []string) {
+	b.mu.Lock()
+	var msgs []mqtt.Message
+	for topic, payload := range b.retained {
+		for _, f := range filters {
+			if mqtt.Match(f, topic) {
+				msgs = append(msgs, mqtt.Message{Topic: topic, Payload: payload})
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+	for _, m := range msgs {
+		s.write(0x31, publishBody(m.Topic, m.Payload))
+	}
+}
+
+func publishBody(topic string, payload []byte) []byte {
+	body := binary.BigEndian.AppendUint16(nil, uint16(len(topic)))
+	body = append(body, topic...)
+	return append(body, payload...)
+}
+
+func (s *session) write(header byte, body []byte) {
+	packet := []byte{header}
+	n := len(body)
+	for {
+		d := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			d |= 0x80
+		}
+		packet = append(packet, d)
+		if n == 0 {
+			break
+		}
+	}
+	packet = append(packet, body...)
+	s.writeMu.Lock()
+	s.conn.Write(packet)
+	s.writeMu.Unlock()
+}
+
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, mult := 0, 1
+	for i := 0; ; i++ {
+		d, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(d&0x7f) * mult
+		if d&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, errors.New("mqtttest: malformed length")
+		}
+		mult *= 128
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	return header, body, err
+}
+
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errors.New("mqtttest: short string")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errors.New("mqtttest: short string")
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
@@ -0,0 +1,220 @@
+package permissions
+
+import (
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/users"
+)
+
+// Built-in roles, from most to least trusted.
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+	RoleGuest  = "guest"
+)
+
+// Agents a role can reach, see config.RoleConfig.Agents.
+const (
+	AgentMain     = "main"     // the chat agent itself
+	AgentSubagent = "subagent" // spawn, subagent and learn tools; subagents run with the full tool set
+	AgentCouncil  = "council"  // the council of experts
+)
+
+var builtinRoles = map[string]config.RoleConfig{
+	RoleOwner: {
+		Tools:    []string{"*"},
+		Commands: []string{"*"},
+		Agents:   []string{"*"},
+	},
+	RoleAdmin: {
+		Tools:    []string{"*"},
+		Commands: []string{"/model", "/link", "/name", "/voice", "/join", "/leave"},
+		Agents:   []string{"*"},
+	},
+	RoleMember: {
+		Tools: []string{"*"},
+		// cron jobs and HEARTBEAT.md run commands and agent turns with no
+		// sender, and skills and config shape everyone's turns, so members
+		// can't write files. The Google tools act as the owner's account.
+		DenyTools: []string{
+			"exec", "host_exec", "i2c", "spi", "cron",
+			"write_file", "edit_file", "append_file",
+			"gmail", "gdrive", "calendar",
+		},
+		Commands: []string{"/link", "/name", "/voice"},
+		Agents:   []string{AgentMain, AgentCouncil},
+	},
+	RoleGuest: {
+		Tools:       []string{"web_search", "web_fetch", "weather", "translate", "youtube", "message"},
+		Commands:    []string{"/link", "/name", "/voice"},
+		Agents:      []string{AgentMain},
+		DailyTokens: 50000,
+	},
+}
+
+// MessageOthers is listed like a tool name. Roles without it can only use
+// the message tool on the chat they are in, not reach other people or chats.
+const MessageOthers = "message_others"
+
+// toolAgents maps tools that hand work to other agents.
+var toolAgents = map[string]string{
+	"spawn":    AgentSubagent,
+	"subagent": AgentSubagent,
+	"learn":    AgentSubagent,
+	"council":  AgentCouncil,
+}
+
+// Role is a named set of permissions.
+type Role struct {
+	Name string
+	config.RoleConfig
+}
+
+// AllowsTool reports whether the role may call a tool.
+func (r Role) AllowsTool(name string) bool {
+	if agent, ok := toolAgents[name]; ok && !r.AllowsAgent(agent) {
+		return false
+	}
+	return listed(r.Tools, name) && !listed(r.DenyTools, name)
+}
+
+// AllowsCommand reports whether the role may use a slash command.
+func (r Role) AllowsCommand(command string) bool {
+	return listed(r.Commands, command)
+}
+
+// AllowsAgent reports whether the role may reach an agent.
+func (r Role) AllowsAgent(agent string) bool {
+	return listed(r.Agents, agent)
+}
+
+func listed(list []string, name string) bool {
+	for _, item := range list {
+		if item == "*" || item == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy resolves the role of a sender from the central permissions
+// config, following accounts linked in the user directory.
+type Policy struct {
+	cfg   config.PermissionsConfig
+	users *users.Directory
+}
+
+// NewPolicy creates a Policy. directory may be nil, in which case only
+// "channel:senderID" assignments apply.
+func NewPolicy(cfg config.PermissionsConfig, directory *users.Directory) *Policy {
+	return &Policy{cfg: cfg, users: directory}
+}
+
+// Enabled reports whether any roles are configured. A policy that isn't
+// enabled treats everyone as owner.
+func (p *Policy) Enabled() bool {
+	return p.cfg.DefaultRole != "" || len(p.cfg.Users) > 0 || len(p.cfg.Roles) > 0
+}
+
+// RoleFor returns the role of a sender.
+func (p *Policy) RoleFor(channel, senderID string) Role {
+	if !p.Enabled() {
+		return p.role(RoleOwner)
+	}
+	if name, ok := p.assigned(channel, senderID); ok {
+		return p.role(name)
+	}
+	if p.cfg.DefaultRole != "" {
+		return p.role(p.cfg.DefaultRole)
+	}
+	return p.role(RoleMember)
+}
+
+// Allows reports whether a sender has been given a role that reaches the
+// main agent, which admits them to channels whose allow list doesn't.
+func (p *Policy) Allows(channel, senderID string) bool {
+	name, ok := p.assigned(channel, senderID)
+	return ok && p.role(name).AllowsAgent(AgentMain)
+}
+
+// AllowsCommand reports whether a sender may use a slash command.
+func (p *Policy) AllowsCommand(channel, senderID, command string) bool {
+	return p.RoleFor(channel, senderID).AllowsCommand(command)
+}
+
+// OwnerChat returns the direct chat an owner last wrote from, for reports
+// and alerts meant for them alone. Without roles configured everyone is an
+// owner, so it is whoever wrote most recently.
+func (p *Policy) OwnerChat() (channel, chatID string, ok bool) {
+	if p.users == nil {
+		return "", "", false
+	}
+	for _, u := range p.users.List() {
+		if u.LastChatID == "" {
+			continue
+		}
+		if !p.Enabled() {
+			return u.LastChannel, u.LastChatID, true
+		}
+		for _, a := range u.Accounts {
+			if name, ok := p.assigned(a.Channel, a.SenderID); ok && name == RoleOwner {
+				return u.LastChannel, u.LastChatID, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// assigned finds an explicit role assignment for the sender, its user ID or
+// any account linked to it. Names are never used, as people choose their own.
+func (p *Policy) assigned(channel, senderID string) (string, bool) {
+	if len(p.cfg.Users) == 0 {
+		return "", false
+	}
+	keys := accountKeys(channel, senderID)
+	if p.users != nil {
+		if u, ok := p.users.Lookup(channel, senderID); ok {
+			keys = append(keys, u.ID)
+			for _, a := range u.Accounts {
+				keys = append(keys, accountKeys(a.Channel, a.SenderID)...)
+			}
+		}
+	}
+	for _, key := range keys {
+		if name, ok := p.cfg.Users[key]; ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// accountKeys lists the keys an account can be assigned under: its ID and,
+// for "id|username" senders, its username.
+func accountKeys(channel, senderID string) []string {
+	id, username := senderID, ""
+	if idx := strings.Index(senderID, "|"); idx > 0 {
+		id, username = senderID[:idx], senderID[idx+1:]
+	}
+	keys := []string{channel + ":" + id}
+	if username != "" {
+		keys = append(keys, channel+":"+username, channel+":@"+username)
+	}
+	return keys
+}
+
+// role looks up a role by name. Unknown names get the guest role, so a typo
+// never grants more than intended.
+func (p *Policy) role(name string) Role {
+	if cfg, ok := p.cfg.Roles[name]; ok {
+		return Role{Name: name, RoleConfig: cfg}
+	}
+	if cfg, ok := builtinRoles[name]; ok {
+		return Role{Name: name, RoleConfig: cfg}
+	}
+	if cfg, ok := p.cfg.Roles[RoleGuest]; ok {
+		return Role{Name: RoleGuest, RoleConfig: cfg}
+	}
+	return Role{Name: RoleGuest, RoleConfig: builtinRoles[RoleGuest]}
+}
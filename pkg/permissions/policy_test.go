@@ -0,0 +1,102 @@
+package permissions
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/users"
+)
+
+func TestPolicyDisabledGrantsEverything(t *testing.T) {
+	p := NewPolicy(config.PermissionsConfig{}, nil)
+	role := p.RoleFor("telegram", "123")
+	if p.Enabled() || role.Name != RoleOwner || !role.AllowsTool("exec") || !role.AllowsCommand("/provider") {
+		t.Errorf("role = %+v", role)
+	}
+	if p.Allows("telegram", "123") {
+		t.Error("a disabled policy shouldn't widen channel allow lists")
+	}
+}
+
+func TestPolicyRoles(t *testing.T) {
+	directory := users.NewDirectory(t.TempDir())
+	owner, _ := directory.Touch("telegram", "1|boss", "1", "")
+	code := directory.NewLinkCode(owner.ID)
+	directory.Link(code, "slack", "U1")
+
+	p := NewPolicy(config.PermissionsConfig{
+		DefaultRole: RoleGuest,
+		Users: map[string]string{
+			"telegram:@boss": RoleOwner,
+			"discord:42":     RoleMember,
+			"matrix:@x:y":    "typo",
+		},
+		Roles: map[string]config.RoleConfig{
+			RoleMember: {Tools: []string{"*"}, DenyTools: []string{"exec"}, Agents: []string{"*"}},
+		},
+	}, directory)
+
+	if role := p.RoleFor("slack", "U1"); role.Name != RoleOwner {
+		t.Errorf("linked account role = %s, want owner", role.Name)
+	}
+	if !p.Allows("slack", "U1") || p.Allows("slack", "U2") {
+		t.Error("only assigned senders should be admitted centrally")
+	}
+
+	member := p.RoleFor("discord", "42")
+	if member.AllowsTool("exec") || !member.AllowsTool("spawn") || member.AllowsCommand("/model") {
+		t.Errorf("configured member role = %+v", member)
+	}
+
+	guest := p.RoleFor("discord", "7")
+	if guest.Name != RoleGuest || guest.AllowsTool("write_file") || !guest.AllowsTool("web_search") || guest.DailyTokens == 0 {
+		t.Errorf("default role = %+v", guest)
+	}
+	if guest.AllowsTool(MessageOthers) {
+		t.Error("guests shouldn't message other people")
+	}
+	if guest.AllowsTool("spawn") || guest.AllowsTool("council") {
+		t.Error("guests shouldn't reach other agents")
+	}
+
+	if typo := p.RoleFor("matrix", "@x:y"); typo.Name != RoleGuest {
+		t.Errorf("unknown role resolved to %s, want guest", typo.Name)
+	}
+}
+
+func TestBuiltinMemberCannotSpawn(t *testing.T) {
+	member := NewPolicy(config.PermissionsConfig{DefaultRole: RoleMember}, nil).RoleFor("telegram", "5")
+	if member.AllowsTool("subagent") || !member.AllowsTool("council") || member.AllowsTool("host_exec") || !member.AllowsTool("read_file") {
+		t.Errorf("member = %+v", member)
+	}
+	// Both run the full tool set, exec included, on the member's behalf
+	if member.AllowsTool("cron") || member.AllowsTool("learn") {
+		t.Error("member can reach exec through cron or learn")
+	}
+}
+
+func TestPolicyOwnerChat(t *testing.T) {
+	directory := users.NewDirectory(t.TempDir())
+	directory.Touch("telegram", "1|boss", "1", "")
+	directory.Touch("telegram", "1|boss", "", "") // wrote in a group since
+	directory.Touch("discord", "42", "dm-42", "")
+
+	p := NewPolicy(config.PermissionsConfig{Users: map[string]string{
+		"telegram:@boss": RoleOwner,
+		"discord:42":     RoleMember,
+	}}, directory)
+	if channel, chatID, ok := p.OwnerChat(); !ok || channel != "telegram" || chatID != "1" {
+		t.Errorf("OwnerChat = %s, %s, %v; want the owner's direct chat", channel, chatID, ok)
+	}
+
+	// Without roles everyone is an owner
+	p = NewPolicy(config.PermissionsConfig{}, directory)
+	if channel, chatID, ok := p.OwnerChat(); !ok || channel != "discord" || chatID != "dm-42" {
+		t.Errorf("OwnerChat = %s, %s, %v; want the latest direct chat", channel, chatID, ok)
+	}
+
+	p = NewPolicy(config.PermissionsConfig{Users: map[string]string{"slack:U9": RoleOwner}}, directory)
+	if _, _, ok := p.OwnerChat(); ok {
+		t.Error("found a chat for an owner who never wrote")
+	}
+}
@@ -0,0 +1,204 @@
+package ratelimit
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// DefaultReply is sent to a throttled sender when no reply is configured.
+const DefaultReply = "You're sending messages faster than I can keep up with. Please wait a moment before trying again."
+
+// notifyInterval is how often a throttled sender is told about it.
+const notifyInterval = time.Minute
+
+// RoleResolver returns the role of a sender, or "" when roles aren't used.
+type RoleResolver func(channel, senderID string) string
+
+type dailyTokens struct {
+	day    string
+	tokens int
+}
+
+// Limiter enforces per-sender and per-chat message rates, daily token
+// budgets and queue caps. Counters live in memory and reset on restart.
+type Limiter struct {
+	cfg  config.RateLimitsConfig
+	role RoleResolver
+
+	mu       sync.Mutex
+	recent   map[string][]time.Time // sender or chat key -> message times in the last minute
+	tokens   map[string]dailyTokens
+	queued   map[string]int
+	notified map[string]time.Time
+	now      func() time.Time
+}
+
+// NewLimiter creates a Limiter. role may be nil.
+func NewLimiter(cfg config.RateLimitsConfig, role RoleResolver) *Limiter {
+	return &Limiter{
+		cfg:      cfg,
+		role:     role,
+		recent:   make(map[string][]time.Time),
+		tokens:   make(map[string]dailyTokens),
+		queued:   make(map[string]int),
+		notified: make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// Enabled reports whether any limit is configured.
+func (l *Limiter) Enabled() bool {
+	if l.cfg.RateLimitConfig != (config.RateLimitConfig{}) {
+		return true
+	}
+	for _, c := range l.cfg.Channels {
+		if c != (config.RateLimitConfig{}) {
+			return true
+		}
+	}
+	for _, c := range l.cfg.Roles {
+		if c != (config.RateLimitConfig{}) {
+			return true
+		}
+	}
+	return false
+}
+
+// Limits returns the effective limits for a sender on a channel.
+func (l *Limiter) Limits(channel, senderID string) config.RateLimitConfig {
+	limits := l.cfg.RateLimitConfig
+	if c, ok := l.cfg.Channels[channel]; ok {
+		limits = merge(limits, c)
+	}
+	if l.role != nil && len(l.cfg.Roles) > 0 {
+		if c, ok := l.cfg.Roles[l.role(channel, senderID)]; ok {
+			limits = merge(limits, c)
+		}
+	}
+	return limits
+}
+
+// Admit decides whether a message may go to the agent and, if so, counts
+// it against the limits and the chat's queue. When it may not, reply is
+// the throttling notice to send, or "" if the sender was told recently.
+func (l *Limiter) Admit(channel, senderID, chatID string) (ok bool, reply string) {
+	limits := l.Limits(channel, senderID)
+	sender, chat := senderKey(channel, senderID), channel+":"+chatID
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	senderRecent := l.window(sender, now)
+	chatRecent := l.window("chat|"+chat, now)
+	switch {
+	case over(len(senderRecent), limits.SenderPerMinute),
+		over(len(chatRecent), limits.ChatPerMinute),
+		over(l.tokensToday(sender, now), limits.SenderTokensPerDay),
+		over(l.tokensToday("chat|"+chat, now), limits.ChatTokensPerDay),
+		over(l.queued[chat], limits.MaxQueued):
+		if last, ok := l.notified[sender]; ok && now.Sub(last) < notifyInterval {
+			return false, ""
+		}
+		l.notified[sender] = now
+		if limits.Reply != "" {
+			return false, limits.Reply
+		}
+		return false, DefaultReply
+	}
+
+	l.recent[sender] = append(senderRecent, now)
+	l.recent["chat|"+chat] = append(chatRecent, now)
+	l.queued[chat]++
+	return true, ""
+}
+
+// Done releases a chat's queue slot once the agent has handled a message.
+func (l *Limiter) Done(channel, chatID string) {
+	chat := channel + ":" + chatID
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.queued[chat] <= 1 {
+		delete(l.queued, chat)
+		return
+	}
+	l.queued[chat]--
+}
+
+// RecordTokens counts LLM tokens spent answering a sender in a chat.
+func (l *Limiter) RecordTokens(channel, senderID, chatID string, tokens int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	day := l.now().Format("2006-01-02")
+	for _, key := range []string{senderKey(channel, senderID), "chat|" + channel + ":" + chatID} {
+		t := l.tokens[key]
+		if t.day != day {
+			t = dailyTokens{day: day}
+		}
+		t.tokens += tokens
+		l.tokens[key] = t
+	}
+}
+
+// window drops message times older than a minute. Must be called with the
+// lock held.
+func (l *Limiter) window(key string, now time.Time) []time.Time {
+	times := l.recent[key]
+	i := 0
+	for i < len(times) && now.Sub(times[i]) >= time.Minute {
+		i++
+	}
+	if i == len(times) {
+		delete(l.recent, key)
+		return nil
+	}
+	return times[i:]
+}
+
+// tokensToday must be called with the lock held.
+func (l *Limiter) tokensToday(key string, now time.Time) int {
+	t := l.tokens[key]
+	if t.day != now.Format("2006-01-02") {
+		return 0
+	}
+	return t.tokens
+}
+
+// over reports whether count has reached a limit; zero is unlimited.
+func over(count, limit int) bool {
+	return limit > 0 && count >= limit
+}
+
+// senderKey identifies a sender by the stable part of "id|username" IDs.
+func senderKey(channel, senderID string) string {
+	if idx := strings.Index(senderID, "|"); idx > 0 {
+		senderID = senderID[:idx]
+	}
+	return channel + ":" + senderID
+}
+
+// merge returns base with the non-zero fields of override applied.
+func merge(base, override config.RateLimitConfig) config.RateLimitConfig {
+	if override.SenderPerMinute != 0 {
+		base.SenderPerMinute = override.SenderPerMinute
+	}
+	if override.ChatPerMinute != 0 {
+		base.ChatPerMinute = override.ChatPerMinute
+	}
+	if override.SenderTokensPerDay != 0 {
+		base.SenderTokensPerDay = override.SenderTokensPerDay
+	}
+	if override.ChatTokensPerDay != 0 {
+		base.ChatTokensPerDay = override.ChatTokensPerDay
+	}
+	if override.MaxQueued != 0 {
+		base.MaxQueued = override.MaxQueued
+	}
+	if override.Reply != "" {
+		base.Reply = override.Reply
+	}
+	return base
+}
@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newTestLimiter(cfg config.RateLimitsConfig, role RoleResolver) (*Limiter, *time.Time) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(cfg, role)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	l, _ := newTestLimiter(config.RateLimitsConfig{}, nil)
+	if l.Enabled() {
+		t.Error("limiter without limits reports enabled")
+	}
+	for i := 0; i < 100; i++ {
+		if ok, _ := l.Admit("telegram", "1", "1"); !ok {
+			t.Fatal("message throttled without limits")
+		}
+	}
+}
+
+func TestLimiterSenderPerMinute(t *testing.T) {
+	l, now := newTestLimiter(config.RateLimitsConfig{
+		RateLimitConfig: config.RateLimitConfig{SenderPerMinute: 2},
+	}, nil)
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Admit("telegram", "1|alice", "g1"); !ok {
+			t.Fatalf("message %d throttled", i+1)
+		}
+	}
+	ok, reply := l.Admit("telegram", "1|alice", "g2")
+	if ok || reply != DefaultReply {
+		t.Errorf("third message = (%v, %q), want throttled with the default reply", ok, reply)
+	}
+	if ok, reply := l.Admit("telegram", "1|alice", "g1"); ok || reply != "" {
+		t.Errorf("repeat notice = (%v, %q), want a silent drop", ok, reply)
+	}
+	if ok, _ := l.Admit("telegram", "2|bob", "g1"); !ok {
+		t.Error("another sender was throttled")
+	}
+
+	*now = now.Add(time.Minute)
+	if ok, _ := l.Admit("telegram", "1|alice", "g1"); !ok {
+		t.Error("sender still throttled after a minute")
+	}
+}
+
+func TestLimiterChatPerMinute(t *testing.T) {
+	l, _ := newTestLimiter(config.RateLimitsConfig{
+		RateLimitConfig: config.RateLimitConfig{ChatPerMinute: 2, Reply: "Slow down"},
+	}, nil)
+
+	l.Admit("discord", "1", "room")
+	l.Admit("discord", "2", "room")
+	if ok, reply := l.Admit("discord", "3", "room"); ok || reply != "Slow down" {
+		t.Errorf("third message in chat = (%v, %q)", ok, reply)
+	}
+	if ok, _ := l.Admit("discord", "3", "other"); !ok {
+		t.Error("limit leaked into another chat")
+	}
+}
+
+func TestLimiterTokensPerDay(t *testing.T) {
+	l, now := newTestLimiter(config.RateLimitsConfig{
+		RateLimitConfig: config.RateLimitConfig{SenderTokensPerDay: 1000},
+	}, nil)
+
+	l.RecordTokens("slack", "U1", "C1", 600)
+	if ok, _ := l.Admit("slack", "U1", "C1"); !ok {
+		t.Fatal("sender throttled under budget")
+	}
+	l.RecordTokens("slack", "U1", "C1", 600)
+	if ok, _ := l.Admit("slack", "U1", "C1"); ok {
+		t.Error("sender admitted over budget")
+	}
+
+	*now = now.Add(24 * time.Hour)
+	if ok, _ := l.Admit("slack", "U1", "C1"); !ok {
+		t.Error("budget not reset on a new day")
+	}
+}
+
+func TestLimiterMaxQueued(t *testing.T) {
+	l, now := newTestLimiter(config.RateLimitsConfig{
+		RateLimitConfig: config.RateLimitConfig{MaxQueued: 1},
+	}, nil)
+
+	if ok, _ := l.Admit("line", "1", "c1"); !ok {
+		t.Fatal("first message throttled")
+	}
+	if ok, _ := l.Admit("line", "1", "c1"); ok {
+		t.Error("message admitted past a full queue")
+	}
+	l.Done("line", "c1")
+	*now = now.Add(notifyInterval)
+	if ok, _ := l.Admit("line", "1", "c1"); !ok {
+		t.Error("queue slot not released")
+	}
+	l.Done("line", "c1")
+	l.Done("line", "c1")
+	if ok, _ := l.Admit("line", "1", "c1"); !ok {
+		t.Error("extra Done left the queue in a bad state")
+	}
+}
+
+func TestLimiterOverrides(t *testing.T) {
+	roles := map[string]string{"telegram:1": "owner", "telegram:2": "guest"}
+	l, _ := newTestLimiter(config.RateLimitsConfig{
+		RateLimitConfig: config.RateLimitConfig{SenderPerMinute: 5, MaxQueued: 3},
+		Channels: map[string]config.RateLimitConfig{
+			"telegram": {SenderPerMinute: 10},
+		},
+		Roles: map[string]config.RateLimitConfig{
+			"owner": {SenderPerMinute: -1, MaxQueued: -1},
+			"guest": {SenderPerMinute: 1},
+		},
+	}, func(channel, senderID string) string { return roles[channel+":"+senderID] })
+
+	if got := l.Limits("discord", "9"); got.SenderPerMinute != 5 || got.MaxQueued != 3 {
+		t.Errorf("defaults = %+v", got)
+	}
+	if got := l.Limits("telegram", "3"); got.SenderPerMinute != 10 || got.MaxQueued != 3 {
+		t.Errorf("channel limits = %+v", got)
+	}
+	if got := l.Limits("telegram", "2"); got.SenderPerMinute != 1 {
+		t.Errorf("guest limits = %+v", got)
+	}
+	for i := 0; i < 20; i++ {
+		if ok, _ := l.Admit("telegram", "1", "c1"); !ok {
+			t.Fatalf("owner throttled after %d messages", i)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -14,11 +16,31 @@ import (
 type Session struct {
 	Key      string              `json:"key"`
 	Messages []providers.Message `json:"messages"`
-	Summary  string              `json:"summary,omitempty"`
+	Summary  string              `json:"summary,omitempty"`  // Rolled-up digest of everything older than Chunks
+	Chunks   []SummaryChunk      `json:"chunks,omitempty"`   // Recent chunk summaries, oldest first
+	Outcomes []string            `json:"outcomes,omitempty"` // Key tool outcomes (files written, emails sent, ...)
 	Created  time.Time           `json:"created"`
 	Updated  time.Time           `json:"updated"`
 }
 
+// SummaryChunk is the summary of one contiguous slice of conversation.
+// Chunks accumulate until they are rolled up into the session digest.
+type SummaryChunk struct {
+	Topic    string    `json:"topic,omitempty"`
+	Summary  string    `json:"summary"`
+	Messages int       `json:"messages"`
+	Created  time.Time `json:"created"`
+}
+
+// SessionInfo is a lightweight description of a session for listings.
+type SessionInfo struct {
+	Key      string    `json:"key"`
+	Messages int       `json:"messages"`
+	Summary  string    `json:"summary,omitempty"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+}
+
 type SessionManager struct {
 	sessions map[string]*Session
 	mu       sync.RWMutex
@@ -114,6 +136,25 @@ func (sm *SessionManager) GetHistory(key string) []providers.Message {
 	return history
 }
 
+// ListSessions returns all sessions, most recently updated first.
+func (sm *SessionManager) ListSessions() []SessionInfo {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	infos := make([]SessionInfo, 0, len(sm.sessions))
+	for _, s := range sm.sessions {
+		infos = append(infos, SessionInfo{
+			Key:      s.Key,
+			Messages: len(s.Messages),
+			Summary:  s.Summary,
+			Created:  s.Created,
+			Updated:  s.Updated,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Updated.After(infos[j].Updated) })
+	return infos
+}
+
 func (sm *SessionManager) GetSummary(key string) string {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
@@ -125,15 +166,92 @@ func (sm *SessionManager) GetSummary(key string) string {
 	return session.Summary
 }
 
-func (sm *SessionManager) SetSummary(key string, summary string) {
+// GetSummaryChunks returns a copy of the session's pending chunk summaries.
+func (sm *SessionManager) GetSummaryChunks(key string) []SummaryChunk {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[key]
+	if !ok || len(session.Chunks) == 0 {
+		return nil
+	}
+	chunks := make([]SummaryChunk, len(session.Chunks))
+	copy(chunks, session.Chunks)
+	return chunks
+}
+
+// CompactPrefix replaces the start of a session's history with the chunk
+// summaries of it, keeping everything after. It does nothing and returns
+// false unless the history still starts with prefix and has more after it,
+// e.g. when the session was cleared or truncated while it was summarized.
+func (sm *SessionManager) CompactPrefix(key string, prefix []providers.Message, chunks []SummaryChunk) bool {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
 	session, ok := sm.sessions[key]
-	if ok {
-		session.Summary = summary
-		session.Updated = time.Now()
+	if !ok || len(prefix) == 0 || len(session.Messages) <= len(prefix) {
+		return false
+	}
+	for i, m := range prefix {
+		if !reflect.DeepEqual(session.Messages[i], m) {
+			return false
+		}
+	}
+
+	session.Messages = append([]providers.Message(nil), session.Messages[len(prefix):]...)
+	session.Chunks = append(session.Chunks, chunks...)
+	session.Updated = time.Now()
+	return true
+}
+
+// RollUpChunks replaces the digest and drops the oldest n chunks, which the
+// caller has folded into the new digest.
+func (sm *SessionManager) RollUpChunks(key string, digest string, n int) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		return
+	}
+	if n > len(session.Chunks) {
+		n = len(session.Chunks)
 	}
+	if n > 0 {
+		session.Chunks = append([]SummaryChunk(nil), session.Chunks[n:]...)
+	}
+	session.Summary = digest
+	session.Updated = time.Now()
+}
+
+// GetOutcomes returns a copy of the key tool outcomes recorded for the session.
+func (sm *SessionManager) GetOutcomes(key string) []string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[key]
+	if !ok || len(session.Outcomes) == 0 {
+		return nil
+	}
+	outcomes := make([]string, len(session.Outcomes))
+	copy(outcomes, session.Outcomes)
+	return outcomes
+}
+
+// AddOutcomes appends key tool outcomes, keeping at most max of the newest.
+func (sm *SessionManager) AddOutcomes(key string, outcomes []string, max int) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, ok := sm.sessions[key]
+	if !ok || len(outcomes) == 0 {
+		return
+	}
+	session.Outcomes = append(session.Outcomes, outcomes...)
+	if max > 0 && len(session.Outcomes) > max {
+		session.Outcomes = append([]string(nil), session.Outcomes[len(session.Outcomes)-max:]...)
+	}
+	session.Updated = time.Now()
 }
 
 func (sm *SessionManager) TruncateHistory(key string, keepLast int) {
@@ -175,6 +293,26 @@ func (sm *SessionManager) TruncateHistory(key string, keepLast int) {
 	session.Updated = time.Now()
 }
 
+// DropLastTurn removes the most recent user message and everything added
+// after it, e.g. when that turn was cancelled before it finished.
+func (sm *SessionManager) DropLastTurn(key string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		return
+	}
+
+	for i := len(session.Messages) - 1; i >= 0; i-- {
+		if session.Messages[i].Role == "user" {
+			session.Messages = session.Messages[:i]
+			session.Updated = time.Now()
+			return
+		}
+	}
+}
+
 // sanitizeFilename converts a session key into a cross-platform safe filename.
 // Session keys use "channel:chatID" (e.g. "telegram:123456") but ':' is the
 // volume separator on Windows, so filepath.Base would misinterpret the key.
@@ -213,6 +351,14 @@ func (sm *SessionManager) Save(key string) error {
 		Created: stored.Created,
 		Updated: stored.Updated,
 	}
+	if len(stored.Chunks) > 0 {
+		snapshot.Chunks = make([]SummaryChunk, len(stored.Chunks))
+		copy(snapshot.Chunks, stored.Chunks)
+	}
+	if len(stored.Outcomes) > 0 {
+		snapshot.Outcomes = make([]string, len(stored.Outcomes))
+		copy(snapshot.Outcomes, stored.Outcomes)
+	}
 	if len(stored.Messages) > 0 {
 		snapshot.Messages = make([]providers.Message, len(stored.Messages))
 		copy(snapshot.Messages, stored.Messages)
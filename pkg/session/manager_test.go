@@ -72,3 +72,83 @@ func TestSave_RejectsPathTraversal(t *testing.T) {
 		}
 	}
 }
+
+func TestSummaryChunksAndOutcomes_RoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	sm := NewSessionManager(tmpDir)
+
+	key := "telegram:42"
+	sm.AddMessage(key, "user", "hello")
+	sm.AddMessage(key, "assistant", "hi")
+	sm.CompactPrefix(key, sm.GetHistory(key)[:1], []SummaryChunk{
+		{Topic: "a", Summary: "first"},
+		{Topic: "b", Summary: "second"},
+		{Topic: "c", Summary: "third"},
+	})
+	sm.AddOutcomes(key, []string{"one", "two", "three"}, 2)
+	sm.RollUpChunks(key, "digest", 2)
+
+	if err := sm.Save(key); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	sm2 := NewSessionManager(tmpDir)
+	if got := sm2.GetSummary(key); got != "digest" {
+		t.Errorf("summary = %q, want %q", got, "digest")
+	}
+	chunks := sm2.GetSummaryChunks(key)
+	if len(chunks) != 1 || chunks[0].Topic != "c" {
+		t.Errorf("chunks = %+v, want only topic c", chunks)
+	}
+	outcomes := sm2.GetOutcomes(key)
+	if len(outcomes) != 2 || outcomes[0] != "two" || outcomes[1] != "three" {
+		t.Errorf("outcomes = %v, want [two three]", outcomes)
+	}
+}
+
+func TestDropLastTurn(t *testing.T) {
+	sm := NewSessionManager(t.TempDir())
+	key := "telegram:123456"
+	sm.AddMessage(key, "user", "hello")
+	sm.AddMessage(key, "assistant", "hi")
+	sm.AddMessage(key, "user", "check the weather")
+	sm.AddMessage(key, "assistant", "")
+	sm.AddMessage(key, "tool", "sunny")
+
+	sm.DropLastTurn(key)
+	history := sm.GetHistory(key)
+	if len(history) != 2 || history[1].Content != "hi" {
+		t.Errorf("history = %+v, want the first exchange only", history)
+	}
+}
+
+func TestCompactPrefix(t *testing.T) {
+	sm := NewSessionManager(t.TempDir())
+	key := "telegram:123456"
+	sm.AddMessage(key, "user", "hello")
+	sm.AddMessage(key, "assistant", "hi")
+	sm.AddMessage(key, "user", "bye")
+	prefix := sm.GetHistory(key)[:2]
+
+	if sm.CompactPrefix(key, sm.GetHistory(key), []SummaryChunk{{Topic: "a"}}) {
+		t.Error("compacted the whole history")
+	}
+	if !sm.CompactPrefix(key, prefix, []SummaryChunk{{Topic: "greeting"}}) {
+		t.Fatal("prefix not compacted")
+	}
+	if history := sm.GetHistory(key); len(history) != 1 || history[0].Content != "bye" {
+		t.Errorf("history = %+v, want the tail only", history)
+	}
+	if chunks := sm.GetSummaryChunks(key); len(chunks) != 1 || chunks[0].Topic != "greeting" {
+		t.Errorf("chunks = %+v", chunks)
+	}
+
+	// The history no longer starts with prefix
+	sm.AddMessage(key, "assistant", "see you")
+	if sm.CompactPrefix(key, prefix, []SummaryChunk{{Topic: "again"}}) {
+		t.Error("compacted a prefix that is gone")
+	}
+	if len(sm.GetHistory(key)) != 2 || len(sm.GetSummaryChunks(key)) != 1 {
+		t.Error("failed compaction changed the session")
+	}
+}
@@ -28,11 +28,18 @@ type FeatureBucket struct {
 	Calls            int64 `json:"calls"`
 }
 
+// FeedbackBucket counts user reactions to assistant messages.
+type FeedbackBucket struct {
+	Positive int64 `json:"positive"`
+	Negative int64 `json:"negative"`
+}
+
 // DayBucket tracks token usage for a single day.
 type DayBucket struct {
 	Date     string                    `json:"date"` // "2006-01-02"
 	Features map[string]*FeatureBucket `json:"features"`
 	Totals   FeatureBucket             `json:"totals"`
+	Feedback FeedbackBucket            `json:"feedback"`
 }
 
 // TelemetryData is the on-disk format.
@@ -111,6 +118,22 @@ func (t *Tracker) Record(feature string, prompt, completion, total int) {
 	t.dirty = true
 }
 
+// RecordFeedback counts a positive or negative user reaction for today.
+func (t *Tracker) RecordFeedback(positive bool) {
+	today := time.Now().Format("2006-01-02")
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	bucket := t.getOrCreateDay(today)
+	if positive {
+		bucket.Feedback.Positive++
+	} else {
+		bucket.Feedback.Negative++
+	}
+	t.dirty = true
+}
+
 // GetToday returns today's bucket (copy). Returns nil if no data yet.
 func (t *Tracker) GetToday() *DayBucket {
 	return t.GetDay(time.Now().Format("2006-01-02"))
@@ -217,6 +240,7 @@ func copyDayBucket(src *DayBucket) *DayBucket {
 	cp := &DayBucket{
 		Date:     src.Date,
 		Totals:   src.Totals,
+		Feedback: src.Feedback,
 		Features: make(map[string]*FeatureBucket, len(src.Features)),
 	}
 	for k, v := range src.Features {
@@ -243,5 +267,8 @@ func FormatDayBucket(b *DayBucket) string {
 				name, fb.TotalTokens, fb.PromptTokens, fb.CompletionTokens, fb.Calls)
 		}
 	}
+	if b.Feedback.Positive > 0 || b.Feedback.Negative > 0 {
+		result += fmt.Sprintf("\nFeedback: %d 👍 / %d 👎\n", b.Feedback.Positive, b.Feedback.Negative)
+	}
 	return result
 }
@@ -6,10 +6,12 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/knowledge"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
 // LearnTool enables deep learning on arbitrary topics via web research.
@@ -19,8 +21,29 @@ type LearnTool struct {
 	subagentMgr    *SubagentManager
 	channel        string
 	chatID         string
+	defaultTTL     int          // hours before a researched topic goes stale (0 = never)
+	sendCallback   SendCallback // notifies users about material changes from scheduled refreshes
+	refreshing     sync.Map     // slugs with a research subagent in flight
+	failuresMu     sync.Mutex
+	failures       map[string]refreshFailure // scheduled refreshes that failed, by slug
 }
 
+// refreshFailure tracks a topic whose scheduled refresh keeps failing.
+type refreshFailure struct {
+	count int
+	retry time.Time // not retried before this
+}
+
+const (
+	// maxScheduledRefreshes caps how many stale topics are re-researched per check,
+	// so a backlog of expired topics doesn't spawn a burst of subagents.
+	maxScheduledRefreshes = 2
+	// refreshBackoff is how long a topic waits after its first failed refresh;
+	// it doubles with each further failure, up to maxRefreshBackoff.
+	refreshBackoff    = time.Hour
+	maxRefreshBackoff = 7 * 24 * time.Hour
+)
+
 func NewLearnTool(workspace string, loader *knowledge.Loader, subagentMgr *SubagentManager) *LearnTool {
 	return &LearnTool{
 		workspace:       workspace,
@@ -29,6 +52,16 @@ func NewLearnTool(workspace string, loader *knowledge.Loader, subagentMgr *Subag
 	}
 }
 
+// SetDefaultTTL sets the TTL in hours applied to new topics that don't specify one.
+func (t *LearnTool) SetDefaultTTL(hours int) {
+	t.defaultTTL = hours
+}
+
+// SetSendCallback sets the callback used to notify users about refreshed topics.
+func (t *LearnTool) SetSendCallback(callback SendCallback) {
+	t.sendCallback = callback
+}
+
 func (t *LearnTool) Name() string { return "learn" }
 
 func (t *LearnTool) Description() string {
@@ -57,6 +90,10 @@ func (t *LearnTool) Parameters() map[string]interface{} {
 				"enum":        []string{"overview", "detailed", "deep"},
 				"description": "Research depth: overview (quick), detailed (default), deep (thorough)",
 			},
+			"ttl_hours": map[string]interface{}{
+				"type":        "integer",
+				"description": "Hours until the topic is considered stale and re-researched automatically (0 = never). Use short TTLs for fast-changing topics (prices, news), long ones for stable topics (history).",
+			},
 		},
 		"required": []string{"action"},
 	}
@@ -97,6 +134,11 @@ func (t *LearnTool) start(ctx context.Context, args map[string]interface{}) *Too
 
 	slug := slugify(topic)
 
+	ttl := t.defaultTTL
+	if v, ok := args["ttl_hours"].(float64); ok {
+		ttl = int(v)
+	}
+
 	// Check if already exists and is ready
 	if content, err := t.knowledgeLoader.LoadContent(slug); err == nil && content != "" {
 		return SilentResult(fmt.Sprintf("Topic '%s' already has knowledge. Use action 'refresh' to update it.", topic))
@@ -113,13 +155,16 @@ func (t *LearnTool) start(ctx context.Context, args map[string]interface{}) *Too
 		UpdatedAt:   knowledge.Now(),
 		Version:     1,
 		AutoInject:  true,
+		TTLHours:    ttl,
+		Channel:     t.channel,
+		ChatID:      t.chatID,
 	}
 	if err := t.knowledgeLoader.SaveMeta(meta); err != nil {
 		return ErrorResult(fmt.Sprintf("failed to create topic directory: %v", err))
 	}
 
 	// Build research prompt
-	prompt := t.buildResearchPrompt(topic, purpose, depth, slug)
+	prompt := t.buildResearchPrompt(topic, purpose, depth, slug, true)
 
 	// Spawn research subagent
 	if t.subagentMgr == nil {
@@ -127,8 +172,8 @@ func (t *LearnTool) start(ctx context.Context, args map[string]interface{}) *Too
 	}
 
 	_, err := t.subagentMgr.Spawn(ctx, prompt, fmt.Sprintf("learn:%s", slug), t.channel, t.chatID, func(callbackCtx context.Context, result *ToolResult) {
-		// On completion, refresh the index
-		t.knowledgeLoader.RefreshIndex()
+		// On completion, restore our bookkeeping fields and refresh the index
+		t.finishResearch(meta, "", false)
 		logger.InfoCF("learn", "Research completed, index refreshed",
 			map[string]interface{}{"topic": topic, "slug": slug})
 	})
@@ -177,17 +222,17 @@ func (t *LearnTool) refresh(ctx context.Context, args map[string]interface{}) *T
 	}
 
 	slug := slugify(topic)
-	all := t.knowledgeLoader.ListAll()
-	found := false
-	for _, meta := range all {
-		if meta.Slug == slug {
-			found = true
-			break
-		}
-	}
+	meta, found := t.knowledgeLoader.GetMeta(slug)
 	if !found {
 		return ErrorResult(fmt.Sprintf("topic '%s' not found. Use action 'start' first.", topic))
 	}
+	if v, ok := args["ttl_hours"].(float64); ok {
+		meta.TTLHours = int(v)
+	}
+	if _, busy := t.refreshing.LoadOrStore(slug, true); busy {
+		return SilentResult(fmt.Sprintf("Topic '%s' is already being refreshed.", topic))
+	}
+	oldContent, _ := t.knowledgeLoader.LoadContent(slug)
 
 	// Re-start research
 	args["action"] = "start"
@@ -198,23 +243,211 @@ func (t *LearnTool) refresh(ctx context.Context, args map[string]interface{}) *T
 		depth = "detailed"
 	}
 
-	prompt := t.buildResearchPrompt(topic, purpose, depth, slug)
+	prompt := t.buildResearchPrompt(topic, purpose, depth, slug, true)
 
 	if t.subagentMgr == nil {
+		t.refreshing.Delete(slug)
 		return ErrorResult("subagent manager not available")
 	}
 
 	_, err := t.subagentMgr.Spawn(ctx, prompt, fmt.Sprintf("learn-refresh:%s", slug), t.channel, t.chatID, func(callbackCtx context.Context, result *ToolResult) {
-		t.knowledgeLoader.RefreshIndex()
+		defer t.refreshing.Delete(slug)
+		// The subagent notifies the user itself on manual refreshes
+		t.finishResearch(meta, oldContent, false)
 	})
 	if err != nil {
+		t.refreshing.Delete(slug)
 		return ErrorResult(fmt.Sprintf("failed to spawn research subagent: %v", err))
 	}
 
 	return AsyncResult(fmt.Sprintf("Refreshing knowledge on '%s'...", topic))
 }
 
-func (t *LearnTool) buildResearchPrompt(topic, purpose, depth, slug string) string {
+// StartRefreshLoop periodically marks expired topics stale and re-researches
+// them until ctx is done.
+func (t *LearnTool) StartRefreshLoop(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				t.RefreshStale(ctx)
+			}
+		}
+	}()
+}
+
+// RefreshStale marks expired topics stale and spawns research subagents for
+// up to maxScheduledRefreshes of them. Returns the number of refreshes started.
+func (t *LearnTool) RefreshStale(ctx context.Context) int {
+	if t.subagentMgr == nil {
+		return 0
+	}
+
+	started := 0
+	for _, meta := range t.knowledgeLoader.MarkStale(time.Now()) {
+		if started >= maxScheduledRefreshes {
+			break
+		}
+		if t.backingOff(meta.Slug, time.Now()) {
+			continue
+		}
+		if _, busy := t.refreshing.LoadOrStore(meta.Slug, true); busy {
+			continue
+		}
+
+		meta := meta
+		oldContent, _ := t.knowledgeLoader.LoadContent(meta.Slug)
+		prompt := t.buildResearchPrompt(meta.Title, meta.Description, "detailed", meta.Slug, false)
+
+		_, err := t.subagentMgr.Spawn(ctx, prompt, fmt.Sprintf("learn-refresh:%s", meta.Slug), meta.Channel, meta.ChatID, func(callbackCtx context.Context, result *ToolResult) {
+			defer t.refreshing.Delete(meta.Slug)
+			if result.IsError || !t.finishResearch(meta, oldContent, true) {
+				t.refreshFailed(meta.Slug, time.Now())
+				return
+			}
+			t.failuresMu.Lock()
+			delete(t.failures, meta.Slug)
+			t.failuresMu.Unlock()
+		})
+		if err != nil {
+			t.refreshing.Delete(meta.Slug)
+			logger.WarnCF("learn", "Scheduled refresh failed to start",
+				map[string]interface{}{"slug": meta.Slug, "error": err.Error()})
+			continue
+		}
+		logger.InfoCF("learn", "Scheduled refresh started",
+			map[string]interface{}{"slug": meta.Slug, "updated_at": meta.UpdatedAt, "ttl_hours": meta.TTLHours})
+		started++
+	}
+	return started
+}
+
+// backingOff reports whether slug's scheduled refresh failed recently and
+// must not be retried yet.
+func (t *LearnTool) backingOff(slug string, now time.Time) bool {
+	t.failuresMu.Lock()
+	defer t.failuresMu.Unlock()
+	f, ok := t.failures[slug]
+	return ok && now.Before(f.retry)
+}
+
+// refreshFailed records a failed scheduled refresh, postponing the next try.
+func (t *LearnTool) refreshFailed(slug string, now time.Time) {
+	t.failuresMu.Lock()
+	defer t.failuresMu.Unlock()
+	if t.failures == nil {
+		t.failures = make(map[string]refreshFailure)
+	}
+	f := t.failures[slug]
+	f.count++
+	wait := refreshBackoff
+	for i := 1; i < f.count && wait < maxRefreshBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxRefreshBackoff {
+		wait = maxRefreshBackoff
+	}
+	f.retry = now.Add(wait)
+	t.failures[slug] = f
+	logger.WarnCF("learn", "Scheduled refresh failed, backing off",
+		map[string]interface{}{"slug": slug, "failures": f.count, "retry": f.retry.Format(time.RFC3339)})
+}
+
+// finishResearch runs after a research subagent completes. The subagent
+// rewrites META.json itself, so fields it doesn't know about (TTL, notify
+// target, creation time) are restored from prev. When oldContent is given the
+// new KNOWLEDGE.md is diffed against it, and material changes are reported to
+// the topic's chat if notify is set. It returns false if the research left no
+// knowledge behind.
+func (t *LearnTool) finishResearch(prev knowledge.KnowledgeMeta, oldContent string, notify bool) bool {
+	t.knowledgeLoader.RefreshIndex()
+
+	meta, ok := t.knowledgeLoader.GetMeta(prev.Slug)
+	if !ok {
+		meta = prev
+	}
+	newContent, err := t.knowledgeLoader.LoadContent(prev.Slug)
+	if err != nil || strings.TrimSpace(newContent) == "" {
+		logger.WarnCF("learn", "Research finished without knowledge content",
+			map[string]interface{}{"slug": prev.Slug})
+		return false
+	}
+
+	meta.TTLHours = prev.TTLHours
+	meta.Channel = prev.Channel
+	meta.ChatID = prev.ChatID
+	meta.Source = prev.Source
+	if prev.CreatedAt != "" {
+		meta.CreatedAt = prev.CreatedAt
+	}
+	meta.Status = "ready"
+	meta.UpdatedAt = knowledge.Now()
+	meta.CharCount = len(newContent)
+
+	var diff knowledge.ContentDiff
+	if oldContent != "" {
+		diff = knowledge.DiffContent(oldContent, newContent)
+		if len(diff.Added) > 0 || len(diff.Removed) > 0 {
+			if meta.Version <= prev.Version {
+				meta.Version = prev.Version + 1
+			}
+		}
+	}
+
+	if err := t.knowledgeLoader.SaveMeta(meta); err != nil {
+		logger.WarnCF("learn", "Failed to finalize topic metadata",
+			map[string]interface{}{"slug": meta.Slug, "error": err.Error()})
+	}
+	t.knowledgeLoader.RefreshIndex()
+
+	if oldContent == "" {
+		return true
+	}
+	logger.InfoCF("learn", "Topic refreshed",
+		map[string]interface{}{
+			"slug":         meta.Slug,
+			"added":        len(diff.Added),
+			"removed":      len(diff.Removed),
+			"change_ratio": diff.ChangeRatio,
+		})
+
+	if notify && diff.IsMaterial() && t.sendCallback != nil && meta.Channel != "" && meta.ChatID != "" {
+		t.sendCallback(meta.Channel, meta.ChatID, formatRefreshNotice(meta.Title, diff))
+	}
+	return true
+}
+
+// formatRefreshNotice summarizes a material change for the user.
+func formatRefreshNotice(title string, diff knowledge.ContentDiff) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📚 Actualicé lo que sé sobre '%s' (%d líneas nuevas, %d eliminadas).", title, len(diff.Added), len(diff.Removed)))
+
+	shown := 0
+	for _, line := range diff.Added {
+		// Skip headings and short fragments; they say little on their own
+		if strings.HasPrefix(line, "#") || len(line) < 20 {
+			continue
+		}
+		if shown == 0 {
+			sb.WriteString("\n\nNovedades:")
+		}
+		sb.WriteString("\n• " + utils.Truncate(strings.TrimLeft(line, "-*• "), 160))
+		shown++
+		if shown == 3 {
+			break
+		}
+	}
+	return sb.String()
+}
+
+func (t *LearnTool) buildResearchPrompt(topic, purpose, depth, slug string, notifyUser bool) string {
 	searchCount := 3
 	fetchCount := 2
 	wordRange := "500-1000"
@@ -236,6 +469,11 @@ func (t *LearnTool) buildResearchPrompt(topic, purpose, depth, slug string) stri
 		purposeSection = fmt.Sprintf("\nFocus: %s\n", purpose)
 	}
 
+	notifyStep := "7. NOTIFY: Use message tool to send a short summary (2-3 lines) to the user about what you learned."
+	if !notifyUser {
+		notifyStep = "7. DO NOT message the user; this is a scheduled background refresh and changes are reported separately."
+	}
+
 	return fmt.Sprintf(`[AUTONOMOUS RESEARCH] Learn about: %s
 %s
 Instructions:
@@ -255,11 +493,11 @@ Instructions:
    - char_count: (actual character count of KNOWLEDGE.md)
    - keywords: (extract 5-10 relevant keywords from your research)
 6. SOURCES: Use write_file tool to save source URLs to %s/sources.json as a JSON array of objects with "url" and "title" fields.
-7. NOTIFY: Use message tool to send a short summary (2-3 lines) to the user about what you learned.
+%s
 
 Write in Spanish. Be thorough but concise. Focus on actionable knowledge.`,
 		topic, purposeSection, searchCount, fetchCount, wordRange,
-		knowledgePath, knowledgePath, time.Now().Format(time.RFC3339), knowledgePath)
+		knowledgePath, knowledgePath, time.Now().Format(time.RFC3339), knowledgePath, notifyStep)
 }
 
 // slugify converts a topic name to a URL-safe slug.
@@ -0,0 +1,126 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/knowledge"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// researchProvider plays a research subagent: it rewrites the topic's
+// KNOWLEDGE.md and META.json the way the prompt asks, forgetting the fields
+// only the learn tool knows about.
+type researchProvider struct {
+	loader  *knowledge.Loader
+	slug    string
+	content string
+	err     error
+}
+
+func (p *researchProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	dir := filepath.Join(p.loader.GetBaseDir(), p.slug)
+	if err := os.WriteFile(filepath.Join(dir, "KNOWLEDGE.md"), []byte(p.content), 0644); err != nil {
+		return nil, err
+	}
+	p.loader.SaveMeta(knowledge.KnowledgeMeta{Slug: p.slug, Title: "Docker", Status: "ready", Version: 1})
+	return &providers.LLMResponse{Content: "Research done"}, nil
+}
+
+func (p *researchProvider) GetDefaultModel() string { return "test-model" }
+
+func newStaleTopic(t *testing.T) *knowledge.Loader {
+	t.Helper()
+	loader := knowledge.NewLoader(t.TempDir())
+	meta := knowledge.KnowledgeMeta{
+		Slug:      "docker",
+		Title:     "Docker",
+		Status:    "ready",
+		CreatedAt: "2026-01-01T00:00:00Z",
+		UpdatedAt: time.Now().Add(-48 * time.Hour).Format(time.RFC3339),
+		Version:   2,
+		TTLHours:  24,
+		Channel:   "telegram",
+		ChatID:    "42",
+	}
+	if err := loader.SaveMeta(meta); err != nil {
+		t.Fatal(err)
+	}
+	old := "# Docker\n\nDocker Engine 24 is the current release.\nCompose v1 is still supported.\n"
+	os.WriteFile(filepath.Join(loader.GetBaseDir(), "docker", "KNOWLEDGE.md"), []byte(old), 0644)
+	loader.RefreshIndex()
+	return loader
+}
+
+func TestLearnTool_RefreshStale(t *testing.T) {
+	loader := newStaleTopic(t)
+	provider := &researchProvider{
+		loader:  loader,
+		slug:    "docker",
+		content: "# Docker\n\nDocker Engine 27 is the current release.\nCompose v1 reached end of life; use docker compose.\n",
+	}
+	tool := NewLearnTool(t.TempDir(), loader, NewSubagentManager(provider, "test-model", t.TempDir(), nil))
+
+	type notice struct{ channel, chatID, content string }
+	notices := make(chan notice, 1)
+	tool.SetSendCallback(func(channel, chatID, content string) error {
+		notices <- notice{channel, chatID, content}
+		return nil
+	})
+
+	if n := tool.RefreshStale(context.Background()); n != 1 {
+		t.Fatalf("RefreshStale = %d, want 1", n)
+	}
+	select {
+	case n := <-notices:
+		if n.channel != "telegram" || n.chatID != "42" || n.content == "" {
+			t.Errorf("notice = %+v", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no refresh notice sent")
+	}
+
+	meta, _ := loader.GetMeta("docker")
+	if meta.Version != 3 || meta.Status != "ready" || meta.TTLHours != 24 ||
+		meta.Channel != "telegram" || meta.ChatID != "42" || meta.CreatedAt != "2026-01-01T00:00:00Z" {
+		t.Errorf("meta after refresh = %+v", meta)
+	}
+}
+
+func TestLearnTool_RefreshStaleBacksOff(t *testing.T) {
+	loader := newStaleTopic(t)
+	provider := &researchProvider{err: errors.New("search unavailable")}
+	tool := NewLearnTool(t.TempDir(), loader, NewSubagentManager(provider, "test-model", t.TempDir(), nil))
+
+	if n := tool.RefreshStale(context.Background()); n != 1 {
+		t.Fatalf("RefreshStale = %d, want 1", n)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !tool.backingOff("docker", time.Now()) {
+		if time.Now().After(deadline) {
+			t.Fatal("failed refresh not recorded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if n := tool.RefreshStale(context.Background()); n != 0 {
+		t.Errorf("RefreshStale right after a failure = %d, want 0", n)
+	}
+	if meta, _ := loader.GetMeta("docker"); meta.Status != "stale" || meta.Version != 2 {
+		t.Errorf("failed refresh changed the topic: %+v", meta)
+	}
+
+	// Each further failure waits twice as long
+	now := time.Now()
+	tool.refreshFailed("docker", now)
+	if !tool.backingOff("docker", now.Add(90*time.Minute)) || tool.backingOff("docker", now.Add(2*time.Hour+time.Minute)) {
+		t.Error("second failure should back off for two hours")
+	}
+}
@@ -3,16 +3,33 @@ package tools
 import (
 	"context"
 	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
 )
 
 type SendCallback func(channel, chatID, content string) error
 
+// OutboundCallback delivers a full outbound message, including attachments,
+// buttons, replies, edits and deletes.
+type OutboundCallback func(msg bus.OutboundMessage) error
+
+// RecipientResolver finds the channel and chat where a person, given by
+// name or user ID, was last active.
+type RecipientResolver func(name string) (channel, chatID string, err error)
+
 type MessageTool struct {
-	sendCallback   SendCallback
-	defaultChannel string
-	defaultChatID  string
-	sentInRound    bool   // Tracks whether a message was sent in the current processing round
-	lastSentContent string // Content of the last message sent in this round
+	sendCallback     SendCallback
+	outboundCallback OutboundCallback
+	resolveRecipient RecipientResolver
+	attachmentDirs   []string // local attachments must be under one of these
+	currentChatOnly  bool     // the sender may only message the current chat
+	defaultChannel   string
+	defaultChatID    string
+	speech           *bus.Speech // how replies to the current chat are spoken, if at all
+	sentInRound      bool        // Tracks whether a message was sent in the current processing round
+	lastSentContent  string      // Content of the last message sent in this round
 }
 
 func NewMessageTool() *MessageTool {
@@ -24,7 +41,9 @@ func (t *MessageTool) Name() string {
 }
 
 func (t *MessageTool) Description() string {
-	return "Send a message to user on a chat channel. Use this when you want to communicate something."
+	return "Send a message to user on a chat channel. Use this when you want to communicate something. " +
+		"Can reach a person by name (\"to\") on the channel they last used, attach files, reply to a message, offer buttons, edit/delete a message you sent (\"last\" targets your latest one), or speak the message as a voice note. " +
+		"Channels that can't render these get a plain-text version."
 }
 
 func (t *MessageTool) Parameters() map[string]interface{} {
@@ -43,6 +62,53 @@ func (t *MessageTool) Parameters() map[string]interface{} {
 				"type":        "string",
 				"description": "Optional: target chat/user ID",
 			},
+			"to": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: name of a person to message instead of channel/chat_id; it goes to the chat where they last messaged you directly",
+			},
+			"attachments": map[string]interface{}{
+				"type":        "array",
+				"description": "Optional: files to send. path is a URL or a file in the workspace (relative paths resolve there); filename, mime_type and caption are optional",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"path":      map[string]interface{}{"type": "string"},
+						"filename":  map[string]interface{}{"type": "string"},
+						"mime_type": map[string]interface{}{"type": "string"},
+						"caption":   map[string]interface{}{"type": "string"},
+					},
+					"required": []string{"path"},
+				},
+			},
+			"reply_to": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: ID of the message to reply to",
+			},
+			"buttons": map[string]interface{}{
+				"type":        "array",
+				"description": "Optional: buttons shown under the message, e.g. to ask the user to pick an option. A press comes back to you as a message naming the button and its data; a button with url opens a link instead",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"label": map[string]interface{}{"type": "string"},
+						"data":  map[string]interface{}{"type": "string"},
+						"url":   map[string]interface{}{"type": "string"},
+					},
+					"required": []string{"label"},
+				},
+			},
+			"edit": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: ID of a message you sent to replace with this content, or \"last\"",
+			},
+			"delete": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: ID of a message you sent to delete, or \"last\". Content is ignored",
+			},
+			"speak": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Optional: true to send the content as a voice note, e.g. when the user asks for audio; false to force text. Replies to a voice note are spoken by default",
+			},
 		},
 		"required": []string{"content"},
 	}
@@ -55,6 +121,18 @@ func (t *MessageTool) SetContext(channel, chatID string) {
 	t.lastSentContent = ""
 }
 
+// SetSpeech sets how messages to the current chat are spoken by default;
+// nil sends them as text.
+func (t *MessageTool) SetSpeech(speech *bus.Speech) {
+	t.speech = speech
+}
+
+// SetCurrentChatOnly restricts the current round to the chat it came from,
+// so "to", channel and chat_id can't reach anyone else.
+func (t *MessageTool) SetCurrentChatOnly(only bool) {
+	t.currentChatOnly = only
+}
+
 // HasSentInRound returns true if the message tool sent a message during the current round.
 func (t *MessageTool) HasSentInRound() bool {
 	return t.sentInRound
@@ -69,15 +147,48 @@ func (t *MessageTool) SetSendCallback(callback SendCallback) {
 	t.sendCallback = callback
 }
 
+// SetRecipientResolver enables the "to" argument.
+func (t *MessageTool) SetRecipientResolver(resolver RecipientResolver) {
+	t.resolveRecipient = resolver
+}
+
+// SetAttachmentDirs allows local attachments from dirs, typically the
+// workspace and the channels' media directory; relative paths resolve
+// against the first. Other local files, config.json included, can't be sent.
+func (t *MessageTool) SetAttachmentDirs(dirs ...string) {
+	t.attachmentDirs = dirs
+}
+
+// SetOutboundCallback sets the callback used for every message. Without it
+// the tool falls back to the send callback, which only carries plain text.
+func (t *MessageTool) SetOutboundCallback(callback OutboundCallback) {
+	t.outboundCallback = callback
+}
+
 func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	deleteID, _ := args["delete"].(string)
 	content, ok := args["content"].(string)
-	if !ok {
+	if !ok && deleteID == "" {
 		return &ToolResult{ForLLM: "content is required", IsError: true}
 	}
 
 	channel, _ := args["channel"].(string)
 	chatID, _ := args["chat_id"].(string)
 
+	to, _ := args["to"].(string)
+	if t.currentChatOnly && (to != "" || (channel != "" && channel != t.defaultChannel) || (chatID != "" && chatID != t.defaultChatID)) {
+		return ErrorResult("you can only send messages to the current chat")
+	}
+	if to != "" && channel == "" && chatID == "" {
+		if t.resolveRecipient == nil {
+			return ErrorResult("sending to people by name is not supported here")
+		}
+		var err error
+		if channel, chatID, err = t.resolveRecipient(to); err != nil {
+			return ErrorResult(err.Error())
+		}
+	}
+
 	if channel == "" {
 		channel = t.defaultChannel
 	}
@@ -89,11 +200,40 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 		return &ToolResult{ForLLM: "No target channel/chat specified", IsError: true}
 	}
 
-	if t.sendCallback == nil {
-		return &ToolResult{ForLLM: "Message sending not configured", IsError: true}
+	msg := bus.OutboundMessage{
+		Channel:  channel,
+		ChatID:   chatID,
+		Content:  content,
+		DeleteID: deleteID,
+	}
+	msg.ReplyTo, _ = args["reply_to"].(string)
+	msg.EditID, _ = args["edit"].(string)
+	var err error
+	if msg.Attachments, err = parseAttachments(args["attachments"]); err != nil {
+		return ErrorResult(err.Error())
+	}
+	for i := range msg.Attachments {
+		if msg.Attachments[i].Path, err = t.attachmentPath(msg.Attachments[i].Path); err != nil {
+			return ErrorResult(err.Error())
+		}
+	}
+	if msg.Actions, err = parseActions(args["buttons"]); err != nil {
+		return ErrorResult(err.Error())
 	}
+	msg.Speech = t.speechFor(msg, args["speak"])
+	rich := msg.ReplyTo != "" || msg.EditID != "" || msg.DeleteID != "" || len(msg.Attachments) > 0 || len(msg.Actions) > 0
 
-	if err := t.sendCallback(channel, chatID, content); err != nil {
+	switch {
+	case t.outboundCallback != nil:
+		err = t.outboundCallback(msg)
+	case t.sendCallback == nil:
+		return &ToolResult{ForLLM: "Message sending not configured", IsError: true}
+	case rich:
+		return ErrorResult("attachments, buttons, replies, edits and deletes are not supported here")
+	default:
+		err = t.sendCallback(channel, chatID, content)
+	}
+	if err != nil {
 		return &ToolResult{
 			ForLLM:  fmt.Sprintf("sending message: %v", err),
 			IsError: true,
@@ -101,6 +241,13 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 		}
 	}
 
+	switch {
+	case msg.DeleteID != "":
+		return SilentResult(fmt.Sprintf("Message %s deleted in %s:%s", msg.DeleteID, channel, chatID))
+	case msg.EditID != "":
+		return SilentResult(fmt.Sprintf("Message %s edited in %s:%s", msg.EditID, channel, chatID))
+	}
+
 	t.sentInRound = true
 	t.lastSentContent = content
 	// Silent: user already received the message directly
@@ -109,3 +256,109 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 		Silent: true,
 	}
 }
+
+// speechFor applies the speak argument. Without it messages to the current
+// chat are spoken like the turn's reply would be.
+func (t *MessageTool) speechFor(msg bus.OutboundMessage, speak interface{}) *bus.Speech {
+	current := msg.Channel == t.defaultChannel && msg.ChatID == t.defaultChatID
+	switch speak {
+	case true:
+		if current && t.speech != nil {
+			speech := *t.speech
+			return &speech
+		}
+		return &bus.Speech{}
+	case nil:
+		if current && t.speech != nil && msg.EditID == "" && msg.DeleteID == "" {
+			speech := *t.speech
+			return &speech
+		}
+	}
+	return nil
+}
+
+// parseAttachments accepts a list of paths or attachment objects.
+func parseAttachments(raw interface{}) ([]bus.Attachment, error) {
+	items, _ := raw.([]interface{})
+	var attachments []bus.Attachment
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			if v != "" {
+				attachments = append(attachments, bus.Attachment{Path: v})
+			}
+		case map[string]interface{}:
+			a := bus.Attachment{}
+			a.Path, _ = v["path"].(string)
+			a.Filename, _ = v["filename"].(string)
+			a.MIMEType, _ = v["mime_type"].(string)
+			a.Caption, _ = v["caption"].(string)
+			if a.Path == "" {
+				return nil, fmt.Errorf("attachment path is required")
+			}
+			attachments = append(attachments, a)
+		default:
+			return nil, fmt.Errorf("attachments must be paths or objects")
+		}
+	}
+	return attachments, nil
+}
+
+// attachmentPath resolves a local attachment and checks it is under one of
+// the attachment dirs. URLs are passed through.
+func (t *MessageTool) attachmentPath(path string) (string, error) {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path, nil
+	}
+	if len(t.attachmentDirs) == 0 {
+		return "", fmt.Errorf("local attachments are not supported here")
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(t.attachmentDirs[0], path)
+	}
+	abs := resolveLinks(path)
+	for _, dir := range t.attachmentDirs {
+		if rel, err := filepath.Rel(resolveLinks(dir), abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return abs, nil
+		}
+	}
+	return "", fmt.Errorf("access denied: attachment %s is outside the workspace", path)
+}
+
+// resolveLinks returns the absolute path with symlinks resolved, as far as
+// it exists.
+func resolveLinks(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real
+	}
+	return abs
+}
+
+// parseActions reads the buttons argument. Every button needs a label, which
+// doubles as its data when neither data nor url is given.
+func parseActions(raw interface{}) ([]bus.Action, error) {
+	items, _ := raw.([]interface{})
+	var actions []bus.Action
+	for _, item := range items {
+		v, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("buttons must be objects with a label")
+		}
+		a := bus.Action{}
+		a.Label, _ = v["label"].(string)
+		a.Data, _ = v["data"].(string)
+		a.URL, _ = v["url"].(string)
+		if a.Label == "" {
+			return nil, fmt.Errorf("button label is required")
+		}
+		if a.Data == "" && a.URL == "" {
+			a.Data = a.Label
+		}
+		actions = append(actions, a)
+	}
+	return actions, nil
+}
@@ -3,7 +3,11 @@ package tools
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
 )
 
 func TestMessageTool_Execute_Success(t *testing.T) {
@@ -257,3 +261,206 @@ func TestMessageTool_Parameters(t *testing.T) {
 		t.Error("Expected chat_id type to be 'string'")
 	}
 }
+
+func TestMessageTool_Execute_Rich(t *testing.T) {
+	workspace := t.TempDir()
+	tool := NewMessageTool()
+	tool.SetContext("test-channel", "test-chat-id")
+	tool.SetAttachmentDirs(workspace)
+
+	var sent []bus.OutboundMessage
+	tool.SetOutboundCallback(func(msg bus.OutboundMessage) error {
+		sent = append(sent, msg)
+		return nil
+	})
+
+	ctx := context.Background()
+	result := tool.Execute(ctx, map[string]interface{}{
+		"content":     "Pick one",
+		"reply_to":    "m1",
+		"attachments": []interface{}{"a.png", map[string]interface{}{"path": filepath.Join(workspace, "b.pdf"), "caption": "B"}},
+		"buttons":     []interface{}{map[string]interface{}{"label": "Yes"}, map[string]interface{}{"label": "Docs", "url": "https://example.com"}},
+	})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+	msg := sent[0]
+	if msg.ReplyTo != "m1" || len(msg.Attachments) != 2 || msg.Attachments[1].Caption != "B" {
+		t.Errorf("message = %+v", msg)
+	}
+	if len(msg.Actions) != 2 || msg.Actions[0].Data != "Yes" || msg.Actions[1].URL != "https://example.com" {
+		t.Errorf("actions = %+v", msg.Actions)
+	}
+	if !tool.HasSentInRound() {
+		t.Error("a sent message should count for the round")
+	}
+
+	// Deleting needs no content and doesn't count as the round's reply
+	tool.SetContext("test-channel", "test-chat-id")
+	result = tool.Execute(ctx, map[string]interface{}{"delete": "last"})
+	if result.IsError || sent[1].DeleteID != "last" || tool.HasSentInRound() {
+		t.Errorf("delete: result=%+v msg=%+v", result, sent[1])
+	}
+
+	if result := tool.Execute(ctx, map[string]interface{}{"content": "x", "buttons": []interface{}{map[string]interface{}{}}}); !result.IsError {
+		t.Error("expected an error for a button without label")
+	}
+}
+
+func TestMessageTool_Execute_AttachmentPaths(t *testing.T) {
+	root := t.TempDir()
+	workspace := filepath.Join(root, "workspace")
+	media := filepath.Join(root, "media")
+	os.MkdirAll(workspace, 0755)
+	os.MkdirAll(media, 0755)
+	os.WriteFile(filepath.Join(root, "config.json"), []byte(`{"api_key": "secret"}`), 0600)
+	os.WriteFile(filepath.Join(workspace, "report.pdf"), []byte("%PDF"), 0644)
+	os.WriteFile(filepath.Join(media, "photo.jpg"), []byte("jpg"), 0644)
+
+	tool := NewMessageTool()
+	tool.SetContext("test-channel", "test-chat-id")
+	tool.SetAttachmentDirs(workspace, media)
+	var sent []bus.OutboundMessage
+	tool.SetOutboundCallback(func(msg bus.OutboundMessage) error {
+		sent = append(sent, msg)
+		return nil
+	})
+
+	allowed := []string{"report.pdf", filepath.Join(media, "photo.jpg"), "https://example.com/a.png"}
+	for _, path := range allowed {
+		result := tool.Execute(context.Background(), map[string]interface{}{"content": "here", "attachments": []interface{}{path}})
+		if result.IsError {
+			t.Errorf("attachment %q rejected: %s", path, result.ForLLM)
+		}
+	}
+	if got := sent[0].Attachments[0].Path; got != resolveLinks(filepath.Join(workspace, "report.pdf")) {
+		t.Errorf("relative attachment resolved to %q", got)
+	}
+
+	denied := []string{
+		"../config.json",
+		filepath.Join(root, "config.json"),
+		"/etc/passwd",
+		filepath.Join(root, "workspace2", "x"),
+	}
+	for _, path := range denied {
+		result := tool.Execute(context.Background(), map[string]interface{}{"content": "here", "attachments": []interface{}{path}})
+		if !result.IsError {
+			t.Errorf("attachment %q should be rejected", path)
+		}
+	}
+	if len(sent) != len(allowed) {
+		t.Errorf("sent %d messages, want %d", len(sent), len(allowed))
+	}
+}
+
+func TestMessageTool_Execute_CurrentChatOnly(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetContext("telegram", "7")
+	tool.SetCurrentChatOnly(true)
+	tool.SetRecipientResolver(func(name string) (string, string, error) { return "slack", "D1", nil })
+	var sentChatID string
+	tool.SetSendCallback(func(channel, chatID, content string) error {
+		sentChatID = chatID
+		return nil
+	})
+
+	ctx := context.Background()
+	for _, args := range []map[string]interface{}{
+		{"content": "hi", "to": "Ana"},
+		{"content": "hi", "channel": "slack", "chat_id": "D1"},
+		{"content": "hi", "chat_id": "8"},
+	} {
+		if result := tool.Execute(ctx, args); !result.IsError {
+			t.Errorf("%v should be limited to the current chat", args)
+		}
+	}
+	if sentChatID != "" {
+		t.Errorf("message reached chat %s", sentChatID)
+	}
+	if result := tool.Execute(ctx, map[string]interface{}{"content": "hi", "chat_id": "7"}); result.IsError || sentChatID != "7" {
+		t.Errorf("current chat: %+v", result)
+	}
+}
+
+func TestMessageTool_Execute_RichWithoutOutboundCallback(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetContext("test-channel", "test-chat-id")
+	tool.SetSendCallback(func(channel, chatID, content string) error { return nil })
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"content": "hi", "edit": "last"})
+	if !result.IsError {
+		t.Error("rich fields should be rejected by the plain send callback")
+	}
+}
+
+func TestMessageTool_Execute_To(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetContext("test-channel", "test-chat-id")
+
+	var sentChannel, sentChatID string
+	tool.SetSendCallback(func(channel, chatID, content string) error {
+		sentChannel, sentChatID = channel, chatID
+		return nil
+	})
+
+	ctx := context.Background()
+	if result := tool.Execute(ctx, map[string]interface{}{"content": "hi", "to": "Ana"}); !result.IsError {
+		t.Error("expected an error without a recipient resolver")
+	}
+
+	tool.SetRecipientResolver(func(name string) (string, string, error) {
+		if name != "Ana" {
+			return "", "", errors.New("unknown")
+		}
+		return "slack", "D42", nil
+	})
+	result := tool.Execute(ctx, map[string]interface{}{"content": "hi", "to": "Ana"})
+	if result.IsError || sentChannel != "slack" || sentChatID != "D42" {
+		t.Errorf("sent to %s:%s, result %+v", sentChannel, sentChatID, result)
+	}
+	if result := tool.Execute(ctx, map[string]interface{}{"content": "hi", "to": "Bob"}); !result.IsError {
+		t.Error("expected an error for an unknown person")
+	}
+}
+
+func TestMessageTool_Execute_Speak(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetContext("test-channel", "test-chat-id")
+
+	var sent []bus.OutboundMessage
+	tool.SetOutboundCallback(func(msg bus.OutboundMessage) error {
+		sent = append(sent, msg)
+		return nil
+	})
+	ctx := context.Background()
+	send := func(args map[string]interface{}) bus.OutboundMessage {
+		t.Helper()
+		if result := tool.Execute(ctx, args); result.IsError {
+			t.Fatalf("unexpected error: %s", result.ForLLM)
+		}
+		return sent[len(sent)-1]
+	}
+
+	if msg := send(map[string]interface{}{"content": "Hi"}); msg.Speech != nil {
+		t.Errorf("text turn spoke: %+v", msg.Speech)
+	}
+	if msg := send(map[string]interface{}{"content": "Hi", "speak": true}); msg.Speech == nil {
+		t.Error("speak:true sent text")
+	}
+
+	// Replies in a voice turn are spoken in the turn's voice unless told not to
+	tool.SetSpeech(&bus.Speech{Voice: "nova"})
+	if msg := send(map[string]interface{}{"content": "Hi"}); msg.Speech == nil || msg.Speech.Voice != "nova" {
+		t.Errorf("voice turn: speech = %+v", msg.Speech)
+	}
+	if msg := send(map[string]interface{}{"content": "Hi", "speak": false}); msg.Speech != nil {
+		t.Error("speak:false was spoken")
+	}
+	if msg := send(map[string]interface{}{"content": "Hi", "channel": "other", "chat_id": "42"}); msg.Speech != nil {
+		t.Error("message to another chat took the turn's speech")
+	}
+	if msg := send(map[string]interface{}{"content": "Hi", "edit": "last"}); msg.Speech != nil {
+		t.Error("edit was spoken")
+	}
+}
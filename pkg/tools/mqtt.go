@@ -0,0 +1,166 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/mqtt"
+)
+
+// MQTTTool publishes to MQTT topics and reads retained device state, e.g. to
+// switch a Zigbee2MQTT plug or check a Tasmota sensor. Each call uses a
+// short-lived connection.
+type MQTTTool struct {
+	opts          mqtt.Options
+	publishTopics []string
+}
+
+// NewMQTTTool creates the tool. publishTopics limits which topic filters the
+// agent may publish to; empty allows all.
+func NewMQTTTool(opts mqtt.Options, publishTopics []string) *MQTTTool {
+	if opts.ClientID == "" {
+		opts.ClientID = "picoclaw"
+	}
+	opts.ClientID += "-tool"
+	return &MQTTTool{opts: opts, publishTopics: publishTopics}
+}
+
+func (t *MQTTTool) Name() string { return "mqtt" }
+
+func (t *MQTTTool) Description() string {
+	return "Home automation over MQTT (Zigbee2MQTT, Tasmota, ...). Actions: publish (send a payload to a topic, e.g. zigbee2mqtt/lamp/set {\"state\":\"ON\"}), get (read the retained state of a topic; + and # wildcards allowed)."
+}
+
+func (t *MQTTTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"publish", "get"},
+				"description": "Action to perform",
+			},
+			"topic": map[string]interface{}{
+				"type":        "string",
+				"description": "MQTT topic (wildcards only for get)",
+			},
+			"payload": map[string]interface{}{
+				"type":        "string",
+				"description": "Message payload, usually JSON (for publish)",
+			},
+			"retain": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Publish as retained message (for publish, default false)",
+			},
+			"wait_ms": map[string]interface{}{
+				"type":        "number",
+				"description": "How long to collect retained messages, default 1000 (for get)",
+			},
+		},
+		"required": []string{"action", "topic"},
+	}
+}
+
+func (t *MQTTTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	topic, _ := args["topic"].(string)
+	if topic == "" {
+		return ErrorResult("topic is required")
+	}
+
+	switch action {
+	case "publish":
+		payload, _ := args["payload"].(string)
+		retain, _ := args["retain"].(bool)
+		return t.publish(ctx, topic, payload, retain)
+	case "get":
+		wait := time.Second
+		if ms, ok := args["wait_ms"].(float64); ok && ms > 0 && ms <= 10000 {
+			wait = time.Duration(ms) * time.Millisecond
+		}
+		return t.get(ctx, topic, wait)
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+func (t *MQTTTool) publish(ctx context.Context, topic, payload string, retain bool) *ToolResult {
+	if !t.canPublish(topic) {
+		return ErrorResult(fmt.Sprintf("publishing to %s is not allowed (allowed: %s)", topic, strings.Join(t.publishTopics, ", ")))
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	client, err := mqtt.Dial(dialCtx, t.opts, nil)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("mqtt connect failed: %v", err))
+	}
+	defer client.Close()
+
+	if err := client.Publish(topic, []byte(payload), retain); err != nil {
+		return ErrorResult(fmt.Sprintf("publish failed: %v", err))
+	}
+	return SilentResult(fmt.Sprintf("Published to %s: %s", topic, payload))
+}
+
+func (t *MQTTTool) canPublish(topic string) bool {
+	if len(t.publishTopics) == 0 {
+		return true
+	}
+	for _, filter := range t.publishTopics {
+		if mqtt.Match(filter, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// get subscribes briefly and reports the retained messages the broker sends.
+func (t *MQTTTool) get(ctx context.Context, topic string, wait time.Duration) *ToolResult {
+	var mu sync.Mutex
+	state := make(map[string]string)
+
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	client, err := mqtt.Dial(dialCtx, t.opts, func(m mqtt.Message) {
+		if !m.Retained {
+			return
+		}
+		mu.Lock()
+		state[m.Topic] = string(m.Payload)
+		mu.Unlock()
+	})
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("mqtt connect failed: %v", err))
+	}
+	defer client.Close()
+
+	if err := client.Subscribe(dialCtx, topic); err != nil {
+		return ErrorResult(fmt.Sprintf("subscribe failed: %v", err))
+	}
+	select {
+	case <-time.After(wait):
+	case <-ctx.Done():
+		return ErrorResult("cancelled")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(state) == 0 {
+		return SilentResult(fmt.Sprintf("No retained state on %s", topic))
+	}
+	topics := make([]string, 0, len(state))
+	for k := range state {
+		topics = append(topics, k)
+	}
+	sort.Strings(topics)
+	var lines []string
+	for _, k := range topics {
+		lines = append(lines, fmt.Sprintf("%s: %s", k, state[k]))
+	}
+	return SilentResult(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,50 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/mqtt"
+	"github.com/sipeed/picoclaw/pkg/mqtt/mqtttest"
+)
+
+func TestMQTTTool(t *testing.T) {
+	broker := mqtttest.NewBroker()
+	defer broker.Close()
+	broker.Publish("tasmota/plug/STATE", []byte(`{"POWER":"OFF"}`), true)
+	broker.Publish("tasmota/fan/STATE", []byte(`{"POWER":"ON"}`), true)
+
+	tool := NewMQTTTool(mqtt.Options{Broker: broker.URL}, []string{"zigbee2mqtt/+/set"})
+	ctx := context.Background()
+
+	result := tool.Execute(ctx, map[string]interface{}{"action": "get", "topic": "tasmota/+/STATE", "wait_ms": float64(300)})
+	if result.IsError || !strings.Contains(result.ForLLM, `tasmota/fan/STATE: {"POWER":"ON"}`) || !strings.Contains(result.ForLLM, "tasmota/plug/STATE") {
+		t.Errorf("unexpected get result: %+v", result)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"action": "publish", "topic": "zigbee2mqtt/lamp/set", "payload": `{"state":"ON"}`})
+	if result.IsError {
+		t.Fatalf("publish failed: %s", result.ForLLM)
+	}
+	waitForBroker(t, broker, "zigbee2mqtt/lamp/set")
+
+	result = tool.Execute(ctx, map[string]interface{}{"action": "publish", "topic": "tasmota/plug/cmnd", "payload": "ON"})
+	if !result.IsError {
+		t.Error("publishing outside publish_topics should fail")
+	}
+}
+
+func waitForBroker(t *testing.T, broker *mqtttest.Broker, topic string) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		for _, m := range broker.Received() {
+			if m.Topic == topic {
+				return
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("no message on %s", topic)
+}
@@ -19,6 +19,7 @@ type SubagentTask struct {
 	Status        string
 	Result        string
 	Created       int64
+	cancel        context.CancelFunc
 }
 
 // SystemPromptBuilder is a function that builds the system prompt dynamically.
@@ -119,8 +120,15 @@ func (sm *SubagentManager) Spawn(ctx context.Context, task, label, originChannel
 	}
 	sm.tasks[taskID] = subagentTask
 
+	// The task outlives the turn that spawned it; CancelOrigin stops it
+	taskCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	subagentTask.cancel = cancel
+
 	// Start task in background with context cancellation support
-	go sm.runTask(ctx, subagentTask, callback)
+	go func() {
+		defer cancel()
+		sm.runTask(taskCtx, subagentTask, callback)
+	}()
 
 	if label != "" {
 		return fmt.Sprintf("Spawned subagent '%s' for task: %s", label, task), nil
@@ -128,10 +136,8 @@ func (sm *SubagentManager) Spawn(ctx context.Context, task, label, originChannel
 	return fmt.Sprintf("Spawned subagent for task: %s", task), nil
 }
 
+// runTask runs a spawned task; Spawn has already marked it running.
 func (sm *SubagentManager) runTask(ctx context.Context, task *SubagentTask, callback AsyncCallback) {
-	task.Status = "running"
-	task.Created = time.Now().UnixMilli()
-
 	// Build system prompt for subagent (inherits main agent personality if configured)
 	systemPrompt := sm.buildSystemPrompt()
 
@@ -176,14 +182,6 @@ func (sm *SubagentManager) runTask(ctx context.Context, task *SubagentTask, call
 
 	sm.mu.Lock()
 	var result *ToolResult
-	defer func() {
-		sm.mu.Unlock()
-		// Call callback if provided and result is set
-		if callback != nil && result != nil {
-			callback(ctx, result)
-		}
-	}()
-
 	if err != nil {
 		task.Status = "failed"
 		task.Result = fmt.Sprintf("Error: %v", err)
@@ -220,17 +218,40 @@ func (sm *SubagentManager) runTask(ctx context.Context, task *SubagentTask, call
 		}
 	}
 
-	// Send announce message back to main agent
-	if sm.bus != nil {
-		announceContent := fmt.Sprintf("Task '%s' completed.\n\nResult:\n%s", task.Label, task.Result)
-		sm.bus.PublishInbound(bus.InboundMessage{
-			Channel:  "system",
-			SenderID: fmt.Sprintf("subagent:%s", task.ID),
-			// Format: "original_channel:original_chat_id" for routing back
-			ChatID:  fmt.Sprintf("%s:%s", task.OriginChannel, task.OriginChatID),
-			Content: announceContent,
-		})
+	announce := bus.InboundMessage{
+		Channel:  "system",
+		SenderID: fmt.Sprintf("subagent:%s", task.ID),
+		// Format: "original_channel:original_chat_id" for routing back
+		ChatID:  fmt.Sprintf("%s:%s", task.OriginChannel, task.OriginChatID),
+		Content: fmt.Sprintf("Task '%s' completed.\n\nResult:\n%s", task.Label, task.Result),
+	}
+	sm.mu.Unlock()
+
+	if callback != nil {
+		callback(ctx, result)
+	}
+
+	// Send announce message back to main agent, unless /stop cancelled the
+	// task: announcing it would start a new turn in the stopped chat
+	if sm.bus != nil && ctx.Err() == nil {
+		sm.bus.PublishInbound(announce)
+	}
+}
+
+// CancelOrigin stops the running tasks spawned from a chat and returns how
+// many there were.
+func (sm *SubagentManager) CancelOrigin(channel, chatID string) int {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	cancelled := 0
+	for _, task := range sm.tasks {
+		if task.Status == "running" && task.OriginChannel == channel && task.OriginChatID == chatID && task.cancel != nil {
+			task.cancel()
+			cancelled++
+		}
 	}
+	return cancelled
 }
 
 func (sm *SubagentManager) GetTask(taskID string) (*SubagentTask, bool) {
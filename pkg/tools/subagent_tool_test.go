@@ -4,6 +4,7 @@ import (
 	"context"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/providers"
@@ -313,3 +314,54 @@ func TestSubagentTool_ForUserTruncation(t *testing.T) {
 		t.Error("ForLLM should contain reference to original task")
 	}
 }
+
+// blockingProvider answers only once its context is cancelled.
+type blockingProvider struct{ MockLLMProvider }
+
+func (p *blockingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// TestSubagentManager_CancelOrigin verifies spawned tasks outlive their turn until cancelled
+func TestSubagentManager_CancelOrigin(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	manager := NewSubagentManager(&blockingProvider{}, "test-model", "/tmp/test", msgBus)
+
+	done := make(chan *ToolResult, 1)
+	turnCtx, endTurn := context.WithCancel(context.Background())
+	if _, err := manager.Spawn(turnCtx, "research", "r", "telegram", "42", func(ctx context.Context, result *ToolResult) {
+		done <- result
+	}); err != nil {
+		t.Fatalf("Spawn failed: %v", err)
+	}
+	endTurn()
+
+	select {
+	case result := <-done:
+		t.Fatalf("task stopped with its turn: %+v", result)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if n := manager.CancelOrigin("telegram", "7"); n != 0 {
+		t.Errorf("CancelOrigin for another chat stopped %d tasks", n)
+	}
+	if n := manager.CancelOrigin("telegram", "42"); n != 1 {
+		t.Errorf("CancelOrigin stopped %d tasks, want 1", n)
+	}
+	select {
+	case result := <-done:
+		if !result.IsError || !strings.Contains(result.ForLLM, "cancelled") {
+			t.Errorf("result = %+v", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("task still running after CancelOrigin")
+	}
+
+	// A stopped task isn't announced, which would start a new turn
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if msg, ok := msgBus.ConsumeInbound(ctx); ok {
+		t.Errorf("cancelled task announced: %+v", msg)
+	}
+}
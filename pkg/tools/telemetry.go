@@ -19,7 +19,7 @@ func NewTelemetryTool(tracker *telemetry.Tracker) *TelemetryTool {
 func (t *TelemetryTool) Name() string { return "telemetry" }
 
 func (t *TelemetryTool) Description() string {
-	return "Check token usage statistics. Use when the user asks about token consumption, costs, or usage stats."
+	return "Check token usage statistics and user feedback (reaction) counts. Use when the user asks about token consumption, costs, usage stats or feedback."
 }
 
 func (t *TelemetryTool) Parameters() map[string]interface{} {
@@ -67,14 +67,20 @@ func (t *TelemetryTool) Execute(ctx context.Context, args map[string]interface{}
 
 		var grandTotal int64
 		var grandCalls int64
+		var positive, negative int64
 		for _, d := range days {
 			sb.WriteString(fmt.Sprintf("%s: %d tokens in %d calls\n",
 				d.Date, d.Totals.TotalTokens, d.Totals.Calls))
 			grandTotal += d.Totals.TotalTokens
 			grandCalls += d.Totals.Calls
+			positive += d.Feedback.Positive
+			negative += d.Feedback.Negative
 		}
 		sb.WriteString(fmt.Sprintf("\nGrand total: %d tokens in %d calls over %d days\n",
 			grandTotal, grandCalls, len(days)))
+		if positive > 0 || negative > 0 {
+			sb.WriteString(fmt.Sprintf("User feedback: %d 👍 / %d 👎\n", positive, negative))
+		}
 
 		return SilentResult(sb.String())
 
@@ -0,0 +1,440 @@
+package users
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LinkCodeTTL is how long a /link code stays valid.
+const LinkCodeTTL = 10 * time.Minute
+
+const (
+	// maxLinkFailures is how many wrong codes a sender may try before being
+	// locked out of linking for linkLockout.
+	maxLinkFailures = 5
+	linkLockout     = time.Hour
+	// maxCodeMisses is how many wrong codes, from anyone, a live code
+	// survives. A linked account inherits the user's roles, so codes must
+	// not be guessable.
+	maxCodeMisses = 10
+	// flushInterval is how often LastSeen and token counts are written.
+	flushInterval = time.Minute
+)
+
+// Account is one sender identity on one channel.
+type Account struct {
+	Channel  string `json:"channel"`
+	SenderID string `json:"sender_id"`
+}
+
+// User is a person known across channels.
+type User struct {
+	ID          string        `json:"id"`
+	Name        string        `json:"name,omitempty"`
+	Accounts    []Account     `json:"accounts"`
+	LastChannel string        `json:"last_channel,omitempty"` // where they last messaged the bot directly
+	LastChatID  string        `json:"last_chat_id,omitempty"`
+	LastSeen    time.Time     `json:"last_seen"`
+	UsageDay    string        `json:"usage_day,omitempty"` // date TokensToday counts for
+	TokensToday int           `json:"tokens_today,omitempty"`
+	Voice       VoiceSettings `json:"voice,omitzero"`
+}
+
+// Modes for VoiceSettings.Replies.
+const (
+	VoiceRepliesAuto   = ""       // speak only when answering a voice note
+	VoiceRepliesAlways = "always" // speak every reply
+	VoiceRepliesOff    = "off"    // never speak
+)
+
+// VoiceSettings is how a user likes replies spoken. Empty fields use the
+// configured defaults.
+type VoiceSettings struct {
+	Voice    string `json:"voice,omitempty"`    // TTS engine voice name
+	Language string `json:"language,omitempty"` // e.g. "en-US"; picks a voice when Voice is empty
+	Replies  string `json:"replies,omitempty"`
+}
+
+// Channels lists the channels the user has accounts on.
+func (u User) Channels() []string {
+	seen := make(map[string]bool)
+	var channels []string
+	for _, a := range u.Accounts {
+		if !seen[a.Channel] {
+			seen[a.Channel] = true
+			channels = append(channels, a.Channel)
+		}
+	}
+	return channels
+}
+
+func (u *User) clone() User {
+	c := *u
+	c.Accounts = append([]Account(nil), u.Accounts...)
+	return c
+}
+
+type linkCode struct {
+	userID  string
+	expires time.Time
+	misses  int // wrong codes tried while this one was live
+}
+
+// linkFailures counts a sender's wrong /link codes.
+type linkFailures struct {
+	count  int
+	locked time.Time // no attempts accepted before this
+}
+
+// Directory links channel-specific sender IDs to users, persisted to
+// workspace/state/users.json.
+type Directory struct {
+	filePath string
+	mu       sync.Mutex
+	users    map[string]*User
+	accounts map[string]string // account key -> user ID
+	codes    map[string]linkCode
+	failures map[string]linkFailures // account key -> wrong codes tried
+	dirty    bool                    // changes saveSoon hasn't written yet
+	savedAt  time.Time
+}
+
+// NewDirectory loads the user directory for a workspace.
+func NewDirectory(workspace string) *Directory {
+	stateDir := filepath.Join(workspace, "state")
+	os.MkdirAll(stateDir, 0755)
+	d := &Directory{
+		filePath: filepath.Join(stateDir, "users.json"),
+		users:    make(map[string]*User),
+		accounts: make(map[string]string),
+		codes:    make(map[string]linkCode),
+		failures: make(map[string]linkFailures),
+	}
+	d.load()
+	return d
+}
+
+// accountKey identifies an account by its stable ID, ignoring the
+// "|username" suffix some channels append to sender IDs.
+func accountKey(channel, senderID string) string {
+	if idx := strings.Index(senderID, "|"); idx > 0 {
+		senderID = senderID[:idx]
+	}
+	return channel + ":" + senderID
+}
+
+// Touch returns the user behind a sender, creating one on first contact.
+// A non-empty chatID is recorded as where they can be reached; pass "" for
+// group chats. name is used when the user has none yet; the "|username"
+// part of senderID is the fallback.
+func (d *Directory) Touch(channel, senderID, chatID, name string) (User, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := accountKey(channel, senderID)
+	u, ok := d.users[d.accounts[key]]
+	changed := !ok
+	if !ok {
+		u = &User{ID: newUserID(), Accounts: []Account{{Channel: channel, SenderID: senderID}}}
+		d.users[u.ID] = u
+		d.accounts[key] = u.ID
+	}
+	if u.Name == "" {
+		u.Name = name
+		if idx := strings.Index(senderID, "|"); u.Name == "" && idx > 0 {
+			u.Name = senderID[idx+1:]
+		}
+		changed = changed || u.Name != ""
+	}
+	if chatID != "" && (u.LastChannel != channel || u.LastChatID != chatID) {
+		u.LastChannel = channel
+		u.LastChatID = chatID
+		changed = true
+	}
+	u.LastSeen = time.Now()
+	if changed {
+		// New people, names and places to reach them are written right away
+		return u.clone(), d.save()
+	}
+	return u.clone(), d.saveSoon()
+}
+
+// Lookup returns the user behind a sender, if known.
+func (d *Directory) Lookup(channel, senderID string) (User, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	u, ok := d.users[d.accounts[accountKey(channel, senderID)]]
+	if !ok {
+		return User{}, false
+	}
+	return u.clone(), true
+}
+
+// Find returns the user with the given ID or name (case-insensitive).
+func (d *Directory) Find(nameOrID string) (User, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if u, ok := d.users[nameOrID]; ok {
+		return u.clone(), true
+	}
+	var found *User
+	for _, u := range d.users {
+		if strings.EqualFold(u.Name, nameOrID) && (found == nil || u.LastSeen.After(found.LastSeen)) {
+			found = u
+		}
+	}
+	if found == nil {
+		return User{}, false
+	}
+	return found.clone(), true
+}
+
+// List returns all users, most recently active first.
+func (d *Directory) List() []User {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	list := make([]User, 0, len(d.users))
+	for _, u := range d.users {
+		list = append(list, u.clone())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LastSeen.After(list[j].LastSeen) })
+	return list
+}
+
+// SetName renames a user.
+func (d *Directory) SetName(userID, name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	u, ok := d.users[userID]
+	if !ok {
+		return fmt.Errorf("unknown user %s", userID)
+	}
+	u.Name = name
+	return d.save()
+}
+
+// SetVoice changes how a user's replies are spoken.
+func (d *Directory) SetVoice(userID string, voice VoiceSettings) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	u, ok := d.users[userID]
+	if !ok {
+		return fmt.Errorf("unknown user %s", userID)
+	}
+	u.Voice = voice
+	return d.save()
+}
+
+// ForChat returns the user last reached directly in a chat, if any.
+func (d *Directory) ForChat(channel, chatID string) (User, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, u := range d.users {
+		if u.LastChannel == channel && u.LastChatID == chatID {
+			return u.clone(), true
+		}
+	}
+	return User{}, false
+}
+
+// AddTokens adds LLM token usage to a user's count for today.
+func (d *Directory) AddTokens(userID string, tokens int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	u, ok := d.users[userID]
+	if !ok {
+		return fmt.Errorf("unknown user %s", userID)
+	}
+	if today := time.Now().Format("2006-01-02"); u.UsageDay != today {
+		u.UsageDay, u.TokensToday = today, 0
+	}
+	u.TokensToday += tokens
+	return d.saveSoon()
+}
+
+// TokensToday returns how many LLM tokens a user has used today.
+func (d *Directory) TokensToday(userID string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	u, ok := d.users[userID]
+	if !ok || u.UsageDay != time.Now().Format("2006-01-02") {
+		return 0
+	}
+	return u.TokensToday
+}
+
+// NewLinkCode issues a one-time code that links another account to userID.
+func (d *Directory) NewLinkCode(userID string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	for code, lc := range d.codes {
+		if now.After(lc.expires) || lc.userID == userID {
+			delete(d.codes, code)
+		}
+	}
+	for {
+		b := make([]byte, 5)
+		rand.Read(b)
+		code := base32.StdEncoding.EncodeToString(b) // 8 characters, 40 bits
+		if _, taken := d.codes[code]; !taken {
+			d.codes[code] = linkCode{userID: userID, expires: now.Add(LinkCodeTTL)}
+			return code
+		}
+	}
+}
+
+// Link attaches the sender's account to the user that issued code. Any
+// other accounts the sender's user already had move along with it. Senders
+// who keep trying wrong codes are locked out for a while.
+func (d *Directory) Link(code, channel, senderID string) (User, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	key := accountKey(channel, senderID)
+	if f := d.failures[key]; now.Before(f.locked) {
+		return User{}, fmt.Errorf("too many wrong codes, try again later")
+	}
+
+	code = strings.ToUpper(strings.TrimSpace(code))
+	lc, ok := d.codes[code]
+	var target *User
+	if ok && now.Before(lc.expires) {
+		target, ok = d.users[lc.userID]
+	} else {
+		ok = false
+	}
+	if !ok {
+		delete(d.codes, code)
+		d.linkFailed(key, now)
+		return User{}, fmt.Errorf("invalid or expired link code")
+	}
+	delete(d.codes, code)
+	delete(d.failures, key)
+
+	if old, ok := d.users[d.accounts[key]]; ok {
+		if old.ID == target.ID {
+			return target.clone(), nil
+		}
+		for _, a := range old.Accounts {
+			target.Accounts = append(target.Accounts, a)
+			d.accounts[accountKey(a.Channel, a.SenderID)] = target.ID
+		}
+		if old.LastChatID != "" && (target.LastChatID == "" || old.LastSeen.After(target.LastSeen)) {
+			target.LastChannel, target.LastChatID, target.LastSeen = old.LastChannel, old.LastChatID, old.LastSeen
+		}
+		switch {
+		case old.UsageDay == target.UsageDay:
+			target.TokensToday += old.TokensToday
+		case old.UsageDay > target.UsageDay:
+			target.UsageDay, target.TokensToday = old.UsageDay, old.TokensToday
+		}
+		delete(d.users, old.ID)
+	} else {
+		target.Accounts = append(target.Accounts, Account{Channel: channel, SenderID: senderID})
+		d.accounts[key] = target.ID
+	}
+	return target.clone(), d.save()
+}
+
+// linkFailed records a wrong code from the account key, locking it out after
+// maxLinkFailures, and counts it against every live code. Caller must hold
+// d.mu.
+func (d *Directory) linkFailed(key string, now time.Time) {
+	f := d.failures[key]
+	if !f.locked.IsZero() && !now.Before(f.locked) {
+		f = linkFailures{} // served the last lockout
+	}
+	f.count++
+	if f.count >= maxLinkFailures {
+		f.locked = now.Add(linkLockout)
+	}
+	d.failures[key] = f
+
+	for c, lc := range d.codes {
+		lc.misses++
+		if lc.misses >= maxCodeMisses {
+			delete(d.codes, c)
+			continue
+		}
+		d.codes[c] = lc
+	}
+}
+
+func newUserID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return "u-" + hex.EncodeToString(b)
+}
+
+func (d *Directory) load() {
+	data, err := os.ReadFile(d.filePath)
+	if err != nil {
+		return
+	}
+	var list []*User
+	if json.Unmarshal(data, &list) != nil {
+		return
+	}
+	for _, u := range list {
+		d.users[u.ID] = u
+		for _, a := range u.Accounts {
+			d.accounts[accountKey(a.Channel, a.SenderID)] = u.ID
+		}
+	}
+}
+
+// save writes the directory atomically. Must be called with the lock held.
+// saveSoon batches frequent small changes such as LastSeen and token counts,
+// writing at most once per flushInterval. Flush writes what's left.
+func (d *Directory) saveSoon() error {
+	d.dirty = true
+	if time.Since(d.savedAt) < flushInterval {
+		return nil
+	}
+	return d.save()
+}
+
+// Flush writes changes saveSoon has held back, e.g. on shutdown.
+func (d *Directory) Flush() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.dirty {
+		return nil
+	}
+	return d.save()
+}
+
+func (d *Directory) save() error {
+	list := make([]*User, 0, len(d.users))
+	for _, u := range d.users {
+		list = append(list, u)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := d.filePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, d.filePath); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	d.dirty = false
+	d.savedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,148 @@
+package users
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTouchAndLink(t *testing.T) {
+	workspace := t.TempDir()
+	d := NewDirectory(workspace)
+
+	ana, err := d.Touch("telegram", "123|ana", "123", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ana.Name != "ana" {
+		t.Errorf("name = %q, want username fallback", ana.Name)
+	}
+	if again, _ := d.Touch("telegram", "123|ana_renamed", "123", "Ana"); again.ID != ana.ID {
+		t.Error("same account resolved to a new user")
+	}
+	slack, _ := d.Touch("slack", "U42", "D42", "Ana P.")
+	if slack.ID == ana.ID {
+		t.Fatal("unlinked accounts share a user")
+	}
+
+	code := d.NewLinkCode(ana.ID)
+	if _, err := d.Link("000000x", "slack", "U42"); err == nil {
+		t.Error("bogus code accepted")
+	}
+	linked, err := d.Link(code, "slack", "U42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked.ID != ana.ID || strings.Join(linked.Channels(), ",") != "telegram,slack" {
+		t.Errorf("linked = %+v", linked)
+	}
+	if linked.LastChannel != "slack" || linked.LastChatID != "D42" {
+		t.Errorf("last active = %s:%s, want the more recent slack chat", linked.LastChannel, linked.LastChatID)
+	}
+	if _, err := d.Link(code, "slack", "U42"); err == nil {
+		t.Error("code reused")
+	}
+
+	// Group activity doesn't change where a person is reached
+	d.Touch("telegram", "123|ana", "", "")
+
+	reloaded := NewDirectory(workspace)
+	u, ok := reloaded.Lookup("slack", "U42")
+	if !ok || u.ID != ana.ID || len(reloaded.List()) != 1 {
+		t.Fatalf("after reload: %+v (users %d)", u, len(reloaded.List()))
+	}
+	if found, ok := reloaded.Find("ANA"); !ok || found.LastChatID != "D42" {
+		t.Errorf("Find = %+v, %v", found, ok)
+	}
+	if err := reloaded.SetName(ana.ID, "Ana Pérez"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.Find("ana pérez"); !ok {
+		t.Error("renamed user not found")
+	}
+}
+
+func TestVoiceSettings(t *testing.T) {
+	workspace := t.TempDir()
+	d := NewDirectory(workspace)
+	ana, _ := d.Touch("telegram", "123|ana", "123", "")
+	d.Touch("telegram", "456|bo", "", "")
+
+	if err := d.SetVoice(ana.ID, VoiceSettings{Language: "en-GB", Replies: VoiceRepliesAlways}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetVoice("nobody", VoiceSettings{}); err == nil {
+		t.Error("unknown user accepted")
+	}
+
+	reloaded := NewDirectory(workspace)
+	u, ok := reloaded.ForChat("telegram", "123")
+	if !ok || u.ID != ana.ID || u.Voice.Language != "en-GB" || u.Voice.Replies != VoiceRepliesAlways {
+		t.Errorf("ForChat = %+v, %v", u, ok)
+	}
+	if _, ok := reloaded.ForChat("telegram", "456"); ok {
+		t.Error("user only seen in a group found by chat")
+	}
+}
+
+func TestLinkGuessing(t *testing.T) {
+	d := NewDirectory(t.TempDir())
+	owner, _ := d.Touch("telegram", "1|boss", "1", "")
+	code := d.NewLinkCode(owner.ID)
+	if len(code) < 8 {
+		t.Errorf("code %q is too short to be unguessable", code)
+	}
+
+	// A sender trying codes is locked out, even once they have the right one
+	for i := 0; i < maxLinkFailures; i++ {
+		d.Link(fmt.Sprintf("WRONG%03d", i), "discord", "7")
+	}
+	if _, err := d.Link(code, "discord", "7"); err == nil {
+		t.Fatal("locked out sender linked")
+	}
+
+	// The code itself dies after enough wrong guesses from anyone
+	for i := 0; i < maxCodeMisses; i++ {
+		d.Link(fmt.Sprintf("WRONG%03d", i), "discord", fmt.Sprintf("%d", 100+i))
+	}
+	if _, err := d.Link(code, "slack", "U42"); err == nil {
+		t.Error("code survived repeated guessing")
+	}
+
+	// Codes are case-insensitive
+	code = d.NewLinkCode(owner.ID)
+	if _, err := d.Link(strings.ToLower(code), "slack", "U42"); err != nil {
+		t.Errorf("lowercase code rejected: %v", err)
+	}
+}
+
+func TestBatchedSaves(t *testing.T) {
+	workspace := t.TempDir()
+	d := NewDirectory(workspace)
+
+	ana, _ := d.Touch("telegram", "123|ana", "123", "")
+	if _, ok := NewDirectory(workspace).Lookup("telegram", "123"); !ok {
+		t.Fatal("new user not saved right away")
+	}
+
+	// Repeat visits and token counts wait for the next flush
+	for i := 0; i < 10; i++ {
+		d.Touch("telegram", "123|ana", "123", "")
+		d.AddTokens(ana.ID, 100)
+	}
+	if got := NewDirectory(workspace).TokensToday(ana.ID); got != 0 {
+		t.Errorf("tokens on disk before flush = %d, want 0", got)
+	}
+	if err := d.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := NewDirectory(workspace).TokensToday(ana.ID); got != 1000 {
+		t.Errorf("tokens on disk after flush = %d, want 1000", got)
+	}
+
+	// A new place to reach someone is saved right away
+	d.Touch("telegram", "123|ana", "456", "")
+	if u, _ := NewDirectory(workspace).Lookup("telegram", "123"); u.LastChatID != "456" {
+		t.Errorf("last chat on disk = %q, want 456", u.LastChatID)
+	}
+}
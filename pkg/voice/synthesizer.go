@@ -0,0 +1,376 @@
+package voice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// SpeechOptions are a listener's preferences. Empty fields fall back to the
+// engine's configured defaults.
+type SpeechOptions struct {
+	Voice    string // engine-specific voice name
+	Language string // e.g. "en-US"; picks a voice when Voice is empty
+}
+
+// Synthesizer turns text into speech. Synthesize writes an audio file in
+// the engine's own format and returns its path; the caller removes it.
+type Synthesizer interface {
+	Synthesize(ctx context.Context, text string, opts SpeechOptions) (string, error)
+}
+
+// NewSynthesizer builds the engine named in cfg. It returns nil without an
+// error when no engine is configured.
+func NewSynthesizer(cfg config.TTSConfig) (Synthesizer, error) {
+	switch strings.ToLower(cfg.Engine) {
+	case "", "off", "none":
+		return nil, nil
+	case "edge-tts", "edge":
+		return &EdgeTTS{Voice: cfg.Voice, Language: cfg.Language}, nil
+	case "piper":
+		if cfg.Piper.Model == "" {
+			return nil, fmt.Errorf("piper needs a model")
+		}
+		return &Piper{Binary: cfg.Piper.Binary, Model: cfg.Piper.Model, Voice: cfg.Voice, Language: cfg.Language}, nil
+	case "openai":
+		return NewOpenAISpeech(cfg.OpenAI.APIKey, cfg.OpenAI.APIBase, cfg.OpenAI.Model, cfg.Voice), nil
+	default:
+		return nil, fmt.Errorf("unknown tts engine %q", cfg.Engine)
+	}
+}
+
+// EdgeTTS speaks through the edge-tts CLI (pip install edge-tts), which uses
+// Microsoft Edge's online voices.
+type EdgeTTS struct {
+	Voice    string // e.g. "es-AR-TomasNeural"
+	Language string
+}
+
+// defaultEdgeVoice is the voice replies were always spoken with before
+// engines were configurable.
+const defaultEdgeVoice = "es-AR-TomasNeural"
+
+// edgeVoices maps languages to an Edge voice, for listeners who only set
+// their language. Bare languages match any region.
+var edgeVoices = map[string]string{
+	"en":    "en-US-AriaNeural",
+	"en-us": "en-US-AriaNeural",
+	"en-gb": "en-GB-SoniaNeural",
+	"es":    "es-ES-AlvaroNeural",
+	"es-es": "es-ES-AlvaroNeural",
+	"es-ar": "es-AR-TomasNeural",
+	"es-mx": "es-MX-JorgeNeural",
+	"pt":    "pt-BR-FranciscaNeural",
+	"pt-br": "pt-BR-FranciscaNeural",
+	"pt-pt": "pt-PT-RaquelNeural",
+	"fr":    "fr-FR-DeniseNeural",
+	"de":    "de-DE-KatjaNeural",
+	"it":    "it-IT-ElsaNeural",
+	"nl":    "nl-NL-ColetteNeural",
+	"ja":    "ja-JP-NanamiNeural",
+	"ko":    "ko-KR-SunHiNeural",
+	"zh":    "zh-CN-XiaoxiaoNeural",
+	"zh-cn": "zh-CN-XiaoxiaoNeural",
+	"zh-tw": "zh-TW-HsiaoChenNeural",
+	"ru":    "ru-RU-SvetlanaNeural",
+	"hi":    "hi-IN-SwaraNeural",
+	"ar":    "ar-SA-ZariyahNeural",
+}
+
+func (e *EdgeTTS) voice(opts SpeechOptions) string {
+	if opts.Voice != "" {
+		return opts.Voice
+	}
+	if v := languageMatch(edgeVoices, opts.Language); v != "" {
+		return v
+	}
+	if e.Voice != "" {
+		return e.Voice
+	}
+	if v := languageMatch(edgeVoices, e.Language); v != "" {
+		return v
+	}
+	return defaultEdgeVoice
+}
+
+// Synthesize writes an MP3.
+func (e *EdgeTTS) Synthesize(ctx context.Context, text string, opts SpeechOptions) (string, error) {
+	out, err := tempAudioPath(".mp3")
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.CommandContext(ctx, "edge-tts", "--voice", e.voice(opts), "--text", text, "--write-media", out)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(out)
+		return "", fmt.Errorf("edge-tts failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return out, nil
+}
+
+// Piper speaks with a local Piper model, so no text leaves the machine.
+type Piper struct {
+	Binary   string // "piper" on PATH when empty
+	Model    string // .onnx file, or a directory of them
+	Voice    string // model name within Model when it is a directory
+	Language string
+}
+
+// model picks the .onnx file to use. Within a directory a voice is chosen
+// by file name ("en_US-lessac-medium"), a language by the name's prefix.
+func (p *Piper) model(opts SpeechOptions) (string, error) {
+	info, err := os.Stat(p.Model)
+	if err != nil {
+		return "", fmt.Errorf("piper model: %w", err)
+	}
+	if !info.IsDir() {
+		return p.Model, nil
+	}
+
+	models, _ := filepath.Glob(filepath.Join(p.Model, "*.onnx"))
+	if len(models) == 0 {
+		return "", fmt.Errorf("no piper models in %s", p.Model)
+	}
+	sort.Strings(models)
+	byName := func(voice string) string {
+		for _, m := range models {
+			if strings.TrimSuffix(filepath.Base(m), ".onnx") == voice {
+				return m
+			}
+		}
+		return ""
+	}
+	byLanguage := func(language string) string {
+		// Piper names models after locales such as "en_US"
+		language = strings.ReplaceAll(language, "-", "_")
+		if language == "" {
+			return ""
+		}
+		for _, prefix := range []string{language + "-", strings.SplitN(language, "_", 2)[0] + "_"} {
+			for _, m := range models {
+				if strings.HasPrefix(strings.ToLower(filepath.Base(m)), strings.ToLower(prefix)) {
+					return m
+				}
+			}
+		}
+		return ""
+	}
+
+	for _, m := range []string{byName(opts.Voice), byLanguage(opts.Language), byName(p.Voice), byLanguage(p.Language)} {
+		if m != "" {
+			return m, nil
+		}
+	}
+	return models[0], nil
+}
+
+// Synthesize writes a WAV.
+func (p *Piper) Synthesize(ctx context.Context, text string, opts SpeechOptions) (string, error) {
+	model, err := p.model(opts)
+	if err != nil {
+		return "", err
+	}
+	binary := p.Binary
+	if binary == "" {
+		binary = "piper"
+	}
+	out, err := tempAudioPath(".wav")
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.CommandContext(ctx, binary, "--model", model, "--output_file", out)
+	cmd.Stdin = strings.NewReader(text)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(out)
+		return "", fmt.Errorf("piper failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return out, nil
+}
+
+// OpenAISpeech calls an OpenAI-compatible /audio/speech endpoint, which
+// many local servers also offer.
+type OpenAISpeech struct {
+	apiKey     string
+	apiBase    string
+	model      string
+	voice      string
+	httpClient *http.Client
+}
+
+func NewOpenAISpeech(apiKey, apiBase, model, voice string) *OpenAISpeech {
+	if apiBase == "" {
+		apiBase = "https://api.openai.com/v1"
+	}
+	if model == "" {
+		model = "tts-1"
+	}
+	if voice == "" {
+		voice = "alloy"
+	}
+	return &OpenAISpeech{
+		apiKey:  apiKey,
+		apiBase: strings.TrimRight(apiBase, "/"),
+		model:   model,
+		voice:   voice,
+		httpClient: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+	}
+}
+
+// Synthesize writes an Ogg/Opus file. The model works out the language
+// from the text, so only the voice is passed on.
+func (o *OpenAISpeech) Synthesize(ctx context.Context, text string, opts SpeechOptions) (string, error) {
+	voice := opts.Voice
+	if voice == "" {
+		voice = o.voice
+	}
+	body, err := json.Marshal(map[string]string{
+		"model":           o.model,
+		"input":           text,
+		"voice":           voice,
+		"response_format": "opus",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.apiBase+"/audio/speech", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("speech API error (status %d): %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	out, err := tempAudioPath(".ogg")
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, resp.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(out)
+		return "", fmt.Errorf("failed to save speech: %w", err)
+	}
+	logger.DebugCF("voice", "Speech synthesized", map[string]interface{}{
+		"voice": voice,
+		"chars": len(text),
+	})
+	return out, nil
+}
+
+// ToVoiceNote converts the audio at path to Ogg/Opus, the format chat apps
+// play as a voice note, and removes the original either way. Ogg files are
+// returned as they are.
+func ToVoiceNote(ctx context.Context, path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ogg", ".oga", ".opus":
+		return path, nil
+	}
+	out, err := Convert(ctx, path, ".ogg")
+	os.Remove(path)
+	if err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// Convert re-encodes an audio file with ffmpeg into a new temp file of the
+// format ext names: ".ogg" gives Opus, ".m4a" AAC and ".mp3" MP3. The
+// source is left in place.
+func Convert(ctx context.Context, path, ext string) (string, error) {
+	var codec []string
+	switch ext {
+	case ".ogg":
+		codec = []string{"-c:a", "libopus", "-b:a", "64k"}
+	case ".m4a":
+		codec = []string{"-c:a", "aac", "-b:a", "96k"}
+	case ".mp3":
+		codec = []string{"-c:a", "libmp3lame", "-b:a", "96k"}
+	default:
+		return "", fmt.Errorf("unsupported audio format %q", ext)
+	}
+	out, err := tempAudioPath(ext)
+	if err != nil {
+		return "", err
+	}
+	args := append([]string{"-y", "-i", path, "-vn"}, codec...)
+	cmd := exec.CommandContext(ctx, "ffmpeg", append(args, out)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(out)
+		return "", fmt.Errorf("ffmpeg failed: %w: %s", err, lastLine(string(output)))
+	}
+	return out, nil
+}
+
+// Duration asks ffprobe how long an audio file plays.
+func Duration(ctx context.Context, path string) (time.Duration, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "csv=p=0", path)
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected ffprobe output %q", strings.TrimSpace(string(output)))
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// languageMatch looks a language up in a table keyed by lowercase tags,
+// falling back from "en-AU" to "en".
+func languageMatch(table map[string]string, language string) string {
+	language = strings.ToLower(strings.ReplaceAll(language, "_", "-"))
+	if language == "" {
+		return ""
+	}
+	if v, ok := table[language]; ok {
+		return v
+	}
+	return table[strings.SplitN(language, "-", 2)[0]]
+}
+
+func tempAudioPath(ext string) (string, error) {
+	f, err := os.CreateTemp("", "picoclaw_tts_*"+ext)
+	if err != nil {
+		return "", fmt.Errorf("failed to create audio file: %w", err)
+	}
+	f.Close()
+	return f.Name(), nil
+}
+
+// lastLine keeps the useful end of a tool's noisy output.
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return lines[len(lines)-1]
+}
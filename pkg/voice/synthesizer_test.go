@@ -0,0 +1,137 @@
+package voice
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestNewSynthesizer(t *testing.T) {
+	if s, err := NewSynthesizer(config.TTSConfig{}); s != nil || err != nil {
+		t.Errorf("no engine = %v, %v; want nil, nil", s, err)
+	}
+	if _, err := NewSynthesizer(config.TTSConfig{Engine: "piper"}); err == nil {
+		t.Error("piper without a model accepted")
+	}
+	if _, err := NewSynthesizer(config.TTSConfig{Engine: "espeak"}); err == nil {
+		t.Error("unknown engine accepted")
+	}
+	s, err := NewSynthesizer(config.TTSConfig{Engine: "openai"})
+	if o, ok := s.(*OpenAISpeech); err != nil || !ok || o.voice != "alloy" || o.model != "tts-1" {
+		t.Errorf("openai = %#v, %v", s, err)
+	}
+}
+
+func TestEdgeTTSVoice(t *testing.T) {
+	tests := []struct {
+		engine EdgeTTS
+		opts   SpeechOptions
+		want   string
+	}{
+		{EdgeTTS{}, SpeechOptions{}, "es-AR-TomasNeural"},
+		{EdgeTTS{Voice: "en-GB-RyanNeural"}, SpeechOptions{}, "en-GB-RyanNeural"},
+		{EdgeTTS{Language: "fr"}, SpeechOptions{}, "fr-FR-DeniseNeural"},
+		{EdgeTTS{Voice: "en-GB-RyanNeural"}, SpeechOptions{Language: "pt_BR"}, "pt-BR-FranciscaNeural"},
+		{EdgeTTS{}, SpeechOptions{Language: "en-AU"}, "en-US-AriaNeural"},
+		{EdgeTTS{}, SpeechOptions{Voice: "ja-JP-KeitaNeural", Language: "en"}, "ja-JP-KeitaNeural"},
+		{EdgeTTS{Voice: "en-GB-RyanNeural"}, SpeechOptions{Language: "xx"}, "en-GB-RyanNeural"},
+	}
+	for _, tt := range tests {
+		if got := tt.engine.voice(tt.opts); got != tt.want {
+			t.Errorf("%+v with %+v = %q, want %q", tt.engine, tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestPiperModel(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"de_DE-thorsten-medium.onnx", "en_GB-alba-medium.onnx", "en_US-lessac-medium.onnx"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0o644)
+	}
+
+	tests := []struct {
+		engine Piper
+		opts   SpeechOptions
+		want   string
+	}{
+		{Piper{}, SpeechOptions{}, "de_DE-thorsten-medium.onnx"},
+		{Piper{Voice: "en_GB-alba-medium"}, SpeechOptions{}, "en_GB-alba-medium.onnx"},
+		{Piper{Voice: "en_GB-alba-medium"}, SpeechOptions{Language: "en-US"}, "en_US-lessac-medium.onnx"},
+		{Piper{}, SpeechOptions{Language: "de"}, "de_DE-thorsten-medium.onnx"},
+		{Piper{Language: "en"}, SpeechOptions{Voice: "en_US-lessac-medium"}, "en_US-lessac-medium.onnx"},
+	}
+	for _, tt := range tests {
+		tt.engine.Model = dir
+		got, err := tt.engine.model(tt.opts)
+		if err != nil || filepath.Base(got) != tt.want {
+			t.Errorf("%+v with %+v = %q, %v; want %q", tt.engine, tt.opts, got, err, tt.want)
+		}
+	}
+
+	single := Piper{Model: filepath.Join(dir, "en_US-lessac-medium.onnx")}
+	if got, _ := single.model(SpeechOptions{Language: "de"}); got != single.Model {
+		t.Errorf("single model = %q", got)
+	}
+	if _, err := (&Piper{Model: t.TempDir()}).model(SpeechOptions{}); err == nil {
+		t.Error("empty model directory accepted")
+	}
+}
+
+func TestOpenAISpeech(t *testing.T) {
+	var got map[string]string
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/speech" {
+			http.NotFound(w, r)
+			return
+		}
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte("OggS fake opus"))
+	}))
+	defer server.Close()
+
+	s := NewOpenAISpeech("sk-test", server.URL+"/v1/", "", "nova")
+	path, err := s.Synthesize(context.Background(), "Hello there", SpeechOptions{Voice: "echo", Language: "en"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	if filepath.Ext(path) != ".ogg" {
+		t.Errorf("path = %q, want an .ogg file", path)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "OggS fake opus" {
+		t.Errorf("audio = %q", data)
+	}
+	if auth != "Bearer sk-test" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	if got["input"] != "Hello there" || got["voice"] != "echo" || got["model"] != "tts-1" || got["response_format"] != "opus" {
+		t.Errorf("request = %v", got)
+	}
+
+	// Ogg needs no conversion to be a voice note
+	if note, err := ToVoiceNote(context.Background(), path); err != nil || note != path {
+		t.Errorf("ToVoiceNote = %q, %v", note, err)
+	}
+}
+
+func TestOpenAISpeechError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"invalid voice"}`, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	s := NewOpenAISpeech("", server.URL, "", "")
+	if path, err := s.Synthesize(context.Background(), "Hi", SpeechOptions{}); err == nil {
+		os.Remove(path)
+		t.Fatal("error status accepted")
+	}
+}